@@ -1,3 +1,5 @@
+// +build ignore
+
 package main
 
 import (
@@ -9,7 +11,7 @@ import (
 )
 
 const (
-	GOBFILE = "blocks.gob"
+	GOBFILE = "render/blocks.gob"
 )
 
 const (
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"os"
+	"github.com/imclab/GoCart/render"
+)
+
+func main() {
+	render.Main(os.Args[1:])
+}
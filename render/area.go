@@ -0,0 +1,117 @@
+package render
+
+import (
+	"fmt"
+)
+
+type Area struct {
+	X0, Z0, X1, Z1 int
+	Active bool
+	
+	// With Radius set, only blocks within Radius of Center are in the area.
+	Center BlockPoint
+	Radius int
+}
+
+// A BlockPoint is an x,z world position.
+type BlockPoint struct {
+	X, Z int
+}
+
+func (p *BlockPoint) String() string {
+	return fmt.Sprintf("%d,%d", p.X, p.Z)
+}
+
+func (p *BlockPoint) Set(s string) error {
+	if _, err := fmt.Sscanf(s, "%d,%d", &p.X, &p.Z); err != nil {
+		return fmt.Errorf("expected x,z: %s", err)
+	}
+	return nil
+}
+
+func (a *Area) String() string {
+	if !a.Active {
+		return ""
+	}
+	return fmt.Sprintf("%d,%d,%d,%d", a.X0, a.Z0, a.X1, a.Z1)
+}
+
+// Set takes x0,z0,x1,z1, a WorldEdit .schematic, in which case the area is
+// the region the schematic was copied from, or an .mcselection.
+func (a *Area) Set(s string) error {
+	if isSelection(s) {
+		selection, err := ReadSelection(s)
+		if err != nil {
+			return err
+		}
+		*a = selection.Area()
+		return nil
+	}
+	if isSchematic(s) {
+		schematic, err := ReadSchematic(s)
+		if err != nil {
+			return err
+		}
+		*a = schematic.Area()
+		return nil
+	}
+	
+	var x0, z0, x1, z1 int
+	if _, err := fmt.Sscanf(s, "%d,%d,%d,%d", &x0, &z0, &x1, &z1); err != nil {
+		return fmt.Errorf("expected x0,z0,x1,z1: %s", err)
+	}
+	
+	if x0 > x1 {
+		x0, x1 = x1, x0
+	}
+	if z0 > z1 {
+		z0, z1 = z1, z0
+	}
+	
+	*a = Area{X0: x0, Z0: z0, X1: x1, Z1: z1, Active: true}
+	return nil
+}
+
+// Limit narrows the area to blocks within radius of center, clipping the
+// rectangle to the circle's bounding square.
+func (a *Area) Limit(center BlockPoint, radius int) {
+	x0, z0, x1, z1 := center.X - radius, center.Z - radius, center.X + radius, center.Z + radius
+	if a.Active {
+		x0, z0, x1, z1 = Max(x0, a.X0), Max(z0, a.Z0), Min(x1, a.X1), Min(z1, a.Z1)
+	}
+	*a = Area{X0: x0, Z0: z0, X1: x1, Z1: z1, Active: true, Center: center, Radius: radius}
+}
+
+// within reports whether x, z is no further than Radius from Center.
+func (a Area) within(x, z int) bool {
+	dx, dz := int64(x - a.Center.X), int64(z - a.Center.Z)
+	return a.Radius <= 0 || dx * dx + dz * dz <= int64(a.Radius) * int64(a.Radius)
+}
+
+func (a Area) Contains(x, z int) bool {
+	return !a.Active || (x >= a.X0 && x <= a.X1 && z >= a.Z0 && z <= a.Z1 && a.within(x, z))
+}
+
+// Overlaps reports whether any block of the square of the given size (in
+// blocks) with its minimum corner at x, z lies within the area. Against a
+// radius, the block of the square nearest the center decides.
+func (a Area) Overlaps(x, z, size int) bool {
+	if !a.Active {
+		return true
+	}
+	if x + size <= a.X0 || x > a.X1 || z + size <= a.Z0 || z > a.Z1 {
+		return false
+	}
+	return a.within(Min(Max(a.Center.X, x), x + size - 1), Min(Max(a.Center.Z, z), z + size - 1))
+}
+
+func (a Area) ContainsRegion(r Region) bool {
+	return a.Overlaps(r.X << 9, r.Z << 9, 512)
+}
+
+func (a Area) ContainsChunk(x, z int) bool {
+	return a.Overlaps(x << 4, z << 4, 16)
+}
+
+// Bounds is the projected image rectangle covering every block in the area
+// from bedrock to the build limit.
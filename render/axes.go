@@ -0,0 +1,187 @@
+package render
+
+import (
+	"math"
+	"image"
+	"strconv"
+	"image/draw"
+)
+
+const (
+	TICKLENGTH = 4
+	RULEWIDTH = 2
+)
+
+// Axes selects the map furniture drawn around the edges of each image.
+// Ticks only apply to top-down images, whose edges run along the X and Z
+// axes; the scale bar and north arrow follow the projection of either mode.
+type Axes struct {
+	Ticks, ScaleBar, NorthArrow bool
+}
+
+// A stroke is a line segment in image pixels.
+type stroke struct {
+	x0, y0, x1, y1 float64
+}
+
+func round(f float64) int {
+	return int(math.Floor(f + 0.5))
+}
+
+// drawStrokes draws every halo before any line so that crossing strokes
+// don't cut into each other.
+func drawStrokes(img *image.RGBA, strokes []stroke, width int, style TextStyle) {
+	halo := Max(style.Halo, 0)
+	for pass := 0; pass < 2; pass++ {
+		if pass == 0 && halo == 0 {
+			continue
+		}
+		
+		src, grow := image.NewUniform(style.HaloColor), halo
+		if pass == 1 {
+			src, grow = image.NewUniform(style.Color), 0
+		}
+		
+		for _, s := range strokes {
+			steps := Max(round(math.Abs(s.x1 - s.x0)), round(math.Abs(s.y1 - s.y0)), 1)
+			for i := 0; i <= steps; i++ {
+				t := float64(i) / float64(steps)
+				x, y := round(s.x0 + (s.x1 - s.x0) * t), round(s.y0 + (s.y1 - s.y0) * t)
+				dot := image.Rect(x - width / 2, y - width / 2, x - width / 2 + width, y - width / 2 + width)
+				draw.Draw(img, dot.Inset(-grow), src, image.ZP, draw.Src)
+			}
+		}
+	}
+}
+
+// DrawAxes draws the furniture selected in opts.Axes onto img, which may be
+// any part of the frame being encoded.
+func DrawAxes(img *image.RGBA, mode Mode, frame image.Rectangle, opts *Options) {
+	style := opts.Labels
+	if opts.Axes.Ticks && TopDown(mode) {
+		frame = drawTicks(img, frame, style)
+	}
+	if opts.Axes.ScaleBar {
+		drawScaleBar(img, mode, frame, style)
+	}
+	if opts.Axes.NorthArrow {
+		drawNorthArrow(img, mode, frame, style)
+	}
+}
+
+// drawTicks labels each edge every power of two blocks, at least a chunk,
+// far enough apart that the widest label fits between ticks. Ticks too close
+// to a corner to label are left out. It returns the frame inside the labels.
+func drawTicks(img *image.RGBA, frame image.Rectangle, style TextStyle) image.Rectangle {
+	widest := 0
+	for _, v := range []int{frame.Min.X, frame.Max.X, frame.Min.Y, frame.Max.Y} {
+		widest = Max(widest, style.Width(strconv.Itoa(v)))
+	}
+	
+	step := 16
+	for step < widest + 2 * style.Height() {
+		step <<= 1
+	}
+	
+	gap := TICKLENGTH + Max(style.Halo, 0) + 1
+	inner := image.Rect(frame.Min.X + gap + widest, frame.Min.Y + gap + style.Height(), frame.Max.X - gap - widest, frame.Max.Y - gap - style.Height())
+	
+	var strokes []stroke
+	for x := (frame.Min.X + step - 1) &^ (step - 1); x < frame.Max.X; x += step {
+		label := strconv.Itoa(x)
+		left := x - style.Width(label) / 2
+		if left < inner.Min.X || left + style.Width(label) > inner.Max.X {
+			continue
+		}
+		fx := float64(x)
+		strokes = append(strokes, stroke{fx, float64(frame.Min.Y), fx, float64(frame.Min.Y + TICKLENGTH)})
+		strokes = append(strokes, stroke{fx, float64(frame.Max.Y - 1), fx, float64(frame.Max.Y - 1 - TICKLENGTH)})
+		DrawText(img, image.Pt(left, frame.Min.Y + gap), label, style)
+		DrawText(img, image.Pt(left, frame.Max.Y - gap - style.Height()), label, style)
+	}
+	
+	for z := (frame.Min.Y + step - 1) &^ (step - 1); z < frame.Max.Y; z += step {
+		label := strconv.Itoa(z)
+		top := z - style.Height() / 2
+		if top < inner.Min.Y || top + style.Height() > inner.Max.Y {
+			continue
+		}
+		fz := float64(z)
+		strokes = append(strokes, stroke{float64(frame.Min.X), fz, float64(frame.Min.X + TICKLENGTH), fz})
+		strokes = append(strokes, stroke{float64(frame.Max.X - 1), fz, float64(frame.Max.X - 1 - TICKLENGTH), fz})
+		DrawText(img, image.Pt(frame.Min.X + gap, top), label, style)
+		DrawText(img, image.Pt(frame.Max.X - gap - style.Width(label), top), label, style)
+	}
+	
+	drawStrokes(img, strokes, 1, style)
+	return inner
+}
+
+// drawScaleBar draws a bar in the bottom left corner along the world's X
+// axis, a round number of blocks long and at most a quarter of the frame
+// wide.
+func drawScaleBar(img *image.RGBA, mode Mode, frame image.Rectangle, style TextStyle) {
+	x0, y0 := mode.Project(0, 0, 0)
+	limit := x0 + frame.Dx() / 4
+	length := 0
+scan:
+	for n := 1; ; n *= 10 {
+		for _, m := range []int{1, 2, 5} {
+			if x, _ := mode.Project(m * n, 0, 0); x > limit {
+				break scan
+			}
+			length = m * n
+		}
+	}
+	if length == 0 {
+		return
+	}
+	
+	x1, y1 := mode.Project(length, 0, 0)
+	dx, dy := float64(x1 - x0), float64(y1 - y0)
+	margin := style.Height() + Max(style.Halo, 0)
+	ox, oy := float64(frame.Min.X + margin), float64(frame.Max.Y - margin - RULEWIDTH)
+	
+	drawStrokes(img, []stroke{
+		{ox, oy, ox + dx, oy + dy},
+		{ox, oy - 3, ox, oy + 3},
+		{ox + dx, oy + dy - 3, ox + dx, oy + dy + 3},
+	}, RULEWIDTH, style)
+	
+	label := strconv.Itoa(length) + " blocks"
+	left := Max(round(ox + dx / 2) - style.Width(label) / 2, frame.Min.X + margin / 2)
+	DrawText(img, image.Pt(left, round(oy + dy / 2) - style.Height() - 3 - margin / 2), label, style)
+}
+
+// drawNorthArrow points toward negative Z in the top right corner.
+func drawNorthArrow(img *image.RGBA, mode Mode, frame image.Rectangle, style TextStyle) {
+	x0, y0 := mode.Project(0, 0, 0)
+	x1, y1 := mode.Project(0, 0, -1)
+	dx, dy := float64(x1 - x0), float64(y1 - y0)
+	norm := math.Hypot(dx, dy)
+	dx, dy = dx / norm, dy / norm
+	
+	size := float64(3 * style.Height())
+	margin := float64(style.Height() + Max(style.Halo, 0))
+	cx, cy := float64(frame.Max.X) - margin - size, float64(frame.Min.Y) + margin + size
+	tx, ty := cx + dx * size / 2, cy + dy * size / 2
+	
+	// The head's barbs are the shaft turned 150 degrees either way.
+	sin, cos := math.Sincos(5 * math.Pi / 6)
+	barb := size / 3
+	drawStrokes(img, []stroke{
+		{cx - dx * size / 2, cy - dy * size / 2, tx, ty},
+		{tx, ty, tx + (dx * cos - dy * sin) * barb, ty + (dx * sin + dy * cos) * barb},
+		{tx, ty, tx + (dx * cos + dy * sin) * barb, ty + (-dx * sin + dy * cos) * barb},
+	}, RULEWIDTH, style)
+	
+	lx, ly := tx + dx * (margin + barb / 2), ty + dy * (margin + barb / 2)
+	DrawText(img, image.Pt(round(lx) - style.Width("N") / 2, round(ly) - style.Height() / 2), "N", style)
+}
+
+// AxesOverlay draws the furniture selected in opts.Axes.
+type AxesOverlay struct{}
+
+func (AxesOverlay) DrawOver(img *image.RGBA, mode Mode, frame image.Rectangle, opts *Options) {
+	DrawAxes(img, mode, frame, opts)
+}
@@ -0,0 +1,161 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"strconv"
+	"strings"
+	"image/color"
+	"encoding/json"
+)
+
+// BIOMEUNSET marks columns whose biome hasn't been generated yet.
+const BIOMEUNSET = 0xFF
+
+var biomeNames = map[byte]string{
+	0: "Ocean",
+	1: "Plains",
+	2: "Desert",
+	3: "ExtremeHills",
+	4: "Forest",
+	5: "Taiga",
+	6: "Swampland",
+	7: "River",
+	8: "Hell",
+	9: "Sky",
+	10: "FrozenOcean",
+	11: "FrozenRiver",
+	12: "IcePlains",
+	13: "IceMountains",
+	14: "MushroomIsland",
+	15: "MushroomIslandShore",
+	16: "Beach",
+	17: "DesertHills",
+	18: "ForestHills",
+	19: "TaigaHills",
+	20: "ExtremeHillsEdge",
+	21: "Jungle",
+	22: "JungleHills",
+	23: "JungleEdge",
+	24: "DeepOcean",
+	25: "StoneBeach",
+	26: "ColdBeach",
+	27: "BirchForest",
+	28: "BirchForestHills",
+	29: "RoofedForest",
+	30: "ColdTaiga",
+	31: "ColdTaigaHills",
+	32: "MegaTaiga",
+	33: "MegaTaigaHills",
+	34: "ExtremeHillsPlus",
+	35: "Savanna",
+	36: "SavannaPlateau",
+	37: "Mesa",
+	38: "MesaPlateauF",
+	39: "MesaPlateau",
+}
+
+// BiomeName names a biome, including the mutated variants 128 above their
+// base biome.
+func BiomeName(id byte) string {
+	if name, exists := biomeNames[id]; exists {
+		return name
+	}
+	if name, exists := biomeNames[id - 128]; id >= 128 && exists {
+		return name + "M"
+	}
+	return fmt.Sprintf("Unknown(%d)", id)
+}
+
+// Colors of biomes in biomes mode, which -biome-palette overrides.
+var biomeColors = map[byte]color.RGBA{
+	0: {0x00, 0x00, 0x70, 0xFF},
+	1: {0x8D, 0xB3, 0x60, 0xFF},
+	2: {0xFA, 0x94, 0x18, 0xFF},
+	3: {0x60, 0x60, 0x60, 0xFF},
+	4: {0x05, 0x66, 0x21, 0xFF},
+	5: {0x0B, 0x66, 0x59, 0xFF},
+	6: {0x07, 0xF9, 0xB2, 0xFF},
+	7: {0x00, 0x00, 0xFF, 0xFF},
+	8: {0xFF, 0x00, 0x00, 0xFF},
+	9: {0x80, 0x80, 0xFF, 0xFF},
+	10: {0x90, 0x90, 0xA0, 0xFF},
+	11: {0xA0, 0xA0, 0xFF, 0xFF},
+	12: {0xFF, 0xFF, 0xFF, 0xFF},
+	13: {0xA0, 0xA0, 0xA0, 0xFF},
+	14: {0xFF, 0x00, 0xFF, 0xFF},
+	15: {0xA0, 0x00, 0xFF, 0xFF},
+	16: {0xFA, 0xDE, 0x55, 0xFF},
+	17: {0xD2, 0x5F, 0x12, 0xFF},
+	18: {0x22, 0x55, 0x1C, 0xFF},
+	19: {0x16, 0x39, 0x33, 0xFF},
+	20: {0x72, 0x78, 0x9A, 0xFF},
+	21: {0x53, 0x7B, 0x09, 0xFF},
+	22: {0x2C, 0x42, 0x05, 0xFF},
+	23: {0x62, 0x8B, 0x17, 0xFF},
+	24: {0x00, 0x00, 0x30, 0xFF},
+	25: {0xA2, 0xA2, 0x84, 0xFF},
+	26: {0xFA, 0xF0, 0xC0, 0xFF},
+	27: {0x30, 0x74, 0x44, 0xFF},
+	28: {0x1F, 0x5F, 0x32, 0xFF},
+	29: {0x40, 0x51, 0x1A, 0xFF},
+	30: {0x31, 0x55, 0x4A, 0xFF},
+	31: {0x24, 0x3F, 0x36, 0xFF},
+	32: {0x59, 0x66, 0x51, 0xFF},
+	33: {0x45, 0x4F, 0x3E, 0xFF},
+	34: {0x50, 0x70, 0x50, 0xFF},
+	35: {0xBD, 0xB2, 0x5F, 0xFF},
+	36: {0xA7, 0x9D, 0x64, 0xFF},
+	37: {0xD9, 0x45, 0x15, 0xFF},
+	38: {0xB0, 0x97, 0x65, 0xFF},
+	39: {0xCA, 0x8C, 0x65, 0xFF},
+}
+
+// BiomeColor returns the color of a biome, with mutated variants lightened
+// from their base biome unless they have their own.
+func BiomeColor(id byte) (color.RGBA, bool) {
+	if c, exists := biomeColors[id]; exists {
+		return c, true
+	}
+	if c, exists := biomeColors[id - 128]; id >= 128 && exists {
+		return lighten(c), true
+	}
+	return color.RGBA{}, false
+}
+
+// ParseBiome reads a biome ID or name as BiomeName gives it, in any case.
+func ParseBiome(s string) (byte, error) {
+	if id, err := strconv.ParseUint(s, 0, 8); err == nil {
+		return byte(id), nil
+	}
+	for id := 0; id < 256; id++ {
+		if strings.EqualFold(s, BiomeName(byte(id))) {
+			return byte(id), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown biome %q", s)
+}
+
+// LoadBiomePalette applies a JSON object of biome ID or name to #rrggbb.
+func LoadBiomePalette(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	
+	var entries map[string]string
+	if err := json.NewDecoder(f).Decode(&entries); err != nil {
+		return err
+	}
+	for key, hex := range entries {
+		id, err := ParseBiome(key)
+		if err != nil {
+			return err
+		}
+		if biomeColors[id], err = ParseHex(hex); err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+	}
+	return nil
+}
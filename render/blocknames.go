@@ -0,0 +1,137 @@
+package render
+
+import "fmt"
+
+var blockNames = map[byte]string{
+	0x00: "Air",
+	0x01: "Stone",
+	0x02: "Grass",
+	0x03: "Dirt",
+	0x04: "Cobblestone",
+	0x05: "Wood",
+	0x06: "Sapling",
+	0x07: "Bedrock",
+	0x08: "Water",
+	0x09: "StationaryWater",
+	0x0A: "Lava",
+	0x0B: "StationaryLava",
+	0x0C: "Sand",
+	0x0D: "Gravel",
+	0x0E: "GoldOre",
+	0x0F: "IronOre",
+	0x10: "CoalOre",
+	0x11: "Log",
+	0x12: "Leaves",
+	0x13: "Sponge",
+	0x14: "Glass",
+	0x15: "LapisLazuliOre",
+	0x16: "LapisLazuliBlock",
+	0x17: "Dispenser",
+	0x18: "Sandstone",
+	0x19: "NoteBlock",
+	0x1A: "Bed",
+	0x1B: "PoweredRail",
+	0x1C: "DetectorRail",
+	0x1D: "StickyPistonBase",
+	0x1F: "TallGrass",
+	0x20: "DeadShrub",
+	0x21: "PistonBase",
+	0x22: "PistonPlatform",
+	0x23: "Wool",
+	0x25: "YellowFlower",
+	0x26: "RedRose",
+	0x27: "BrownMushroom",
+	0x28: "RedMushroom",
+	0x29: "GoldBlock",
+	0x2A: "IronBlock",
+	0x2B: "DoubleStep",
+	0x2C: "Step",
+	0x2D: "Brick",
+	0x2E: "TNT",
+	0x2F: "Bookcase",
+	0x30: "MossyCobblestone",
+	0x31: "Obsidian",
+	0x32: "Torch",
+	0x33: "Fire",
+	0x34: "MobSpawner",
+	0x35: "WoodenStairs",
+	0x36: "Chest",
+	0x37: "RedstoneWire",
+	0x38: "DiamondOre",
+	0x39: "DiamondBlock",
+	0x3A: "Workbench",
+	0x3B: "Crops",
+	0x3C: "Soil",
+	0x3D: "Furnace",
+	0x3E: "BurningFurnace",
+	0x3F: "SignPost",
+	0x40: "WoodenDoor",
+	0x41: "Ladder",
+	0x42: "MinecartTracks",
+	0x43: "CobblestoneStairs",
+	0x44: "WallSign",
+	0x45: "Lever",
+	0x46: "StonePressurePlate",
+	0x47: "IronDoor",
+	0x48: "WoodenPressurePlate",
+	0x49: "RedstoneOre",
+	0x4A: "GlowingRedstoneOre",
+	0x4B: "RedstoneTorchOff",
+	0x4C: "RedstoneTorchOn",
+	0x4D: "StoneButton",
+	0x4E: "Snow",
+	0x4F: "Ice",
+	0x50: "SnowBlock",
+	0x51: "Cactus",
+	0x52: "Clay",
+	0x53: "Reed",
+	0x54: "Jukebox",
+	0x55: "Fence",
+	0x56: "Pumpkin",
+	0x57: "Bloodstone",
+	0x58: "Slowsand",
+	0x59: "Lightstone",
+	0x5A: "Portal",
+	0x5B: "Jackolantern",
+	0x5C: "Cake",
+	0x5D: "RedstoneRepeaterOn",
+	0x5E: "RedstoneRepeaterOff",
+	0x60: "Trapdoor",
+	0x61: "EggBlock",
+	0x62: "StoneBrick",
+	0x63: "HugeBrownMushroom",
+	0x64: "HugeRedMushroom",
+	0x65: "IronBars",
+	0x66: "GlassPane",
+	0x67: "Melon",
+	0x68: "PumpkinStem",
+	0x69: "MelonStem",
+	0x6A: "Vines",
+	0x6B: "FenceGate",
+	0x6C: "BrickStairs",
+	0x6D: "StoneBrickStairs",
+	0x6E: "Mycelium",
+	0x6F: "LilyPad",
+	0x70: "NetherBrick",
+	0x71: "NetherBrickFence",
+	0x72: "NetherBrickStairs",
+	0x73: "NetherWart",
+	0x74: "EnchantmentTable",
+	0x75: "BrewingStand",
+	0x76: "Cauldron",
+	0x77: "EndPortal",
+	0x78: "EndPortalFrame",
+	0x79: "EndStone",
+	0x7A: "DragonEgg",
+	0x81: "EmeraldOre",
+	0x99: "NetherQuartzOre",
+	0xEC: "PineLeaves",
+	0xED: "BirchLeaves",
+}
+
+func BlockName(id byte) string {
+	if name, exists := blockNames[id]; exists {
+		return name
+	}
+	return fmt.Sprintf("Unknown(0x%02X)", id)
+}
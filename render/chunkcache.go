@@ -0,0 +1,122 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"sync"
+	"io/ioutil"
+	"crypto/sha1"
+	"encoding/gob"
+	"path/filepath"
+	"compress/flate"
+)
+
+// CHUNKCACHEVERSION is bumped whenever Level changes, leaving older caches
+// to be rebuilt.
+const CHUNKCACHEVERSION = 2
+
+// A ChunkCache keeps decoded chunks on disk, one file per region, so renders
+// of chunks that haven't been saved since skip decompressing and parsing
+// them. Chunks are matched by region path and the timestamp in the region
+// header, which Minecraft updates whenever it writes a chunk.
+type ChunkCache struct {
+	Dir string
+	
+	// Each region's cached chunks by index in the region file, from when it
+	// was read until it's assembled, along with how many were used.
+	mu sync.Mutex
+	regions map[int]*regionChunks
+}
+
+type regionChunks struct {
+	chunks map[int]Level
+	hits int
+}
+
+type chunkFile struct {
+	Version int
+	Chunks map[int]Level
+}
+
+func (c *ChunkCache) filename(region Region) string {
+	path, err := filepath.Abs(region.Path)
+	if err != nil {
+		path = region.Path
+	}
+	return filepath.Join(c.Dir, fmt.Sprintf("%x", sha1.Sum([]byte(path)))[:12] + "-" + filepath.Base(region.Path) + ".chunks")
+}
+
+// Load reads the chunks cached for a region, empty if there are none yet.
+func (c *ChunkCache) Load(index int, region Region) map[int]Level {
+	cached := chunkFile{Chunks: make(map[int]Level)}
+	if f, err := os.Open(c.filename(region)); err == nil {
+		fr := flate.NewReader(f)
+		if gob.NewDecoder(fr).Decode(&cached) != nil || cached.Version != CHUNKCACHEVERSION {
+			cached.Chunks = make(map[int]Level)
+		}
+		fr.Close()
+		f.Close()
+	}
+	
+	c.mu.Lock()
+	if c.regions == nil {
+		c.regions = make(map[int]*regionChunks)
+	}
+	c.regions[index] = &regionChunks{chunks: cached.Chunks}
+	c.mu.Unlock()
+	return cached.Chunks
+}
+
+// Hit counts a chunk of the region as taken from the cache.
+func (c *ChunkCache) Hit(index int) {
+	c.mu.Lock()
+	c.regions[index].hits++
+	c.mu.Unlock()
+}
+
+// Store passes on each region's job, first saving its chunks if any had to
+// be decoded, failing the render if they can't be.
+func (c *ChunkCache) Store(regions PositionList, in <-chan Job, out chan<- Job, failure *Failure) {
+	for job := range in {
+		c.mu.Lock()
+		rc := c.regions[job.Index]
+		delete(c.regions, job.Index)
+		c.mu.Unlock()
+		
+		if rc != nil && rc.hits < len(job.Chunks) {
+			for _, chunk := range job.Chunks {
+				level := chunk.(Level)
+				rc.chunks[int(level.X & 31) + int(level.Z & 31) << 5] = level
+			}
+			failure.Fail(fatalError("Error writing chunk cache: ", c.write(regions[job.Index - 1].(Region), rc.chunks)))
+		}
+		out <- job
+	}
+	close(out)
+}
+
+func (c *ChunkCache) write(region Region, chunks map[int]Level) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	
+	f, err := ioutil.TempFile(c.Dir, ".chunks-")
+	if err != nil {
+		return err
+	}
+	fw, err := flate.NewWriter(f, flate.BestSpeed)
+	if err == nil {
+		err = gob.NewEncoder(fw).Encode(chunkFile{CHUNKCACHEVERSION, chunks})
+		if closeErr := fw.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.filename(region))
+}
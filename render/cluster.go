@@ -0,0 +1,109 @@
+package render
+
+import (
+	"os"
+	"image"
+	"strings"
+	"path/filepath"
+	"encoding/json"
+)
+
+// CLUSTERSIZE is the cell size in viewer pixels markers are grouped into at
+// every zoom level.
+const CLUSTERSIZE = 64
+
+type MarkerCluster struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	Count int `json:"count"`
+	Label string `json:"label,omitempty"`
+}
+
+type MarkerZoom struct {
+	Zoom int `json:"zoom"`
+	Scale float64 `json:"scale"`
+	Markers []MarkerCluster `json:"markers"`
+}
+
+type MarkerSet struct {
+	Image string `json:"image"`
+	Width int `json:"width"`
+	Height int `json:"height"`
+	Zooms []MarkerZoom `json:"zooms"`
+}
+
+// Cluster groups points falling in the same cell x cell square, placing each
+// group at its centroid. Clusters keep the order of their first point.
+func Cluster(points []image.Point, labels []string, cell int) (clusters []MarkerCluster) {
+	index := make(map[image.Point]int)
+	sums := []image.Point{}
+	
+	for i, pt := range points {
+		key := image.Pt(floorDiv(pt.X, cell), floorDiv(pt.Y, cell))
+		j, exists := index[key]
+		if !exists {
+			j = len(clusters)
+			index[key] = j
+			clusters = append(clusters, MarkerCluster{Label: labels[i]})
+			sums = append(sums, image.ZP)
+		}
+		clusters[j].Count++
+		sums[j] = sums[j].Add(pt)
+	}
+	
+	for i := range clusters {
+		clusters[i].X = sums[i].X / clusters[i].Count
+		clusters[i].Y = sums[i].Y / clusters[i].Count
+		if clusters[i].Count > 1 {
+			clusters[i].Label = ""
+		}
+	}
+	return
+}
+
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
+
+// MarkerSetFilename turns map.png into map.markers.json.
+func MarkerSetFilename(out string) string {
+	return strings.TrimSuffix(out, filepath.Ext(out)) + ".markers.json"
+}
+
+// WriteMarkerSet writes markers clustered for zoom levels 0 through zooms,
+// where zooms is the image at full size and each level below halves it.
+// Coordinates are in pixels of the image scaled to that zoom level.
+func WriteMarkerSet(output *Output, markers []Marker, zooms int) error {
+	bounds := output.ChunkBounds
+	
+	points := make([]image.Point, len(markers))
+	labels := make([]string, len(markers))
+	for i, m := range markers {
+		x, y := output.Mode.Project(m.X, m.Y, m.Z)
+		points[i] = image.Pt(x, y).Sub(bounds.Min)
+		labels[i] = m.Label
+	}
+	
+	set := MarkerSet{Image: filepath.Base(output.Out), Width: bounds.Dx(), Height: bounds.Dy()}
+	for zoom := 0; zoom <= zooms; zoom++ {
+		shift := uint(zooms - zoom)
+		
+		clusters := Cluster(points, labels, CLUSTERSIZE << shift)
+		for i := range clusters {
+			clusters[i].X >>= shift
+			clusters[i].Y >>= shift
+		}
+		set.Zooms = append(set.Zooms, MarkerZoom{zoom, 1 / float64(int(1) << shift), clusters})
+	}
+	
+	setFile, err := os.Create(MarkerSetFilename(output.Out))
+	if err != nil {
+		return err
+	}
+	defer setFile.Close()
+	
+	return json.NewEncoder(setFile).Encode(set)
+}
@@ -0,0 +1,110 @@
+package render
+
+import (
+	"math"
+	"image/color"
+)
+
+type Lab struct {
+	L, A, B float64
+}
+
+func linearize(c uint8) float64 {
+	v := float64(c) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v + 0.055) / 1.055, 2.4)
+}
+
+func delinearize(v float64) uint8 {
+	if v <= 0.0031308 {
+		v *= 12.92
+	} else {
+		v = 1.055 * math.Pow(v, 1 / 2.4) - 0.055
+	}
+	return uint8(math.Max(0, math.Min(255, v * 255 + 0.5)))
+}
+
+func labF(t float64) float64 {
+	if t > 216.0 / 24389.0 {
+		return math.Cbrt(t)
+	}
+	return (24389.0 / 27.0 * t + 16) / 116
+}
+
+func labFInv(t float64) float64 {
+	if t * t * t > 216.0 / 24389.0 {
+		return t * t * t
+	}
+	return (116 * t - 16) * 27.0 / 24389.0
+}
+
+// Conversions use sRGB primaries and the D65 white point.
+func LinearToLab(r, g, b float64) Lab {
+	x := (0.4124 * r + 0.3576 * g + 0.1805 * b) / 0.95047
+	y := 0.2126 * r + 0.7152 * g + 0.0722 * b
+	z := (0.0193 * r + 0.1192 * g + 0.9505 * b) / 1.08883
+	
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return Lab{116 * fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+func ToLab(c color.RGBA) Lab {
+	return LinearToLab(linearize(c.R), linearize(c.G), linearize(c.B))
+}
+
+func (l Lab) RGBA() color.RGBA {
+	fy := (l.L + 16) / 116
+	x := labFInv(fy + l.A / 500) * 0.95047
+	y := labFInv(fy)
+	z := labFInv(fy - l.B / 200) * 1.08883
+	
+	r := 3.2406 * x - 1.5372 * y - 0.4986 * z
+	g := -0.9689 * x + 1.8758 * y + 0.0415 * z
+	b := 0.0557 * x - 0.2040 * y + 1.0570 * z
+	return color.RGBA{delinearize(r), delinearize(g), delinearize(b), 0xFF}
+}
+
+// DeltaE is the CIE76 colour difference; around 2.3 is just noticeable.
+func DeltaE(a, b Lab) float64 {
+	return math.Sqrt((a.L - b.L) * (a.L - b.L) + (a.A - b.A) * (a.A - b.A) + (a.B - b.B) * (a.B - b.B))
+}
+
+type Deficiency struct {
+	Name string
+	Matrix [3][3]float64
+}
+
+// Dichromat simulation matrices (Machado et al. 2009, severity 1.0) applied
+// to linear RGB.
+var deficiencies = []Deficiency{
+	{"protanopia", [3][3]float64{
+		{0.152286, 1.052583, -0.204868},
+		{0.114503, 0.786281, 0.099216},
+		{-0.003882, -0.048116, 1.051998},
+	}},
+	{"deuteranopia", [3][3]float64{
+		{0.367322, 0.860646, -0.227968},
+		{0.280085, 0.672501, 0.047413},
+		{-0.011820, 0.042940, 0.968881},
+	}},
+	{"tritanopia", [3][3]float64{
+		{1.255528, -0.076749, -0.178779},
+		{-0.078411, 0.930809, 0.147602},
+		{0.004733, 0.691367, 0.303900},
+	}},
+}
+
+func (d Deficiency) Simulate(c color.RGBA) Lab {
+	in := [3]float64{linearize(c.R), linearize(c.G), linearize(c.B)}
+	
+	var out [3]float64
+	for i := range out {
+		for j := range in {
+			out[i] += d.Matrix[i][j] * in[j]
+		}
+		out[i] = math.Max(0, math.Min(1, out[i]))
+	}
+	return LinearToLab(out[0], out[1], out[2])
+}
@@ -0,0 +1,125 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"strings"
+)
+
+// A Command is a gocart subcommand, run with the arguments after its name.
+type Command struct {
+	Name, Summary string
+	Run func(args []string) error
+}
+
+var commands []Command
+
+func init() {
+	commands = []Command{
+		{"render", "Render a world to images (the default command).", func(args []string) error { return RenderCommand(args, false, false) }},
+		{"tiles", "Render a world to an MBTiles database, or a Deep Zoom pyramid beside the image.", func(args []string) error { return RenderCommand(args, true, false) }},
+		{"config", "Print what render flags and -config resolve to: config print [flags].", ConfigCommand},
+		{"serve", "Serve a browsable map, rendering tiles as they're asked for.", ServeTiles},
+		{"stats", "Count blocks by type and height.", Stats},
+		{"find", "List where blocks of given types are.", Find},
+		{"palette", "Report block colors that are hard to tell apart.", PaletteCommand},
+		{"prune", "Remove chunks whose terrain was never populated from region files.", Prune},
+		{"explored", "Map which chunks exist, one pixel each.", Explored},
+		{"timelapse", "Render world backups into an animation.", Timelapse},
+		{"timeline", "Chart when chunks were last saved.", Timeline},
+		{"diff", "Draw what changed between two copies of a world.", Diff},
+		{"schematic", "Render a WorldEdit schematic.", RenderSchematic},
+		{"maps", "Render the map items players have made.", Maps},
+		{"quick", "Render every dimension top-down and isometric and serve the maps.", Quick},
+		{"daemon", "Render on a schedule and on request.", RunDaemon},
+		{"status", "Print the status of a running serve or daemon server.", RemoteStatus},
+	}
+}
+
+// globalFlags are those every command takes, and which may be given before
+// the command's name to apply to it.
+func globalFlags() *flag.FlagSet {
+	var progress Progress
+	flags := flag.NewFlagSet("gocart", flag.ContinueOnError)
+	progress.Flags(flags)
+	return flags
+}
+
+// splitGlobal splits the global flags off the front of args.
+func splitGlobal(args []string) (leading, rest []string) {
+	global := globalFlags()
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		name := strings.TrimLeft(args[0], "-")
+		hasValue := strings.Contains(name, "=")
+		if hasValue {
+			name = name[:strings.Index(name, "=")]
+		}
+		f := global.Lookup(name)
+		if f == nil {
+			break
+		}
+		
+		leading, args = append(leading, args[0]), args[1:]
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !hasValue && (!ok || !b.IsBoolFlag()) && len(args) > 0 {
+			leading, args = append(leading, args[0]), args[1:]
+		}
+	}
+	return leading, args
+}
+
+// RunCommand runs the command named by the first argument that isn't a
+// global flag, passing it those flags ahead of its own arguments. Without
+// one, everything is taken as render flags, as before there were commands.
+func RunCommand(args []string) error {
+	leading, args := splitGlobal(args)
+	if len(args) > 0 {
+		if args[0] == "help" {
+			Usage()
+			return nil
+		}
+		for _, command := range commands {
+			if command.Name == args[0] {
+				return command.Run(append(leading, args[1:]...))
+			}
+		}
+		if !strings.HasPrefix(args[0], "-") {
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+			Usage()
+			return usageError("unknown command %q", args[0])
+		}
+	}
+	return RenderCommand(append(leading, args...), false, false)
+}
+
+// ConfigCommand prints what render flags resolve to with -config.
+func ConfigCommand(args []string) error {
+	leading, args := splitGlobal(args)
+	if len(args) < 1 || args[0] != "print" {
+		fmt.Fprintf(os.Stderr, "Usage: %s config print [flags]\n", os.Args[0])
+		return usageError("config takes print")
+	}
+	return RenderCommand(append(leading, args[1:]...), false, true)
+}
+
+// Usage lists the commands, the flags they share and those of render.
+func Usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [global flags] [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, command := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", command.Name, command.Summary)
+	}
+	
+	fmt.Fprintf(out, "\nGlobal flags, taken by every command:\n")
+	global := globalFlags()
+	global.SetOutput(out)
+	global.PrintDefaults()
+	
+	fmt.Fprintf(out, "\nRun %s <command> -h for a command's flags. Those of render:\n", os.Args[0])
+	render := flag.NewFlagSet("render", flag.ContinueOnError)
+	NewRenderSettings(render)
+	render.SetOutput(out)
+	render.PrintDefaults()
+	
+	fmt.Fprintf(out, "\nExit status: %d on success, %d for bad flags, %d when no region files are found, %d for a missing or invalid palette, %d when a render finished but skipped corrupt chunks, and %d for any other error.\n", 0, ExitUsage, ExitNoRegions, ExitPalette, ExitSkipped, ExitFatal)
+}
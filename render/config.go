@@ -0,0 +1,203 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"flag"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Where a setting's effective value came from.
+const (
+	SourceDefault = "default"
+	SourceFlag = "flag"
+	SourceConfig = "config"
+	SourceAuto = "auto"
+)
+
+type Setting struct {
+	Name, Value, Source string
+}
+
+type SettingList []Setting
+
+func (sl SettingList) Len() int {
+	return len(sl)
+}
+
+func (sl SettingList) Less(i, j int) bool {
+	return sl[i].Name < sl[j].Name
+}
+
+func (sl SettingList) Swap(i, j int) {
+	sl[i], sl[j] = sl[j], sl[i]
+}
+
+// A Config holds settings read from a -config file, keyed by flag name.
+// Settings under [profile.name] tables are kept apart, by profile.
+type Config struct {
+	Path string
+	Values map[string]TOMLValue
+	Profiles map[string]map[string]TOMLValue
+	ProfileNames []string
+	
+	// Applied lists the settings that weren't overridden on the command line.
+	Applied map[string]bool
+}
+
+func ReadConfig(path string) (*Config, error) {
+	configFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer configFile.Close()
+	
+	f, err := ParseTOML(configFile)
+	if e, ok := err.(TOMLError); ok {
+		return nil, fmt.Errorf("%s:%d: %s", path, e.Line, e.Message)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	
+	c := &Config{Path: path, Values: make(map[string]TOMLValue), Profiles: make(map[string]map[string]TOMLValue), Applied: make(map[string]bool)}
+	addProfile := func(name string) map[string]TOMLValue {
+		if _, exists := c.Profiles[name]; !exists {
+			c.Profiles[name] = make(map[string]TOMLValue)
+			c.ProfileNames = append(c.ProfileNames, name)
+		}
+		return c.Profiles[name]
+	}
+	
+	// Profiles are listed in the order their tables first appear.
+	for _, table := range f.Tables {
+		if len(table) >= 2 && table[0] == "profile" {
+			addProfile(table[1])
+		}
+	}
+	
+	for key, v := range f.Values {
+		if len(v.Path) < 3 || v.Path[0] != "profile" {
+			c.Values[key] = v
+			continue
+		}
+		
+		name := strings.Join(v.Path[2:], "-")
+		if name == "profile" || name == "config" {
+			return nil, fmt.Errorf("%s:%d: %s can't be set in a profile", path, v.Line, name)
+		}
+		addProfile(v.Path[1])[name] = v
+	}
+	return c, nil
+}
+
+// ForProfile returns the config with the named profile's settings laid over
+// the top-level ones.
+func (c *Config) ForProfile(name string) (*Config, error) {
+	profile, exists := c.Profiles[name]
+	if !exists {
+		return nil, fmt.Errorf("%s: no profile %q (have %s)", c.Path, name, strings.Join(c.ProfileNames, ", "))
+	}
+	
+	p := &Config{Path: c.Path, Values: make(map[string]TOMLValue), Applied: make(map[string]bool)}
+	for key, v := range c.Values {
+		if key != "profile" {
+			p.Values[key] = v
+		}
+	}
+	for key, v := range profile {
+		p.Values[key] = v
+	}
+	return p, nil
+}
+
+// Apply sets every flag the config names that wasn't given on the command
+// line, rejecting settings that aren't flags, sorted by line so the first
+// mistake in the file is the one reported.
+func (c *Config) Apply(flags *flag.FlagSet) error {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	
+	lines := configLines{values: c.Values}
+	for name := range c.Values {
+		lines.names = append(lines.names, name)
+	}
+	sort.Sort(lines)
+	
+	for _, name := range lines.names {
+		v := c.Values[name]
+		if f := flags.Lookup(name); f == nil || f.Name == "config" {
+			return fmt.Errorf("%s:%d: unknown setting %q", c.Path, v.Line, name)
+		}
+		if set[name] {
+			continue
+		}
+		if err := flags.Set(name, v.Value); err != nil {
+			return fmt.Errorf("%s:%d: %s: %s", c.Path, v.Line, name, err)
+		}
+		c.Applied[name] = true
+	}
+	return nil
+}
+
+// configLines sorts setting names by the line they were set on.
+type configLines struct {
+	names []string
+	values map[string]TOMLValue
+}
+
+func (cl configLines) Len() int {
+	return len(cl.names)
+}
+
+func (cl configLines) Less(i, j int) bool {
+	return cl.values[cl.names[i]].Line < cl.values[cl.names[j]].Line
+}
+
+func (cl configLines) Swap(i, j int) {
+	cl.names[i], cl.names[j] = cl.names[j], cl.names[i]
+}
+
+// ResolveSettings lists every flag in flags with its effective value, and
+// which came from config, if any. Call it after defaults have been filled
+// in, so that unset flags whose value no longer matches their default, such
+// as automatic worker counts, are reported as auto.
+func ResolveSettings(flags *flag.FlagSet, config *Config) (settings SettingList) {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	
+	flags.VisitAll(func(f *flag.Flag) {
+		s := Setting{f.Name, f.Value.String(), SourceDefault}
+		if config != nil && config.Applied[f.Name] {
+			s.Source = SourceConfig
+		} else if set[f.Name] {
+			s.Source = SourceFlag
+		} else if s.Value != f.DefValue {
+			s.Source = SourceAuto
+		}
+		settings = append(settings, s)
+	})
+	
+	sort.Sort(settings)
+	return
+}
+
+func (sl SettingList) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	for _, s := range sl {
+		value := s.Value
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Name, value, s.Source)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,382 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"net"
+	"flag"
+	"sync"
+	"time"
+	"strconv"
+	"strings"
+	"os/exec"
+	"net/http"
+	"crypto/subtle"
+	"encoding/json"
+)
+
+const (
+	DAEMONEVERY = 30 * time.Minute
+	DAEMONHISTORY = 20
+	DAEMONLOGSIZE = 1 << 20
+	RENDERPATH = "/render"
+)
+
+const (
+	RunQueued = "queued"
+	RunRunning = "running"
+	RunDone = "done"
+	RunFailed = "failed"
+)
+
+// A DaemonRun is one render, started by the schedule or through the API.
+type DaemonRun struct {
+	RenderStatus
+	ID int `json:"id"`
+	State string `json:"state"`
+	Trigger string `json:"trigger"`
+	Queued time.Time `json:"queued"`
+	
+	log *runLog
+}
+
+// A runLog keeps the last DAEMONLOGSIZE bytes a run wrote.
+type runLog struct {
+	mu sync.Mutex
+	buf []byte
+}
+
+func (l *runLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	l.buf = append(l.buf, p...)
+	if len(l.buf) > DAEMONLOGSIZE {
+		l.buf = append([]byte(nil), l.buf[len(l.buf) - DAEMONLOGSIZE:]...)
+	}
+	l.mu.Unlock()
+	return len(p), nil
+}
+
+func (l *runLog) Bytes() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]byte(nil), l.buf...)
+}
+
+// A Daemon renders the world every Every, each run a separate render so a
+// failed one can't take the daemon down with it. Runs never overlap: they
+// wait in a queue of at most one, so a slot or request arriving while a run
+// is already waiting joins it instead, counted as skipped for the schedule.
+type Daemon struct {
+	Every time.Duration
+	Args []string
+	Log *Progress
+	
+	// Token, when set, must be given as a bearer token to start runs or
+	// read them back.
+	Token string
+	
+	mu sync.Mutex
+	started time.Time
+	next time.Time
+	lastID int
+	queued, running *DaemonRun
+	runs []*DaemonRun
+	schedule ScheduleStatus
+	wake chan bool
+}
+
+// daemonFlags belong to the daemon rather than the renders it runs.
+var daemonFlags = map[string]bool{
+	"every": true,
+	"listen": true,
+	"token": true,
+}
+
+// renderArgs removes the daemon's own flags from args, leaving those to
+// pass on to each render.
+func renderArgs(args []string) (render []string) {
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		if args[i] == name || args[i] == "--" {
+			render = append(render, args[i:]...)
+			break
+		}
+		
+		if n := strings.Index(name, "="); n >= 0 {
+			if daemonFlags[name[:n]] {
+				continue
+			}
+		} else if daemonFlags[name] {
+			i++
+			continue
+		}
+		render = append(render, args[i])
+	}
+	return
+}
+
+// Queue adds a run for trigger, or returns the run already waiting, which
+// will start once the current one finishes.
+func (d *Daemon) Queue(trigger string) (run DaemonRun, joined bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	
+	if d.queued != nil {
+		return *d.queued, true
+	}
+	
+	d.lastID++
+	d.queued = &DaemonRun{ID: d.lastID, State: RunQueued, Trigger: trigger, Queued: time.Now(), log: &runLog{}}
+	d.queued.Label = fmt.Sprintf("#%d", d.lastID)
+	d.runs = append(d.runs, d.queued)
+	if len(d.runs) > DAEMONHISTORY {
+		d.runs = d.runs[len(d.runs) - DAEMONHISTORY:]
+	}
+	
+	select {
+	case d.wake <- true:
+	default:
+	}
+	return *d.queued, false
+}
+
+// Work runs queued renders one at a time, forever.
+func (d *Daemon) Work() {
+	for _ = range d.wake {
+		d.mu.Lock()
+		run := d.queued
+		d.queued, d.running = nil, run
+		if run != nil {
+			run.State = RunRunning
+			run.Started = time.Now()
+		}
+		d.mu.Unlock()
+		if run == nil {
+			continue
+		}
+		
+		d.Log.Printf("Starting run %s (%s)", run.Label, run.Trigger)
+		err := d.render(run.log)
+		
+		d.mu.Lock()
+		run.Duration = time.Since(run.Started)
+		d.schedule.Runs++
+		if err != nil {
+			run.State, run.Error = RunFailed, err.Error()
+			d.schedule.Failures++
+			d.Log.Errorf("Run %s failed after %s: %s", run.Label, run.Duration.Truncate(time.Second), err)
+		} else {
+			run.State = RunDone
+			d.Log.Printf("Run %s finished in %s", run.Label, run.Duration.Truncate(time.Second))
+		}
+		d.running = nil
+		d.mu.Unlock()
+	}
+}
+
+// render runs one render, its output going both to ours and to log.
+func (d *Daemon) render(log io.Writer) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	
+	cmd := exec.Command(self, append([]string{"render"}, d.Args...)...)
+	cmd.Stdout = io.MultiWriter(os.Stdout, log)
+	cmd.Stderr = io.MultiWriter(os.Stderr, log)
+	
+	// Renders that skipped corrupt chunks still wrote their images.
+	err = cmd.Run()
+	if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() == ExitSkipped {
+		return nil
+	}
+	return err
+}
+
+// Schedule queues renders every Every from now on, forever.
+func (d *Daemon) Schedule() {
+	d.mu.Lock()
+	d.started = time.Now()
+	d.next = d.started
+	d.mu.Unlock()
+	go d.Work()
+	
+	for {
+		time.Sleep(time.Until(d.next))
+		if _, joined := d.Queue("schedule"); joined {
+			d.mu.Lock()
+			d.schedule.Skipped++
+			d.mu.Unlock()
+		}
+		
+		d.mu.Lock()
+		d.next = d.next.Add(d.Every)
+		d.mu.Unlock()
+	}
+}
+
+// Run returns a copy of the run with the given ID, if it's still kept.
+func (d *Daemon) Run(id int) (run DaemonRun, exists bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, r := range d.runs {
+		if r.ID == id {
+			return *r, true
+		}
+	}
+	return
+}
+
+func (d *Daemon) Status() ServerStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	
+	schedule := d.schedule
+	schedule.Every = d.Every.String()
+	schedule.Next = d.next
+	status := ServerStatus{Started: d.started, Schedule: &schedule}
+	for _, r := range d.runs {
+		if r.State == RunDone || r.State == RunFailed {
+			status.Renders = append(status.Renders, r.RenderStatus)
+		}
+	}
+	if d.running != nil {
+		running := d.running.RenderStatus
+		status.Rendering = &running
+	}
+	return status
+}
+
+// authorized checks the bearer token given to the render API, if one is set.
+func (d *Daemon) authorized(r *http.Request) bool {
+	if d.Token == "" {
+		return true
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(d.Token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ServeHTTP reports status at STATUSPATH and serves the render API:
+// POST RENDERPATH queues a run, answering with it, and RENDERPATH/{id}/status
+// and RENDERPATH/{id}/log report on a run and return what it has written.
+// Everything under RENDERPATH needs the token, if one is set.
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == STATUSPATH {
+		writeJSON(w, http.StatusOK, d.Status())
+		return
+	}
+	
+	if (r.URL.Path == RENDERPATH || strings.HasPrefix(r.URL.Path, RENDERPATH + "/")) && !d.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Missing or wrong token", http.StatusUnauthorized)
+		return
+	}
+	
+	if r.URL.Path == RENDERPATH {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "Use POST to start a render", http.StatusMethodNotAllowed)
+			return
+		}
+		
+		run, _ := d.Queue("api")
+		w.Header().Set("Location", fmt.Sprintf("%s/%d/status", RENDERPATH, run.ID))
+		writeJSON(w, http.StatusAccepted, run)
+		return
+	}
+	
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, RENDERPATH + "/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if len(parts) != 2 || err != nil || !strings.HasPrefix(r.URL.Path, RENDERPATH + "/") {
+		http.NotFound(w, r)
+		return
+	}
+	run, exists := d.Run(id)
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	
+	switch parts[1] {
+	case "status":
+		writeJSON(w, http.StatusOK, run)
+	case "log":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(run.log.Bytes())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// RunDaemon re-renders the world on a schedule, taking the render flags
+// alongside its own and reporting its runs at STATUSPATH. Renders keep a
+// -cache, beside the output unless given, so each only draws the regions
+// saved since the last.
+func RunDaemon(args []string) error {
+	var (
+		listen string
+		d Daemon
+	)
+	
+	flags := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	flags.DurationVar(&d.Every, "every", DAEMONEVERY, "Start a render this often, or as soon as the last finishes if it overruns.")
+	flags.StringVar(&listen, "listen", "localhost:8080", "Report the schedule and recent runs at " + STATUSPATH + ", and take requests to render at " + RENDERPATH + ", on this address (empty for none).")
+	flags.StringVar(&d.Token, "token", "", "Require this bearer token for " + RENDERPATH + " requests, which start and report on renders. Defaults to $GOCART_API_TOKEN.")
+	s := NewRenderSettings(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	
+	// Read only now, so -h can't show it as the flag's default.
+	if d.Token == "" {
+		d.Token = os.Getenv("GOCART_API_TOKEN")
+	}
+	
+	if d.Every <= 0 {
+		return fatalError("Error scheduling renders: ", fmt.Errorf("-every must be positive"))
+	}
+	
+	// The config is read here too so mistakes in it stop the daemon rather
+	// than failing every run, and so its -cache is respected.
+	if s.ConfigFilename != "" {
+		config, err := ReadConfig(s.ConfigFilename)
+		if err != nil {
+			return fatalError("Error reading config: ", err)
+		}
+		if err := config.Apply(flags); err != nil {
+			return fatalError("Error in config: ", err)
+		}
+	}
+	
+	d.Args = renderArgs(args)
+	d.wake = make(chan bool, 1)
+	d.Log = &s.Opts.Progress
+	d.Log.Start()
+	if s.CacheDir == "" {
+		d.Args = append(d.Args, "-cache", StateDir(s.Out, CACHEDIR))
+	}
+	
+	// Schedule never returns, so the daemon only stops if serving fails.
+	served := make(chan error, 1)
+	if listen != "" {
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			return fatalError("Error starting web server: ", err)
+		}
+		d.Log.Printf("Reporting status at http://%s%s", listener.Addr(), STATUSPATH)
+		go func() {
+			served <- http.Serve(listener, &d)
+		}()
+	}
+	
+	d.Log.Printf("Rendering every %s (Ctrl+C to stop)", d.Every)
+	go d.Schedule()
+	return fatalError("Error serving status: ", <-served)
+}
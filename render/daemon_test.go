@@ -0,0 +1,60 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+)
+
+func TestDaemonToken(t *testing.T) {
+	d := &Daemon{Token: "secret"}
+	run, _ := d.Queue("test")
+	run.log.Write([]byte("rendering\n"))
+	statusPath := fmt.Sprintf("%s/%d/status", RENDERPATH, run.ID)
+	logPath := fmt.Sprintf("%s/%d/log", RENDERPATH, run.ID)
+	
+	for _, test := range []struct {
+		name, method, path, auth string
+		code int
+	}{
+		{"start without a token", "POST", RENDERPATH, "", http.StatusUnauthorized},
+		{"start with the wrong token", "POST", RENDERPATH, "Bearer guess", http.StatusUnauthorized},
+		{"start", "POST", RENDERPATH, "Bearer secret", http.StatusAccepted},
+		{"GET the render API", "GET", RENDERPATH, "Bearer secret", http.StatusMethodNotAllowed},
+		{"status without a token", "GET", statusPath, "", http.StatusUnauthorized},
+		{"status with the wrong token", "GET", statusPath, "Bearer guess", http.StatusUnauthorized},
+		{"status", "GET", statusPath, "Bearer secret", http.StatusOK},
+		{"log without a token", "GET", logPath, "", http.StatusUnauthorized},
+		{"log", "GET", logPath, "Bearer secret", http.StatusOK},
+		{"unknown run without a token", "GET", RENDERPATH + "/99/status", "", http.StatusUnauthorized},
+		{"unknown run", "GET", RENDERPATH + "/99/status", "Bearer secret", http.StatusNotFound},
+		{"server status", "GET", STATUSPATH, "", http.StatusOK},
+	} {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if test.auth != "" {
+			r.Header.Set("Authorization", test.auth)
+		}
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, r)
+		
+		if w.Code != test.code {
+			t.Errorf("%s: got %d, want %d", test.name, w.Code, test.code)
+		}
+		if challenge := w.Header().Get("WWW-Authenticate"); (w.Code == http.StatusUnauthorized) != (challenge == "Bearer") {
+			t.Errorf("%s: WWW-Authenticate = %q with %d", test.name, challenge, w.Code)
+		}
+		if test.path == logPath && w.Code == http.StatusOK && !strings.Contains(w.Body.String(), "rendering") {
+			t.Errorf("%s: got %q", test.name, w.Body.String())
+		}
+	}
+	
+	// Without a token the API is open.
+	d.Token = ""
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", statusPath, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status without a token set: got %d", w.Code)
+	}
+}
@@ -0,0 +1,385 @@
+package render
+
+import (
+	"io"
+	"os"
+	"flag"
+	"sort"
+	"sync"
+	"image"
+	"image/png"
+	"image/color"
+	"path/filepath"
+)
+
+type BlockChange byte
+
+const (
+	Unchanged BlockChange = iota
+	Added
+	Removed
+	Changed
+)
+
+var changeColors = map[BlockChange]color.RGBA{
+	Added: {0x20, 0xd0, 0x20, 0xff},
+	Removed: {0xe0, 0x20, 0x20, 0xff},
+	Changed: {0xf0, 0xc0, 0x10, 0xff},
+}
+
+// A BlockDiff is the highest changed block in a column.
+type BlockDiff struct {
+	X, Y, Z int
+	Change BlockChange
+}
+
+type DiffCounts struct {
+	Added, Removed, Changed int
+	Chunks, Skipped int
+}
+
+// LoadChunk reads and decodes the i'th chunk of an open region file.
+func LoadChunk(regionFile *os.File, region Region, header Header, i int) (level Level, err error) {
+	location := header.Locations[i]
+	chunk := RawChunk{X: region.X << 5 + i & 31, Z: region.Z << 5 + i >> 5, Legacy: region.Legacy}
+	if err = chunk.Read(io.NewSectionReader(regionFile, location.Start(), location.Size())); err != nil {
+		return
+	}
+	if chunk.External() {
+		if err = chunk.ReadExternal(filepath.Dir(region.Path)); err != nil {
+			return
+		}
+	}
+	
+	data, err := chunk.Decompress()
+	if err != nil {
+		return
+	}
+	
+	if chunk.Legacy {
+		err = level.DecodeLegacy(data)
+	} else {
+		err = level.Decode(data)
+	}
+	return
+}
+
+type regionFile struct {
+	Region Region
+	File *os.File
+	Header Header
+	Size int64
+}
+
+func openRegion(region Region, found bool) (*regionFile, error) {
+	if !found {
+		return nil, nil
+	}
+	
+	file, err := os.Open(region.Path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	
+	rf := &regionFile{Region: region, File: file, Size: stat.Size()}
+	rf.Header.Read(file)
+	return rf, nil
+}
+
+func (rf *regionFile) Close() {
+	if rf != nil {
+		rf.File.Close()
+	}
+}
+
+func (rf *regionFile) Has(i int) bool {
+	return rf != nil && rf.Header.Locations[i].Valid(rf.Size)
+}
+
+// DiffChunks compares two versions of a chunk column by column. Either may
+// be nil when the chunk only exists on one side.
+func DiffChunks(old, new *Level, x0, z0 int, area Area) (diffs []BlockDiff, counts DiffCounts) {
+	var oldSections, newSections [16]*Section
+	if old != nil {
+		oldSections = old.SectionTable()
+	}
+	if new != nil {
+		newSections = new.SectionTable()
+	}
+	
+	for z := 0; z < 16; z++ {
+		for x := 0; x < 16; x++ {
+			if !area.Contains(x0 + x, z0 + z) {
+				continue
+			}
+			
+			top := BlockDiff{Change: Unchanged}
+			for y := 255; y >= 0; y-- {
+				a, b := BlockAt(oldSections, x, y, z), BlockAt(newSections, x, y, z)
+				if a == b {
+					continue
+				}
+				
+				change := Changed
+				switch {
+				case a == 0:
+					change = Added
+					counts.Added++
+				case b == 0:
+					change = Removed
+					counts.Removed++
+				default:
+					counts.Changed++
+				}
+				
+				if top.Change == Unchanged {
+					top = BlockDiff{x0 + x, y, z0 + z, change}
+				}
+			}
+			
+			if top.Change != Unchanged {
+				diffs = append(diffs, top)
+			}
+		}
+	}
+	return
+}
+
+// DiffRegions compares every chunk of a pair of regions, skipping chunks
+// whose header timestamps match since they can't have been saved since.
+func DiffRegions(old, new *regionFile, area Area) (diffs []BlockDiff, counts DiffCounts, errs []ChunkError) {
+	region := new
+	if region == nil {
+		region = old
+	}
+	
+	for i := 0; i < 1024; i++ {
+		x, z := region.Region.X << 5 + i & 31, region.Region.Z << 5 + i >> 5
+		if !area.ContainsChunk(x, z) || (!old.Has(i) && !new.Has(i)) {
+			continue
+		}
+		
+		if old.Has(i) && new.Has(i) && old.Header.Timestamps[i] == new.Header.Timestamps[i] {
+			counts.Skipped++
+			continue
+		}
+		
+		var levels [2]*Level
+		for j, rf := range []*regionFile{old, new} {
+			if !rf.Has(i) {
+				continue
+			}
+			level, err := LoadChunk(rf.File, rf.Region, rf.Header, i)
+			if err != nil {
+				errs = append(errs, ChunkError{filepath.Base(rf.Region.Path), x, z, rf.Header.Locations[i].Start(), err})
+				continue
+			}
+			levels[j] = &level
+		}
+		
+		d, c := DiffChunks(levels[0], levels[1], x << 4, z << 4, area)
+		diffs = append(diffs, d...)
+		counts.Added += c.Added
+		counts.Removed += c.Removed
+		counts.Changed += c.Changed
+		counts.Chunks++
+	}
+	return
+}
+
+func DrawChange(img *image.RGBA, mode Mode, d BlockDiff) {
+	c := changeColors[d.Change]
+	x, y := mode.Project(d.X, d.Y, d.Z)
+	if _, iso := mode.(IsometricMode); iso {
+		shade := Blend(c, color.RGBA{0, 0, 0, 0xff}, 0x4c)
+		DrawBlock(img, x, y, BlockColor{0xff, true, c, shade, shade})
+	} else {
+		img.SetRGBA(x, y, c)
+	}
+}
+
+func globRegions(dir string) (map[image.Point]Region, error) {
+	files, err := filepath.Glob(filepath.Join(dir, GLOBPATTERN))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		files, err = filepath.Glob(filepath.Join(dir, LEGACYGLOBPATTERN))
+	}
+	
+	regions := make(map[image.Point]Region)
+	for _, file := range files {
+		region := NewRegion(file)
+		regions[image.Pt(region.X, region.Z)] = region
+	}
+	return regions, err
+}
+
+// Diff renders the newer world grayed out and highlights blocks that were
+// added, removed or changed since the older one.
+func Diff(args []string) error {
+	var (
+		oldDir, newDir, outFilename string
+		opts = Options{Modes: ModeList{IsometricMode{}}}
+	)
+	
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.StringVar(&oldDir, "old", "", "Read the earlier snapshot of the world from this directory.")
+	flags.StringVar(&newDir, "new", DIR, "Read the later snapshot of the world from this directory.")
+	flags.StringVar(&outFilename, "out", "diff.png", "Write the difference image to this file.")
+	flags.Var(&opts.Modes, "mode", "Render in this mode (iso, xray, topdown).")
+	flags.Var(&opts.Area, "area", "Only compare blocks within x0,z0,x1,z1 (world coordinates).")
+	opts.Progress.Flags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	
+	opts.Auto()
+	opts.Progress.Start()
+	mode := opts.Modes[0]
+	opts.Modes = opts.Modes[:1]
+	
+	if oldDir == "" {
+		flags.Usage()
+		return usageError("diff needs -old")
+	}
+	
+	oldRegions, err := globRegions(oldDir)
+	if err != nil {
+		return fatalError("Error globbing region files: ", err)
+	}
+	newRegions, err := globRegions(newDir)
+	if err != nil {
+		return fatalError("Error globbing region files: ", err)
+	}
+	
+	var (
+		coords []image.Point
+		render PositionList
+		bounds image.Rectangle
+	)
+	for pt, region := range newRegions {
+		if opts.Area.ContainsRegion(region) {
+			coords = append(coords, pt)
+			render = append(render, region)
+			bounds = bounds.Union(mode.RegionBounds(region))
+		}
+	}
+	for pt, region := range oldRegions {
+		if _, exists := newRegions[pt]; !exists && opts.Area.ContainsRegion(region) {
+			coords = append(coords, pt)
+			bounds = bounds.Union(mode.RegionBounds(region))
+		}
+	}
+	sort.Sort(render)
+	if opts.Area.Active {
+		bounds = bounds.Intersect(mode.AreaBounds(opts.Area))
+	}
+	
+	opts.Progress.Printf("Comparing %d regions...", len(coords))
+	
+	var (
+		mu sync.Mutex
+		diffs []BlockDiff
+		total DiffCounts
+	)
+	work := make(chan image.Point)
+	done := make(chan bool)
+	failure := new(Failure)
+	
+	Spawn(opts.Decoders, func() {
+		for pt := range work {
+			oldRF, err := openRegion(oldRegions[pt], oldRegions[pt].Path != "")
+			if err != nil {
+				failure.Fail(fatalError("Error opening region file: ", err))
+				continue
+			}
+			newRF, err := openRegion(newRegions[pt], newRegions[pt].Path != "")
+			if err != nil {
+				oldRF.Close()
+				failure.Fail(fatalError("Error opening region file: ", err))
+				continue
+			}
+			
+			d, c, errs := DiffRegions(oldRF, newRF, opts.Area)
+			oldRF.Close()
+			newRF.Close()
+			
+			mu.Lock()
+			diffs = append(diffs, d...)
+			total.Added += c.Added
+			total.Removed += c.Removed
+			total.Changed += c.Changed
+			total.Chunks += c.Chunks
+			total.Skipped += c.Skipped
+			for _, err := range errs {
+				opts.Progress.ChunkError(err)
+			}
+			mu.Unlock()
+		}
+	}, func() {
+		close(done)
+	})
+	
+	for _, pt := range coords {
+		work <- pt
+	}
+	close(work)
+	<-done
+	if err := failure.Err(); err != nil {
+		return err
+	}
+	
+	opts.Progress.Printf("Compared %d chunks, skipped %d unchanged: %d blocks added, %d removed, %d changed",
+		total.Chunks, total.Skipped, total.Added, total.Removed, total.Changed)
+	
+	img := RenderFrame(render, bounds, &opts)
+	gray := Fade{Style: FadeGray}
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := gray.Color(color.RGBA{img.Pix[i], img.Pix[i + 1], img.Pix[i + 2], img.Pix[i + 3]}, 0.8)
+		img.Pix[i], img.Pix[i + 1], img.Pix[i + 2] = c.R, c.G, c.B
+	}
+	
+	// Draw back to front so nearer highlights cover farther ones.
+	sort.Sort(byDrawOrder(diffs))
+	for _, d := range diffs {
+		DrawChange(img, mode, d)
+	}
+	
+	outFile, err := os.Create(outFilename)
+	if err != nil {
+		return fatalError("Error creating image file: ", err)
+	}
+	defer outFile.Close()
+	
+	if err := png.Encode(outFile, img); err != nil {
+		return fatalError("Error encoding image: ", err)
+	}
+	opts.Progress.Done()
+	return nil
+}
+
+type byDrawOrder []BlockDiff
+
+func (b byDrawOrder) Len() int {
+	return len(b)
+}
+
+func (b byDrawOrder) Less(i, j int) bool {
+	if b[i].Z != b[j].Z {
+		return b[i].Z < b[j].Z
+	}
+	if b[i].X != b[j].X {
+		return b[i].X > b[j].X
+	}
+	return b[i].Y < b[j].Y
+}
+
+func (b byDrawOrder) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
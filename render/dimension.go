@@ -0,0 +1,608 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"sort"
+	"image"
+	"strconv"
+	"strings"
+	"image/png"
+	"image/draw"
+	"path/filepath"
+)
+
+var dimensionDirs = []struct {
+	ID int
+	Name, Path, Key string
+}{
+	{0, "overworld", "", "minecraft:overworld"},
+	{-1, "nether", "DIM-1", "minecraft:the_nether"},
+	{1, "end", "DIM1", "minecraft:the_end"},
+}
+
+const (
+	// CUSTOMDIMENSIONS holds the dimensions of datapacks, since 1.16, each
+	// in a <namespace>/<name> directory.
+	CUSTOMDIMENSIONS = "dimensions"
+	
+	// Custom dimensions have no numeric id, only their namespace:name key,
+	// so all share CUSTOMID, which is no vanilla dimension's.
+	CUSTOMID = 2
+)
+
+// A Dimension is a world, or one dimension of it, and its outputs. Key is
+// the dimension's namespace:name, such as minecraft:the_nether, which
+// markers and anything kept between renders refer to it by.
+type Dimension struct {
+	ID int
+	Name string
+	Path string
+	Key string
+	
+	Regions PositionList
+	Entities PositionList
+	Markers []Marker
+	Paths []Path
+	Outputs []*Output
+	
+	// Other is the overworld or nether drawn under the rest of the
+	// overlays, for -nether-overlay.
+	Other *DimensionOverlay
+	
+	// Blocks covers the rendered chunks in world x, z.
+	Blocks image.Rectangle
+	Chunks int
+	
+	surface map[image.Point][]int
+}
+
+// An Output is one image being rendered for a dimension in a given mode.
+type Output struct {
+	Mode Mode
+	Out string
+	
+	Bounds image.Rectangle
+	ChunkBounds image.Rectangle
+	
+	// Img and Stream hold the canvas Scale times larger than the image,
+	// when supersampling, until it is averaged down for encoding.
+	Scale int
+	Img *image.RGBA
+	Stream *Stream
+	Mapped *MappedImage
+	File *os.File
+}
+
+// OutputFilename inserts the given name parts before the extension, so
+// map.png becomes map_nether_topdown.png.
+func OutputFilename(out string, parts ...string) string {
+	ext := filepath.Ext(out)
+	name := strings.TrimSuffix(out, ext)
+	for _, part := range parts {
+		if part != "" {
+			name += "_" + part
+		}
+	}
+	return name + ext
+}
+
+// A RenderTarget is a set of modes rendered to images named after Out.
+type RenderTarget struct {
+	Out string
+	Modes ModeList
+}
+
+func FindDimensions(dir, out string, all bool, modes ModeList) ([]*Dimension, error) {
+	return FindTargets(dir, []RenderTarget{{out, modes}}, all)
+}
+
+// FindTargets returns the world itself, or with all set every dimension
+// under it that has a region directory, with an output for each target's
+// modes. Output names only carry the dimension and mode when more than one
+// of each is being rendered.
+func FindTargets(dir string, targets []RenderTarget, all bool) ([]*Dimension, error) {
+	dimensions := []*Dimension{{Path: dir, Key: dimensionDirs[0].Key}}
+	if all {
+		var err error
+		if dimensions, err = WorldDimensions(dir); err != nil {
+			return nil, err
+		}
+	}
+	
+	for _, dimension := range dimensions {
+		dimension.AddOutputs(targets)
+	}
+	return dimensions, nil
+}
+
+// AddOutputs adds an output for each of the targets' modes, named after the
+// target and the dimension's name, if it has one.
+func (d *Dimension) AddOutputs(targets []RenderTarget) {
+	for _, target := range targets {
+		for _, mode := range target.Modes {
+			modeName := ""
+			if len(target.Modes) > 1 {
+				modeName = mode.Name()
+			}
+			d.Outputs = append(d.Outputs, &Output{Mode: mode, Out: OutputFilename(target.Out, d.Name, modeName)})
+		}
+	}
+}
+
+// WorldDimensions returns every dimension of the world at dir that has a
+// region directory: the overworld, nether and end, then those of datapacks,
+// named after their namespace and name. Datapack dimensions are always saved
+// in the 1.13+ format, so rendering one fails in CheckFormat.
+func WorldDimensions(dir string) (dimensions []*Dimension, err error) {
+	for _, d := range dimensionDirs {
+		path := filepath.Join(dir, d.Path)
+		if _, err := os.Stat(filepath.Join(path, filepath.Dir(GLOBPATTERN))); err == nil {
+			dimensions = append(dimensions, &Dimension{ID: d.ID, Name: d.Name, Path: path, Key: d.Key})
+		}
+	}
+	
+	regionDirs, err := filepath.Glob(filepath.Join(dir, CUSTOMDIMENSIONS, "*", "*", filepath.Dir(GLOBPATTERN)))
+	if err != nil {
+		return nil, fatalError("Error globbing dimensions: ", err)
+	}
+	sort.Strings(regionDirs)
+	for _, regionDir := range regionDirs {
+		path := filepath.Dir(regionDir)
+		namespace, name := filepath.Base(filepath.Dir(path)), filepath.Base(path)
+		dimensions = append(dimensions, &Dimension{ID: CUSTOMID, Name: namespace + "_" + name, Path: path, Key: namespace + ":" + name})
+	}
+	return dimensions, nil
+}
+
+// FindDimension returns the dimension of the world at dir given as
+// ParseDimension reads it.
+func FindDimension(dir, dimension string) (*Dimension, error) {
+	key, err := ParseDimension(dimension)
+	if err != nil {
+		return nil, err
+	}
+	
+	dimensions, err := WorldDimensions(dir)
+	if err != nil {
+		return nil, err
+	}
+	
+	var keys []string
+	for _, d := range dimensions {
+		if d.Key == key {
+			return d, nil
+		}
+		keys = append(keys, d.Key)
+	}
+	return nil, fmt.Errorf("no dimension %s in %s, only %s", key, dir, strings.Join(keys, ", "))
+}
+
+// DimensionKey returns the key of the vanilla dimension with the given
+// numeric id, by which older files refer to dimensions.
+func DimensionKey(id int) (string, bool) {
+	for _, d := range dimensionDirs {
+		if d.ID == id {
+			return d.Key, true
+		}
+	}
+	return "", false
+}
+
+// ParseDimension returns the key of a dimension given as namespace:name,
+// or for vanilla dimensions also by name, such as nether, or numeric id.
+// Empty means the overworld.
+func ParseDimension(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return dimensionDirs[0].Key, nil
+	}
+	if id, err := strconv.Atoi(s); err == nil {
+		if key, ok := DimensionKey(id); ok {
+			return key, nil
+		}
+		return "", fmt.Errorf("no dimension %d, datapack dimensions are given by namespace:name", id)
+	}
+	for _, d := range dimensionDirs {
+		if s == d.Name {
+			return d.Key, nil
+		}
+	}
+	if !strings.Contains(s, ":") {
+		return "", fmt.Errorf("unknown dimension %q, expected namespace:name", s)
+	}
+	return s, nil
+}
+
+// StoreName names the dimension in the paths of caches, render state and
+// snapshots: by numeric id if it's vanilla, as it always was, and by
+// namespace/name if it's custom, so adding a datapack moves nothing else.
+func (d *Dimension) StoreName() string {
+	if d.ID != CUSTOMID {
+		return strconv.Itoa(d.ID)
+	}
+	return strings.Replace(d.Key, ":", "/", 1)
+}
+
+func (d *Dimension) Glob(index int, opts *Options) error {
+	files, err := filepath.Glob(filepath.Join(d.Path, GLOBPATTERN))
+	if err != nil {
+		return fatalError("Error globbing region files: ", err)
+	}
+	
+	// Worlds converted to Anvil keep their old region files around, so only
+	// fall back to MCRegion when there is nothing newer.
+	if len(files) == 0 {
+		files, err = filepath.Glob(filepath.Join(d.Path, LEGACYGLOBPATTERN))
+		if err != nil {
+			return fatalError("Error globbing legacy region files: ", err)
+		}
+	}
+	
+	for _, file := range files {
+		region := NewRegion(file)
+		region.Dimension = index
+		if !opts.Area.ContainsRegion(region) {
+			continue
+		}
+		
+		for _, output := range d.Outputs {
+			if output.Bounds == image.Rect(0, 0, 0, 0) {
+				output.Bounds = output.Mode.RegionBounds(region)
+			} else {
+				output.Bounds = output.Bounds.Union(output.Mode.RegionBounds(region))
+			}
+		}
+		
+		d.Regions = append(d.Regions, region)
+	}
+	
+	if opts.Area.Active {
+		for _, output := range d.Outputs {
+			output.Bounds = output.Bounds.Intersect(output.Mode.AreaBounds(opts.Area))
+		}
+	}
+	
+	sort.Sort(d.Regions)
+	return nil
+}
+
+func (d *Dimension) Create(opts *Options) error {
+	stream := opts.Stream
+	if over, memory := OverBudget(d, opts); over {
+		opts.Progress.Printf("Compositing a strip at a time, since the whole images would need an estimated %d MiB, over -max-memory %s", memory >> 20, &opts.MaxMemory)
+		stream = true
+	}
+	
+	mapped := opts.Mapped && !stream
+	if available := AvailableMemory(); !stream && available > 0 {
+		if canvas := CanvasBytes(d, opts); canvas > available {
+			opts.Progress.Printf("Keeping the images in memory-mapped files, since they need %d MiB and only %d MiB is available", canvas >> 20, available >> 20)
+			mapped = true
+		}
+	}
+	
+	for _, output := range d.Outputs {
+		if err := CheckCanvas(output, d.Regions, stream, opts); err != nil {
+			return fatalError("Image too large: ", err)
+		}
+		
+		var err error
+		if output.File, err = os.Create(output.Out); err != nil {
+			return fatalError("Error creating image file: ", err)
+		}
+		
+		opts.Progress.Printf("Max image dimensions: %+v", output.Bounds.Size())
+		output.Scale = Supersample(output.Mode, opts)
+		if stream {
+			if output.Stream, err = NewStream(filepath.Dir(output.Out)); err != nil {
+				return fatalError("Error creating layer buffer: ", err)
+			}
+			output.Stream.Background = opts.Background
+		} else if mapped {
+			if output.Mapped, err = NewMappedImage(filepath.Dir(output.Out), ScaleRect(output.Bounds, output.Scale)); err != nil {
+				return fatalError("Error mapping image file: ", err)
+			}
+			output.Img = output.Mapped.RGBA
+			opts.Background.Fill(output.Img)
+		} else {
+			output.Img = image.NewRGBA(ScaleRect(output.Bounds, output.Scale))
+			opts.Background.Fill(output.Img)
+		}
+	}
+	return nil
+}
+
+func (d *Dimension) Close() {
+	for _, output := range d.Outputs {
+		if output.File != nil {
+			output.File.Close()
+		}
+		if output.Stream != nil {
+			output.Stream.Close()
+		}
+		if output.Mapped != nil {
+			output.Mapped.Close()
+		}
+	}
+}
+
+func (d *Dimension) AddChunk(chunk Level, filter EntityFilter, opts *Options) {
+	if d.Chunks == 0 {
+		d.Blocks = TopDownMode{}.ChunkBounds(chunk)
+	} else {
+		d.Blocks = d.Blocks.Union(TopDownMode{}.ChunkBounds(chunk))
+	}
+	d.Chunks++
+	
+	for _, output := range d.Outputs {
+		if output.ChunkBounds == image.Rect(0, 0, 0, 0) {
+			output.ChunkBounds = output.Mode.ChunkBounds(chunk)
+		} else {
+			output.ChunkBounds = output.ChunkBounds.Union(output.Mode.ChunkBounds(chunk))
+		}
+	}
+	
+	d.setSurface(d.SurfaceHeights(chunk))
+	for _, entity := range ChunkEntities(chunk, filter, opts) {
+		d.Entities = append(d.Entities, entity)
+	}
+}
+
+// A SurfaceHeight is the height of the surface under a marker placed on it.
+type SurfaceHeight struct {
+	X, Y, Z int
+}
+
+// SurfaceHeights returns the height under each surface marker in chunk.
+func (d *Dimension) SurfaceHeights(chunk Level) (heights []SurfaceHeight) {
+	if len(chunk.HeightMap) != 256 {
+		return
+	}
+	for _, i := range d.surface[image.Pt(int(chunk.X), int(chunk.Z))] {
+		m := d.Markers[i]
+		heights = append(heights, SurfaceHeight{m.X, int(chunk.HeightMap[(m.Z & 15) << 4 + m.X & 15]), m.Z})
+	}
+	return
+}
+
+func (d *Dimension) setSurface(heights []SurfaceHeight) {
+	for _, h := range heights {
+		for _, i := range d.surface[image.Pt(h.X >> 4, h.Z >> 4)] {
+			if m := &d.Markers[i]; m.X == h.X && m.Z == h.Z {
+				m.Y = h.Y
+			}
+		}
+	}
+}
+
+// surfaceIn returns where the surface markers within region are.
+func (d *Dimension) surfaceIn(region Region) (points []image.Point) {
+	for chunk, markers := range d.surface {
+		if chunk.X >> 5 == region.X && chunk.Y >> 5 == region.Z {
+			for _, i := range markers {
+				points = append(points, image.Pt(d.Markers[i].X, d.Markers[i].Z))
+			}
+		}
+	}
+	return
+}
+
+// ChunkEntities returns the entities in chunk that filter draws.
+func ChunkEntities(chunk Level, filter EntityFilter, opts *Options) (entities []Entity) {
+	if !filter.Enabled() {
+		return
+	}
+	for _, entity := range chunk.Entities {
+		if x, _, z, ok := entity.Block(); ok && opts.Area.Contains(x, z) && filter.Match(entity) {
+			entities = append(entities, entity)
+		}
+	}
+	return
+}
+
+// FoundMarkers marks the blocks in chunk that -find asks for.
+func FoundMarkers(chunk Level, opts *Options) (markers []Marker) {
+	if opts.Find.Empty() {
+		return
+	}
+	for _, block := range chunk.FindBlocks(&opts.Find, opts.Area) {
+		markers = append(markers, block.Marker())
+	}
+	return
+}
+
+// AddCached adds what a cached region's chunks contribute besides their
+// layers, without decoding them.
+func (d *Dimension) AddCached(entry *LayerEntry, opts *Options) {
+	if entry.Chunks == 0 {
+		return
+	}
+	if d.Chunks == 0 {
+		d.Blocks = entry.Blocks
+	} else {
+		d.Blocks = d.Blocks.Union(entry.Blocks)
+	}
+	d.Chunks += entry.Chunks
+	
+	for _, output := range d.Outputs {
+		bounds := entry.find(output.Mode).ChunkBounds
+		if output.ChunkBounds == image.Rect(0, 0, 0, 0) {
+			output.ChunkBounds = bounds
+		} else {
+			output.ChunkBounds = output.ChunkBounds.Union(bounds)
+		}
+	}
+	
+	for _, entity := range entry.Entities {
+		d.Entities = append(d.Entities, entity)
+	}
+	d.AddMarkers(entry.Found, opts)
+	d.setSurface(entry.Surface)
+}
+
+func (d *Dimension) AddMarkers(markers []Marker, opts *Options) {
+	if d.surface == nil {
+		d.surface = make(map[image.Point][]int)
+	}
+	
+	for _, m := range markers {
+		if !opts.Area.Contains(m.X, m.Z) {
+			continue
+		}
+		
+		if m.Surface {
+			chunk := image.Pt(m.X >> 4, m.Z >> 4)
+			d.surface[chunk] = append(d.surface[chunk], len(d.Markers))
+		}
+		d.Markers = append(d.Markers, m)
+	}
+}
+
+func (d *Dimension) AddPaths(paths []Path) {
+	d.Paths = append(d.Paths, paths...)
+}
+
+func (d *Dimension) AddLayer(layer Layer) error {
+	for i, output := range d.Outputs {
+		img := layer.Imgs[i]
+		if output.Stream != nil {
+			if err := output.Stream.Add(img); err != nil {
+				return err
+			}
+		} else {
+			draw.Draw(output.Img, img.Bounds(), img, img.Bounds().Min, draw.Over)
+		}
+	}
+	return nil
+}
+
+func (d *Dimension) Finish(opts *Options) (jobs []EncodeJob, err error) {
+	if len(d.Entities) != 0 {
+		opts.Progress.Printf("Drawing %d entities...", len(d.Entities))
+		sort.Sort(d.Entities)
+	}
+	
+	if opts.Area.Active {
+		d.Blocks = d.Blocks.Intersect(TopDownMode{}.AreaBounds(opts.Area))
+	}
+	
+	for _, output := range d.Outputs {
+		if opts.Area.Active {
+			output.ChunkBounds = output.ChunkBounds.Intersect(output.Mode.AreaBounds(opts.Area))
+		}
+		if opts.Trim {
+			output.ChunkBounds = d.Trim(output, opts)
+		}
+		
+		opts.Progress.Printf("Rendered %s dimensions: %+v", output.Out, output.ChunkBounds.Size())
+		if opts.MarkerZooms > 0 && len(d.Markers) != 0 {
+			if err := WriteMarkerSet(output, d.Markers, opts.MarkerZooms); err != nil {
+				return nil, fatalError("Error writing marker set: ", err)
+			}
+		}
+		
+		info := d.MapInfo(output, opts.Progress.Elapsed())
+		if err := info.Write(MapInfoFilename(output.Out)); err != nil {
+			return nil, fatalError("Error writing map info: ", err)
+		}
+		
+		job, err := d.encoder(output, info.Text(), opts)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// encoder returns the job writing output as a PNG, or into an MBTiles file
+// when it's named like one, and cutting any tile pyramids asked for.
+func (d *Dimension) encoder(output *Output, text []PNGText, opts *Options) (EncodeJob, error) {
+	var tilers []TileWriter
+	if opts.DZI {
+		dzi, err := NewDZIWriter(DZIFilename(output.Out), output.ChunkBounds)
+		if err != nil {
+			return nil, fatalError("Error creating tile pyramid: ", err)
+		}
+		tilers = append(tilers, dzi)
+	}
+	
+	mbtiles := IsMBTiles(output.Out)
+	if mbtiles {
+		name := strings.TrimSuffix(filepath.Base(output.Out), filepath.Ext(output.Out))
+		tilers = append(tilers, NewMBTilesWriter(output.File, name, output.ChunkBounds))
+	}
+	
+	tile := func(strip image.Image) {
+		for _, t := range tilers {
+			t.Write(strip)
+		}
+	}
+	closeTiles := func() error {
+		for _, t := range tilers {
+			if err := t.Close(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	
+	if output.Stream != nil {
+		return func() error {
+			var err error
+			if mbtiles {
+				err = output.Stream.Composite(output.ChunkBounds, output.Scale, func(strip *image.RGBA) error {
+					d.Overlay(strip, output, opts)
+					tile(strip)
+					return nil
+				})
+			} else {
+				err = output.Stream.Encode(output.File, output.ChunkBounds, output.Scale, text, func(strip *image.RGBA) {
+					d.Overlay(strip, output, opts)
+					tile(strip)
+				})
+			}
+			if err != nil {
+				return err
+			}
+			return closeTiles()
+		}, nil
+	}
+	
+	if output.Scale > 1 {
+		output.Img = Downsample(output.Img.SubImage(ScaleRect(output.ChunkBounds, output.Scale)).(*image.RGBA), output.Scale)
+	}
+	d.Overlay(output.Img, output, opts)
+	return func() error {
+		if !mbtiles {
+			if err := png.Encode(&pngTextWriter{w: output.File, text: text}, output.Img.SubImage(output.ChunkBounds)); err != nil {
+				return err
+			}
+		}
+		
+		b := output.ChunkBounds
+		for y := b.Min.Y; y < b.Max.Y && len(tilers) != 0; y += STRIPHEIGHT {
+			tile(output.Img.SubImage(image.Rect(b.Min.X, y, b.Max.X, Min(y + STRIPHEIGHT, b.Max.Y))))
+		}
+		return closeTiles()
+	}, nil
+}
+
+// Overlay draws the dimension's overlays over img.
+func (d *Dimension) Overlay(img *image.RGBA, output *Output, opts *Options) {
+	for _, overlay := range d.Overlays(opts) {
+		overlay.DrawOver(img, output.Mode, output.ChunkBounds, opts)
+	}
+}
+
+// Overlays returns what's drawn over the dimension's images: the other
+// dimension, entities, paths, markers, axes and the title, then any in
+// opts.Overlays.
+func (d *Dimension) Overlays(opts *Options) []Overlay {
+	overlays := []Overlay{EntityOverlay(d.Entities), PathOverlay(d.Paths), MarkerOverlay(d.Markers), AxesOverlay{}, TitleOverlay(opts.Title)}
+	if d.Other != nil {
+		overlays = append([]Overlay{d.Other}, overlays...)
+	}
+	return append(overlays, opts.Overlays...)
+}
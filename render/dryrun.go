@@ -0,0 +1,82 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DryRun reports what rendering dimensions would take, from the headers of the
+// region files alone: how many regions and chunks each dimension has, and
+// how large each image could grow and the memory it's estimated to need.
+func DryRun(dimensions []*Dimension, opts *Options) error {
+	var regions, chunks int
+	for i, dimension := range dimensions {
+		if err := dimension.Glob(i, opts); err != nil {
+			return err
+		}
+		if err := dimension.CheckFormat(); err != nil {
+			return fatalError("Error reading world: ", err)
+		}
+		name := dimension.Name
+		if name == "" {
+			name = dimension.Path
+		}
+		
+		count := 0
+		for _, r := range dimension.Regions {
+			n, err := CountChunks(r.(Region), opts.Area)
+			if err != nil {
+				opts.Progress.Warnf("Error reading %s: %s", filepath.Base(r.(Region).Path), err)
+			}
+			count += n
+		}
+		regions, chunks = regions + len(dimension.Regions), chunks + count
+		opts.Progress.Printf("%s: %d regions, %d chunks", name, len(dimension.Regions), count)
+		if len(dimension.Regions) == 0 {
+			continue
+		}
+		
+		over, _ := OverBudget(dimension, opts)
+		stream := opts.Stream || over
+		for _, output := range dimension.Outputs {
+			scale := Supersample(output.Mode, opts)
+			size := ScaleRect(output.Bounds, scale).Size()
+			memory := EstimateMemory(output.Mode, output.Bounds, dimension.Regions, opts.Drawers, scale, stream)
+			how := "whole"
+			if stream {
+				how = "a strip at a time"
+			}
+			opts.Progress.Printf("%s: %s up to %dx%d, needing an estimated %d MiB composited %s", output.Out, output.Mode.Name(), size.X, size.Y, memory >> 20, how)
+			if err := CheckCanvas(output, dimension.Regions, stream, opts); err != nil {
+				opts.Progress.Warnf("%s won't render: %s", output.Out, err)
+			}
+		}
+	}
+	opts.Progress.Printf("%d regions and %d chunks in all; nothing was rendered (-dry-run)", regions, chunks)
+	return nil
+}
+
+// CountChunks counts the chunks a region file's header lists within area.
+func CountChunks(region Region, area Area) (int, error) {
+	regionFile, err := os.Open(region.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer regionFile.Close()
+	
+	stat, err := regionFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+	
+	var header Header
+	header.Read(regionFile)
+	
+	count := 0
+	for i, location := range header.Locations {
+		if location.Valid(stat.Size()) && area.ContainsChunk(region.X << 5 + i & 31, region.Z << 5 + i >> 5) {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,71 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"image"
+	"strings"
+	"image/png"
+	"path/filepath"
+)
+
+// DZIFilename turns map.png into map.dzi. Tiles go in map_files beside it.
+func DZIFilename(out string) string {
+	return strings.TrimSuffix(out, filepath.Ext(out)) + ".dzi"
+}
+
+// A DZIWriter cuts an image into a Deep Zoom tile pyramid for OpenSeadragon
+// and the like, down to a single pixel at level 0.
+type DZIWriter struct {
+	*Pyramid
+	Filename string
+	
+	dir string
+}
+
+func NewDZIWriter(filename string, bounds image.Rectangle) (*DZIWriter, error) {
+	w := &DZIWriter{Filename: filename}
+	w.dir = strings.TrimSuffix(filename, filepath.Ext(filename)) + "_files"
+	if err := os.RemoveAll(w.dir); err != nil {
+		return nil, err
+	}
+	
+	levels := PyramidLevels(bounds, 1)
+	for i := 0; i < levels; i++ {
+		if err := os.MkdirAll(filepath.Join(w.dir, fmt.Sprint(i)), 0755); err != nil {
+			return nil, err
+		}
+	}
+	w.Pyramid = NewPyramid(bounds, levels, w.tile)
+	return w, nil
+}
+
+func (w *DZIWriter) tile(level, col, row int, tile *image.RGBA) error {
+	tileFile, err := os.Create(filepath.Join(w.dir, fmt.Sprint(level), fmt.Sprintf("%d_%d.png", col, row)))
+	if err != nil {
+		return err
+	}
+	defer tileFile.Close()
+	
+	return png.Encode(tileFile, tile)
+}
+
+// Close writes any tiles still held and the .dzi descriptor.
+func (w *DZIWriter) Close() error {
+	if err := w.Pyramid.Close(); err != nil {
+		return err
+	}
+	
+	dziFile, err := os.Create(w.Filename)
+	if err != nil {
+		return err
+	}
+	defer dziFile.Close()
+	
+	_, err = fmt.Fprintf(dziFile, `<?xml version="1.0" encoding="UTF-8"?>
+<Image xmlns="http://schemas.microsoft.com/deepzoom/2008" Format="png" Overlap="0" TileSize="%d">
+<Size Width="%d" Height="%d"/>
+</Image>
+`, TILESIZE, w.Bounds.Dx(), w.Bounds.Dy())
+	return err
+}
@@ -0,0 +1,149 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"image"
+	"strings"
+	"image/color"
+)
+
+const (
+	// SEALEVEL is the height of the air above the sea's surface.
+	SEALEVEL = 63
+	
+	// SEADEPTH is how deep water must be to take the deepest blue.
+	SEADEPTH = 32
+)
+
+// A GradientStop colors one height of an elevation Gradient.
+type GradientStop struct {
+	Y int
+	Color color.RGBA
+}
+
+// A Gradient colors heights between its stops, in order of height, by
+// blending the stops either side; heights beyond the ends take the color of
+// the nearest.
+type Gradient []GradientStop
+
+// DefaultElevation is a hypsometric tint from lowland green at the shore up
+// through yellows and browns to snow at the top of the world.
+var DefaultElevation = Gradient{
+	{SEALEVEL, color.RGBA{0x4F, 0x9A, 0x4A, 0xFF}},
+	{80, color.RGBA{0xA7, 0xC7, 0x6A, 0xFF}},
+	{100, color.RGBA{0xE8, 0xD8, 0x8A, 0xFF}},
+	{130, color.RGBA{0xC4, 0x9A, 0x5A, 0xFF}},
+	{170, color.RGBA{0x8A, 0x6A, 0x4A, 0xFF}},
+	{210, color.RGBA{0xDC, 0xDC, 0xDC, 0xFF}},
+	{255, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}},
+}
+
+// seaGradient colors water by its depth rather than its height.
+var seaGradient = Gradient{
+	{1, color.RGBA{0x9E, 0xCA, 0xE1, 0xFF}},
+	{SEADEPTH / 4, color.RGBA{0x42, 0x92, 0xC6, 0xFF}},
+	{SEADEPTH, color.RGBA{0x08, 0x30, 0x6B, 0xFF}},
+}
+
+func (g *Gradient) String() string {
+	stops := make([]string, len(*g))
+	for i, stop := range *g {
+		stops[i] = fmt.Sprintf("%d:%s", stop.Y, Hex(stop.Color))
+	}
+	return strings.Join(stops, ",")
+}
+
+func (g *Gradient) Set(s string) error {
+	*g = nil
+	for _, stop := range strings.Split(s, ",") {
+		var y int
+		var hex string
+		if _, err := fmt.Sscanf(strings.Replace(strings.TrimSpace(stop), ":", " ", 1), "%d %s", &y, &hex); err != nil {
+			return fmt.Errorf("invalid gradient stop %q, expected y:#rrggbb", stop)
+		}
+		c, err := ParseHex(hex)
+		if err != nil {
+			return fmt.Errorf("invalid gradient stop %q: %s", stop, err)
+		}
+		*g = append(*g, GradientStop{y, c})
+	}
+	sort.SliceStable(*g, func(i, j int) bool {
+		return (*g)[i].Y < (*g)[j].Y
+	})
+	return nil
+}
+
+// At returns the color of height y.
+func (g Gradient) At(y int) color.RGBA {
+	if len(g) == 0 {
+		return color.RGBA{}
+	}
+	if y <= g[0].Y {
+		return g[0].Color
+	}
+	for i := 1; i < len(g); i++ {
+		if y <= g[i].Y {
+			a, b := g[i - 1], g[i]
+			return Blend(a.Color, b.Color, byte((y - a.Y) * 0xFF / (b.Y - a.Y)))
+		}
+	}
+	return g[len(g) - 1].Color
+}
+
+// ElevationMode draws one pixel per column like TopDownMode, colored by the
+// height of its surface through -elevation-gradient whatever the blocks
+// there, and water by its depth in blues. Leaves and other translucent
+// blocks are looked through to the ground.
+type ElevationMode struct {
+	TopDownMode
+}
+
+func (ElevationMode) Name() string {
+	return "elevation"
+}
+
+func (ElevationMode) Draw(img *image.RGBA, l Level, n Neighborhood, opts *Options) {
+	gradient := opts.Elevation
+	if len(gradient) == 0 {
+		gradient = DefaultElevation
+	}
+	
+	sections := l.SectionTable()
+	hidden := opts.Filter.Hidden()
+	for z := 0; z < 16; z++ {
+		for x := 0; x < 16; x++ {
+			wx, wz := int(l.X) << 4 + x, int(l.Z) << 4 + z
+			if !opts.Area.Contains(wx, wz) {
+				continue
+			}
+			
+			y, block, found := surface(sections, x, z, &hidden)
+			if !found {
+				continue
+			}
+			c := gradient.At(y)
+			if IsWater(block) {
+				c = seaGradient.At(WaterDepth(sections, x, y, z))
+			}
+			if height, known := n.Height(wx, wz); opts.Shadows && known && opts.Sun.Shadowed(n, wx, height - 1, wz) {
+				c = Blend(c, shadowColor, SHADOWALPHA)
+			}
+			img.SetRGBA(wx, wz, c)
+		}
+	}
+}
+
+// surface finds the highest block of a column that is water or opaque.
+func surface(sections [16]*Section, x, z int, hidden *BlockSet) (int, byte, bool) {
+	for y := 255; y >= 0; y-- {
+		block := BlockAt(sections, x, y, z)
+		if hidden[block] {
+			continue
+		}
+		if c, exists := blockColors[block]; exists && c.Alpha == 0xFF || IsWater(block) {
+			return y, block, true
+		}
+	}
+	return 0, 0, false
+}
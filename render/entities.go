@@ -0,0 +1,177 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"image/draw"
+	"image/color"
+)
+
+var (
+	entityColors map[string]color.RGBA
+	entityNames map[string]string
+	entityDefault = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	entityOutline = color.RGBA{0x00, 0x00, 0x00, 0xff}
+)
+
+type Entity struct {
+	ID string `nbt:"id"`
+	Pos []float64
+}
+
+func (e Entity) String() string {
+	return fmt.Sprintf("{ID: %s Pos: %0.1f}", e.ID, e.Pos)
+}
+
+func (e Entity) Block() (x, y, z int, ok bool) {
+	if len(e.Pos) != 3 {
+		return 0, 0, 0, false
+	}
+	return Floor(e.Pos[0]), Floor(e.Pos[1]), Floor(e.Pos[2]), true
+}
+
+func (e Entity) GetPos() (int, int) {
+	x, _, z, _ := e.Block()
+	return x, z
+}
+
+func (e Entity) Color() color.RGBA {
+	if c, exists := entityColors[entityKey(e.ID)]; exists {
+		return c
+	}
+	return entityDefault
+}
+
+// entityKey gives the name an entity ID is looked up by: lower case, without
+// the minecraft: namespace of 1.11 on, and renamed back to the name it had
+// before if it's been renamed since.
+func entityKey(id string) string {
+	id = strings.ToLower(strings.TrimPrefix(id, "minecraft:"))
+	if name, exists := entityNames[id]; exists {
+		return name
+	}
+	return id
+}
+
+func Floor(f float64) int {
+	i := int(f)
+	if f < 0 && float64(i) != f {
+		i--
+	}
+	return i
+}
+
+type EntityFilter map[string]bool
+
+func NewEntityFilter(types string) EntityFilter {
+	filter := make(EntityFilter)
+	for _, t := range strings.Split(types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter[entityKey(t)] = true
+		}
+	}
+	return filter
+}
+
+func (f EntityFilter) Enabled() bool {
+	return len(f) != 0
+}
+
+func (f EntityFilter) Match(e Entity) bool {
+	return f["all"] || f[entityKey(e.ID)]
+}
+
+func DrawEntity(img *image.RGBA, mode Mode, e Entity) {
+	x, y, z, ok := e.Block()
+	if !ok {
+		return
+	}
+	
+	xISO, yISO := mode.Project(x, y, z)
+	draw.Draw(img, image.Rect(xISO - 2, yISO - 1, xISO + 2, yISO + 3), image.NewUniform(entityOutline), image.ZP, draw.Src)
+	draw.Draw(img, image.Rect(xISO - 1, yISO, xISO + 1, yISO + 2), image.NewUniform(e.Color()), image.ZP, draw.Src)
+}
+
+func init() {
+	entityColors = map[string]color.RGBA{
+		// Hostile mobs
+		"creeper": {0x3f, 0xd0, 0x3f, 0xff},
+		"skeleton": {0xd8, 0xd8, 0xd8, 0xff},
+		"spider": {0x5a, 0x30, 0x30, 0xff},
+		"cavespider": {0x0c, 0x52, 0x5c, 0xff},
+		"zombie": {0x2f, 0x7a, 0x5a, 0xff},
+		"pigzombie": {0xe0, 0x9a, 0x9a, 0xff},
+		"slime": {0x7e, 0xbf, 0x6e, 0xff},
+		"lavaslime": {0x6b, 0x1a, 0x0a, 0xff},
+		"ghast": {0xf0, 0xf0, 0xf0, 0xff},
+		"enderman": {0x16, 0x16, 0x16, 0xff},
+		"silverfish": {0x8a, 0x8a, 0x8a, 0xff},
+		"blaze": {0xf6, 0xb2, 0x01, 0xff},
+		"witch": {0x34, 0x00, 0x00, 0xff},
+		"enderdragon": {0x1c, 0x00, 0x2c, 0xff},
+		
+		// Passive mobs
+		"villager": {0x56, 0x3c, 0x33, 0xff},
+		"villagergolem": {0xdb, 0xcd, 0xc2, 0xff},
+		"snowman": {0xfe, 0xfe, 0xfe, 0xff},
+		"pig": {0xf0, 0xa5, 0xa2, 0xff},
+		"sheep": {0xe7, 0xe7, 0xe7, 0xff},
+		"cow": {0x44, 0x36, 0x26, 0xff},
+		"mushroomcow": {0xa0, 0x0d, 0x10, 0xff},
+		"chicken": {0xa1, 0xa1, 0xa1, 0xff},
+		"squid": {0x22, 0x3b, 0x4d, 0xff},
+		"wolf": {0xd7, 0xd3, 0xd3, 0xff},
+		"ozelot": {0xef, 0xde, 0x7d, 0xff},
+		
+		// Objects
+		"itemframe": {0xff, 0x00, 0xff, 0xff},
+		"armorstand": {0x00, 0xff, 0xff, 0xff},
+		"painting": {0xff, 0x80, 0x00, 0xff},
+		"boat": {0x9d, 0x80, 0x4f, 0xff},
+		"minecart": {0x60, 0x60, 0x60, 0xff},
+		"item": {0xff, 0xff, 0x00, 0xff},
+		"xporb": {0xa0, 0xff, 0x20, 0xff},
+		"primedtnt": {0xff, 0x00, 0x00, 0xff},
+		"fallingsand": {0xdb, 0xd3, 0xa0, 0xff},
+		"endercrystal": {0xff, 0x60, 0xff, 0xff},
+	}
+	
+	// IDs from 1.11 on that differ from the names above by more than case.
+	entityNames = map[string]string{
+		"cave_spider": "cavespider",
+		"zombie_pigman": "pigzombie",
+		"zombified_piglin": "pigzombie",
+		"magma_cube": "lavaslime",
+		"ender_dragon": "enderdragon",
+		"villager_golem": "villagergolem",
+		"iron_golem": "villagergolem",
+		"snow_golem": "snowman",
+		"mooshroom": "mushroomcow",
+		"ocelot": "ozelot",
+		"item_frame": "itemframe",
+		"glow_item_frame": "itemframe",
+		"armor_stand": "armorstand",
+		"chest_boat": "boat",
+		"minecartrideable": "minecart",
+		"chest_minecart": "minecart",
+		"minecartchest": "minecart",
+		"furnace_minecart": "minecart",
+		"minecartfurnace": "minecart",
+		"hopper_minecart": "minecart",
+		"minecarthopper": "minecart",
+		"tnt_minecart": "minecart",
+		"minecarttnt": "minecart",
+		"spawner_minecart": "minecart",
+		"minecartspawner": "minecart",
+		"commandblock_minecart": "minecart",
+		"command_block_minecart": "minecart",
+		"minecartcommandblock": "minecart",
+		"xp_orb": "xporb",
+		"experience_orb": "xporb",
+		"tnt": "primedtnt",
+		"falling_block": "fallingsand",
+		"ender_crystal": "endercrystal",
+		"end_crystal": "endercrystal",
+	}
+}
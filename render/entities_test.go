@@ -0,0 +1,53 @@
+package render
+
+import (
+	"testing"
+)
+
+func TestEntityColor(t *testing.T) {
+	for _, test := range []struct {
+		id, name string
+	}{
+		{"Creeper", "creeper"},
+		{"minecraft:creeper", "creeper"},
+		{"LavaSlime", "lavaslime"},
+		{"minecraft:magma_cube", "lavaslime"},
+		{"minecraft:slime", "slime"},
+		{"PigZombie", "pigzombie"},
+		{"minecraft:zombie_pigman", "pigzombie"},
+		{"minecraft:zombified_piglin", "pigzombie"},
+		{"minecraft:cave_spider", "cavespider"},
+		{"minecraft:iron_golem", "villagergolem"},
+		{"minecraft:item_frame", "itemframe"},
+		{"MinecartChest", "minecart"},
+		{"minecraft:hopper_minecart", "minecart"},
+		{"minecraft:tnt", "primedtnt"},
+		{"minecraft:end_crystal", "endercrystal"},
+	} {
+		if got, want := (Entity{ID: test.id}).Color(), entityColors[test.name]; got != want {
+			t.Errorf("%s: color %v, want %s's %v", test.id, got, test.name, want)
+		}
+	}
+	if got := (Entity{ID: "minecraft:axolotl"}).Color(); got != entityDefault {
+		t.Errorf("minecraft:axolotl: color %v, want the default", got)
+	}
+}
+
+func TestEntityFilter(t *testing.T) {
+	filter := NewEntityFilter(" LavaSlime, minecraft:cave_spider,")
+	for id, want := range map[string]bool{
+		"LavaSlime": true,
+		"minecraft:magma_cube": true,
+		"CaveSpider": true,
+		"minecraft:cave_spider": true,
+		"minecraft:slime": false,
+		"Spider": false,
+	} {
+		if got := filter.Match(Entity{ID: id}); got != want {
+			t.Errorf("%s: matched %t, want %t", id, got, want)
+		}
+	}
+	if !NewEntityFilter("all").Match(Entity{ID: "minecraft:axolotl"}) {
+		t.Error("all didn't match minecraft:axolotl")
+	}
+}
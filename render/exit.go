@@ -0,0 +1,100 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"log"
+	"flag"
+	"errors"
+)
+
+// Exit statuses, so scripts can tell what went wrong without reading the
+// output. Any other fatal error, such as failing to read or write a file,
+// exits with ExitFatal, as errhandler does.
+const (
+	ExitFatal = 1
+	ExitUsage = 2
+	ExitNoRegions = 3
+	ExitPalette = 4
+	
+	// ExitSkipped is for renders that finished but left out corrupt chunks.
+	ExitSkipped = 5
+)
+
+// An ExitError is an error a render returns rather than ending the program,
+// with the message errhandler would have prefixed it with and the status
+// the commands exit with for it.
+type ExitError struct {
+	Status int
+	Msg string
+	Err error
+	
+	// Reported is set if the error has been reported already, as the flag
+	// package does its errors, so it's only exited with.
+	Reported bool
+}
+
+func (e *ExitError) Error() string {
+	return e.Msg + e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// exitError returns err, if set, as an ExitError with status.
+func exitError(status int, msg string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ExitError{Status: status, Msg: msg, Err: err}
+}
+
+// fatalError returns err, if set, as an ExitError with ExitFatal.
+func fatalError(msg string, err error) error {
+	return exitError(ExitFatal, msg, err)
+}
+
+// ErrSkipped ends a render that finished but left out corrupt chunks, which
+// it has reported already.
+var ErrSkipped = &ExitError{Status: ExitSkipped, Err: errors.New("corrupt chunks were skipped"), Reported: true}
+
+// parseFlags parses args into flags as flag.ExitOnError would, but returning
+// the status to exit with rather than exiting. The flags report their errors
+// themselves, so -h is an error exiting successfully.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	switch err := flags.Parse(args); err {
+	case nil:
+		return nil
+	case flag.ErrHelp:
+		return &ExitError{Status: 0, Err: err, Reported: true}
+	default:
+		return &ExitError{Status: ExitUsage, Err: err, Reported: true}
+	}
+}
+
+// usageError is for commands given the wrong arguments, after printing how
+// to use them.
+func usageError(format string, args ...interface{}) error {
+	return &ExitError{Status: ExitUsage, Err: fmt.Errorf(format, args...), Reported: true}
+}
+
+// HandleError ends the program if err is set, with the status of the
+// ExitError it wraps or ExitFatal. Only the gocart command should call it:
+// everything else returns its errors.
+func HandleError(err error) {
+	if err == nil {
+		return
+	}
+	
+	status := ExitFatal
+	var exit *ExitError
+	if errors.As(err, &exit) {
+		status = exit.Status
+		if exit.Reported {
+			os.Exit(status)
+		}
+	}
+	log.Print(err)
+	os.Exit(status)
+}
@@ -0,0 +1,251 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"flag"
+	"sync"
+	"image"
+	"strings"
+	"image/png"
+	"image/color"
+	"path/filepath"
+)
+
+var (
+	populatedColor = color.RGBA{0x6C, 0xB0, 0x4C, 0xFF}
+	unpopulatedColor = color.RGBA{0xE0, 0xC0, 0x40, 0xFF}
+	brokenColor = color.RGBA{0xD0, 0x30, 0x30, 0xFF}
+)
+
+// An ExploredChunk is a chunk present in a region file, with the bytes of
+// the file it takes up, kept in its own .mcc file if External. Chunks that
+// record neither TerrainPopulated nor a Status known to be before or after
+// population are Unknown, and counted as populated.
+type ExploredChunk struct {
+	X, Z int
+	Offset, Size int64
+	Populated, Unknown, External bool
+	Err error
+}
+
+// ExploreRegion lists the chunks in a region file, decoding each only as far
+// as whether its terrain has been populated.
+func ExploreRegion(region Region) ([]ExploredChunk, error) {
+	regionFile, err := os.Open(region.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer regionFile.Close()
+	
+	stat, err := regionFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	
+	var header Header
+	header.Read(regionFile)
+	
+	var chunks []ExploredChunk
+	for i, location := range header.Locations {
+		if !location.Valid(stat.Size()) {
+			continue
+		}
+		
+		c := ExploredChunk{X: region.X << 5 + i & 31, Z: region.Z << 5 + i >> 5, Offset: location.Start(), Size: location.Size()}
+		raw := RawChunk{X: c.X, Z: c.Z, Legacy: region.Legacy}
+		c.Err = raw.Read(io.NewSectionReader(regionFile, location.Start(), location.Size()))
+		if c.Err == nil && raw.External() {
+			c.External = true
+			c.Err = raw.ReadExternal(filepath.Dir(region.Path))
+		}
+		var data []byte
+		if c.Err == nil {
+			data, c.Err = raw.Decompress()
+		}
+		if c.Err == nil {
+			c.Populated, c.Unknown, c.Err = terrainPopulated(data)
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, nil
+}
+
+// unpopulatedStatuses are the generation stages of 1.13+ chunks before
+// features are placed, which the game carries on from when they're needed.
+var unpopulatedStatuses = map[string]bool{
+	"empty": true,
+	"structure_starts": true,
+	"structure_references": true,
+	"biomes": true,
+	"noise": true,
+	"surface": true,
+	"carvers": true,
+	"liquid_carvers": true,
+	"base": true,
+	"carved": true,
+	"liquid_carved": true,
+}
+
+// populatedStatuses are the stages from features on.
+var populatedStatuses = map[string]bool{
+	"features": true,
+	"decorated": true,
+	"initialize_light": true,
+	"light": true,
+	"lighted": true,
+	"spawn": true,
+	"mobs_spawned": true,
+	"heightmaps": true,
+	"finalized": true,
+	"full": true,
+	"fullchunk": true,
+	"postprocessed": true,
+}
+
+// terrainPopulated reads whether a chunk has been populated from its
+// TerrainPopulated tag before 1.13, or its Status since, under Level until
+// 1.18 and at the top level after. Chunks with neither are unknown.
+func terrainPopulated(data []byte) (populated, unknown bool, err error) {
+	root, err := ReadNBTTree(data)
+	if err != nil {
+		return
+	}
+	level, ok := root["Level"].(map[string]interface{})
+	if !ok {
+		level = root
+	}
+	
+	if populated, ok := level["TerrainPopulated"].(int8); ok {
+		return populated == 1, false, nil
+	}
+	if status, ok := level["Status"].(string); ok {
+		status = strings.TrimPrefix(status, "minecraft:")
+		switch {
+		case unpopulatedStatuses[status]:
+			return false, false, nil
+		case populatedStatuses[status]:
+			return true, false, nil
+		}
+	}
+	return true, true, nil
+}
+
+// ExploredImage draws one pixel per chunk: green where the terrain has been
+// populated, yellow where it's only been generated, red where it can't be
+// read.
+func ExploredImage(chunks []ExploredChunk) *image.RGBA {
+	var bounds image.Rectangle
+	for i, c := range chunks {
+		r := image.Rect(c.X, c.Z, c.X + 1, c.Z + 1)
+		if i == 0 {
+			bounds = r
+		} else {
+			bounds = bounds.Union(r)
+		}
+	}
+	
+	img := image.NewRGBA(bounds)
+	for _, c := range chunks {
+		switch {
+		case c.Err != nil:
+			img.SetRGBA(c.X, c.Z, brokenColor)
+		case c.Populated:
+			img.SetRGBA(c.X, c.Z, populatedColor)
+		default:
+			img.SetRGBA(c.X, c.Z, unpopulatedColor)
+		}
+	}
+	return img
+}
+
+// Explored maps which chunks of a world exist, one pixel each, and reports
+// how much of its region files pruning unpopulated chunks would free.
+func Explored(args []string) error {
+	var (
+		dir, outFilename string
+		opts Options
+	)
+	
+	flags := flag.NewFlagSet("explored", flag.ContinueOnError)
+	flags.StringVar(&dir, "dir", DIR, "Read region files from the world or dimension at this directory.")
+	flags.StringVar(&outFilename, "out", "explored.png", "Write the map to this file.")
+	flags.Var(&opts.Area, "area", "Only map regions within x0,z0,x1,z1 (world coordinates).")
+	opts.Progress.Flags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	
+	opts.Auto()
+	opts.Progress.Start()
+	
+	dimension := &Dimension{Path: dir}
+	if err := dimension.Glob(0, &opts); err != nil {
+		return err
+	}
+	if len(dimension.Regions) == 0 {
+		return exitError(ExitNoRegions, "Error reading world: ", fmt.Errorf("no region files found in %s", dir))
+	}
+	
+	var (
+		mu sync.Mutex
+		chunks []ExploredChunk
+	)
+	work := make(chan Region)
+	done := make(chan bool)
+	Spawn(opts.Readers, func() {
+		for region := range work {
+			found, err := ExploreRegion(region)
+			if err != nil {
+				opts.Progress.Warnf("Error reading %s: %s", filepath.Base(region.Path), err)
+			}
+			for _, c := range found {
+				if c.Err != nil {
+					opts.Progress.ChunkError(ChunkError{filepath.Base(region.Path), c.X, c.Z, c.Offset, c.Err})
+				}
+			}
+			mu.Lock()
+			chunks = append(chunks, found...)
+			mu.Unlock()
+		}
+	}, func() {
+		close(done)
+	})
+	for _, region := range dimension.Regions {
+		work <- region.(Region)
+	}
+	close(work)
+	<-done
+	
+	if len(chunks) == 0 {
+		return fatalError("Error reading world: ", fmt.Errorf("no chunks found in %s", dir))
+	}
+	
+	outFile, err := os.Create(outFilename)
+	if err != nil {
+		return fatalError("Error creating image: ", err)
+	}
+	defer outFile.Close()
+	if err := png.Encode(outFile, ExploredImage(chunks)); err != nil {
+		return fatalError("Error encoding image: ", err)
+	}
+	
+	var populated, unknown int
+	var prunable int64
+	for _, c := range chunks {
+		if c.Unknown {
+			unknown++
+		}
+		if c.Populated {
+			populated++
+		} else if c.Err == nil {
+			prunable += c.Size
+		}
+	}
+	if unknown != 0 {
+		opts.Progress.Warnf("%d chunks record neither TerrainPopulated nor a known Status, so are counted as populated", unknown)
+	}
+	opts.Progress.Printf("%d chunks in %d regions, %d populated; pruning the rest would free %.1f MiB", len(chunks), len(dimension.Regions), populated, float64(prunable) / (1 << 20))
+	return nil
+}
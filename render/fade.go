@@ -0,0 +1,83 @@
+package render
+
+import (
+	"fmt"
+	"time"
+	"image/color"
+)
+
+type FadeStyle string
+
+const (
+	FadeSepia FadeStyle = "sepia"
+	FadeGray FadeStyle = "gray"
+)
+
+func (s *FadeStyle) String() string {
+	return string(*s)
+}
+
+func (s *FadeStyle) Set(v string) error {
+	switch FadeStyle(v) {
+	case FadeSepia, FadeGray:
+		*s = FadeStyle(v)
+		return nil
+	}
+	return fmt.Errorf("unknown fade style %q, expected sepia or gray", v)
+}
+
+// Fade blends chunks toward sepia or grayscale by how long ago they were
+// last saved, reaching full strength at Duration.
+type Fade struct {
+	Duration time.Duration
+	Style FadeStyle
+	Now time.Time
+}
+
+func (f Fade) Amount(l Level) float64 {
+	if f.Duration <= 0 || l.Modified == 0 {
+		return 0
+	}
+	
+	age := f.Now.Sub(time.Unix(l.Modified, 0))
+	if age <= 0 {
+		return 0
+	}
+	if age >= f.Duration {
+		return 1
+	}
+	return float64(age) / float64(f.Duration)
+}
+
+func (f Fade) Color(c color.RGBA, amount float64) color.RGBA {
+	if amount <= 0 {
+		return c
+	}
+	
+	r, g, b := float64(c.R), float64(c.G), float64(c.B)
+	var tr, tg, tb float64
+	if f.Style == FadeGray {
+		tr = 0.299 * r + 0.587 * g + 0.114 * b
+		tg, tb = tr, tr
+	} else {
+		tr = 0.393 * r + 0.769 * g + 0.189 * b
+		tg = 0.349 * r + 0.686 * g + 0.168 * b
+		tb = 0.272 * r + 0.534 * g + 0.131 * b
+	}
+	
+	mix := func(from, to float64) uint8 {
+		v := from + (to - from) * amount
+		if v > 255 {
+			v = 255
+		}
+		return uint8(v)
+	}
+	return color.RGBA{mix(r, tr), mix(g, tg), mix(b, tb), c.A}
+}
+
+func (f Fade) Block(c BlockColor, amount float64) BlockColor {
+	c.Top = f.Color(c.Top, amount)
+	c.Left = f.Color(c.Left, amount)
+	c.Right = f.Color(c.Right, amount)
+	return c
+}
@@ -0,0 +1,250 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"flag"
+	"sort"
+	"sync"
+	"strconv"
+	"strings"
+	"encoding/csv"
+	"encoding/json"
+)
+
+// A BlockSet selects block IDs, e.g. for searching.
+type BlockSet [256]bool
+
+func normalizeBlockName(name string) string {
+	name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "minecraft:")
+	return strings.NewReplacer("_", "", " ", "", "-", "").Replace(name)
+}
+
+// ParseBlock reads a block ID or name. Names are matched ignoring case and
+// underscores, so mob_spawner, MobSpawner and minecraft:mob_spawner are all
+// the same block.
+func ParseBlock(s string) (byte, error) {
+	if n, err := strconv.ParseUint(strings.TrimSpace(s), 0, 8); err == nil {
+		return byte(n), nil
+	}
+	
+	normalized := normalizeBlockName(s)
+	for id, name := range blockNames {
+		if normalizeBlockName(name) == normalized {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown block %q", s)
+}
+
+// ParseBlockSet reads comma-separated block IDs or names.
+func ParseBlockSet(s string) (set BlockSet, err error) {
+	for _, token := range strings.Split(s, ",") {
+		if strings.TrimSpace(token) == "" {
+			continue
+		}
+		id, err := ParseBlock(token)
+		if err != nil {
+			return set, err
+		}
+		set[id] = true
+	}
+	return
+}
+
+func (s *BlockSet) String() string {
+	var names []string
+	for id, selected := range s {
+		if selected {
+			names = append(names, BlockName(byte(id)))
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func (s *BlockSet) Set(v string) (err error) {
+	*s, err = ParseBlockSet(v)
+	return
+}
+
+func (s *BlockSet) Empty() bool {
+	for _, selected := range s {
+		if selected {
+			return false
+		}
+	}
+	return true
+}
+
+// A BlockFilter leaves blocks out of renders: those in Hide and, when Only
+// isn't empty, any not in Only.
+type BlockFilter struct {
+	Hide, Only BlockSet
+}
+
+// Hidden returns every block the filter leaves out.
+func (f *BlockFilter) Hidden() (hidden BlockSet) {
+	only := !f.Only.Empty()
+	for id := range hidden {
+		hidden[id] = f.Hide[id] || only && !f.Only[id]
+	}
+	return
+}
+
+type FoundBlock struct {
+	Dimension string `json:"dimension,omitempty"`
+	ID byte `json:"-"`
+	Block string `json:"block"`
+	X int `json:"x"`
+	Y int `json:"y"`
+	Z int `json:"z"`
+}
+
+// Marker shows the block in its own top color.
+func (b FoundBlock) Marker() Marker {
+	return Marker{X: b.X, Y: b.Y, Z: b.Z, Color: blockColors[b.ID].Top}
+}
+
+// FindBlocks returns every block in the chunk that is in the set.
+func (l Level) FindBlocks(set *BlockSet, area Area) (found []FoundBlock) {
+	l.EachBlock(func(x, y, z int, block byte) {
+		if set[block] && area.Contains(x, z) {
+			found = append(found, FoundBlock{"", block, BlockName(block), x, y, z})
+		}
+	})
+	return
+}
+
+// Find searches a world for blocks and lists their coordinates.
+func Find(args []string) error {
+	var (
+		dir, outFilename, format string
+		blocks BlockSet
+		allDimensions bool
+		opts Options
+	)
+	
+	flags := flag.NewFlagSet("find", flag.ContinueOnError)
+	flags.StringVar(&dir, "dir", DIR, "Read region files from the world at this directory.")
+	flags.Var(&blocks, "block", "Find these comma-separated block names or IDs (e.g. mob_spawner,diamond_ore).")
+	flags.StringVar(&outFilename, "out", "-", "Write the blocks found to this file (- for stdout).")
+	flags.StringVar(&format, "format", "text", "List blocks as text, csv or json.")
+	flags.BoolVar(&allDimensions, "all-dimensions", false, "Include the nether and end.")
+	flags.Var(&opts.Area, "area", "Only search within x0,z0,x1,z1 (world coordinates).")
+	opts.Progress.Flags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	
+	if blocks.Empty() {
+		return fatalError("Error parsing flags: ", fmt.Errorf("-block is required"))
+	}
+	if format != "text" && format != "csv" && format != "json" {
+		return fatalError("Error parsing flags: ", fmt.Errorf("unknown format %q, expected text, csv or json", format))
+	}
+	
+	opts.Auto()
+	// Text progress would be mixed into the output on stdout.
+	if outFilename == "-" && opts.Progress.Mode != ProgressJSON {
+		opts.Progress.Quiet = true
+	}
+	opts.Progress.Start()
+	
+	dimensions, err := FindDimensions(dir, "", allDimensions, nil)
+	if err != nil {
+		return err
+	}
+	var regions PositionList
+	for i, dimension := range dimensions {
+		if err := dimension.Glob(i, &opts); err != nil {
+			return err
+		}
+		regions = append(regions, dimension.Regions...)
+	}
+	
+	var (
+		mu sync.Mutex
+		found []FoundBlock
+	)
+	jobs := Decode(regions, &opts)
+	done := make(chan bool)
+	Spawn(opts.Drawers, func() {
+		for job := range jobs {
+			dimension := dimensions[regions[job.Index - 1].(Region).Dimension].Name
+			for _, chunk := range job.Chunks {
+				for _, block := range chunk.(Level).FindBlocks(&blocks, opts.Area) {
+					block.Dimension = dimension
+					mu.Lock()
+					found = append(found, block)
+					mu.Unlock()
+				}
+			}
+			for _, chunkErr := range job.Errors {
+				opts.Progress.ChunkError(chunkErr)
+			}
+		}
+	}, func() {
+		close(done)
+	})
+	<-done
+	
+	sort.Sort(byLocation(found))
+	opts.Progress.Printf("Found %d blocks in %d regions", len(found), len(regions))
+	
+	out := io.Writer(os.Stdout)
+	if outFilename != "-" {
+		outFile, err := os.Create(outFilename)
+		if err != nil {
+			return fatalError("Error creating output file: ", err)
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+	
+	switch format {
+	case "json":
+		if found == nil {
+			found = []FoundBlock{}
+		}
+		return fatalError("Error writing blocks: ", json.NewEncoder(out).Encode(found))
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write([]string{"dimension", "block", "x", "y", "z"})
+		for _, b := range found {
+			w.Write([]string{b.Dimension, b.Block, fmt.Sprint(b.X), fmt.Sprint(b.Y), fmt.Sprint(b.Z)})
+		}
+		w.Flush()
+		return fatalError("Error writing blocks: ", w.Error())
+	default:
+		for _, b := range found {
+			if b.Dimension != "" {
+				fmt.Fprintf(out, "%s ", b.Dimension)
+			}
+			fmt.Fprintf(out, "%s %d %d %d\n", b.Block, b.X, b.Y, b.Z)
+		}
+	}
+	return nil
+}
+
+type byLocation []FoundBlock
+
+func (b byLocation) Len() int {
+	return len(b)
+}
+
+func (b byLocation) Less(i, j int) bool {
+	switch {
+	case b[i].Dimension != b[j].Dimension:
+		return b[i].Dimension < b[j].Dimension
+	case b[i].X != b[j].X:
+		return b[i].X < b[j].X
+	case b[i].Z != b[j].Z:
+		return b[i].Z < b[j].Z
+	}
+	return b[i].Y < b[j].Y
+}
+
+func (b byLocation) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
@@ -0,0 +1,94 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"errors"
+	"path/filepath"
+)
+
+// FLATTENINGVERSION is the DataVersion of Minecraft 1.13, which replaced
+// block IDs in chunks with paletted block states.
+const FLATTENINGVERSION = 1451
+
+// ErrFlattened is the error for chunks saved by 1.13 or later, which decode
+// as empty and unpopulated since they have no Blocks arrays.
+var ErrFlattened = errors.New("saved by Minecraft 1.13 or later, whose block states can't be drawn yet")
+
+// Flattened reports whether chunk data is in the format of 1.13 or later:
+// a DataVersion from then on, or, without one, a Status but no
+// TerrainPopulated.
+func Flattened(data []byte) bool {
+	root, err := ReadNBTTree(data)
+	if err != nil {
+		return false
+	}
+	if version, ok := root["DataVersion"].(int32); ok {
+		return version >= FLATTENINGVERSION
+	}
+	
+	level, _ := root["Level"].(map[string]interface{})
+	_, populated := level["TerrainPopulated"]
+	_, status := level["Status"].(string)
+	return status && !populated
+}
+
+// CheckFormat returns an error if the first chunk found in the dimension's
+// regions is in the 1.13+ format, which would otherwise render as an empty
+// image. Datapack dimensions only exist in such worlds. Regions that can't
+// be read are left for the render to report.
+func (d *Dimension) CheckFormat() error {
+	for _, r := range d.Regions {
+		region := r.(Region)
+		if region.Legacy {
+			continue
+		}
+		
+		data, x, z, err := firstChunk(region)
+		if err != nil || data == nil {
+			continue
+		}
+		if Flattened(data) {
+			return fmt.Errorf("%s: chunk %d,%d of %s was %s", d.Key, x, z, filepath.Base(region.Path), ErrFlattened)
+		}
+		return nil
+	}
+	return nil
+}
+
+// firstChunk returns the decompressed data of the first chunk in the region
+// file, or nil if there are none.
+func firstChunk(region Region) (data []byte, x, z int, err error) {
+	regionFile, err := os.Open(region.Path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer regionFile.Close()
+	
+	stat, err := regionFile.Stat()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	
+	var header Header
+	header.Read(regionFile)
+	for i, location := range header.Locations {
+		if !location.Valid(stat.Size()) {
+			continue
+		}
+		
+		raw := RawChunk{X: region.X << 5 + i & 31, Z: region.Z << 5 + i >> 5}
+		if err := raw.Read(io.NewSectionReader(regionFile, location.Start(), location.Size())); err != nil {
+			return nil, raw.X, raw.Z, err
+		}
+		if raw.External() {
+			if err := raw.ReadExternal(filepath.Dir(region.Path)); err != nil {
+				return nil, raw.X, raw.Z, err
+			}
+		}
+		data, err := raw.Decompress()
+		return data, raw.X, raw.Z, err
+	}
+	return nil, 0, 0, nil
+}
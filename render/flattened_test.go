@@ -0,0 +1,37 @@
+package render
+
+import "testing"
+
+func TestFlattened(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		data []byte
+		flattened bool
+	}{
+		{"1.12", legacyChunk(0, 0, 1), false},
+		{"1.16", flattenedChunk(0, 0), true},
+		{"1.18", nbtRoot(nbtTag(TagInt, "DataVersion", nbtInt(2860)), nbtTag(TagString, "Status", nbtString("minecraft:full"))), true},
+		{"1.13 without DataVersion", nbtRoot(nbtTag(TagCompound, "Level", nbtCompound(nbtTag(TagString, "Status", nbtString("full"))))), true},
+		{"1.8", nbtRoot(nbtTag(TagCompound, "Level", nbtCompound(nbtTag(TagByte, "TerrainPopulated", []byte{0})))), false},
+		{"invalid", []byte{TagCompound, 0}, false},
+	} {
+		if got := Flattened(test.data); got != test.flattened {
+			t.Errorf("%s: Flattened = %v, want %v", test.name, got, test.flattened)
+		}
+	}
+}
+
+func TestDecodeFlattened(t *testing.T) {
+	var level Level
+	if err := level.Decode(legacyChunk(2, 3, 1)); err != nil {
+		t.Fatalf("1.12 chunk: %s", err)
+	}
+	if level.X != 2 || level.Z != 3 || level.TerrainPopulated != 1 || len(level.Sections) != 1 || !level.Sections[0].Valid() {
+		t.Errorf("1.12 chunk decoded as %+v", level)
+	}
+	
+	level = Level{}
+	if err := level.Decode(flattenedChunk(0, 0)); err != ErrFlattened {
+		t.Errorf("1.16 chunk: got error %v, want ErrFlattened", err)
+	}
+}
@@ -0,0 +1,91 @@
+package render
+
+import (
+	"io"
+	"bytes"
+	"image"
+	"testing"
+)
+
+// drawFuzzed decodes and draws data as one chunk's NBT, if it validates,
+// reporting whether it got that far.
+func drawFuzzed(data []byte) bool {
+	var level Level
+	if ValidateNBT(data) != nil || level.Decode(data) != nil {
+		return false
+	}
+	level.Draw(image.NewRGBA(DefaultProjection.ChunkBounds(level)), IsometricMode{}, NewNeighborhood(PositionList{level}), &Options{Occlusion: true})
+	return true
+}
+
+// FuzzValidate treats its input both as a region file, pushing every chunk
+// it locates through decompression, validation, decoding and drawing, and
+// as a chunk's NBT on its own. Run it with go test -fuzz FuzzValidate.
+func FuzzValidate(f *testing.F) {
+	if err := LoadBlockColors(); err != nil {
+		f.Fatal(err)
+	}
+	
+	deep := nbtRoot()
+	for i := 0; i < 2 * MAXNBTDEPTH; i++ {
+		deep = nbtRoot(nbtTag(TagCompound, "c", deep[3:]))
+	}
+	oversized := nbtRoot(nbtTag(TagByteArray, "Blocks", nbtInt(MAXNBTARRAY + 1)))
+	pastEnd := regionData(map[int][]byte{0: legacyChunk(0, 0, 1)})
+	pastEnd[3] = 200
+	
+	for _, seed := range [][]byte{
+		regionData(map[int][]byte{0: legacyChunk(0, 0, 1), 33: legacyChunk(1, 1, 2)}),
+		regionData(map[int][]byte{5: flattenedChunk(5, 0)}),
+		pastEnd,
+		legacyChunk(0, 0, 1),
+		flattenedChunk(0, 0),
+		deep,
+		oversized,
+		nil,
+	} {
+		f.Add(seed)
+	}
+	
+	f.Fuzz(func(t *testing.T, data []byte) {
+		drawFuzzed(data)
+		
+		r := bytes.NewReader(data)
+		var header Header
+		header.Read(r)
+		for _, location := range header.Locations {
+			if !location.Valid(int64(len(data))) {
+				continue
+			}
+			
+			var chunk RawChunk
+			if chunk.Read(io.NewSectionReader(r, location.Start(), location.Size())) != nil {
+				continue
+			}
+			if levelData, err := chunk.Decompress(); err == nil {
+				drawFuzzed(levelData)
+			}
+		}
+	})
+}
+
+// TestFuzzSeeds checks the seeds reach as far as they're meant to, so the
+// fuzzer starts from chunks that draw.
+func TestFuzzSeeds(t *testing.T) {
+	if err := LoadBlockColors(); err != nil {
+		t.Fatal(err)
+	}
+	
+	if !drawFuzzed(legacyChunk(0, 0, 1)) {
+		t.Error("a 1.12 chunk didn't draw")
+	}
+	for name, data := range map[string][]byte{
+		"1.16 chunk": flattenedChunk(0, 0),
+		"truncated chunk": legacyChunk(0, 0, 1)[:100],
+		"oversized array": nbtRoot(nbtTag(TagByteArray, "Blocks", nbtInt(MAXNBTARRAY + 1))),
+	} {
+		if drawFuzzed(data) {
+			t.Errorf("%s drew", name)
+		}
+	}
+}
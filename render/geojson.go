@@ -0,0 +1,245 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"image"
+	"strconv"
+	"image/color"
+	"encoding/json"
+)
+
+// Lines and polygons without heights are drawn at sea level.
+const PATHHEIGHT = 64
+
+// A Path is a line or polygon drawn over the finished map, such as a town
+// border or rail line. Points are x, y, z world coordinates.
+type Path struct {
+	Label string
+	Points [][3]int
+	Closed bool
+	Color color.RGBA
+}
+
+// Feature is a GeoJSON feature whose coordinates are [x, z] or [x, z, y]
+// world coordinates, following GeoJSON's easting, northing, altitude order.
+type Feature struct {
+	Geometry struct {
+		Type string `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+	Properties struct {
+		Label string `json:"label"`
+		Name string `json:"name"`
+		Color string `json:"color"`
+		Dimension interface{} `json:"dimension"`
+	} `json:"properties"`
+}
+
+// ReadMarkerFile loads points, lines and polygons from a GeoJSON
+// FeatureCollection or a bare array of features, keyed by the dimension
+// key of their dimension property: a vanilla id, or a namespace:name.
+// Features are labelled with their label or name property and colored
+// with an optional #rrggbb color property.
+func ReadMarkerFile(path string) (markers map[string][]Marker, paths map[string][]Path, err error) {
+	markerFile, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer markerFile.Close()
+	
+	var raw json.RawMessage
+	if err := json.NewDecoder(markerFile).Decode(&raw); err != nil {
+		return nil, nil, err
+	}
+	
+	var features []Feature
+	if len(raw) != 0 && raw[0] == '[' {
+		err = json.Unmarshal(raw, &features)
+	} else {
+		var collection struct {
+			Features []Feature `json:"features"`
+		}
+		err = json.Unmarshal(raw, &collection)
+		features = collection.Features
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	markers = make(map[string][]Marker)
+	paths = make(map[string][]Path)
+	for i, f := range features {
+		label := f.Properties.Label
+		if label == "" {
+			label = f.Properties.Name
+		}
+		
+		var c color.RGBA
+		if f.Properties.Color != "" {
+			if c, err = ParseHex(f.Properties.Color); err != nil {
+				return nil, nil, fmt.Errorf("feature %d: %s", i, err)
+			}
+		}
+		
+		lines, closed, err := f.Lines()
+		if err != nil {
+			return nil, nil, fmt.Errorf("feature %d: %s", i, err)
+		}
+		
+		dim, err := f.DimensionKey()
+		if err != nil {
+			return nil, nil, fmt.Errorf("feature %d: %s", i, err)
+		}
+		for _, line := range lines {
+			if closed == nil {
+				for _, pt := range line {
+					markers[dim] = append(markers[dim], pt.Marker(label, c))
+				}
+				continue
+			}
+			
+			path := Path{Label: label, Closed: *closed, Color: c}
+			for _, pt := range line {
+				path.Points = append(path.Points, pt.Point())
+			}
+			paths[dim] = append(paths[dim], path)
+		}
+	}
+	return markers, paths, nil
+}
+
+// DimensionKey returns the key of the feature's dimension, the overworld
+// if it has none.
+func (f Feature) DimensionKey() (string, error) {
+	switch dim := f.Properties.Dimension.(type) {
+	case nil:
+		return ParseDimension("")
+	case float64:
+		return ParseDimension(strconv.FormatFloat(dim, 'f', -1, 64))
+	case string:
+		return ParseDimension(dim)
+	}
+	return "", fmt.Errorf("invalid dimension %v", f.Properties.Dimension)
+}
+
+type coordinate []float64
+
+func (c coordinate) Marker(label string, col color.RGBA) Marker {
+	m := Marker{Label: label, X: Floor(c[0]), Z: Floor(c[1]), Surface: len(c) < 3, Color: col}
+	if !m.Surface {
+		m.Y = Floor(c[2])
+	}
+	return m
+}
+
+func (c coordinate) Point() [3]int {
+	if len(c) < 3 {
+		return [3]int{Floor(c[0]), PATHHEIGHT, Floor(c[1])}
+	}
+	return [3]int{Floor(c[0]), Floor(c[2]), Floor(c[1])}
+}
+
+// Lines flattens the feature's geometry into lists of coordinates. closed is
+// nil for points, otherwise whether each line is a polygon ring.
+func (f Feature) Lines() (lines [][]coordinate, closed *bool, err error) {
+	open, ring := false, true
+	switch f.Geometry.Type {
+	case "Point":
+		var pt coordinate
+		err = json.Unmarshal(f.Geometry.Coordinates, &pt)
+		lines = [][]coordinate{{pt}}
+	case "MultiPoint":
+		var pts []coordinate
+		err = json.Unmarshal(f.Geometry.Coordinates, &pts)
+		lines = [][]coordinate{pts}
+	case "LineString":
+		var line []coordinate
+		err = json.Unmarshal(f.Geometry.Coordinates, &line)
+		lines, closed = [][]coordinate{line}, &open
+	case "MultiLineString":
+		err = json.Unmarshal(f.Geometry.Coordinates, &lines)
+		closed = &open
+	case "Polygon":
+		err = json.Unmarshal(f.Geometry.Coordinates, &lines)
+		closed = &ring
+	case "MultiPolygon":
+		var polygons [][][]coordinate
+		err = json.Unmarshal(f.Geometry.Coordinates, &polygons)
+		for _, polygon := range polygons {
+			lines = append(lines, polygon...)
+		}
+		closed = &ring
+	default:
+		return nil, nil, fmt.Errorf("unsupported geometry type %q", f.Geometry.Type)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	for _, line := range lines {
+		for _, pt := range line {
+			if len(pt) < 2 {
+				return nil, nil, fmt.Errorf("expected [x, z] or [x, z, y] coordinates, got %v", pt)
+			}
+		}
+	}
+	return lines, closed, nil
+}
+
+// Project returns the path's points in image coordinates and the vertical
+// extent they cover.
+func (p Path) Project(mode Mode) (pts []image.Point, top, bottom int) {
+	for i, pt := range p.Points {
+		x, y := mode.Project(pt[0], pt[1], pt[2])
+		pts = append(pts, image.Pt(x, y))
+		if i == 0 || y < top {
+			top = y
+		}
+		if i == 0 || y > bottom {
+			bottom = y
+		}
+	}
+	return
+}
+
+// DrawPath outlines the path and labels it at the average of its points,
+// which for a polygon ring falls inside most town-shaped borders.
+func DrawPath(img *image.RGBA, mode Mode, p Path, style TextStyle) {
+	pts, _, _ := p.Project(mode)
+	if len(pts) == 0 {
+		return
+	}
+	
+	line := style
+	line.Color = p.Color
+	if line.Color.A == 0 {
+		line.Color = markerColor
+	}
+	
+	var strokes []stroke
+	var sum image.Point
+	for i, pt := range pts {
+		sum = sum.Add(pt)
+		next := i + 1
+		if next == len(pts) {
+			if !p.Closed {
+				break
+			}
+			next = 0
+		}
+		strokes = append(strokes, stroke{float64(pt.X), float64(pt.Y), float64(pts[next].X), float64(pts[next].Y)})
+	}
+	if len(pts) == 1 {
+		strokes = append(strokes, stroke{float64(pts[0].X), float64(pts[0].Y), float64(pts[0].X), float64(pts[0].Y)})
+	}
+	drawStrokes(img, strokes, RULEWIDTH, line)
+	
+	if p.Label != "" {
+		center := pts[0]
+		if p.Closed {
+			center = sum.Div(len(pts))
+		}
+		DrawText(img, image.Pt(center.X - style.Width(p.Label) / 2, center.Y - style.Height() / 2), p.Label, style)
+	}
+}
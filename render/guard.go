@@ -0,0 +1,278 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"image"
+	"math"
+	"bytes"
+	"strconv"
+	"strings"
+	"path/filepath"
+)
+
+const (
+	MAXPIXELS = 1 << 30
+	MAXOUTLIERS = 8
+)
+
+type Limits struct {
+	MaxPixels int64
+	Stream bool
+	
+	// Mapped keeps canvases in memory-mapped files, as is done anyway when
+	// they wouldn't fit in the memory available.
+	Mapped bool
+	
+	// MaxMemory streams any dimension whose canvases wouldn't fit in it, only
+	// refusing to render if even a strip at a time wouldn't, unless Fallback
+	// says to refuse straight away.
+	MaxMemory ByteSize
+	Fallback MemoryFallback
+}
+
+// A ByteSize is a number of bytes, given with an optional K, M, G or T
+// suffix in powers of 1024.
+type ByteSize int64
+
+var byteSuffixes = []string{"K", "M", "G", "T"}
+
+func (b *ByteSize) String() string {
+	n := int64(*b)
+	for i := len(byteSuffixes); i > 0; i-- {
+		if unit := int64(1) << uint(10 * i); n != 0 && n % unit == 0 {
+			return fmt.Sprintf("%d%s", n / unit, byteSuffixes[i - 1])
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func (b *ByteSize) Set(s string) error {
+	number := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	shift := uint(0)
+	for i, suffix := range byteSuffixes {
+		if strings.HasSuffix(number, suffix) {
+			number, shift = strings.TrimSuffix(number, suffix), uint(10 * (i + 1))
+			break
+		}
+	}
+	
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q, expected e.g. 512M or 4G", s)
+	}
+	*b = ByteSize(n * float64(int64(1) << shift))
+	return nil
+}
+
+// A MiBSize sets a ByteSize from the deprecated -maxmemory, which took
+// plain numbers as MiB and refused to render over them.
+type MiBSize struct {
+	Limits *Limits
+}
+
+func (m MiBSize) String() string {
+	if m.Limits == nil {
+		return "0"
+	}
+	return m.Limits.MaxMemory.String()
+}
+
+func (m MiBSize) Set(s string) error {
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		s += "M"
+	}
+	m.Limits.Fallback = FALLBACKREFUSE
+	return m.Limits.MaxMemory.Set(s)
+}
+
+// A MemoryFallback is what to do with images that wouldn't fit in
+// -max-memory whole: composite them a strip at a time, or refuse.
+type MemoryFallback string
+
+const (
+	FALLBACKSTREAM MemoryFallback = "stream"
+	FALLBACKREFUSE MemoryFallback = "refuse"
+)
+
+func (f *MemoryFallback) String() string {
+	if *f == "" {
+		return string(FALLBACKSTREAM)
+	}
+	return string(*f)
+}
+
+func (f *MemoryFallback) Set(s string) error {
+	switch MemoryFallback(s) {
+	case FALLBACKSTREAM, FALLBACKREFUSE:
+		*f = MemoryFallback(s)
+		return nil
+	}
+	return fmt.Errorf("invalid fallback %q, expected %s or %s", s, FALLBACKSTREAM, FALLBACKREFUSE)
+}
+
+// OverBudget reports whether the dimension's canvases, held whole, would
+// exceed -max-memory where streaming them would need less, and the memory
+// they'd need.
+func OverBudget(d *Dimension, opts *Options) (bool, int64) {
+	if opts.MaxMemory <= 0 || opts.Stream || opts.Fallback == FALLBACKREFUSE {
+		return false, 0
+	}
+	
+	var whole, streamed int64
+	for _, output := range d.Outputs {
+		scale := Supersample(output.Mode, opts)
+		whole += EstimateMemory(output.Mode, output.Bounds, d.Regions, opts.Drawers, scale, false)
+		streamed += EstimateMemory(output.Mode, output.Bounds, d.Regions, opts.Drawers, scale, true)
+	}
+	return whole > int64(opts.MaxMemory) && streamed < whole, whole
+}
+
+// EstimateMemory approximates peak usage: the canvas plus one region layer
+// per drawer. Streamed canvases only hold one strip and the row of layers
+// crossing it.
+func EstimateMemory(mode Mode, bounds image.Rectangle, regions PositionList, drawers, scale int, stream bool) int64 {
+	bounds = ScaleRect(bounds, scale)
+	canvas := int64(bounds.Dx()) * int64(bounds.Dy()) * 4
+	if len(regions) == 0 {
+		return canvas
+	}
+	
+	layer := ScaleRect(mode.RegionBounds(regions[0].(Region)), scale)
+	layerSize := int64(layer.Dx()) * int64(layer.Dy()) * 4
+	if stream {
+		canvas = int64(bounds.Dx()) * STRIPHEIGHT * int64(scale) * 4 + int64(bounds.Dx() / layer.Dx() + 2) * layerSize
+	}
+	return canvas + int64(Min(drawers, len(regions))) * layerSize
+}
+
+// CheckCanvas fails if rendering bounds would exceed the configured limits,
+// explaining which regions stretch the canvas and how to avoid them.
+func CheckCanvas(output *Output, regions PositionList, stream bool, opts *Options) error {
+	bounds := output.Bounds
+	pixels := int64(bounds.Dx()) * int64(bounds.Dy())
+	memory := EstimateMemory(output.Mode, bounds, regions, opts.Drawers, Supersample(output.Mode, opts), stream)
+	
+	var reason string
+	switch {
+	case opts.MaxPixels > 0 && pixels > opts.MaxPixels:
+		reason = fmt.Sprintf("canvas of %dx%d (%d pixels) exceeds -maxpixels %d", bounds.Dx(), bounds.Dy(), pixels, opts.MaxPixels)
+	case opts.MaxMemory > 0 && memory > int64(opts.MaxMemory):
+		reason = fmt.Sprintf("estimated memory use of %d MiB exceeds -max-memory %s", memory >> 20, &opts.MaxMemory)
+		if stream {
+			reason += " even composited a strip at a time"
+		}
+	default:
+		return nil
+	}
+	
+	buf := bytes.NewBufferString(reason)
+	
+	outliers, inliers := Outliers(regions)
+	if len(outliers) > 0 {
+		fmt.Fprintf(buf, "\n\nThese regions lie far from the rest of the world:\n")
+		for i, r := range outliers {
+			if i == MAXOUTLIERS {
+				fmt.Fprintf(buf, "\t... and %d more\n", len(outliers) - MAXOUTLIERS)
+				break
+			}
+			region := r.(Region)
+			fmt.Fprintf(buf, "\t%s (region %d,%d, blocks %d,%d to %d,%d)\n", filepath.Base(region.Path),
+				region.X, region.Z, region.X << 9, region.Z << 9, region.X << 9 + 511, region.Z << 9 + 511)
+		}
+	}
+	
+	if len(inliers) > 0 {
+		x0, z0, x1, z1 := RegionExtent(inliers)
+		fmt.Fprintf(buf, "\nTo render only the main area try: -area %d,%d,%d,%d", x0 << 9, z0 << 9, x1 << 9 + 511, z1 << 9 + 511)
+	} else {
+		fmt.Fprintf(buf, "\nUse -area to render a smaller part of the world.")
+	}
+	
+	return fmt.Errorf("%s", buf.String())
+}
+
+func RegionExtent(regions PositionList) (x0, z0, x1, z1 int) {
+	for i, r := range regions {
+		x, z := r.GetPos()
+		if i == 0 || x < x0 {
+			x0 = x
+		}
+		if i == 0 || z < z0 {
+			z0 = z
+		}
+		if i == 0 || x > x1 {
+			x1 = x
+		}
+		if i == 0 || z > z1 {
+			z1 = z
+		}
+	}
+	return
+}
+
+// Outliers splits regions by their distance from the median region. Anything
+// more than four times the median distance (and at least four regions away)
+// is reported as an outlier, farthest first.
+func Outliers(regions PositionList) (outliers, inliers PositionList) {
+	if len(regions) == 0 {
+		return
+	}
+	
+	xs, zs := make([]int, len(regions)), make([]int, len(regions))
+	for i, r := range regions {
+		xs[i], zs[i] = r.GetPos()
+	}
+	sort.Ints(xs)
+	sort.Ints(zs)
+	mx, mz := xs[len(xs) / 2], zs[len(zs) / 2]
+	
+	distance := func(r Positioner) int {
+		x, z := r.GetPos()
+		return Max(Abs(x - mx), Abs(z - mz))
+	}
+	
+	distances := make([]int, len(regions))
+	for i, r := range regions {
+		distances[i] = distance(r)
+	}
+	sort.Ints(distances)
+	threshold := Max(4 * distances[len(distances) / 2], 4)
+	
+	for _, r := range regions {
+		if distance(r) > threshold {
+			outliers = append(outliers, r)
+		} else {
+			inliers = append(inliers, r)
+		}
+	}
+	
+	sort.Sort(byDistance{outliers, distance})
+	return
+}
+
+type byDistance struct {
+	PositionList
+	distance func(Positioner) int
+}
+
+func (b byDistance) Less(i, j int) bool {
+	return b.distance(b.PositionList[i]) > b.distance(b.PositionList[j])
+}
+
+func Max(a ...int) (max int) {
+	max = math.MinInt32
+	for _, i := range a {
+		if i > max {
+			max = i
+		}
+	}
+	return
+}
+
+func Abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -0,0 +1,115 @@
+package render
+
+import (
+	"math"
+	"time"
+	"image"
+	"image/color"
+)
+
+const (
+	// TICK is how long a game tick lasts, the unit of InhabitedTime.
+	TICK = time.Second / 20
+	
+	// DefaultInhabitedMax is the InhabitedTime at which local difficulty
+	// stops rising, as good a point as any to call a chunk fully lived in.
+	DefaultInhabitedMax = 50 * time.Hour
+	DefaultAgeMax = 30 * 24 * time.Hour
+)
+
+// heatStops run from cold to hot, evenly spaced.
+var heatStops = []color.RGBA{
+	{0x1A, 0x1A, 0x5C, 0xFF},
+	{0x20, 0x60, 0xC0, 0xFF},
+	{0x20, 0xB0, 0xA0, 0xFF},
+	{0x90, 0xD0, 0x30, 0xFF},
+	{0xF0, 0xC0, 0x20, 0xFF},
+	{0xE0, 0x30, 0x20, 0xFF},
+}
+
+// HeatColor returns the color of heat t, from 0 for cold to 1 for hot.
+func HeatColor(t float64) color.RGBA {
+	t = math.Max(0, math.Min(1, t)) * float64(len(heatStops) - 1)
+	i := int(t)
+	if i == len(heatStops) - 1 {
+		return heatStops[i]
+	}
+	
+	f := t - float64(i)
+	a, b := heatStops[i], heatStops[i + 1]
+	mix := func(a, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b) - float64(a)) * f + 0.5)
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xFF}
+}
+
+// LogHeat places d on a logarithmic scale up to max, so a few minutes stand
+// apart from none as clearly as days do from hours.
+func LogHeat(d, max time.Duration) float64 {
+	if d <= 0 || max <= 0 {
+		return 0
+	}
+	return math.Log1p(d.Seconds()) / math.Log1p(max.Seconds())
+}
+
+// fillChunk colors every column of a chunk within the area, one pixel each.
+func fillChunk(img *image.RGBA, l Level, c color.RGBA, opts *Options) {
+	for z := 0; z < 16; z++ {
+		for x := 0; x < 16; x++ {
+			wx, wz := int(l.X) << 4 + x, int(l.Z) << 4 + z
+			if opts.Area.Contains(wx, wz) {
+				img.SetRGBA(wx, wz, c)
+			}
+		}
+	}
+}
+
+// InhabitedMode draws one pixel per column like TopDownMode, colored by how
+// long players have spent near its chunk, hottest at -inhabited-max.
+type InhabitedMode struct {
+	TopDownMode
+}
+
+func (InhabitedMode) Name() string {
+	return "inhabited"
+}
+
+func (InhabitedMode) Draw(img *image.RGBA, l Level, n Neighborhood, opts *Options) {
+	max := opts.InhabitedMax
+	if max <= 0 {
+		max = DefaultInhabitedMax
+	}
+	fillChunk(img, l, HeatColor(LogHeat(time.Duration(l.InhabitedTime) * TICK, max)), opts)
+}
+
+// AgeMode draws one pixel per column like TopDownMode, colored by how long
+// ago its chunk was last updated: hottest for the newest, coldest from
+// -age-max on. Ages are game time, the world's time in level.dat less the
+// chunk's LastUpdate, or without a level.dat the time since the region
+// header says the chunk was saved.
+type AgeMode struct {
+	TopDownMode
+}
+
+func (AgeMode) Name() string {
+	return "age"
+}
+
+func (AgeMode) Draw(img *image.RGBA, l Level, n Neighborhood, opts *Options) {
+	max := opts.AgeMax
+	if max <= 0 {
+		max = DefaultAgeMax
+	}
+	
+	var age time.Duration
+	if opts.WorldTime > 0 {
+		age = time.Duration(opts.WorldTime - l.LastUpdate) * TICK
+	} else if l.Modified > 0 {
+		now := opts.Fade.Now
+		if now.IsZero() {
+			now = time.Now()
+		}
+		age = now.Sub(time.Unix(l.Modified, 0))
+	}
+	fillChunk(img, l, HeatColor(1 - LogHeat(age, max)), opts)
+}
@@ -0,0 +1,49 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+)
+
+type Tile struct {
+	Region Region
+	Mode Mode
+	Img *image.RGBA
+}
+
+func (t Tile) Bounds() image.Rectangle {
+	return t.Img.Bounds()
+}
+
+// Hooks let code embedding the renderer receive each region's tile as soon
+// as it has been drawn, before compositing and encoding of the full map. The
+// callbacks run concurrently on the drawer goroutines and must not modify the
+// tile image.
+type Hooks struct {
+	Tile func(Tile)
+	EncodedTile func(Tile, []byte)
+}
+
+// emit passes hooks the tile at its final size, averaging down layers drawn
+// scale times larger only if a hook wants them.
+func (h Hooks) emit(region Region, mode Mode, img *image.RGBA, scale int) {
+	if h.Tile == nil && h.EncodedTile == nil {
+		return
+	}
+	if scale > 1 {
+		img = Downsample(img, scale)
+	}
+	
+	tile := Tile{region, mode, img}
+	if h.Tile != nil {
+		h.Tile(tile)
+	}
+	
+	if h.EncodedTile != nil {
+		buf := bytes.NewBuffer(nil)
+		if png.Encode(buf, img) == nil {
+			h.EncodedTile(tile, buf.Bytes())
+		}
+	}
+}
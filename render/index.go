@@ -0,0 +1,46 @@
+package render
+
+import (
+	"os"
+	"html/template"
+	"path/filepath"
+)
+
+const INDEXFILE = "index.html"
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>GoCart</title>
+<style>
+body { font-family: sans-serif; background: #222; color: #ddd; }
+a { color: #9cf; }
+figure { display: inline-block; margin: 1em; text-align: center; }
+img { max-width: 320px; max-height: 320px; background: #333; }
+</style>
+</head>
+<body>
+<h1>GoCart</h1>
+{{range .}}{{$dimension := .Name}}{{range .Outputs}}{{if .File}}<figure>
+<a href="{{.Link}}"><img src="{{.Link}}"></a>
+<figcaption>{{if $dimension}}{{$dimension}} {{end}}{{.Mode.Name}}</figcaption>
+</figure>
+{{end}}{{end}}{{end}}</body>
+</html>
+`))
+
+func (o *Output) Link() string {
+	return filepath.Base(o.Out)
+}
+
+// WriteIndex writes an index.html beside the images linking every output.
+func WriteIndex(dir string, dimensions []*Dimension) error {
+	indexFile, err := os.Create(filepath.Join(dir, INDEXFILE))
+	if err != nil {
+		return err
+	}
+	defer indexFile.Close()
+	
+	return indexTemplate.Execute(indexFile, dimensions)
+}
@@ -0,0 +1,52 @@
+package render
+
+import (
+	"image/color"
+)
+
+// Blocks whose color varies from block to block in the game, and so get
+// -jitter.
+var jitterBlocks = map[byte]bool{
+	0x02: true, // Grass
+	0x12: true, // Leaves
+	0x1F: true, // TallGrass
+	0x20: true, // DeadShrub
+	0x6A: true, // Vines
+	0x6F: true, // LilyPad
+	0xA1: true, // Leaves2
+	0xAF: true, // DoublePlant
+}
+
+// blockHash mixes the world seed with a block's coordinates, so the same
+// block in the same world always gets the same value regardless of which
+// chunks are rendered or in what order.
+func blockHash(seed int64, x, y, z int) uint64 {
+	h := uint64(seed) ^ uint64(x) * 0x9E3779B97F4A7C15 ^ uint64(y) * 0xC2B2AE3D27D4EB4F ^ uint64(z) * 0x165667B19E3779F9
+	h ^= h >> 33
+	h *= 0xFF51AFD7ED558CCD
+	h ^= h >> 33
+	h *= 0xC4CEB9FE1A85EC53
+	h ^= h >> 33
+	return h
+}
+
+func brighten(c color.RGBA, offset int) color.RGBA {
+	add := func(v uint8) uint8 {
+		return uint8(Max(0, Min(int(v) + offset, 0xff)))
+	}
+	return color.RGBA{add(c.R), add(c.G), add(c.B), c.A}
+}
+
+// Jitter brightens or darkens foliage by up to amount, the same way on
+// every render of the world.
+func Jitter(c BlockColor, block byte, amount int, seed int64, x, y, z int) BlockColor {
+	if amount <= 0 || !jitterBlocks[block] {
+		return c
+	}
+	
+	offset := int(blockHash(seed, x, y, z) % uint64(2 * amount + 1)) - amount
+	c.Top = brighten(c.Top, offset)
+	c.Left = brighten(c.Left, offset)
+	c.Right = brighten(c.Right, offset)
+	return c
+}
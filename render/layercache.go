@@ -0,0 +1,481 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"flag"
+	"time"
+	"image"
+	"bytes"
+	"strings"
+	"io/ioutil"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/json"
+	"path/filepath"
+	"compress/flate"
+)
+
+const (
+	CACHEDIR = ".gocart-cache"
+	CHECKPOINTDIR = ".gocart-checkpoint"
+	CHECKPOINTFILE = "checkpoint.json"
+)
+
+// cacheFlags don't change what's drawn for any region, only which layers are
+// kept or how they're composited and encoded, so changing them leaves a
+// -cache valid. The modes themselves are matched per layer. The world is
+// told apart by its seed rather than -dir, so it can be moved.
+var cacheFlags = map[string]bool{
+	"dir": true,
+	"out": true,
+	"upload-parallel": true,
+	"all-dimensions": true,
+	"dimension": true,
+	"modes": true,
+	"projection": true,
+	"slices": true,
+	"objective": true,
+	"positions": true,
+	"markers": true,
+	"routes": true,
+	"dzi": true,
+	"marker-zooms": true,
+	"label-scale": true,
+	"label-halo": true,
+	"title": true,
+	"axes": true,
+	"scale-bar": true,
+	"north-arrow": true,
+	"progress": true,
+	"log-format": true,
+	"quiet": true,
+	"v": true,
+	"vv": true,
+	"maxpixels": true,
+	"maxmemory": true,
+	"max-memory": true,
+	"memory-fallback": true,
+	"workers": true,
+	"stream": true,
+	"mmap": true,
+	"readers": true,
+	"decompressors": true,
+	"decoders": true,
+	"drawers": true,
+	"encoders": true,
+	"chunk-buffer": true,
+	"region-buffer": true,
+	"nice": true,
+	"pace": true,
+	"snapshot": true,
+	"no-lock": true,
+	"lock-wait": true,
+	"palette": true,
+	"palette-report": true,
+	"deltae": true,
+	"dry-run": true,
+	"report": true,
+	"profile": true,
+	"config": true,
+	"cache": true,
+	"chunk-cache": true,
+	"resume": true,
+}
+
+// A LayerCache keeps each region's drawn layers between renders, so only
+// regions whose files have changed since need to be read and drawn again.
+// Entries are only reused when drawn with the same settings and palette.
+//
+// Its RenderState lets regions that were copied or moved since count as
+// unchanged too.
+//
+// As a Checkpoint it only lasts until the render finishes, so one that was
+// interrupted can resume, and it keeps the time the render started for
+// -fade to go on measuring from.
+type LayerCache struct {
+	Dir string
+	Settings string
+	Checkpoint bool
+	
+	key string
+	state *RenderState
+	seen map[string]bool
+}
+
+// A LayerEntry is one region's layers, one per mode, with everything else
+// its chunks add to the dimension.
+type LayerEntry struct {
+	Key string
+	ModTime time.Time
+	Size int64
+	Complete bool
+	
+	Chunks int
+	Blocks image.Rectangle
+	Layers []CachedLayer
+	
+	Entities []Entity
+	Found []Marker
+	Surface []SurfaceHeight
+	SurfaceMarkers []image.Point
+}
+
+type checkpoint struct {
+	Started time.Time `json:"started"`
+}
+
+type CachedLayer struct {
+	Mode string
+	Name string
+	ChunkBounds image.Rectangle
+	Bounds image.Rectangle
+	Pix []byte
+}
+
+// NewLayerCache returns nil when dir is empty, so no cache is used.
+func NewLayerCache(dir string, flags *flag.FlagSet) *LayerCache {
+	if dir == "" {
+		return nil
+	}
+	
+	var settings []string
+	flags.VisitAll(func(f *flag.Flag) {
+		if !cacheFlags[f.Name] {
+			settings = append(settings, f.Name + "=" + f.Value.String())
+		}
+	})
+	return &LayerCache{Dir: dir, Settings: strings.Join(settings, "\n")}
+}
+
+// StateDir is where to keep name for renders to out: beside it, or in the
+// working directory when out is in a bucket.
+func StateDir(out, name string) string {
+	if strings.Contains(out, "://") {
+		return name
+	}
+	return filepath.Join(filepath.Dir(out), name)
+}
+
+// Usable reports why layers can't be reused for this render, if they can't:
+// faded layers and age mode change with the time of each render, only kept
+// by checkpoints.
+func (c *LayerCache) Usable(opts *Options) error {
+	if c.Checkpoint {
+		return nil
+	}
+	if opts.Fade.Duration > 0 {
+		return fmt.Errorf("-fade depends on the time of each render")
+	}
+	for _, mode := range opts.Modes {
+		if _, aged := mode.(AgeMode); aged {
+			return fmt.Errorf("age mode depends on the time of each render")
+		}
+	}
+	if len(opts.Shaders) != 0 {
+		return fmt.Errorf("it can't tell what custom block shaders do")
+	}
+	return nil
+}
+
+// Prepare keys the cache to the palette and world seed, which may have been
+// loaded since the settings were read. A checkpoint left by an interrupted render sets
+// the time to fade from to when that render started; otherwise one is
+// started.
+func (c *LayerCache) Prepare(opts *Options) error {
+	h := sha1.New()
+	fmt.Fprint(h, c.Settings, PaletteVersion(), opts.Seed)
+	if opts.Script != nil {
+		fmt.Fprint(h, opts.Script.Version())
+	}
+	c.key = fmt.Sprintf("%x", h.Sum(nil))
+	
+	// A damaged state only costs redrawing what it would have spared.
+	state, err := ReadRenderState(c.stateFile())
+	if err != nil {
+		opts.Progress.Warnf("Starting a new render state: %s", err)
+	}
+	c.state, c.seen = state, make(map[string]bool)
+	if !c.Checkpoint {
+		return nil
+	}
+	
+	filename := filepath.Join(c.Dir, c.key[:12], CHECKPOINTFILE)
+	var cp checkpoint
+	if data, err := ioutil.ReadFile(filename); err == nil && json.Unmarshal(data, &cp) == nil {
+		opts.Progress.Printf("Resuming the render started at %s", cp.Started.Format(time.RFC3339))
+		opts.Fade.Now = cp.Started
+		return nil
+	}
+	
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(checkpoint{opts.Fade.Now})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// Finish saves the render state once the render is complete, or removes a
+// checkpoint.
+func (c *LayerCache) Finish() error {
+	if !c.Checkpoint {
+		if err := os.MkdirAll(filepath.Dir(c.stateFile()), 0755); err != nil {
+			return err
+		}
+		return c.state.Write(c.stateFile(), c.seen)
+	}
+	if err := os.RemoveAll(filepath.Join(c.Dir, c.key[:12])); err != nil {
+		return err
+	}
+	
+	// Left alone while other renders' checkpoints are still in it.
+	os.Remove(c.Dir)
+	return nil
+}
+
+// Entries are kept apart by settings, so renders with different settings,
+// such as profiles, don't replace each other's.
+func (c *LayerCache) filename(d *Dimension, region Region) string {
+	return filepath.Join(c.Dir, c.key[:12], d.StoreName(), filepath.Base(region.Path) + ".layer")
+}
+
+func (c *LayerCache) stateFile() string {
+	return filepath.Join(c.Dir, c.key[:12], STATEFILE)
+}
+
+func modeKey(mode Mode) string {
+	return fmt.Sprintf("%#v", mode)
+}
+
+// Stale returns the regions that must be drawn again: those never cached,
+// changed since, cached with errors or missing one of the dimension's modes.
+func (c *LayerCache) Stale(dimensions []*Dimension, regions PositionList) (stale PositionList) {
+	for _, r := range regions {
+		region := r.(Region)
+		if !c.fresh(dimensions[region.Dimension], region) {
+			stale = append(stale, r)
+		}
+	}
+	return
+}
+
+func (c *LayerCache) fresh(d *Dimension, region Region) bool {
+	stat, err := os.Stat(region.Path)
+	if err != nil {
+		return false
+	}
+	
+	name := stateName(d, region)
+	c.seen[name] = true
+	entry, err := c.load(d, region, false)
+	if err != nil || entry.Key != c.key || !entry.Complete {
+		return false
+	}
+	
+	// A file with another modification time may still be the one drawn, if
+	// every chunk's timestamp matches. One drawn by an interrupted render
+	// has its state brought up to date first.
+	recorded := c.state.Regions[name]
+	if entry.ModTime.Equal(stat.ModTime()) && entry.Size == stat.Size() {
+		if recorded == nil || !recorded.Modified.Equal(stat.ModTime()) || recorded.Size != stat.Size() {
+			if err := c.state.Record(name, region, entry.Tiles(), nil); err != nil {
+				return false
+			}
+		}
+	} else if recorded == nil || !recorded.Modified.Equal(stat.ModTime()) || recorded.Size != stat.Size() {
+		if !c.state.Unchanged(name, region.Path) {
+			return false
+		}
+	}
+	
+	// Surface markers may have moved since, needing heights from other chunks.
+	surface := d.surfaceIn(region)
+	if len(surface) != len(entry.SurfaceMarkers) {
+		return false
+	}
+	cached := make(map[image.Point]bool)
+	for _, p := range entry.SurfaceMarkers {
+		cached[p] = true
+	}
+	for _, p := range surface {
+		if !cached[p] {
+			return false
+		}
+	}
+	
+	if entry.Chunks == 0 {
+		return true
+	}
+	for _, output := range d.Outputs {
+		if entry.find(output.Mode) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Tiles returns the part of each mode's image the entry's layers cover.
+func (e *LayerEntry) Tiles() (tiles []TileDependency) {
+	for _, l := range e.Layers {
+		tiles = append(tiles, TileDependency{l.Name, l.ChunkBounds})
+	}
+	return
+}
+
+func (e *LayerEntry) find(mode Mode) *CachedLayer {
+	for i := range e.Layers {
+		if e.Layers[i].Mode == modeKey(mode) {
+			return &e.Layers[i]
+		}
+	}
+	return nil
+}
+
+// load reads a region's entry, only as far as its summary unless layers is
+// set.
+func (c *LayerCache) load(d *Dimension, region Region, layers bool) (*LayerEntry, error) {
+	f, err := os.Open(c.filename(d, region))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	
+	var entry LayerEntry
+	dec := gob.NewDecoder(f)
+	if err := dec.Decode(&entry); err != nil {
+		return nil, err
+	}
+	if !layers {
+		return &entry, nil
+	}
+	
+	for i := range entry.Layers {
+		if err := dec.Decode(&entry.Layers[i].Pix); err != nil {
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// Store replaces a region's entry with its freshly drawn layer. Regions
+// with errors are stored too, since they still need compositing, but are
+// drawn again next time.
+func (c *LayerCache) Store(d *Dimension, region Region, layer Layer, opts *Options) error {
+	stat, err := os.Stat(region.Path)
+	if err != nil {
+		return err
+	}
+	
+	entry := LayerEntry{Key: c.key, ModTime: stat.ModTime(), Size: stat.Size(), Complete: len(layer.Errors) == 0, Chunks: len(layer.Chunks), SurfaceMarkers: d.surfaceIn(region)}
+	for i, chunk := range layer.Chunks {
+		level := chunk.(Level)
+		if i == 0 {
+			entry.Blocks = TopDownMode{}.ChunkBounds(level)
+		} else {
+			entry.Blocks = entry.Blocks.Union(TopDownMode{}.ChunkBounds(level))
+		}
+		entry.Entities = append(entry.Entities, ChunkEntities(level, opts.Entities, opts)...)
+		entry.Found = append(entry.Found, FoundMarkers(level, opts)...)
+		entry.Surface = append(entry.Surface, d.SurfaceHeights(level)...)
+	}
+	
+	for i, img := range layer.Imgs {
+		mode := d.Outputs[i].Mode
+		cached := CachedLayer{Mode: modeKey(mode), Name: mode.Name(), Bounds: img.Bounds()}
+		for j, chunk := range layer.Chunks {
+			if j == 0 {
+				cached.ChunkBounds = mode.ChunkBounds(chunk.(Level))
+			} else {
+				cached.ChunkBounds = cached.ChunkBounds.Union(mode.ChunkBounds(chunk.(Level)))
+			}
+		}
+		
+		var buf bytes.Buffer
+		fw, err := flate.NewWriter(&buf, flate.BestSpeed)
+		if err != nil {
+			return err
+		}
+		fw.Write(img.Pix)
+		if err := fw.Close(); err != nil {
+			return err
+		}
+		cached.Pix = buf.Bytes()
+		entry.Layers = append(entry.Layers, cached)
+	}
+	
+	filename := c.filename(d, region)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	
+	// Written under a temporary name so an interrupted render never leaves a
+	// truncated entry behind.
+	f, err := ioutil.TempFile(filepath.Dir(filename), ".layer-")
+	if err != nil {
+		return err
+	}
+	enc := gob.NewEncoder(f)
+	summary := entry
+	summary.Layers = make([]CachedLayer, len(entry.Layers))
+	for i, l := range entry.Layers {
+		l.Pix = nil
+		summary.Layers[i] = l
+	}
+	err = enc.Encode(summary)
+	for i := 0; err == nil && i < len(entry.Layers); i++ {
+		err = enc.Encode(entry.Layers[i].Pix)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		return err
+	}
+	return c.state.Record(stateName(d, region), region, entry.Tiles(), layer.Errors)
+}
+
+// Composite adds every region's layer to its dimension in order from the
+// cache, along with everything else its chunks add.
+func (c *LayerCache) Composite(dimensions []*Dimension, regions PositionList, opts *Options) error {
+	for _, r := range regions {
+		region := r.(Region)
+		d := dimensions[region.Dimension]
+		entry, err := c.load(d, region, true)
+		if err != nil {
+			return err
+		}
+		d.AddCached(entry, opts)
+		if entry.Chunks == 0 {
+			continue
+		}
+		
+		var layer Layer
+		for _, output := range d.Outputs {
+			img, err := entry.find(output.Mode).Image()
+			if err != nil {
+				return fmt.Errorf("%s: %s", c.filename(d, region), err)
+			}
+			layer.Imgs = append(layer.Imgs, img)
+		}
+		if err := d.AddLayer(layer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *CachedLayer) Image() (*image.RGBA, error) {
+	img := image.NewRGBA(l.Bounds)
+	fr := flate.NewReader(bytes.NewReader(l.Pix))
+	defer fr.Close()
+	_, err := io.ReadFull(fr, img.Pix)
+	return img, err
+}
@@ -0,0 +1,101 @@
+package render
+
+import (
+	"fmt"
+	"bytes"
+	"github.com/bemasher/GoNBT"
+)
+
+const (
+	LEGACYGLOBPATTERN = "region/*.mcr"
+	LEGACYHEIGHT = 128
+)
+
+// LegacyLevel is the pre-Anvil MCRegion chunk layout: a single 128 block
+// high Blocks array indexed with y varying fastest, then z, then x.
+type LegacyLevel struct {
+	X int32 `nbt:"xPos"`
+	Z int32 `nbt:"zPos"`
+	LastUpdate int64
+	TerrainPopulated byte
+	HeightMap []byte
+	Blocks []byte
+	Data []byte
+	BlockLight []byte
+	Entities []Entity
+}
+
+func (l *Level) DecodeLegacy(data []byte) (err error) {
+	if err = ValidateNBT(data); err != nil {
+		return
+	}
+	
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("nbt: %v", r)
+		}
+	}()
+	
+	var legacy LegacyLevel
+	nbt.Read(bytes.NewReader(data), &legacy)
+	
+	if len(legacy.Blocks) != LEGACYHEIGHT * 256 {
+		return fmt.Errorf("legacy chunk has %d blocks, expected %d", len(legacy.Blocks), LEGACYHEIGHT * 256)
+	}
+	
+	*l = legacy.Level()
+	return
+}
+
+// Level converts the chunk into Anvil sections so it can be drawn like any
+// other chunk. Nibble metadata and light are repacked alongside the block
+// ids.
+func (legacy LegacyLevel) Level() (l Level) {
+	l.X, l.Z = legacy.X, legacy.Z
+	l.LastUpdate = legacy.LastUpdate
+	l.TerrainPopulated = legacy.TerrainPopulated
+	l.Entities = legacy.Entities
+	
+	l.HeightMap = make([]int32, len(legacy.HeightMap))
+	for i, h := range legacy.HeightMap {
+		l.HeightMap[i] = int32(h)
+	}
+	
+	hasData := len(legacy.Data) == len(legacy.Blocks) / 2
+	hasLight := len(legacy.BlockLight) == len(legacy.Blocks) / 2
+	for sy := 0; sy < LEGACYHEIGHT >> 4; sy++ {
+		section := Section{Y: byte(sy), Blocks: make([]byte, 4096), Data: make([]byte, 2048)}
+		if hasLight {
+			section.BlockLight = make([]byte, 2048)
+		}
+		
+		empty := true
+		for y := 0; y < 16; y++ {
+			for z := 0; z < 16; z++ {
+				for x := 0; x < 16; x++ {
+					src := (x << 4 + z) << 7 + sy << 4 + y
+					dst := (y << 4 + z) << 4 + x
+					
+					section.Blocks[dst] = legacy.Blocks[src]
+					if section.Blocks[dst] != 0 {
+						empty = false
+					}
+					
+					if hasData {
+						nibble := legacy.Data[src >> 1] >> uint(src & 1 << 2) & 0x0F
+						section.Data[dst >> 1] |= nibble << uint(dst & 1 << 2)
+					}
+					if hasLight {
+						nibble := legacy.BlockLight[src >> 1] >> uint(src & 1 << 2) & 0x0F
+						section.BlockLight[dst >> 1] |= nibble << uint(dst & 1 << 2)
+					}
+				}
+			}
+		}
+		
+		if !empty {
+			l.Sections = append(l.Sections, section)
+		}
+	}
+	return
+}
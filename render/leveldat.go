@@ -0,0 +1,93 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"path/filepath"
+)
+
+const LEVELDATFILE = "level.dat"
+
+type LevelDat struct {
+	Data LevelData
+}
+
+// LevelData is the part of level.dat describing the world. Worlds from 1.16
+// on keep their seed in WorldGenSettings rather than RandomSeed, so Seed
+// should be used to read it.
+type LevelData struct {
+	LevelName string
+	RandomSeed int64
+	Time int64
+	SpawnX, SpawnY, SpawnZ int32
+	Version GameVersion
+	WorldGenSettings WorldGenSettings
+	
+	// GameRules holds each rule's value as the game keeps it, as a string.
+	GameRules map[string]string `nbt:"-"`
+}
+
+// A GameVersion is the version of the game that last saved a world, which
+// only 1.9 and later record.
+type GameVersion struct {
+	Id int32
+	Name string
+}
+
+type WorldGenSettings struct {
+	Seed int64 `nbt:"seed"`
+}
+
+func ReadLevelDat(dir string) (level LevelDat, err error) {
+	path := filepath.Join(dir, LEVELDATFILE)
+	data, err := ReadNBTData(path)
+	if err != nil {
+		return
+	}
+	if err = DecodeNBT(path, data, &level); err != nil {
+		return
+	}
+	
+	// Game rules are keyed by name, so they're read from the tree instead.
+	root, err := ReadNBTTree(data)
+	if err != nil {
+		return level, fmt.Errorf("%s: %s", path, err)
+	}
+	levelData, _ := root["Data"].(map[string]interface{})
+	rules, _ := levelData["GameRules"].(map[string]interface{})
+	level.Data.GameRules = make(map[string]string)
+	for name, value := range rules {
+		if s, ok := value.(string); ok {
+			level.Data.GameRules[name] = s
+		}
+	}
+	return
+}
+
+// Seed is the world's seed, wherever its version keeps it.
+func (d LevelData) Seed() int64 {
+	if d.WorldGenSettings.Seed != 0 {
+		return d.WorldGenSettings.Seed
+	}
+	return d.RandomSeed
+}
+
+// Summary describes the world in a line for the render summary.
+func (d LevelData) Summary() string {
+	version := d.Version.Name
+	if version == "" {
+		version = "an unknown version"
+	}
+	return fmt.Sprintf("World %q from %s, seed %d, spawn at %d,%d,%d", d.LevelName, version, d.Seed(), d.SpawnX, d.SpawnY, d.SpawnZ)
+}
+
+// Rules lists the world's game rules as name=value, sorted by name.
+func (d LevelData) Rules() string {
+	rules := make([]string, 0, len(d.GameRules))
+	for name, value := range d.GameRules {
+		rules = append(rules, name + "=" + value)
+	}
+	sort.Strings(rules)
+	return strings.Join(rules, " ")
+}
@@ -0,0 +1,247 @@
+package render
+
+import (
+	"os"
+	"sync"
+	"time"
+	"bytes"
+	"image"
+	"net/http"
+	"encoding/json"
+)
+
+// LIVEQUEUE is how many updates a viewer can fall behind before it's
+// dropped and left to reconnect.
+const LIVEQUEUE = 16
+
+// A TileUpdate lists the tiles, as z, x, y, that changed since it was last
+// sent. Every layer of each has been thrown away.
+type TileUpdate struct {
+	Tiles [][3]int `json:"tiles"`
+}
+
+// TileEvents fans updates out to every connected viewer.
+type TileEvents struct {
+	mu sync.Mutex
+	viewers map[chan []byte]bool
+}
+
+func (e *TileEvents) subscribe() chan []byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	
+	if e.viewers == nil {
+		e.viewers = make(map[chan []byte]bool)
+	}
+	c := make(chan []byte, LIVEQUEUE)
+	e.viewers[c] = true
+	return c
+}
+
+func (e *TileEvents) unsubscribe(c chan []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	
+	if e.viewers[c] {
+		delete(e.viewers, c)
+		close(c)
+	}
+}
+
+// Publish sends message to every viewer, dropping any too far behind.
+func (e *TileEvents) Publish(message []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	
+	for c := range e.viewers {
+		select {
+		case c <- message:
+		default:
+			delete(e.viewers, c)
+			close(c)
+		}
+	}
+}
+
+// ServeHTTP upgrades the request to a WebSocket and passes it updates until
+// either end gives up.
+func (e *TileEvents) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := UpgradeWebSocket(w, r)
+	if err == ErrWebSocketOrigin {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer ws.Close()
+	
+	c := e.subscribe()
+	go func() {
+		ws.Wait()
+		e.unsubscribe(c)
+	}()
+	
+	for message := range c {
+		if err := ws.WriteText(message); err != nil {
+			e.unsubscribe(c)
+			return
+		}
+	}
+}
+
+// WatchRegions polls the region files every Watch for chunks saved since the
+// last look, throwing away every tile showing them and telling viewers.
+// Only regions that existed when serving started are watched.
+func (t *TileServer) WatchRegions() {
+	saved := make(map[string]Header)
+	modified := make(map[string]time.Time)
+	for _, r := range t.Regions {
+		region := r.(Region)
+		if rf, err := openRegion(region, true); err == nil {
+			saved[region.Path] = rf.Header
+			modified[region.Path] = t.regionModified(region)
+			rf.Close()
+		}
+	}
+	
+	ticker := time.NewTicker(t.Watch)
+	for _ = range ticker.C {
+		var chunks []image.Point
+		for _, r := range t.Regions {
+			region := r.(Region)
+			mtime := t.regionModified(region)
+			if mtime.Equal(modified[region.Path]) {
+				continue
+			}
+			
+			rf, err := openRegion(region, true)
+			if err != nil {
+				t.Opts.Progress.Errorf("Error watching %s: %s", region.Path, err)
+				continue
+			}
+			old := saved[region.Path]
+			for i, timestamp := range rf.Header.Timestamps {
+				x, z := region.X << 5 + i & 31, region.Z << 5 + i >> 5
+				if timestamp != old.Timestamps[i] && t.Opts.Area.ContainsChunk(x, z) {
+					chunks = append(chunks, image.Pt(x, z))
+				}
+			}
+			saved[region.Path] = rf.Header
+			modified[region.Path] = mtime
+			rf.Close()
+		}
+		
+		if len(chunks) != 0 {
+			t.Invalidate(chunks)
+		}
+	}
+}
+
+func (t *TileServer) regionModified(region Region) time.Time {
+	stat, err := os.Stat(region.Path)
+	if err != nil {
+		return time.Time{}
+	}
+	return stat.ModTime()
+}
+
+// Invalidate throws away every tile, at every zoom and in every layer, that
+// shows any of chunks, and tells viewers which they were.
+func (t *TileServer) Invalidate(chunks []image.Point) {
+	tiles := make(map[[3]int]bool)
+	for _, chunk := range chunks {
+		x, z := chunk.X << 4, chunk.Y << 4
+		bounds := t.Mode.AreaBounds(Area{X0: x, Z0: z, X1: x + 15, Z1: z + 15}).Intersect(t.Bounds)
+		if bounds.Empty() {
+			continue
+		}
+		
+		bounds = bounds.Sub(t.Bounds.Min)
+		for zoom := t.Zooms - 1; zoom >= 0; zoom-- {
+			size := TILESIZE << uint(t.Zooms - 1 - zoom)
+			for ty := bounds.Min.Y / size; ty <= (bounds.Max.Y - 1) / size; ty++ {
+				for tx := bounds.Min.X / size; tx <= (bounds.Max.X - 1) / size; tx++ {
+					tiles[[3]int{zoom, tx, ty}] = true
+				}
+			}
+		}
+	}
+	
+	// Held so no tile drawn from the old chunks is saved after this.
+	t.mu.Lock()
+	var update TileUpdate
+	for tile := range tiles {
+		for _, layer := range t.Layers {
+			filename := t.Filename(nil, layer.Name, tile[0], tile[1], tile[2])
+			t.cache.Remove(filename)
+			os.Remove(filename)
+		}
+		update.Tiles = append(update.Tiles, tile)
+	}
+	t.mu.Unlock()
+	
+	t.Opts.Progress.Printf("%d chunks saved, %d tiles to redraw", len(chunks), len(update.Tiles))
+	if message, err := json.Marshal(update); err == nil {
+		t.Events.Publish(message)
+	}
+}
+
+// PlayerUpdate is sent to viewers whenever who is online, or where, changes.
+type PlayerUpdate struct {
+	Players []LivePlayer `json:"players"`
+}
+
+// Players returns who was online in the served dimension at the last poll.
+func (t *TileServer) Players() PlayerUpdate {
+	t.playersMu.Lock()
+	defer t.playersMu.Unlock()
+	return PlayerUpdate{t.players}
+}
+
+// PollPlayers asks the server over RCON where everyone is every
+// RCONInterval, telling viewers about any change. A lost connection is
+// redialed at the next poll.
+func (t *TileServer) PollPlayers() {
+	var (
+		rcon *RCON
+		last []byte
+	)
+	ticker := time.NewTicker(t.RCONInterval)
+	for ; ; <-ticker.C {
+		var err error
+		if rcon == nil {
+			if rcon, err = DialRCON(t.RCON, t.RCONPassword); err != nil {
+				t.Opts.Progress.Errorf("Error connecting to RCON: %s", err)
+				continue
+			}
+		}
+		
+		all, err := rcon.Players()
+		if err != nil {
+			t.Opts.Progress.Errorf("Error listing players: %s", err)
+			rcon.Close()
+			rcon = nil
+			continue
+		}
+		
+		var update PlayerUpdate
+		for _, p := range all {
+			if p.Dimension == t.Dimension {
+				update.Players = append(update.Players, p)
+			}
+		}
+		
+		message, err := json.Marshal(update)
+		if err != nil || bytes.Equal(message, last) {
+			continue
+		}
+		last = message
+		
+		t.playersMu.Lock()
+		t.players = update.Players
+		t.playersMu.Unlock()
+		t.Events.Publish(message)
+	}
+}
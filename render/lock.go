@@ -0,0 +1,142 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"errors"
+	"syscall"
+	"io/ioutil"
+	"path/filepath"
+)
+
+const (
+	LOCKFILE = ".gocart.lock"
+	LOCKHEARTBEAT = time.Minute
+	LOCKSTALE = 10 * LOCKHEARTBEAT
+)
+
+// A Lock keeps other GoCart runs out of a directory. The holder touches the
+// lock file every LOCKHEARTBEAT, so a lock left behind by a crashed or killed
+// run is recognised as stale once it hasn't been touched for LOCKSTALE. This
+// works across hosts sharing a filesystem, unlike checking process IDs.
+type Lock struct {
+	Path string
+	done chan bool
+}
+
+type LockedError struct {
+	Path string
+	Owner string
+	Age time.Duration
+}
+
+func (e LockedError) Error() string {
+	return fmt.Sprintf("%s is held by %s (last refreshed %s ago)", e.Path, e.Owner, e.Age - e.Age % time.Second)
+}
+
+// AcquireLock takes the lock in dir, retrying until wait has passed.
+func AcquireLock(dir string, wait time.Duration) (*Lock, error) {
+	path := filepath.Join(dir, LOCKFILE)
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("pid %d on %s since %s", os.Getpid(), host, time.Now().Format(time.RFC3339))
+	deadline := time.Now().Add(wait)
+	
+	for {
+		lockFile, err := os.OpenFile(path, os.O_WRONLY | os.O_CREATE | os.O_EXCL, 0644)
+		if err == nil {
+			_, err = lockFile.WriteString(owner + "\n")
+			lockFile.Close()
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			
+			l := &Lock{path, make(chan bool)}
+			go l.heartbeat()
+			return l, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		
+		stat, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		
+		age := time.Since(stat.ModTime())
+		if age > LOCKSTALE || abandoned(path) {
+			os.Remove(path)
+			continue
+		}
+		
+		if !time.Now().Before(deadline) {
+			held, _ := ioutil.ReadFile(path)
+			return nil, LockedError{path, string(trimNewline(held)), age}
+		}
+		
+		pause := time.Second
+		if remaining := deadline.Sub(time.Now()); remaining < pause {
+			pause = remaining
+		}
+		time.Sleep(pause)
+	}
+}
+
+// abandoned reports whether the lock's owner was a process on this host
+// that has since died, as after a crash or kill, so it needn't go stale
+// before a render can -resume.
+func abandoned(path string) bool {
+	held, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	
+	var (
+		pid int
+		owner string
+	)
+	if _, err := fmt.Sscanf(string(held), "pid %d on %s since", &pid, &owner); err != nil {
+		return false
+	}
+	host, _ := os.Hostname()
+	return owner == host && pid != os.Getpid() && !ProcessExists(pid)
+}
+
+func trimNewline(b []byte) []byte {
+	for len(b) > 0 && (b[len(b) - 1] == '\n' || b[len(b) - 1] == '\r') {
+		b = b[:len(b) - 1]
+	}
+	return b
+}
+
+func (l *Lock) heartbeat() {
+	ticker := time.NewTicker(LOCKHEARTBEAT)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			os.Chtimes(l.Path, now, now)
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// ReadOnly reports whether err is from writing where that isn't allowed,
+// including on a read-only mount.
+func ReadOnly(err error) bool {
+	return os.IsPermission(err) || errors.Is(err, syscall.EROFS)
+}
+
+func (l *Lock) Release() {
+	if l != nil {
+		close(l.done)
+		os.Remove(l.Path)
+	}
+}
@@ -0,0 +1,29 @@
+package render
+
+import (
+	"os"
+	"syscall"
+)
+
+// ProcessExists reports whether a process with pid is running, by sending it
+// no signal at all.
+func ProcessExists(pid int) bool {
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
+
+// FileLocked reports whether another process holds a lock on the file at
+// path, as the game does on a world's session.lock while it has the world
+// open.
+func FileLocked(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	
+	lock := syscall.Flock_t{Type: syscall.F_WRLCK}
+	if err := syscall.FcntlFlock(f.Fd(), syscall.F_GETLK, &lock); err != nil {
+		return false
+	}
+	return lock.Type != syscall.F_UNLCK
+}
@@ -0,0 +1,13 @@
+// +build !linux
+
+package render
+
+// ProcessExists can't tell here, so locks are only taken over once stale.
+func ProcessExists(pid int) bool {
+	return true
+}
+
+// FileLocked can't tell here, so worlds are never known to be open.
+func FileLocked(path string) bool {
+	return false
+}
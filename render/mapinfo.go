@@ -0,0 +1,126 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"strconv"
+	"strings"
+	"path/filepath"
+	"encoding/json"
+)
+
+// A PixelTransform maps a block's x, y, z to the pixel it's drawn at:
+// pixel x = X[0]*x + X[1]*y + X[2]*z + X[3], and likewise for Y. Top-down
+// images ignore y; isometric ones need it to go back from pixels to blocks.
+type PixelTransform struct {
+	X [4]int `json:"x"`
+	Y [4]int `json:"y"`
+}
+
+// NewPixelTransform recovers the transform from mode's projection, which is
+// linear, offset so the image's top left pixel is 0, 0.
+func NewPixelTransform(mode Mode, output *Output) (t PixelTransform) {
+	x0, y0 := mode.Project(0, 0, 0)
+	for i, axis := range [3][3]int{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}} {
+		x, y := mode.Project(axis[0], axis[1], axis[2])
+		t.X[i], t.Y[i] = x - x0, y - y0
+	}
+	t.X[3], t.Y[3] = x0 - output.ChunkBounds.Min.X, y0 - output.ChunkBounds.Min.Y
+	return
+}
+
+// BlockBounds is the inclusive range of world coordinates rendered.
+type BlockBounds struct {
+	MinX int `json:"min_x"`
+	MinZ int `json:"min_z"`
+	MaxX int `json:"max_x"`
+	MaxZ int `json:"max_z"`
+}
+
+// MapInfo is written beside each image so other tools can relate its pixels
+// to world coordinates, which can't be recovered from the PNG alone.
+type MapInfo struct {
+	Image string `json:"image"`
+	World string `json:"world"`
+	Width int `json:"width"`
+	Height int `json:"height"`
+	
+	// Dimension is a vanilla dimension's numeric id, left out for custom
+	// dimensions, which only have a DimensionKey.
+	Dimension *int `json:"dimension,omitempty"`
+	DimensionKey string `json:"dimension_key,omitempty"`
+	
+	Mode string `json:"mode"`
+	Bounds BlockBounds `json:"bounds"`
+	Transform PixelTransform `json:"transform"`
+	Chunks int `json:"chunks"`
+	Rendered time.Time `json:"rendered"`
+	Duration float64 `json:"duration"`
+	Palette string `json:"palette"`
+}
+
+func MapInfoFilename(out string) string {
+	return strings.TrimSuffix(out, filepath.Ext(out)) + ".json"
+}
+
+// MapInfo describes output once everything has been drawn, with duration
+// the time taken so far.
+func (d *Dimension) MapInfo(output *Output, duration time.Duration) MapInfo {
+	world, err := filepath.Abs(d.Path)
+	if err != nil {
+		world = d.Path
+	}
+	
+	info := MapInfo{
+		Image: filepath.Base(output.Out),
+		World: world,
+		Width: output.ChunkBounds.Dx(),
+		Height: output.ChunkBounds.Dy(),
+		DimensionKey: d.Key,
+		Mode: output.Mode.Name(),
+		Bounds: BlockBounds{d.Blocks.Min.X, d.Blocks.Min.Y, d.Blocks.Max.X - 1, d.Blocks.Max.Y - 1},
+		Transform: NewPixelTransform(output.Mode, output),
+		Chunks: d.Chunks,
+		Rendered: time.Now(),
+		Duration: duration.Seconds(),
+		Palette: PaletteVersion(),
+	}
+	if d.ID != CUSTOMID {
+		id := d.ID
+		info.Dimension = &id
+	}
+	return info
+}
+
+func (info MapInfo) Write(filename string) error {
+	infoFile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer infoFile.Close()
+	
+	return json.NewEncoder(infoFile).Encode(info)
+}
+
+// Text is the subset of the info embedded in the PNG itself, so an image
+// found on its own can still be reproduced. Bounds are given in -area's
+// x0,z0,x1,z1 form.
+func (info MapInfo) Text() []PNGText {
+	transform, _ := json.Marshal(info.Transform)
+	b := info.Bounds
+	dimension := info.DimensionKey
+	if info.Dimension != nil {
+		dimension = strconv.Itoa(*info.Dimension)
+	}
+	return []PNGText{
+		{"Software", "GoCart " + Version},
+		{"Creation Time", info.Rendered.Format(time.RFC1123Z)},
+		{"GoCart:World", info.World},
+		{"GoCart:Dimension", dimension},
+		{"GoCart:Mode", info.Mode},
+		{"GoCart:Bounds", fmt.Sprintf("%d,%d,%d,%d", b.MinX, b.MinZ, b.MaxX, b.MaxZ)},
+		{"GoCart:Transform", string(transform)},
+		{"GoCart:Palette", info.Palette},
+	}
+}
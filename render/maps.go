@@ -0,0 +1,279 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"sort"
+	"image"
+	"strconv"
+	"strings"
+	"image/png"
+	"image/color"
+	"path/filepath"
+)
+
+const (
+	MAPPATTERN = "data/map_*.dat"
+	MAPSIZE = 128
+)
+
+// mapColors is the vanilla map color table. Each byte of a map's colors
+// picks one of these bases (c >> 2) and one of four shades (c & 3).
+var mapColors = []color.RGBA{
+	{0, 0, 0, 0},
+	{127, 178, 56, 255}, {247, 233, 163, 255}, {199, 199, 199, 255}, {255, 0, 0, 255},
+	{160, 160, 255, 255}, {167, 167, 167, 255}, {0, 124, 0, 255}, {255, 255, 255, 255},
+	{164, 168, 184, 255}, {151, 109, 77, 255}, {112, 112, 112, 255}, {64, 64, 255, 255},
+	{143, 119, 72, 255}, {255, 252, 245, 255}, {216, 127, 51, 255}, {178, 76, 216, 255},
+	{102, 153, 216, 255}, {229, 229, 51, 255}, {127, 204, 25, 255}, {242, 127, 165, 255},
+	{76, 76, 76, 255}, {153, 153, 153, 255}, {76, 127, 153, 255}, {127, 63, 178, 255},
+	{51, 76, 178, 255}, {102, 76, 51, 255}, {102, 127, 51, 255}, {153, 51, 51, 255},
+	{25, 25, 25, 255}, {250, 238, 77, 255}, {92, 219, 213, 255}, {74, 128, 255, 255},
+	{0, 217, 58, 255}, {129, 86, 49, 255}, {112, 2, 0, 255}, {209, 177, 161, 255},
+	{159, 82, 36, 255}, {149, 87, 108, 255}, {112, 108, 138, 255}, {186, 133, 36, 255},
+	{103, 117, 53, 255}, {160, 77, 78, 255}, {57, 41, 35, 255}, {135, 107, 98, 255},
+	{87, 92, 92, 255}, {122, 73, 88, 255}, {76, 62, 92, 255}, {76, 50, 35, 255},
+	{76, 82, 42, 255}, {142, 60, 46, 255}, {37, 22, 16, 255},
+}
+
+var mapShades = [4]uint32{180, 220, 255, 135}
+
+func MapColor(c byte) color.RGBA {
+	base := int(c >> 2)
+	if base == 0 || base >= len(mapColors) {
+		return color.RGBA{}
+	}
+	
+	shade := mapShades[c & 3]
+	b := mapColors[base]
+	return color.RGBA{uint8(uint32(b.R) * shade / 255), uint8(uint32(b.G) * shade / 255), uint8(uint32(b.B) * shade / 255), 0xff}
+}
+
+// A MapItem is one data/map_<id>.dat file.
+type MapItem struct {
+	ID int `nbt:"-"`
+	Scale byte `nbt:"scale"`
+	Dimension byte `nbt:"dimension"`
+	XCenter int32 `nbt:"xCenter"`
+	ZCenter int32 `nbt:"zCenter"`
+	Colors []byte `nbt:"colors"`
+}
+
+func ReadMapItems(dir string) (maps []*MapItem, err error) {
+	files, err := filepath.Glob(filepath.Join(dir, MAPPATTERN))
+	if err != nil {
+		return nil, err
+	}
+	
+	for _, file := range files {
+		m := new(MapItem)
+		if _, err := fmt.Sscanf(filepath.Base(file), "map_%d.dat", &m.ID); err != nil {
+			continue
+		}
+		if err := ReadNBTFile(file, m); err != nil {
+			return nil, err
+		}
+		if len(m.Colors) != MAPSIZE * MAPSIZE {
+			return nil, fmt.Errorf("%s: expected %d colors, found %d", file, MAPSIZE * MAPSIZE, len(m.Colors))
+		}
+		maps = append(maps, m)
+	}
+	
+	sort.Sort(byMapID(maps))
+	return
+}
+
+func (m *MapItem) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, MAPSIZE, MAPSIZE))
+	for i, c := range m.Colors {
+		img.SetRGBA(i % MAPSIZE, i / MAPSIZE, MapColor(c))
+	}
+	return img
+}
+
+// Blocks is the width of world each map pixel covers.
+func (m *MapItem) Blocks() int {
+	return 1 << uint(Min(int(m.Scale), 4))
+}
+
+// Bounds is the area of the world the map covers, in blocks.
+func (m *MapItem) Bounds() image.Rectangle {
+	half := MAPSIZE * m.Blocks() / 2
+	return image.Rect(int(m.XCenter) - half, int(m.ZCenter) - half, int(m.XCenter) + half, int(m.ZCenter) + half)
+}
+
+// DrawScaled draws src onto dst at r, repeating each source pixel as needed.
+func DrawScaled(dst *image.RGBA, r image.Rectangle, src *image.RGBA) {
+	sb := src.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := src.RGBAAt(sb.Min.X + (x - r.Min.X) * sb.Dx() / r.Dx(), sb.Min.Y + (y - r.Min.Y) * sb.Dy() / r.Dy())
+			if c.A != 0 {
+				dst.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+// MapGrid lays maps out in ID order, columns wide.
+func MapGrid(maps []*MapItem, columns, scale int) *image.RGBA {
+	size := MAPSIZE * scale
+	rows := (len(maps) + columns - 1) / columns
+	img := image.NewRGBA(image.Rect(0, 0, Min(columns, len(maps)) * size, rows * size))
+	for i, m := range maps {
+		pt := image.Pt(i % columns * size, i / columns * size)
+		DrawScaled(img, image.Rectangle{pt, pt.Add(image.Pt(size, size))}, m.Image())
+	}
+	return img
+}
+
+// MapWall places maps where they are in the world at the resolution of the
+// most detailed map, drawing detailed maps over coarser ones.
+func MapWall(maps []*MapItem) *image.RGBA {
+	finest := maps[0].Blocks()
+	var bounds image.Rectangle
+	for _, m := range maps {
+		finest = Min(finest, m.Blocks())
+		bounds = bounds.Union(m.Bounds())
+	}
+	
+	byScale := append([]*MapItem(nil), maps...)
+	sort.Stable(byMapScale(byScale))
+	
+	pixels := func(r image.Rectangle) image.Rectangle {
+		return image.Rect(floorDiv(r.Min.X, finest), floorDiv(r.Min.Y, finest), floorDiv(r.Max.X, finest), floorDiv(r.Max.Y, finest))
+	}
+	
+	img := image.NewRGBA(pixels(bounds))
+	for _, m := range byScale {
+		DrawScaled(img, pixels(m.Bounds()), m.Image())
+	}
+	return img
+}
+
+func writePNG(filename string, img image.Image) error {
+	imgFile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer imgFile.Close()
+	return png.Encode(imgFile, img)
+}
+
+// Maps renders the map items players have made, for archiving map art.
+func Maps(args []string) error {
+	var (
+		dir, outFilename, layout, ids string
+		columns, scale, dimension int
+		progress Progress
+	)
+	
+	flags := flag.NewFlagSet("maps", flag.ContinueOnError)
+	flags.StringVar(&dir, "dir", DIR, "Read map items from the world at this directory.")
+	flags.StringVar(&outFilename, "out", "maps.png", "Write the maps to this file, or to files named after it with -layout single.")
+	flags.StringVar(&layout, "layout", "grid", "Draw maps in a grid by ID, placed by their world position (world), or each to its own file (single).")
+	flags.StringVar(&ids, "ids", "", "Only draw these comma-separated map IDs.")
+	flags.IntVar(&columns, "columns", 0, "Number of maps per row with -layout grid (0 for a square grid).")
+	flags.IntVar(&scale, "scale", 1, "Enlarge each map pixel to this many image pixels with -layout grid and single.")
+	flags.IntVar(&dimension, "dimension", 0, "Only place maps of this dimension with -layout world.")
+	progress.Flags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	progress.Start()
+	
+	maps, err := ReadMapItems(dir)
+	if err != nil {
+		return fatalError("Error reading maps: ", err)
+	}
+	
+	if ids != "" {
+		wanted := make(map[int]bool)
+		for _, id := range strings.Split(ids, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				return fatalError("Error parsing -ids: ", err)
+			}
+			wanted[n] = true
+		}
+		
+		var selected []*MapItem
+		for _, m := range maps {
+			if wanted[m.ID] {
+				selected = append(selected, m)
+			}
+		}
+		maps = selected
+	}
+	
+	if layout == "world" {
+		var placed []*MapItem
+		for _, m := range maps {
+			if int(int8(m.Dimension)) == dimension {
+				placed = append(placed, m)
+			}
+		}
+		maps = placed
+	}
+	
+	if len(maps) == 0 {
+		return fatalError("Error reading maps: ", fmt.Errorf("no maps found in %s", filepath.Join(dir, filepath.Dir(MAPPATTERN))))
+	}
+	scale = Max(scale, 1)
+	
+	switch layout {
+	case "single":
+		for _, m := range maps {
+			img := MapGrid([]*MapItem{m}, 1, scale)
+			if err := writePNG(OutputFilename(outFilename, fmt.Sprint(m.ID)), img); err != nil {
+				return fatalError("Error writing map: ", err)
+			}
+		}
+	case "grid":
+		if columns <= 0 {
+			for columns = 1; columns * columns < len(maps); columns++ {
+			}
+		}
+		err = writePNG(outFilename, MapGrid(maps, columns, scale))
+	case "world":
+		err = writePNG(outFilename, MapWall(maps))
+	default:
+		return fatalError("Error parsing flags: ", fmt.Errorf("unknown layout %q, expected grid, world or single", layout))
+	}
+	if err != nil {
+		return fatalError("Error writing maps: ", err)
+	}
+	
+	progress.Printf("Rendered %d maps", len(maps))
+	return nil
+}
+
+type byMapID []*MapItem
+
+func (b byMapID) Len() int {
+	return len(b)
+}
+
+func (b byMapID) Less(i, j int) bool {
+	return b[i].ID < b[j].ID
+}
+
+func (b byMapID) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
+
+// byMapScale orders coarse maps first so detailed ones are drawn over them.
+type byMapScale []*MapItem
+
+func (b byMapScale) Len() int {
+	return len(b)
+}
+
+func (b byMapScale) Less(i, j int) bool {
+	return b[i].Scale > b[j].Scale
+}
+
+func (b byMapScale) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
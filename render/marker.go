@@ -0,0 +1,54 @@
+package render
+
+import (
+	"image"
+	"image/draw"
+	"image/color"
+)
+
+var (
+	markerColor = color.RGBA{0xff, 0xd7, 0x00, 0xff}
+	markerOutline = color.RGBA{0x00, 0x00, 0x00, 0xff}
+)
+
+// A Marker is a labelled point of interest drawn over the finished map.
+// Surface markers have their Y replaced by the terrain height once the chunk
+// beneath them is rendered. Markers with an Icon, such as players' heads,
+// draw it in place of a dot.
+type Marker struct {
+	Label string
+	X, Y, Z int
+	Surface bool
+	Color color.RGBA
+	Player string
+	Icon *image.RGBA
+}
+
+func (m Marker) GetPos() (int, int) {
+	return m.X, m.Z
+}
+
+func DrawMarker(img *image.RGBA, mode Mode, m Marker, style TextStyle) {
+	x, y := mode.Project(m.X, m.Y, m.Z)
+	
+	c := m.Color
+	if c.A == 0 {
+		c = markerColor
+	}
+	
+	top := y - 2
+	if m.Icon != nil {
+		icon := m.Icon.Bounds()
+		at := image.Pt(x - icon.Dx() / 2, y - icon.Dy() / 2)
+		top = at.Y - 1
+		draw.Draw(img, image.Rectangle{at, at.Add(icon.Size())}.Inset(-1), image.NewUniform(markerOutline), image.ZP, draw.Src)
+		draw.Draw(img, image.Rectangle{at, at.Add(icon.Size())}, m.Icon, icon.Min, draw.Over)
+	} else {
+		draw.Draw(img, image.Rect(x - 3, y - 2, x + 3, y + 4), image.NewUniform(markerOutline), image.ZP, draw.Src)
+		draw.Draw(img, image.Rect(x - 2, y - 1, x + 2, y + 3), image.NewUniform(c), image.ZP, draw.Src)
+	}
+	
+	if m.Label != "" {
+		DrawText(img, image.Pt(x - style.Width(m.Label) / 2, top - style.Height() - 1 - Max(style.Halo, 0)), m.Label, style)
+	}
+}
@@ -0,0 +1,142 @@
+package render
+
+import (
+	"io"
+	"fmt"
+	"math"
+	"sort"
+	"bytes"
+	"image"
+	"strings"
+	"image/png"
+	"path/filepath"
+)
+
+// MBTILESID is the application ID marking SQLite files as MBTiles ("MPBX").
+const MBTILESID = 0x4D504258
+
+// IsMBTiles reports whether out names an MBTiles file rather than an image.
+func IsMBTiles(out string) bool {
+	return strings.EqualFold(filepath.Ext(out), ".mbtiles")
+}
+
+type mbtilesEntry struct {
+	zoom, col, row int
+	rowid int64
+}
+
+type mbtilesIndex []mbtilesEntry
+
+func (idx mbtilesIndex) Len() int {
+	return len(idx)
+}
+
+func (idx mbtilesIndex) Less(i, j int) bool {
+	a, b := idx[i], idx[j]
+	if a.zoom != b.zoom {
+		return a.zoom < b.zoom
+	}
+	if a.col != b.col {
+		return a.col < b.col
+	}
+	return a.row < b.row
+}
+
+func (idx mbtilesIndex) Swap(i, j int) {
+	idx[i], idx[j] = idx[j], idx[i]
+}
+
+// An MBTilesWriter stores an image's tile pyramid in an MBTiles database,
+// zoom 0 being the level where the whole image fits in one tile. The image
+// sits in the top left corner of the square the zoom levels cover, and tiles
+// with nothing drawn in them are left out.
+type MBTilesWriter struct {
+	*Pyramid
+	Name string
+	
+	db *SQLiteDB
+	metadata *SQLiteTable
+	tiles *SQLiteTable
+	index mbtilesIndex
+}
+
+func NewMBTilesWriter(w io.WriterAt, name string, bounds image.Rectangle) *MBTilesWriter {
+	mb := &MBTilesWriter{Name: name, db: NewSQLiteDB(w)}
+	mb.db.ApplicationID = MBTILESID
+	mb.metadata = mb.db.CreateTable("metadata", "CREATE TABLE metadata (name text, value text)")
+	mb.tiles = mb.db.CreateTable("tiles", "CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob)")
+	mb.Pyramid = NewPyramid(bounds, PyramidLevels(bounds, TILESIZE), mb.tile)
+	return mb
+}
+
+func (mb *MBTilesWriter) tile(zoom, col, row int, tile *image.RGBA) error {
+	// The tile is cut from a row of them, so its Pix runs on past its edge.
+	empty := true
+	for y := tile.Rect.Min.Y; y < tile.Rect.Max.Y && empty; y++ {
+		line := tile.Pix[tile.PixOffset(tile.Rect.Min.X, y):][:4 * tile.Rect.Dx()]
+		for i := 3; i < len(line) && empty; i += 4 {
+			empty = line[i] == 0
+		}
+	}
+	if empty {
+		return nil
+	}
+	
+	buf := bytes.NewBuffer(nil)
+	if err := png.Encode(buf, tile); err != nil {
+		return err
+	}
+	
+	// Rows count up from the bottom, as in TMS.
+	row = 1 << uint(zoom) - 1 - row
+	rowid, err := mb.tiles.Insert(zoom, col, row, buf.Bytes())
+	mb.index = append(mb.index, mbtilesEntry{zoom, col, row, rowid})
+	return err
+}
+
+// lonLat places a pixel of the image on the Web Mercator world the tiles
+// cover, for viewers that want to know where to look.
+func (mb *MBTilesWriter) lonLat(x, y float64) (float64, float64) {
+	size := float64(int(TILESIZE) << uint(len(mb.levels) - 1))
+	return x / size * 360 - 180, math.Atan(math.Sinh(math.Pi * (1 - 2 * y / size))) * 180 / math.Pi
+}
+
+// Close writes any tiles still held, the metadata and the tile index.
+func (mb *MBTilesWriter) Close() error {
+	if err := mb.Pyramid.Close(); err != nil {
+		return err
+	}
+	
+	maxZoom := len(mb.levels) - 1
+	w, h := float64(mb.Bounds.Dx()), float64(mb.Bounds.Dy())
+	left, top := mb.lonLat(0, 0)
+	right, bottom := mb.lonLat(w, h)
+	lon, lat := mb.lonLat(w / 2, h / 2)
+	
+	metadata := [][2]string{
+		{"name", mb.Name},
+		{"type", "baselayer"},
+		{"version", "1"},
+		{"description", "Rendered by GoCart " + Version},
+		{"format", "png"},
+		{"minzoom", "0"},
+		{"maxzoom", fmt.Sprint(maxZoom)},
+		{"bounds", fmt.Sprintf("%f,%f,%f,%f", left, bottom, right, top)},
+		{"center", fmt.Sprintf("%f,%f,%d", lon, lat, Max(maxZoom - 2, 0))},
+	}
+	for _, m := range metadata {
+		if _, err := mb.metadata.Insert(m[0], m[1]); err != nil {
+			return err
+		}
+	}
+	
+	sort.Sort(mb.index)
+	entries := make([][]interface{}, len(mb.index))
+	for i, e := range mb.index {
+		entries[i] = []interface{}{e.zoom, e.col, e.row, e.rowid}
+	}
+	if err := mb.db.CreateIndex("tile_index", "tiles", "CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row)", entries); err != nil {
+		return err
+	}
+	return mb.db.Close()
+}
@@ -0,0 +1,122 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"testing"
+	"strings"
+	"image/png"
+	"image/color"
+	"encoding/binary"
+)
+
+func TestMBTilesWriter(t *testing.T) {
+	// Three columns of full size tiles, the last left transparent.
+	bounds := image.Rect(-100, -50, 500, 250)
+	src := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Min.X + 2 * TILESIZE; x++ {
+			src.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), uint8(x ^ y), 0xFF})
+		}
+	}
+	
+	f := tempFile(t, "test.mbtiles")
+	mb := NewMBTilesWriter(f, "test", bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 64 {
+		mb.Write(src.SubImage(image.Rect(bounds.Min.X, y, bounds.Max.X, y + 64)))
+	}
+	if err := mb.Close(); err != nil {
+		t.Fatal(err)
+	}
+	
+	data, schema := readSQLite(t, f)
+	if id := binary.BigEndian.Uint32(data[68:]); id != MBTILESID {
+		t.Errorf("application id = %#x, want %#x", id, MBTILESID)
+	}
+	var names []string
+	for _, object := range schema {
+		names = append(names, object[0].(string) + " " + object[1].(string))
+	}
+	if got := strings.Join(names, ", "); got != "table metadata, table tiles, index tile_index" {
+		t.Errorf("schema holds %s", got)
+	}
+	
+	metadata, err := ReadSQLiteTable(f, "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]string)
+	for _, row := range metadata {
+		values[row[0].(string)] = row[1].(string)
+	}
+	for name, want := range map[string]string{"name": "test", "format": "png", "minzoom": "0", "maxzoom": "2"} {
+		if values[name] != want {
+			t.Errorf("metadata %s = %q, want %q", name, values[name], want)
+		}
+	}
+	
+	rows, err := ReadSQLiteTable(f, "tiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tiles := make(map[[3]int64][]byte)
+	for _, row := range rows {
+		tiles[[3]int64{row[0].(int64), row[1].(int64), row[2].(int64)}] = row[3].([]byte)
+	}
+	
+	// Rows count up from the bottom of the four at zoom 2.
+	for key, want := range map[[3]int64]bool{
+		{0, 0, 0}: true,
+		{1, 0, 1}: true,
+		{2, 0, 3}: true,
+		{2, 1, 2}: true,
+		{2, 2, 3}: false,
+		{2, 2, 2}: false,
+	} {
+		if _, exists := tiles[key]; exists != want {
+			t.Errorf("tile %v exists: %t, want %t", key, exists, want)
+		}
+	}
+	
+	// A full size tile comes back exactly as drawn.
+	tile, err := png.Decode(bytes.NewReader(tiles[[3]int64{2, 1, 2}]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := bounds.Min.Add(image.Pt(TILESIZE, TILESIZE))
+	if tile.Bounds() != image.Rect(0, 0, TILESIZE, bounds.Dy() - TILESIZE) {
+		t.Fatalf("tile is %v", tile.Bounds())
+	}
+	for y := 0; y < tile.Bounds().Dy(); y++ {
+		for x := 0; x < TILESIZE; x++ {
+			if got, want := color.RGBAModel.Convert(tile.At(x, y)), src.At(origin.X + x, origin.Y + y); got != want {
+				t.Fatalf("pixel %d,%d = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+	
+	// The unique index covers every tile in order.
+	layout := &sqliteLayout{t: t, data: data, seen: make(map[uint32]int)}
+	keys := layout.tree(uint32(schema[2][3].(int64)))
+	if len(keys) != len(rows) {
+		t.Fatalf("index holds %d keys for %d tiles", len(keys), len(rows))
+	}
+	for i, key := range keys {
+		if i > 0 && !mbtilesKeyLess(keys[i - 1], key) {
+			t.Errorf("index keys %v and %v are out of order", keys[i - 1], key)
+		}
+		row := rows[key[3].(int64) - 1]
+		if key[0] != row[0] || key[1] != row[1] || key[2] != row[2] {
+			t.Errorf("index key %v points at tile %v", key, row[:3])
+		}
+	}
+}
+
+func mbtilesKeyLess(a, b []interface{}) bool {
+	for i := 0; i < 3; i++ {
+		if a[i].(int64) != b[i].(int64) {
+			return a[i].(int64) < b[i].(int64)
+		}
+	}
+	return false
+}
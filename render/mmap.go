@@ -0,0 +1,24 @@
+package render
+
+import (
+	"image"
+)
+
+// A MappedImage is an RGBA image whose pixels live in a memory-mapped
+// temporary file instead of on the heap. The kernel writes pages it needs
+// back to the file rather than to swap, so a canvas larger than RAM costs
+// disk time instead of getting the process killed. Being an *image.RGBA it
+// takes the same fast paths through image/draw as any other canvas.
+type MappedImage struct {
+	*image.RGBA
+	data []byte
+}
+
+// CanvasBytes is the memory the dimension's canvases need held whole.
+func CanvasBytes(d *Dimension, opts *Options) (total int64) {
+	for _, output := range d.Outputs {
+		bounds := ScaleRect(output.Bounds, Supersample(output.Mode, opts))
+		total += int64(bounds.Dx()) * int64(bounds.Dy()) * 4
+	}
+	return
+}
@@ -0,0 +1,64 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"image"
+	"bufio"
+	"syscall"
+	"io/ioutil"
+)
+
+// NewMappedImage maps a temporary file in dir large enough for r. The file
+// is removed straight away, so it's gone when the process exits, however it
+// exits.
+func NewMappedImage(dir string, r image.Rectangle) (*MappedImage, error) {
+	size := int64(r.Dx()) * int64(r.Dy()) * 4
+	if size == 0 {
+		return &MappedImage{RGBA: image.NewRGBA(r)}, nil
+	}
+	
+	file, err := ioutil.TempFile(dir, ".gocart-canvas-")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	os.Remove(file.Name())
+	
+	if err := file.Truncate(size); err != nil {
+		return nil, err
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ | syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &MappedImage{&image.RGBA{Pix: data, Stride: 4 * r.Dx(), Rect: r}, data}, nil
+}
+
+func (m *MappedImage) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(m.data)
+	m.data, m.RGBA = nil, nil
+	return err
+}
+
+// AvailableMemory is how much more the system can allocate without swapping,
+// or 0 if unknown.
+func AvailableMemory() int64 {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var kb int64
+		if n, _ := fmt.Sscanf(scanner.Text(), "MemAvailable: %d kB", &kb); n == 1 {
+			return kb << 10
+		}
+	}
+	return 0
+}
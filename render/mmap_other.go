@@ -0,0 +1,21 @@
+// +build !linux
+
+package render
+
+import (
+	"fmt"
+	"image"
+)
+
+func NewMappedImage(dir string, r image.Rectangle) (*MappedImage, error) {
+	return nil, fmt.Errorf("memory-mapped canvases aren't supported on this platform")
+}
+
+func (m *MappedImage) Close() error {
+	return nil
+}
+
+// AvailableMemory is unknown here, so canvases are never mapped unless asked.
+func AvailableMemory() int64 {
+	return 0
+}
@@ -0,0 +1,351 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"image/color"
+)
+
+// A Mode turns chunks into pixels. Each mode has its own projection, so the
+// bounds of regions, chunks and areas are all computed through it.
+type Mode interface {
+	Name() string
+	RegionBounds(r Region) image.Rectangle
+	ChunkBounds(l Level) image.Rectangle
+	AreaBounds(a Area) image.Rectangle
+	Project(x, y, z int) (int, int)
+	Draw(img *image.RGBA, l Level, n Neighborhood, opts *Options)
+}
+
+// RegisterMode makes a mode, such as one of another program embedding the
+// renderer, available to -modes by its name.
+func RegisterMode(m Mode) {
+	modes[m.Name()] = m
+}
+
+var modes = map[string]Mode{
+	"iso": IsometricMode{},
+	"xray": IsometricMode{XRay: true},
+	"textured": IsometricMode{Textured: true},
+	"surface": IsometricMode{Surface: true},
+	"topdown": TopDownMode{},
+	"biomes": BiomeMode{},
+	"inhabited": InhabitedMode{},
+	"age": AgeMode{},
+	"elevation": ElevationMode{},
+}
+
+type ModeList []Mode
+
+func (ml *ModeList) String() string {
+	names := make([]string, len(*ml))
+	for i, m := range *ml {
+		names[i] = m.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// SetProjection applies p to the list's isometric modes.
+func (ml ModeList) SetProjection(p Projection) {
+	for i, mode := range ml {
+		if iso, ok := mode.(IsometricMode); ok {
+			// Textures are lost at the default size, so textured modes keep
+			// their own unless given another.
+			if iso.Textured && p == DefaultProjection {
+				continue
+			}
+			iso.Projection = p
+			ml[i] = iso
+		}
+	}
+}
+
+func (ml *ModeList) Set(s string) error {
+	*ml = nil
+	for _, name := range strings.Split(s, ",") {
+		mode, exists := modes[strings.TrimSpace(name)]
+		if !exists {
+			return fmt.Errorf("unknown mode %q", name)
+		}
+		*ml = append(*ml, mode)
+	}
+	return nil
+}
+
+// IsometricMode draws blocks with its Projection, or DefaultProjection when
+// that's unset. With XRay, only ores, spawners and chests are drawn solid.
+// Textured modes draw blocks with the textures of the -resource-pack, at
+// TexturedProjection unless given another. Surface modes skip all but the
+// top few blocks of each column, found from its height map, giving up caves
+// and overhangs for speed.
+type IsometricMode struct {
+	Projection Projection
+	XRay bool
+	Textured bool
+	Surface bool
+	Band Band
+}
+
+// SURFACEDEPTH is how far surface mode draws below the lowest of a column's
+// height and those of the neighbors in front of it, enough for shallow water
+// and the foot of a cliff.
+const SURFACEDEPTH = 4
+
+func (m IsometricMode) Name() string {
+	if m.XRay {
+		return "xray" + m.Band.suffix()
+	}
+	if m.Textured {
+		return "textured" + m.Band.suffix()
+	}
+	if m.Surface {
+		return "surface" + m.Band.suffix()
+	}
+	return "iso" + m.Band.suffix()
+}
+
+func (m IsometricMode) projection() Projection {
+	if m.Textured && m.Projection == (Projection{}) {
+		return TexturedProjection
+	}
+	return m.Projection.orDefault()
+}
+
+func (m IsometricMode) RegionBounds(r Region) image.Rectangle {
+	return m.projection().RegionBounds(r)
+}
+
+// Chunks drawn in a band cover the band's heights, whatever is in them, so
+// every slice of a world comes out the same size.
+func (m IsometricMode) ChunkBounds(l Level) image.Rectangle {
+	p := m.projection()
+	if m.Band == (Band{}) {
+		return p.ChunkBounds(l)
+	}
+	x, z := int(l.X) << 4, int(l.Z) << 4
+	return p.Box(x, m.Band.Y0, z, x + 15, m.Band.Y1, z + 15)
+}
+
+func (m IsometricMode) AreaBounds(a Area) image.Rectangle {
+	return m.projection().AreaBounds(a)
+}
+
+func (m IsometricMode) Project(x, y, z int) (int, int) {
+	return m.projection().Project(x, y, z)
+}
+
+func (m IsometricMode) Draw(img *image.RGBA, l Level, n Neighborhood, opts *Options) {
+	l.Draw(img, m, n, opts)
+}
+
+// TopDownMode draws one pixel per column, colored by the highest opaque block
+// with any translucent blocks above it blended on top.
+type TopDownMode struct {
+	Band Band
+}
+
+func (m TopDownMode) Name() string {
+	return "topdown" + m.Band.suffix()
+}
+
+func (TopDownMode) RegionBounds(r Region) image.Rectangle {
+	return image.Rect(r.X << 9, r.Z << 9, (r.X + 1) << 9, (r.Z + 1) << 9)
+}
+
+func (TopDownMode) ChunkBounds(l Level) image.Rectangle {
+	x, z := int(l.X) << 4, int(l.Z) << 4
+	return image.Rect(x, z, x + 16, z + 16)
+}
+
+func (TopDownMode) AreaBounds(a Area) image.Rectangle {
+	return image.Rect(a.X0, a.Z0, a.X1 + 1, a.Z1 + 1)
+}
+
+func (TopDownMode) Project(x, y, z int) (int, int) {
+	return x, z
+}
+
+func (m TopDownMode) Draw(img *image.RGBA, l Level, n Neighborhood, opts *Options) {
+	fade := opts.Fade.Amount(l)
+	
+	sections := l.SectionTable()
+	hidden := opts.Filter.Hidden()
+	bottom, top := m.Band.Limits()
+	shaders := opts.BlockShaders()
+	
+	for z := 0; z < 16; z++ {
+		for x := 0; x < 16; x++ {
+			wx, wz := int(l.X) << 4 + x, int(l.Z) << 4 + z
+			if !opts.Area.Contains(wx, wz) {
+				continue
+			}
+			
+			shade := func(block byte, y int, c BlockColor) BlockColor {
+				c = Jitter(c, block, opts.Jitter, opts.Seed, wx, y, wz)
+				return Shade(shaders, BlockContext{&l, sections, block, wx, y, wz, n}, c)
+			}
+			if c, ok := ColumnColor(sections, x, z, bottom, Min(top, opts.Underground.Top(l, x, z)), !opts.FlatWater, &hidden, shade); ok {
+				if height, known := n.Height(wx, wz); opts.Shadows && known && opts.Sun.Shadowed(n, wx, height - 1, wz) {
+					c = Blend(c, shadowColor, SHADOWALPHA)
+				}
+				img.SetRGBA(wx, wz, opts.Fade.Color(c, fade))
+			}
+		}
+	}
+}
+
+// TopDown reports whether a mode draws one pixel per column, x right and z
+// down.
+func TopDown(mode Mode) bool {
+	switch mode.(type) {
+	case TopDownMode, BiomeMode, InhabitedMode, AgeMode, ElevationMode:
+		return true
+	}
+	return false
+}
+
+// hasTopDown reports whether any of modes is top-down.
+func hasTopDown(modes ModeList) bool {
+	for _, mode := range modes {
+		if TopDown(mode) {
+			return true
+		}
+	}
+	return false
+}
+
+// BiomeMode draws one pixel per column like TopDownMode, colored by the
+// column's biome rather than its blocks.
+type BiomeMode struct {
+	TopDownMode
+}
+
+func (BiomeMode) Name() string {
+	return "biomes"
+}
+
+func (BiomeMode) Draw(img *image.RGBA, l Level, n Neighborhood, opts *Options) {
+	if len(l.Biomes) != 256 {
+		return
+	}
+	fade := opts.Fade.Amount(l)
+	
+	for z := 0; z < 16; z++ {
+		for x := 0; x < 16; x++ {
+			wx, wz := int(l.X) << 4 + x, int(l.Z) << 4 + z
+			if !opts.Area.Contains(wx, wz) || l.Biomes[z << 4 + x] == BIOMEUNSET {
+				continue
+			}
+			if c, ok := BiomeColor(l.Biomes[z << 4 + x]); ok {
+				img.SetRGBA(wx, wz, opts.Fade.Color(c, fade))
+			}
+		}
+	}
+}
+
+// ColumnColor finds the color of a column seen from above, from below top
+// down to bottom. With waterDepth, each body of water is blended once, shaded by how
+// deep it is. Blocks in hidden, if given, are skipped, and each block's color
+// passes through shade, if given, before blending.
+func ColumnColor(sections [16]*Section, x, z, bottom, top int, waterDepth bool, hidden *BlockSet, shade func(block byte, y int, c BlockColor) BlockColor) (color.RGBA, bool) {
+	var translucent []BlockColor
+	for sy := 15; sy >= 0; sy-- {
+		if sections[sy] == nil {
+			continue
+		}
+		
+		for y := 15; y >= 0; y-- {
+			block := sections[sy].Block(x, y, z)
+			if sy << 4 + y >= top || sy << 4 + y < bottom || hidden != nil && hidden[block] {
+				continue
+			}
+			blockColor, exists := blockColors[block]
+			if !exists {
+				continue
+			}
+			
+			if waterDepth && IsWater(block) {
+				if IsWater(BlockAt(sections, x, sy << 4 + y + 1, z)) {
+					continue
+				}
+				blockColor = WaterColor(blockColor, WaterDepth(sections, x, sy << 4 + y, z))
+			}
+			if shade != nil {
+				blockColor = shade(block, sy << 4 + y, blockColor)
+			}
+			
+			if blockColor.Alpha == 0xFF {
+				c := blockColor.Top
+				for i := len(translucent) - 1; i >= 0; i-- {
+					c = Blend(c, translucent[i].Top, translucent[i].Alpha)
+				}
+				return c, true
+			}
+			translucent = append(translucent, blockColor)
+		}
+	}
+	
+	if len(translucent) == 0 {
+		return color.RGBA{}, false
+	}
+	
+	c := translucent[len(translucent) - 1].Top
+	for i := len(translucent) - 2; i >= 0; i-- {
+		c = Blend(c, translucent[i].Top, translucent[i].Alpha)
+	}
+	return c, true
+}
+
+// UNPOPULATEDALPHA is how strongly -unpopulated-tint colors chunks.
+const UNPOPULATEDALPHA = 0x80
+
+// UnpopulatedShader tints chunks whose terrain hasn't been populated, as
+// -unpopulated-tint does.
+type UnpopulatedShader struct {
+	Tint color.RGBA
+}
+
+func (s UnpopulatedShader) Shade(b BlockContext, c BlockColor) BlockColor {
+	if b.Chunk.TerrainPopulated == 1 {
+		return c
+	}
+	return TintBlock(c, s.Tint, UNPOPULATEDALPHA)
+}
+
+// TintBlock blends tint over every face of c.
+func TintBlock(c BlockColor, tint color.RGBA, alpha byte) BlockColor {
+	c.Top = Blend(c.Top, tint, alpha)
+	c.Left = Blend(c.Left, tint, alpha)
+	c.Right = Blend(c.Right, tint, alpha)
+	return c
+}
+
+// Blend draws top over bottom with the given alpha, keeping bottom's alpha.
+func Blend(bottom, top color.RGBA, alpha byte) color.RGBA {
+	a := uint32(alpha)
+	mix := func(b, t uint8) uint8 {
+		return uint8((uint32(t) * a + uint32(b) * (0xFF - a)) / 0xFF)
+	}
+	return color.RGBA{mix(bottom.R, top.R), mix(bottom.G, top.G), mix(bottom.B, top.B), bottom.A}
+}
+
+// Composite blends the top faces of translucent layers front to back, the
+// first uppermost, into the color they make together and how much of what's
+// behind them they hide.
+func Composite(layers []BlockColor) (color.RGBA, byte) {
+	const m = 0xFFFF
+	var r, g, b uint32
+	through := uint32(m)
+	for _, layer := range layers {
+		a := through * uint32(layer.Alpha) / 0xFF
+		r, g, b = r + a * uint32(layer.Top.R), g + a * uint32(layer.Top.G), b + a * uint32(layer.Top.B)
+		through -= a
+	}
+	
+	covered := m - through
+	if covered == 0 {
+		return color.RGBA{}, 0
+	}
+	return color.RGBA{uint8(r / covered), uint8(g / covered), uint8(b / covered), 0xFF}, uint8(covered >> 8)
+}
@@ -0,0 +1,127 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+)
+
+// Builders for the NBT of test chunks: nbtTag names a payload, which the
+// rest encode.
+
+func nbtTag(tag byte, name string, payload []byte) []byte {
+	return append(append([]byte{tag}, nbtString(name)...), payload...)
+}
+
+func nbtRoot(tags ...[]byte) []byte {
+	return nbtTag(TagCompound, "", nbtCompound(tags...))
+}
+
+func nbtCompound(tags ...[]byte) []byte {
+	var b []byte
+	for _, tag := range tags {
+		b = append(b, tag...)
+	}
+	return append(b, TagEnd)
+}
+
+func nbtList(elem byte, items ...[]byte) []byte {
+	b := append([]byte{elem}, nbtInt(int32(len(items)))...)
+	for _, item := range items {
+		b = append(b, item...)
+	}
+	return b
+}
+
+func nbtString(s string) []byte {
+	b := make([]byte, 2, 2 + len(s))
+	binary.BigEndian.PutUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func nbtInt(v int32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(v))
+	return b
+}
+
+func nbtByteArray(v []byte) []byte {
+	return append(nbtInt(int32(len(v))), v...)
+}
+
+func nbtLongArray(n int) []byte {
+	return append(nbtInt(int32(n)), make([]byte, 8 * n)...)
+}
+
+// legacyChunk is a populated 1.12 chunk at x, z whose lowest section is
+// filled with block.
+func legacyChunk(x, z int32, block byte) []byte {
+	blocks := make([]byte, 4096)
+	for i := range blocks {
+		blocks[i] = block
+	}
+	section := nbtCompound(
+		nbtTag(TagByte, "Y", []byte{0}),
+		nbtTag(TagByteArray, "Blocks", nbtByteArray(blocks)),
+		nbtTag(TagByteArray, "Data", nbtByteArray(make([]byte, 2048))),
+		nbtTag(TagByteArray, "BlockLight", nbtByteArray(make([]byte, 2048))),
+	)
+	return nbtRoot(
+		nbtTag(TagInt, "DataVersion", nbtInt(1343)),
+		nbtTag(TagCompound, "Level", nbtCompound(
+			nbtTag(TagInt, "xPos", nbtInt(x)),
+			nbtTag(TagInt, "zPos", nbtInt(z)),
+			nbtTag(TagByte, "TerrainPopulated", []byte{1}),
+			nbtTag(TagList, "Sections", nbtList(TagCompound, section)),
+		)),
+	)
+}
+
+// flattenedChunk is a 1.16 chunk at x, z of stone, in paletted block states.
+func flattenedChunk(x, z int32) []byte {
+	section := nbtCompound(
+		nbtTag(TagByte, "Y", []byte{0}),
+		nbtTag(TagList, "Palette", nbtList(TagCompound, nbtCompound(nbtTag(TagString, "Name", nbtString("minecraft:stone"))))),
+		nbtTag(TagLongArray, "BlockStates", nbtLongArray(256)),
+	)
+	return nbtRoot(
+		nbtTag(TagInt, "DataVersion", nbtInt(2586)),
+		nbtTag(TagCompound, "Level", nbtCompound(
+			nbtTag(TagInt, "xPos", nbtInt(x)),
+			nbtTag(TagInt, "zPos", nbtInt(z)),
+			nbtTag(TagString, "Status", nbtString("full")),
+			nbtTag(TagList, "Sections", nbtList(TagCompound, section)),
+		)),
+	)
+}
+
+// regionData lays out chunks, keyed by their index in the region, zlib
+// compressed in index order from sector 2, with 1000 + index as timestamps.
+func regionData(chunks map[int][]byte) []byte {
+	var header Header
+	var body bytes.Buffer
+	sector := 2
+	for i := 0; i < DIM; i++ {
+		nbt, exists := chunks[i]
+		if !exists {
+			continue
+		}
+		
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		w.Write(nbt)
+		w.Close()
+		data := append(append(nbtInt(int32(compressed.Len() + 1)), CompressionZlib), compressed.Bytes()...)
+		sectors := (len(data) + 4095) / 4096
+		
+		header.Locations[i] = Location{uint32(sector), byte(sectors)}
+		header.Timestamps[i] = int32(1000 + i)
+		body.Write(data)
+		body.Write(make([]byte, sectors * 4096 - len(data)))
+		sector += sectors
+	}
+	
+	var buf bytes.Buffer
+	header.Write(&buf)
+	return append(buf.Bytes(), body.Bytes()...)
+}
@@ -0,0 +1,62 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"bytes"
+	"io/ioutil"
+	"compress/gzip"
+	"github.com/bemasher/GoNBT"
+)
+
+// ReadNBTFile decodes a gzipped NBT file such as level.dat or a player file
+// into v, applying the same limits as chunk data.
+func ReadNBTFile(path string, v interface{}) error {
+	data, err := ReadNBTData(path)
+	if err != nil {
+		return err
+	}
+	return DecodeNBT(path, data, v)
+}
+
+// ReadNBTData reads and validates the NBT of a gzipped file without
+// decoding it.
+func ReadNBTData(path string) ([]byte, error) {
+	nbtFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer nbtFile.Close()
+	
+	gzipReader, err := gzip.NewReader(nbtFile)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+	
+	data, err := ioutil.ReadAll(io.LimitReader(gzipReader, MAXCHUNKSIZE + 1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MAXCHUNKSIZE {
+		return nil, fmt.Errorf("%s: exceeds %d bytes", path, MAXCHUNKSIZE)
+	}
+	
+	if err = ValidateNBT(data); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return data, nil
+}
+
+// DecodeNBT decodes validated NBT data read from path into v.
+func DecodeNBT(path string, data []byte, v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: nbt: %v", path, r)
+		}
+	}()
+	
+	nbt.Read(bytes.NewReader(data), v)
+	return nil
+}
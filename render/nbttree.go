@@ -0,0 +1,103 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"encoding/binary"
+)
+
+// ReadNBTTree decodes NBT data whose layout isn't known ahead, such as
+// compounds keyed by number: compounds become map[string]interface{}, lists
+// []interface{}, arrays slices of their element type and everything else
+// the Go type of its size. The data is validated first, so decoding never
+// runs off its end.
+func ReadNBTTree(data []byte) (root map[string]interface{}, err error) {
+	if err = ValidateNBT(data); err != nil {
+		return
+	}
+	
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("nbt: %v", r)
+		}
+	}()
+	
+	t := nbtTree{data: data}
+	t.pos = 1
+	t.str()
+	return t.payload(TagCompound).(map[string]interface{}), nil
+}
+
+type nbtTree struct {
+	data []byte
+	pos int
+}
+
+func (t *nbtTree) next(n int) []byte {
+	t.pos += n
+	return t.data[t.pos - n : t.pos]
+}
+
+func (t *nbtTree) str() string {
+	n := int(binary.BigEndian.Uint16(t.next(2)))
+	return string(t.next(n))
+}
+
+func (t *nbtTree) length() int {
+	return int(int32(binary.BigEndian.Uint32(t.next(4))))
+}
+
+func (t *nbtTree) payload(tag byte) interface{} {
+	switch tag {
+	case TagByte:
+		return int8(t.next(1)[0])
+	case TagShort:
+		return int16(binary.BigEndian.Uint16(t.next(2)))
+	case TagInt:
+		return int32(binary.BigEndian.Uint32(t.next(4)))
+	case TagLong:
+		return int64(binary.BigEndian.Uint64(t.next(8)))
+	case TagFloat:
+		return math.Float32frombits(binary.BigEndian.Uint32(t.next(4)))
+	case TagDouble:
+		return math.Float64frombits(binary.BigEndian.Uint64(t.next(8)))
+	case TagByteArray:
+		return append([]byte(nil), t.next(t.length())...)
+	case TagString:
+		return t.str()
+	case TagIntArray:
+		values := make([]int32, t.length())
+		for i := range values {
+			values[i] = int32(binary.BigEndian.Uint32(t.next(4)))
+		}
+		return values
+	case TagLongArray:
+		values := make([]int64, t.length())
+		for i := range values {
+			values[i] = int64(binary.BigEndian.Uint64(t.next(8)))
+		}
+		return values
+	case TagList:
+		elem := t.next(1)[0]
+		n := t.length()
+		if elem == TagEnd {
+			n = 0
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			values[i] = t.payload(elem)
+		}
+		return values
+	case TagCompound:
+		values := make(map[string]interface{})
+		for {
+			child := t.next(1)[0]
+			if child == TagEnd {
+				return values
+			}
+			name := t.str()
+			values[name] = t.payload(child)
+		}
+	}
+	panic(fmt.Sprintf("unknown tag %d", tag))
+}
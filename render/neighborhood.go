@@ -0,0 +1,95 @@
+package render
+
+import (
+	"image"
+	"image/color"
+)
+
+const (
+	// How much each taller neighbor darkens a corner with -occlusion.
+	OCCLUSIONSTEP = 0x30
+)
+
+var occlusionShade = color.RGBA{0x00, 0x00, 0x00, 0xff}
+
+// A Neighborhood looks up blocks by world coordinates across a group of
+// chunks, usually all of a region's, so drawing can see past the edges of
+// sections and chunks.
+type Neighborhood map[image.Point]*Neighbor
+
+type Neighbor struct {
+	Sections [16]*Section
+	HeightMap []int32
+}
+
+func NewNeighborhood(chunks PositionList) Neighborhood {
+	n := make(Neighborhood, len(chunks))
+	for _, chunk := range chunks {
+		l := chunk.(Level)
+		n[image.Pt(int(l.X), int(l.Z))] = &Neighbor{l.SectionTable(), l.HeightMap}
+	}
+	return n
+}
+
+// Block returns the block at world coordinates. Blocks in chunks outside the
+// neighborhood aren't known, so ok is false for them.
+func (n Neighborhood) Block(x, y, z int) (block byte, ok bool) {
+	chunk, ok := n[image.Pt(x >> 4, z >> 4)]
+	if !ok {
+		return 0, false
+	}
+	return BlockAt(chunk.Sections, x & 15, y, z & 15), true
+}
+
+// Height returns the chunk's height map entry for a column: the height just
+// above its highest block that stops light.
+func (n Neighborhood) Height(x, z int) (height int, ok bool) {
+	chunk, ok := n[image.Pt(x >> 4, z >> 4)]
+	if !ok || len(chunk.HeightMap) != 256 {
+		return 0, false
+	}
+	return int(chunk.HeightMap[(z & 15) << 4 + x & 15]), true
+}
+
+func (n Neighborhood) Opaque(x, y, z int) bool {
+	block, ok := n.Block(x, y, z)
+	return ok && blockColors[block].Alpha == 0xFF
+}
+
+// Occlusion counts the opaque blocks one above the top face of x, y, z
+// around each half of it as drawn isometrically: the left half faces -x and
+// -z, the right half +x and +z. Each is 0 to 3, an edge and corner count
+// like per-vertex ambient occlusion.
+func (n Neighborhood) Occlusion(x, y, z int) (left, right int) {
+	corner := func(dx, dz int) (count int) {
+		a, b := n.Opaque(x + dx, y + 1, z), n.Opaque(x, y + 1, z + dz)
+		if a && b {
+			return 3
+		}
+		for _, o := range []bool{a, b, n.Opaque(x + dx, y + 1, z + dz)} {
+			if o {
+				count++
+			}
+		}
+		return
+	}
+	return corner(-1, -1), corner(1, 1)
+}
+
+// ShadeTop darkens the left and right halves of an opaque block's top face
+// drawn by DrawBlock at x, y.
+func ShadeTop(img *image.RGBA, x, y int, c BlockColor, left, right int) {
+	if !c.Full {
+		y++
+	}
+	
+	shade := func(px, count int) {
+		if count > 0 {
+			img.SetRGBA(px, y, Blend(img.RGBAAt(px, y), occlusionShade, byte(count * OCCLUSIONSTEP)))
+		}
+	}
+	shade(x - 2, left)
+	shade(x - 1, left)
+	shade(x, right)
+	shade(x + 1, right)
+}
@@ -0,0 +1,120 @@
+package render
+
+import (
+	"math"
+	"image"
+	"image/draw"
+	"path/filepath"
+)
+
+// NETHERSCALE is how many overworld blocks each nether block leads to.
+const NETHERSCALE = 8
+
+// A DimensionOverlay draws another dimension over top-down images at
+// Opacity, each of its pixels Zoom blocks of this one across, as
+// -nether-overlay lays the nether and overworld over each other.
+type DimensionOverlay struct {
+	Img *image.RGBA
+	Zoom int
+	Opacity float64
+}
+
+// NetherOverlay renders whichever of the overworld and nether isn't id,
+// scaled to id's blocks, or returns nil for other dimensions.
+func NetherOverlay(dir string, id int, opts *Options) (*DimensionOverlay, error) {
+	var other string
+	for _, d := range dimensionDirs {
+		if id == 0 && d.ID == -1 || id == -1 && d.ID == 0 {
+			other = filepath.Join(dir, d.Path)
+		}
+	}
+	if other == "" {
+		return nil, nil
+	}
+	
+	mode, zoom, shrink := Mode(TopDownMode{}), 1, NETHERSCALE
+	if id == 0 {
+		mode, zoom, shrink = netherFloorMode{}, NETHERSCALE, 1
+	}
+	img, err := renderFlat(other, mode, shrink, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &DimensionOverlay{img, zoom, opts.NetherOverlay}, nil
+}
+
+// renderFlat draws the dimension at path in a top-down mode, each pixel
+// averaging shrink by shrink blocks.
+func renderFlat(path string, mode Mode, shrink int, opts *Options) (*image.RGBA, error) {
+	flat := Options{Concurrency: opts.Concurrency, ChunkCache: opts.ChunkCache, Modes: ModeList{mode}, FlatWater: opts.FlatWater, Failure: opts.Failure}
+	dimension := &Dimension{Path: path}
+	if err := dimension.Glob(0, &flat); err != nil {
+		return nil, err
+	}
+	
+	var bounds image.Rectangle
+	for _, r := range dimension.Regions {
+		bounds = bounds.Union(mode.RegionBounds(r.(Region)))
+	}
+	img := image.NewRGBA(image.Rect(floorDiv(bounds.Min.X, shrink), floorDiv(bounds.Min.Y, shrink), floorDiv(bounds.Max.X, shrink), floorDiv(bounds.Max.Y, shrink)))
+	for layer := range Render(dimension.Regions, &flat) {
+		for _, l := range layer.Imgs {
+			if shrink > 1 {
+				l = Downsample(l, shrink)
+			}
+			draw.Draw(img, l.Rect, l, l.Rect.Min, draw.Over)
+		}
+	}
+	return img, flat.Failure.Err()
+}
+
+func (o *DimensionOverlay) DrawOver(img *image.RGBA, mode Mode, frame image.Rectangle, opts *Options) {
+	if !TopDown(mode) {
+		return
+	}
+	
+	a := uint32(math.Min(o.Opacity, 1) * 0xFF + 0.5)
+	b := img.Rect.Intersect(frame)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			src := o.Img.RGBAAt(floorDiv(x, o.Zoom), floorDiv(y, o.Zoom))
+			if src.A == 0 {
+				continue
+			}
+			
+			// Both are premultiplied, so src only needs scaling by a.
+			keep := 0xFF - uint32(src.A) * a / 0xFF
+			d := img.Pix[img.PixOffset(x, y):]
+			for k, s := range []uint8{src.R, src.G, src.B, src.A} {
+				d[k] = uint8((uint32(d[k]) * keep + uint32(s) * a) / 0xFF)
+			}
+		}
+	}
+}
+
+// netherFloorMode draws the nether top-down from the floor of the first
+// open space below its roof, rather than the bedrock of the roof itself.
+type netherFloorMode struct {
+	TopDownMode
+}
+
+func (netherFloorMode) Draw(img *image.RGBA, l Level, n Neighborhood, opts *Options) {
+	sections := l.SectionTable()
+	for z := 0; z < 16; z++ {
+		for x := 0; x < 16; x++ {
+			top, roof := 256, false
+			for y := 255; y >= 0; y-- {
+				solid := BlockAt(sections, x, y, z) != 0
+				if roof && !solid {
+					top = y
+					break
+				}
+				roof = roof || solid
+			}
+			
+			if c, ok := ColumnColor(sections, x, z, 0, top, !opts.FlatWater, nil, nil); ok {
+				img.SetRGBA(int(l.X) << 4 + x, int(l.Z) << 4 + z, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package render
+
+import (
+	"strconv"
+	"syscall"
+	"io/ioutil"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle = 3
+	ioprioClassShift = 13
+)
+
+// LowerPriority gives every thread of the process the lowest CPU priority
+// and the idle I/O class, so disk time is only used when nothing else wants
+// it. Linux keeps both per thread; threads started later inherit them.
+func LowerPriority() error {
+	tasks, err := ioutil.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, 19); err != nil {
+			return err
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioClassIdle << ioprioClassShift); errno != 0 {
+			return errno
+		}
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+// +build !linux
+
+package render
+
+// LowerPriority does nothing where priorities aren't supported; -nice still
+// limits workers and paces reads.
+func LowerPriority() error {
+	return nil
+}
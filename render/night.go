@@ -0,0 +1,39 @@
+package render
+
+import (
+	"image/color"
+)
+
+// NIGHTLIGHT is the light level moonlight leaves everything at.
+const NIGHTLIGHT = 4
+
+var nightColor = color.RGBA{0x06, 0x0A, 0x1C, 0xFF}
+
+// LightAt looks up the block light by chunk-local x and z and world height
+// y, treating missing sections and heights outside the world as unlit.
+func LightAt(sections [16]*Section, x, y, z int) int {
+	if y < 0 || y > 255 || sections[y >> 4] == nil {
+		return 0
+	}
+	return int(sections[y >> 4].Light(x, y & 15, z))
+}
+
+// Night darkens c toward the night sky, less the more light, 0 to 15, falls
+// on it. Brightness follows the game's curve, so torchlight falls off
+// quickly into the dark.
+func Night(c BlockColor, light int) BlockColor {
+	f := float64(Max(light, NIGHTLIGHT)) / 15
+	alpha := byte(0xFF * (1 - f / (4 - 3 * f)) * 0.9)
+	
+	c.Top = Blend(c.Top, nightColor, alpha)
+	c.Left = Blend(c.Left, nightColor, alpha)
+	c.Right = Blend(c.Right, nightColor, alpha)
+	return c
+}
+
+// NightShader draws blocks at night, as -night does.
+type NightShader struct{}
+
+func (NightShader) Shade(b BlockContext, c BlockColor) BlockColor {
+	return Night(c, b.Light())
+}
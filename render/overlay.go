@@ -0,0 +1,74 @@
+package render
+
+import (
+	"image"
+)
+
+// An Overlay draws over finished images, given the mode they were drawn in
+// and the frame being encoded. img may be only a strip of the frame, so
+// overlays should skip whatever can't reach it.
+type Overlay interface {
+	DrawOver(img *image.RGBA, mode Mode, frame image.Rectangle, opts *Options)
+}
+
+// overlayMargin is how far beyond a strip a marker or label can be and
+// still reach into it.
+func overlayMargin(opts *Options) int {
+	return opts.Labels.Height() + Max(opts.Labels.Halo, 0) + 8
+}
+
+// near reports whether something projected to y may reach img.
+func near(img *image.RGBA, y int, opts *Options) bool {
+	bounds, margin := img.Bounds(), overlayMargin(opts)
+	return y >= bounds.Min.Y - margin && y < bounds.Max.Y + margin
+}
+
+// EntityOverlay draws entities as dots, as -entities does.
+type EntityOverlay PositionList
+
+func (o EntityOverlay) DrawOver(img *image.RGBA, mode Mode, frame image.Rectangle, opts *Options) {
+	for _, e := range o {
+		if x, y, z, ok := e.(Entity).Block(); ok {
+			if _, yISO := mode.Project(x, y, z); near(img, yISO, opts) {
+				DrawEntity(img, mode, e.(Entity))
+			}
+		}
+	}
+}
+
+// PathOverlay draws lines and polygons, as from -markers and -portals.
+type PathOverlay []Path
+
+func (o PathOverlay) DrawOver(img *image.RGBA, mode Mode, frame image.Rectangle, opts *Options) {
+	bounds, margin := img.Bounds(), overlayMargin(opts)
+	for _, p := range o {
+		if _, top, bottom := p.Project(mode); top < bounds.Max.Y + margin && bottom >= bounds.Min.Y - margin {
+			DrawPath(img, mode, p, opts.Labels)
+		}
+	}
+}
+
+// MarkerOverlay draws labelled markers.
+type MarkerOverlay []Marker
+
+func (o MarkerOverlay) DrawOver(img *image.RGBA, mode Mode, frame image.Rectangle, opts *Options) {
+	for _, m := range o {
+		if _, y := mode.Project(m.X, m.Y, m.Z); near(img, y, opts) {
+			DrawMarker(img, mode, m, opts.Labels)
+		}
+	}
+}
+
+// TitleOverlay draws a title in the top left corner, as -title does.
+type TitleOverlay string
+
+func (o TitleOverlay) DrawOver(img *image.RGBA, mode Mode, frame image.Rectangle, opts *Options) {
+	if o == "" {
+		return
+	}
+	style := opts.Labels.Scaled(2)
+	pt := frame.Min.Add(image.Pt(opts.Labels.Height(), opts.Labels.Height()))
+	if image.Rect(pt.X, pt.Y, pt.X + style.Width(string(o)), pt.Y + style.Height()).Inset(-style.Halo).Overlaps(img.Bounds()) {
+		DrawText(img, pt, string(o), style)
+	}
+}
@@ -0,0 +1,297 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+	"image/draw"
+	"image/color"
+	"crypto/sha1"
+	"encoding/json"
+)
+
+// Shapes configured with -palette, by block state, and those built in for
+// blocks that aren't whole cubes, which they take precedence over.
+var (
+	blockShapes map[BlockState]Shape
+	defaultShapes = builtinShapes()
+)
+
+// A BlockState is a block ID and data value. Data of -1 matches any value.
+type BlockState struct {
+	ID byte
+	Data int
+}
+
+// A Box is one part of a block's shape, from x0, y0, z0 to x1, y1, z1 in
+// sixteenths of a block.
+type Box [6]int
+
+type Shape []Box
+
+// A PaletteEntry overrides a block's colors and gives it a shape. Colors are
+// #rrggbb; Left and Right default to Top, with Right lightened like the
+// built-in palette.
+type PaletteEntry struct {
+	Top, Left, Right string
+	Alpha *int
+	Shape Shape
+}
+
+func ParseHex(s string) (c color.RGBA, err error) {
+	c.A = 0xff
+	_, err = fmt.Sscanf(s, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	if err != nil {
+		err = fmt.Errorf("expected #rrggbb, got %q", s)
+	}
+	return
+}
+
+// A HexColor is a color flag given as #rrggbb, unset while its alpha is 0.
+type HexColor color.RGBA
+
+func (c *HexColor) String() string {
+	if c.A == 0 {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (c *HexColor) Set(s string) error {
+	parsed, err := ParseHex(s)
+	*c = HexColor(parsed)
+	return err
+}
+
+// A BackgroundColor is a HexColor that can also be set back to transparent,
+// its default.
+type BackgroundColor HexColor
+
+func (c *BackgroundColor) String() string {
+	if c.A == 0 {
+		return "transparent"
+	}
+	return (*HexColor)(c).String()
+}
+
+func (c *BackgroundColor) Set(s string) error {
+	if s == "transparent" {
+		*c = BackgroundColor{}
+		return nil
+	}
+	return (*HexColor)(c).Set(s)
+}
+
+// Fill paints img with the color, unless it's transparent.
+func (c BackgroundColor) Fill(img *image.RGBA) {
+	if c.A != 0 {
+		draw.Draw(img, img.Rect, image.NewUniform(color.RGBA(c)), image.ZP, draw.Src)
+	}
+}
+
+func lighten(c color.RGBA) color.RGBA {
+	add := func(v uint8) uint8 {
+		return uint8(Min(int(v) + 0x20, 0xff))
+	}
+	return color.RGBA{add(c.R), add(c.G), add(c.B), c.A}
+}
+
+// ParseBlockState reads a block ID or name with an optional :data suffix.
+func ParseBlockState(s string) (state BlockState, err error) {
+	state.Data = -1
+	if i := strings.LastIndex(s, ":"); i != -1 && !strings.HasSuffix(strings.ToLower(s[:i]), "minecraft") {
+		data, err := strconv.ParseUint(s[i + 1:], 0, 4)
+		if err != nil {
+			return state, fmt.Errorf("bad data value in %q", s)
+		}
+		state.Data = int(data)
+		s = s[:i]
+	}
+	state.ID, err = ParseBlock(s)
+	return
+}
+
+// LoadPaletteFile applies a JSON object of block ID or name, optionally with
+// :data, to PaletteEntry. Colors apply to the whole block ID; shapes may be
+// given per data value.
+func LoadPaletteFile(filename string) error {
+	paletteFile, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer paletteFile.Close()
+	
+	var entries map[string]PaletteEntry
+	if err := json.NewDecoder(paletteFile).Decode(&entries); err != nil {
+		return err
+	}
+	
+	for key, entry := range entries {
+		state, err := ParseBlockState(key)
+		if err != nil {
+			return err
+		}
+		
+		for _, box := range entry.Shape {
+			if box[0] >= box[3] || box[1] >= box[4] || box[2] >= box[5] || box[0] < 0 || box[1] < 0 || box[2] < 0 || box[3] > 16 || box[4] > 16 || box[5] > 16 {
+				return fmt.Errorf("%s: box %v must run from low to high corner within 0-16", key, box)
+			}
+		}
+		if entry.Shape != nil {
+			if blockShapes == nil {
+				blockShapes = make(map[BlockState]Shape)
+			}
+			blockShapes[state] = entry.Shape
+		}
+		
+		if entry.Top == "" && entry.Left == "" && entry.Right == "" && entry.Alpha == nil {
+			continue
+		}
+		if state.Data != -1 {
+			return fmt.Errorf("%s: colors can only be set for a whole block ID", key)
+		}
+		
+		blockColor, exists := blockColors[state.ID]
+		if !exists {
+			blockColor = BlockColor{Alpha: 0xff, Full: true}
+		}
+		if entry.Top != "" {
+			if blockColor.Top, err = ParseHex(entry.Top); err != nil {
+				return fmt.Errorf("%s: %s", key, err)
+			}
+			blockColor.Left, blockColor.Right = blockColor.Top, lighten(blockColor.Top)
+		}
+		if entry.Left != "" {
+			if blockColor.Left, err = ParseHex(entry.Left); err != nil {
+				return fmt.Errorf("%s: %s", key, err)
+			}
+		}
+		if entry.Right != "" {
+			if blockColor.Right, err = ParseHex(entry.Right); err != nil {
+				return fmt.Errorf("%s: %s", key, err)
+			}
+		}
+		if entry.Alpha != nil {
+			if *entry.Alpha < 0 || *entry.Alpha > 0xff {
+				return fmt.Errorf("%s: alpha must be 0-255", key)
+			}
+			blockColor.Alpha = byte(*entry.Alpha)
+		}
+		blockColors[state.ID] = blockColor
+	}
+	return nil
+}
+
+// PaletteVersion identifies the block colors, shapes, textures and biome
+// colors in use, so a change of palette can be told apart from a change in
+// the world. fmt prints maps in key order, so the same palette always hashes
+// the same.
+func PaletteVersion() string {
+	h := sha1.New()
+	fmt.Fprint(h, blockColors, blockShapes, texturesVersion, biomeColors)
+	return fmt.Sprintf("%x", h.Sum(nil))[:12]
+}
+
+// ShapeOf returns the shape for a block state, if it isn't a whole cube.
+func ShapeOf(block byte, data int) (Shape, bool) {
+	for _, shapes := range []map[BlockState]Shape{blockShapes, defaultShapes} {
+		if shape, exists := shapes[BlockState{block, data}]; exists {
+			return shape, true
+		}
+		if shape, exists := shapes[BlockState{block, -1}]; exists {
+			return shape, true
+		}
+	}
+	return nil, false
+}
+
+// DrawShape draws the boxes of a shape into a block's footprint, Width
+// columns by Top plus Side rows, each pixel n by n on a supersampled image.
+// Columns follow x+z across the block and side rows its height, with the top
+// face above the highest, so with the default projection a full box draws
+// exactly what DrawBlock would.
+func DrawShape(img *image.RGBA, x, y, n int, p Projection, c BlockColor, shape Shape) {
+	half := p.Width / 2
+	bounds := ScaleRect(image.Rect(x - half, y, x + half, y + p.Top + p.Side), n)
+	var blockImg *image.RGBA
+	if c.Alpha == 0xFF {
+		blockImg = img.SubImage(bounds).(*image.RGBA)
+	} else {
+		blockImg = image.NewRGBA(bounds)
+	}
+	
+	set := func(px, py int, c color.RGBA) {
+		draw.Draw(blockImg, ScaleRect(image.Rect(px, py, px + 1, py + 1), n), image.NewUniform(c), image.ZP, draw.Src)
+	}
+	
+	for _, box := range shape {
+		x0, x1 := box[0] + box[2], box[3] + box[5]
+		
+		first, last := -1, -1
+		for row := 0; row < p.Side; row++ {
+			lo, hi := 16 * (p.Side - 1 - row) / p.Side, 16 * (p.Side - row) / p.Side
+			if box[1] < hi && box[4] > lo {
+				if first == -1 {
+					first = row
+				}
+				last = row
+			}
+		}
+		if first == -1 {
+			continue
+		}
+		
+		for column := 0; column < p.Width; column++ {
+			if x1 * p.Width <= column * 32 || x0 * p.Width >= (column + 1) * 32 {
+				continue
+			}
+			
+			side := c.Left
+			if column >= half {
+				side = c.Right
+			}
+			
+			for row := first; row < first + p.Top; row++ {
+				set(x - half + column, y + row, c.Top)
+			}
+			for row := first; row <= last; row++ {
+				set(x - half + column, y + p.Top + row, side)
+			}
+		}
+	}
+	
+	if c.Alpha != 0xFF {
+		draw.DrawMask(img, bounds, blockImg, bounds.Min, image.NewUniform(color.RGBA{c.Alpha, c.Alpha, c.Alpha, c.Alpha}), bounds.Min, draw.Over)
+	}
+}
+
+// SavePalette returns a function putting the block colors, shapes, textures
+// and biome colors back as they are now, undoing any palette files or
+// resource packs loaded in between.
+func SavePalette() func() {
+	colors := make(map[byte]BlockColor, len(blockColors))
+	for id, c := range blockColors {
+		colors[id] = c
+	}
+	var shapes map[BlockState]Shape
+	if blockShapes != nil {
+		shapes = make(map[BlockState]Shape, len(blockShapes))
+		for state, shape := range blockShapes {
+			shapes[state] = shape
+		}
+	}
+	
+	biomes := make(map[byte]color.RGBA, len(biomeColors))
+	for id, c := range biomeColors {
+		biomes[id] = c
+	}
+	
+	textures, version := blockTextures, texturesVersion
+	return func() {
+		blockColors, blockShapes = colors, shapes
+		blockTextures, texturesVersion = textures, version
+		biomeColors = biomes
+	}
+}
@@ -0,0 +1,135 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"flag"
+	"sort"
+	"image/color"
+)
+
+const (
+	DELTAE = 5.0
+)
+
+type PaletteIssue struct {
+	A, B byte
+	Deficiency string
+	DeltaE float64
+	Suggestion color.RGBA
+}
+
+func Hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// distinguishable checks a pair under normal vision and every simulated
+// deficiency, returning the first view in which they fall below threshold.
+func distinguishable(a, b color.RGBA, threshold float64) (string, float64, bool) {
+	if d := DeltaE(ToLab(a), ToLab(b)); d < threshold {
+		return "", d, false
+	}
+	
+	for _, deficiency := range deficiencies {
+		if d := DeltaE(deficiency.Simulate(a), deficiency.Simulate(b)); d < threshold {
+			return deficiency.Name, d, false
+		}
+	}
+	return "", 0, true
+}
+
+// suggest nudges the lightness of c away from other until the pair can be
+// told apart in every view, preferring the smallest change.
+func suggest(c, other color.RGBA, threshold float64) color.RGBA {
+	lab, otherLab := ToLab(c), ToLab(other)
+	direction := 1.0
+	if lab.L < otherLab.L || (lab.L == otherLab.L && lab.L > 50) {
+		direction = -1
+	}
+	
+	for step := 1.0; step <= 60; step++ {
+		for _, sign := range []float64{direction, -direction} {
+			candidate := lab
+			candidate.L += sign * step
+			if candidate.L < 0 || candidate.L > 100 {
+				continue
+			}
+			
+			adjusted := candidate.RGBA()
+			if _, _, ok := distinguishable(adjusted, other, threshold); ok {
+				return adjusted
+			}
+		}
+	}
+	return c
+}
+
+func CheckPalette(palette map[byte]BlockColor, threshold float64) (issues []PaletteIssue) {
+	ids := make([]int, 0, len(palette))
+	for id := range palette {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	
+	for i, a := range ids {
+		for _, b := range ids[i + 1:] {
+			ca, cb := palette[byte(a)].Top, palette[byte(b)].Top
+			if ca == cb {
+				continue
+			}
+			
+			if deficiency, d, ok := distinguishable(ca, cb, threshold); !ok {
+				issues = append(issues, PaletteIssue{byte(a), byte(b), deficiency, d, suggest(cb, ca, threshold)})
+			}
+		}
+	}
+	return
+}
+
+// PaletteReport lists block pairs whose top colours are hard to tell apart.
+// Identical colours are assumed to be deliberate and skipped.
+func PaletteReport(w io.Writer, palette map[byte]BlockColor, threshold float64) {
+	issues := CheckPalette(palette, threshold)
+	fmt.Fprintf(w, "Checked %d block colors, found %d pairs with deltaE below %0.1f\n", len(palette), len(issues), threshold)
+	
+	for _, issue := range issues {
+		view := "normal vision"
+		if issue.Deficiency != "" {
+			view = issue.Deficiency
+		}
+		
+		a, b := palette[issue.A].Top, palette[issue.B].Top
+		fmt.Fprintf(w, "%s (%s) and %s (%s): deltaE %0.1f under %s, try %s for %s\n",
+			BlockName(issue.A), Hex(a), BlockName(issue.B), Hex(b),
+			issue.DeltaE, view, Hex(issue.Suggestion), BlockName(issue.B),
+		)
+	}
+}
+
+// PaletteCommand reports on the built-in palette, or the one -palette makes
+// of it, as -palette-report does.
+func PaletteCommand(args []string) error {
+	var (
+		paletteFilename string
+		threshold float64
+		progress Progress
+	)
+	
+	flags := flag.NewFlagSet("palette", flag.ContinueOnError)
+	flags.StringVar(&paletteFilename, "palette", "", "Check the palette overridden by this JSON file, as -palette takes.")
+	flags.Float64Var(&threshold, "deltae", DELTAE, "Minimum CIE76 color difference required.")
+	progress.Flags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	progress.Start()
+	
+	if paletteFilename != "" {
+		if err := LoadPaletteFile(paletteFilename); err != nil {
+			return exitError(ExitPalette, "Error reading palette file: ", err)
+		}
+	}
+	PaletteReport(os.Stdout, blockColors, threshold)
+	return nil
+}
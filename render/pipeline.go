@@ -0,0 +1,558 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"image"
+	"runtime"
+	"path/filepath"
+)
+
+type Concurrency struct {
+	// Workers replaces GOMAXPROCS as the default for every stage.
+	Workers int
+	
+	Readers int
+	Decompressors int
+	Decoders int
+	Drawers int
+	Encoders int
+	
+	// ChunkBuffer chunks may wait between each stage of parsing, ahead of
+	// the goroutines of the next, and RegionBuffer regions between decoding,
+	// drawing and compositing, letting stages that wait on the disk run ahead
+	// of those busy with the CPU.
+	ChunkBuffer int
+	RegionBuffer int
+	
+	// Nice defaults every stage to one goroutine and sleeps Pace after each
+	// chunk read, leaving the machine to whatever else runs on it.
+	Nice bool
+	Pace time.Duration
+}
+
+// Zero or negative counts are replaced with defaults derived from GOMAXPROCS.
+// Readers are kept low since most storage doesn't benefit from deep queues.
+func (c *Concurrency) Auto() {
+	procs := runtime.GOMAXPROCS(0)
+	if c.Nice {
+		procs = 1
+		if c.Pace <= 0 {
+			c.Pace = NICEPACE
+		}
+	}
+	if c.Workers > 0 {
+		procs = c.Workers
+	}
+	if c.Readers <= 0 {
+		c.Readers = Min(procs, 2)
+	}
+	if c.Decompressors <= 0 {
+		c.Decompressors = procs
+	}
+	if c.Decoders <= 0 {
+		c.Decoders = procs
+	}
+	if c.Drawers <= 0 {
+		c.Drawers = procs
+	}
+	if c.Encoders <= 0 {
+		c.Encoders = procs
+	}
+}
+
+// chunkBuffer is how many chunks wait ahead of a stage of n goroutines.
+func (c *Concurrency) chunkBuffer(n int) int {
+	if c.ChunkBuffer > 0 {
+		return c.ChunkBuffer
+	}
+	return n
+}
+
+type Options struct {
+	Concurrency
+	Limits
+	Area Area
+	Progress Progress
+	Hooks Hooks
+	
+	// Report is where -report writes its summary, and Stages times the
+	// pipeline for it.
+	Report string
+	Stages *StageTimes
+	
+	Modes ModeList
+	Fade Fade
+	FlatWater bool
+	Occlusion bool
+	Shadows bool
+	Night bool
+	SpawnLight bool
+	Theme Theme
+	Elevation Gradient
+	Sun Sun
+	Supersample int
+	
+	// Seed is the world's seed from level.dat. Jitter varies foliage
+	// brightness, hashed with Seed so it's stable.
+	Jitter int
+	Seed int64
+	
+	// InhabitedMax is how long players must spend near a chunk for
+	// inhabited mode to draw it hottest.
+	InhabitedMax time.Duration
+	
+	// Unpopulated draws chunks whose terrain hasn't been populated yet,
+	// tinted toward UnpopulatedTint if it's set.
+	Unpopulated bool
+	UnpopulatedTint HexColor
+	
+	// Background fills each image before anything is drawn on it. Trim
+	// crops images to what's drawn over it, TrimPadding pixels wider.
+	Background BackgroundColor
+	Trim bool
+	TrimPadding int
+	
+	// Snapshot copies region files before reading them, for worlds a
+	// running server is saving.
+	Snapshot bool
+	
+	// Portals marks nether portals and links them across dimensions.
+	// NetherOverlay draws the overworld and nether over each other in
+	// top-down modes, scaled to line up, at this opacity.
+	Portals bool
+	NetherOverlay float64
+	POIs POISet
+	
+	// WorldTime is the game time in ticks from level.dat, which age mode
+	// measures chunks' LastUpdate against, and AgeMax the age it draws
+	// coldest.
+	WorldTime int64
+	AgeMax time.Duration
+	Filter BlockFilter
+	Underground Underground
+	Labels TextStyle
+	Axes Axes
+	Title string
+	MarkerZooms int
+	DZI bool
+	
+	Entities EntityFilter
+	Find BlockSet
+	Objective, Positions string
+	
+	// PlayerHeads draws players' markers as their heads, fetched from Mojang
+	// within SkinTimeout and kept in SkinCache.
+	PlayerHeads bool
+	SkinCache string
+	SkinTimeout time.Duration
+	MarkerFile string
+	RouteFile string
+	
+	// Cache keeps region layers between renders when set.
+	Cache *LayerCache
+	
+	// ChunkCache keeps decoded chunks between renders when set.
+	ChunkCache *ChunkCache
+	
+	// Script colors blocks before any other shader.
+	Script *ScriptShader
+	
+	// Shaders color blocks and Overlays draw over finished images after
+	// those the options build in.
+	Shaders []BlockShader
+	Overlays []Overlay
+	
+	// Done, when closed, stops chunks being read or drawn, leaving the rest
+	// of the render to finish with what it has.
+	Done <-chan struct{}
+	
+	// Failure stops the render as Done does once any of its goroutines
+	// fails, keeping the error for the render to return.
+	Failure *Failure
+}
+
+// Cancelled reports whether Done has been closed or the render has failed.
+func (c *Options) Cancelled() bool {
+	if c.Failure.Err() != nil {
+		return true
+	}
+	select {
+	case <-c.Done:
+		return true
+	default:
+		return false
+	}
+}
+
+// A Failure is the first error of a render's goroutines.
+type Failure struct {
+	mu sync.Mutex
+	err error
+}
+
+// Fail records err, if set and the first.
+func (f *Failure) Fail(err error) {
+	if f == nil || err == nil {
+		return
+	}
+	f.mu.Lock()
+	if f.err == nil {
+		f.err = err
+	}
+	f.mu.Unlock()
+}
+
+func (f *Failure) Err() error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+type RegionJob struct {
+	Index int
+	Region Region
+}
+
+type RegionHeader struct {
+	Index int
+	ChunkCount int
+	Err error
+}
+
+type DecodedChunk struct {
+	RawChunk
+	Level Level
+}
+
+type ChunkError struct {
+	Region string
+	X, Z int
+	Offset int64
+	Err error
+}
+
+func (e ChunkError) Error() string {
+	if e.Offset == 0 {
+		return fmt.Sprintf("%s: %s", e.Region, e.Err)
+	}
+	return fmt.Sprintf("%s: chunk %d,%d at offset %d: %s", e.Region, e.X, e.Z, e.Offset, e.Err)
+}
+
+// A Layer holds one image per render mode for a single region.
+type Layer struct {
+	Job
+	Imgs []*image.RGBA
+}
+
+// An EncodeJob writes one finished image.
+type EncodeJob func() error
+
+func Spawn(n int, work func(), finish func()) {
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+	
+	go func() {
+		wg.Wait()
+		finish()
+	}()
+}
+
+// Decode runs the read, decompress and decode stages and returns each
+// region's chunks as soon as all of them have been decoded.
+func Decode(regions PositionList, c *Options) <-chan Job {
+	regionJobs := make(chan RegionJob)
+	headers := make(chan RegionHeader)
+	raw := make(chan RawChunk, c.chunkBuffer(c.Decompressors))
+	decompressed := make(chan RawChunk, c.chunkBuffer(c.Decoders))
+	decoded := make(chan DecodedChunk, c.chunkBuffer(c.Decoders))
+	jobs := make(chan Job, c.RegionBuffer)
+	
+	go func() {
+		for i, r := range regions {
+			regionJobs <- RegionJob{i + 1, r.(Region)}
+		}
+		close(regionJobs)
+	}()
+	
+	Spawn(c.Readers, func() {
+		for job := range regionJobs {
+			ReadRegion(job, c, headers, raw)
+		}
+	}, func() {
+		close(headers)
+		close(raw)
+	})
+	
+	Spawn(c.Decompressors, func() {
+		for chunk := range raw {
+			if chunk.Err == nil && chunk.Cached == nil {
+				start := time.Now()
+				chunk.Data, chunk.Err = chunk.Decompress()
+				c.Stages.Add(StageDecompress, start)
+			}
+			decompressed <- chunk
+		}
+	}, func() {
+		close(decompressed)
+	})
+	
+	Spawn(c.Decoders, func() {
+		for chunk := range decompressed {
+			var level Level
+			if chunk.Cached != nil {
+				level = *chunk.Cached
+				chunk.Cached = nil
+			} else if chunk.Err == nil {
+				start := time.Now()
+				if chunk.Legacy {
+					chunk.Err = level.DecodeLegacy(chunk.Data)
+				} else {
+					chunk.Err = level.Decode(chunk.Data)
+				}
+				level.Modified = int64(chunk.Timestamp)
+				c.Stages.Add(StageDecode, start)
+			}
+			chunk.Data = nil
+			decoded <- DecodedChunk{chunk, level}
+		}
+	}, func() {
+		close(decoded)
+	})
+	
+	if c.ChunkCache != nil {
+		assembled := make(chan Job, c.RegionBuffer)
+		go Assemble(regions, headers, decoded, assembled, c.Unpopulated)
+		go c.ChunkCache.Store(regions, assembled, jobs, c.Failure)
+	} else {
+		go Assemble(regions, headers, decoded, jobs, c.Unpopulated)
+	}
+	return jobs
+}
+
+// Render decodes regions and draws them, returning each region's layer in
+// the order they must be composited.
+func Render(regions PositionList, c *Options) <-chan Layer {
+	jobs := Decode(regions, c)
+	layers := make(chan Layer, c.RegionBuffer)
+	ordered := make(chan Layer, c.RegionBuffer)
+	
+	Spawn(c.Drawers, func() {
+		for job := range jobs {
+			region := regions[job.Index - 1].(Region)
+			layer := Layer{Job: job}
+			if job.ChunkCount != 0 && !c.Cancelled() {
+				neighbors := NewNeighborhood(job.Chunks)
+				for _, mode := range c.Modes {
+					scale := Supersample(mode, c)
+					img := image.NewRGBA(ScaleRect(mode.RegionBounds(region), scale))
+					start := time.Now()
+					for _, chunk := range job.Chunks {
+						mode.Draw(img, chunk.(Level), neighbors, c)
+					}
+					c.Stages.Add(StageDraw, start)
+					
+					// Supersampled layers are composited before they are
+					// averaged down, or the pixels regions share along their
+					// borders would be blended twice and show as seams.
+					c.Hooks.emit(region, mode, img, scale)
+					layer.Imgs = append(layer.Imgs, img)
+				}
+			}
+			layers <- layer
+		}
+	}, func() {
+		close(layers)
+	})
+	
+	go func() {
+		pending := make(map[int]Layer)
+		next := 1
+		for layer := range layers {
+			pending[layer.Index] = layer
+			for l, exists := pending[next]; exists; l, exists = pending[next] {
+				ordered <- l
+				delete(pending, next)
+				next++
+			}
+		}
+		close(ordered)
+	}()
+	
+	return ordered
+}
+
+func ReadRegion(job RegionJob, opts *Options, headers chan<- RegionHeader, raw chan<- RawChunk) {
+	regionFile, err := os.Open(job.Region.Source())
+	if err != nil {
+		headers <- RegionHeader{job.Index, 0, err}
+		return
+	}
+	defer regionFile.Close()
+	
+	stat, err := regionFile.Stat()
+	if err != nil {
+		headers <- RegionHeader{job.Index, 0, err}
+		return
+	}
+	
+	var header Header
+	header.Read(regionFile)
+	
+	// Regions are read whole or not at all once cancelled, so the count
+	// sent ahead always matches the chunks that follow.
+	cancelled := opts.Cancelled()
+	wanted := func(i int) bool {
+		x, z := job.Region.X << 5 + i & 31, job.Region.Z << 5 + i >> 5
+		return header.Locations[i].Valid(stat.Size()) && opts.Area.ContainsChunk(x, z) && !cancelled
+	}
+	
+	count := 0
+	for i := range header.Locations {
+		if wanted(i) {
+			count++
+		}
+	}
+	var cached map[int]Level
+	if opts.ChunkCache != nil {
+		cached = opts.ChunkCache.Load(job.Index, job.Region)
+	}
+	headers <- RegionHeader{job.Index, count, nil}
+	
+	for i, location := range header.Locations {
+		if wanted(i) {
+			if level, exists := cached[i]; exists && level.Modified == int64(header.Timestamps[i]) {
+				opts.ChunkCache.Hit(job.Index)
+				raw <- RawChunk{Region: job.Index, X: job.Region.X << 5 + i & 31, Z: job.Region.Z << 5 + i >> 5, Offset: location.Start(), Timestamp: header.Timestamps[i], Cached: &level}
+				continue
+			}
+			
+			start := time.Now()
+			chunk := readChunk(regionFile, job, i, location, header.Timestamps[i])
+			
+			// A server saving the region as it's read can leave the chunk
+			// torn, so it's read again from wherever the header now puts
+			// it, until it holds still.
+			for retry := 0; retry < LIVERETRIES; retry++ {
+				moved, timestamp, valid := rereadLocation(regionFile, i)
+				if !valid || moved == location && timestamp == chunk.Timestamp {
+					break
+				}
+				opts.Progress.Debugf("Reading chunk %d,%d of %s again: saved while it was read", chunk.X, chunk.Z, filepath.Base(job.Region.Path))
+				location = moved
+				chunk = readChunk(regionFile, job, i, location, timestamp)
+			}
+			opts.Stages.Add(StageRead, start)
+			raw <- chunk
+			
+			if opts.Pace > 0 {
+				time.Sleep(opts.Pace)
+			}
+		}
+	}
+}
+
+func readChunk(regionFile *os.File, job RegionJob, i int, location Location, timestamp int32) RawChunk {
+	chunk := RawChunk{Region: job.Index, X: job.Region.X << 5 + i & 31, Z: job.Region.Z << 5 + i >> 5, Offset: location.Start(), Timestamp: timestamp, Legacy: job.Region.Legacy}
+	chunk.Err = chunk.Read(io.NewSectionReader(regionFile, location.Start(), location.Size()))
+	if chunk.Err == nil && chunk.External() {
+		chunk.Err = chunk.ReadExternal(filepath.Dir(job.Region.Source()))
+	}
+	return chunk
+}
+
+// Assemble gathers decoded chunks back into per-region jobs. A region is
+// complete once as many chunks have arrived as its header announced.
+func Assemble(regions PositionList, headers <-chan RegionHeader, decoded <-chan DecodedChunk, jobs chan<- Job, drawUnpopulated bool) {
+	expected := make(map[int]int)
+	received := make(map[int]int)
+	unpopulated := make(map[int]int)
+	chunks := make(map[int]PositionList)
+	errors := make(map[int][]ChunkError)
+	
+	filename := func(i int) string {
+		return filepath.Base(regions[i - 1].(Region).Path)
+	}
+	
+	complete := func(i int) {
+		if n, exists := expected[i]; exists && received[i] == n {
+			populated := chunks[i]
+			sort.Sort(populated)
+			jobs <- Job{filename(i), i, len(populated), populated, errors[i], unpopulated[i]}
+			
+			delete(expected, i)
+			delete(received, i)
+			delete(unpopulated, i)
+			delete(chunks, i)
+			delete(errors, i)
+		}
+	}
+	
+	for headers != nil || decoded != nil {
+		select {
+		case header, ok := <-headers:
+			if !ok {
+				headers = nil
+				continue
+			}
+			expected[header.Index] = header.ChunkCount
+			if header.Err != nil {
+				errors[header.Index] = append(errors[header.Index], ChunkError{filename(header.Index), 0, 0, 0, header.Err})
+			}
+			complete(header.Index)
+		case chunk, ok := <-decoded:
+			if !ok {
+				decoded = nil
+				continue
+			}
+			received[chunk.Region]++
+			if chunk.Err != nil {
+				errors[chunk.Region] = append(errors[chunk.Region], ChunkError{filename(chunk.Region), chunk.X, chunk.Z, chunk.Offset, chunk.Err})
+			} else if chunk.Level.TerrainPopulated == 1 {
+				chunks[chunk.Region] = append(chunks[chunk.Region], chunk.Level)
+			} else {
+				unpopulated[chunk.Region]++
+				if drawUnpopulated {
+					chunks[chunk.Region] = append(chunks[chunk.Region], chunk.Level)
+				}
+			}
+			complete(chunk.Region)
+		}
+	}
+	close(jobs)
+}
+
+// Encode runs jobs on encoders goroutines, returning the first error.
+func Encode(jobs []EncodeJob, encoders int) error {
+	work := make(chan EncodeJob)
+	done := make(chan bool)
+	failure := new(Failure)
+	
+	Spawn(encoders, func() {
+		for job := range work {
+			failure.Fail(fatalError("Error encoding image: ", job()))
+		}
+	}, func() {
+		close(done)
+	})
+	
+	for _, job := range jobs {
+		work <- job
+	}
+	close(work)
+	<-done
+	return failure.Err()
+}
@@ -0,0 +1,146 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"path/filepath"
+)
+
+const (
+	// PLAYERDATADIR holds player files named by UUID, since 1.7.6.
+	PLAYERDATADIR = "playerdata"
+	
+	// PLAYERRADIUS is how far -per-player maps reach unless given -radius.
+	PLAYERRADIUS = 256
+)
+
+// A PlayerPosition is where a player last logged out, in the dimension with
+// the namespace:name key Dimension. ID names the player's file: their name
+// in players, or their UUID in playerdata.
+type PlayerPosition struct {
+	ID, Dimension string
+	X, Y, Z int
+}
+
+// ReadPlayerPositions loads the last position of every player with a file in
+// the world at dir, in order of ID. Files that can't be read are reported
+// through errs and skipped.
+func ReadPlayerPositions(dir string) (players []PlayerPosition, errs []error) {
+	for _, playersDir := range []string{PLAYERSDIR, PLAYERDATADIR} {
+		files, err := filepath.Glob(filepath.Join(dir, playersDir, "*.dat"))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, file := range files {
+			p, err := ReadPlayerPosition(file)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			players = append(players, p)
+		}
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].ID < players[j].ID
+	})
+	return
+}
+
+// ReadPlayerPosition reads a player file, whose Dimension is a number before
+// 1.16 and a key such as minecraft:the_nether since.
+func ReadPlayerPosition(path string) (p PlayerPosition, err error) {
+	p.ID = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	
+	data, err := ReadNBTData(path)
+	if err != nil {
+		return
+	}
+	root, err := ReadNBTTree(data)
+	if err != nil {
+		return p, fmt.Errorf("%s: %s", path, err)
+	}
+	
+	pos, _ := root["Pos"].([]interface{})
+	var coords []int
+	for _, v := range pos {
+		if f, ok := v.(float64); ok {
+			coords = append(coords, Floor(f))
+		}
+	}
+	if len(coords) != 3 {
+		return p, fmt.Errorf("%s: no position", path)
+	}
+	p.X, p.Y, p.Z = coords[0], coords[1], coords[2]
+	
+	switch dimension := root["Dimension"].(type) {
+	case int32:
+		var ok bool
+		if p.Dimension, ok = DimensionKey(int(dimension)); !ok {
+			return p, fmt.Errorf("%s: unknown dimension %d", path, dimension)
+		}
+	case string:
+		p.Dimension = dimension
+	default:
+		p.Dimension = dimensionDirs[0].Key
+	}
+	return
+}
+
+// RenderPlayers renders a map of the area within radius of each player's
+// last position, in the dimension they were in, named after targets and the
+// player's ID. Each player is marked at the center of their own map.
+func RenderPlayers(dir string, targets []RenderTarget, radius int, opts *Options) error {
+	players, errs := ReadPlayerPositions(dir)
+	for _, err := range errs {
+		opts.Progress.Warnf("Error reading player: %s", err)
+	}
+	if len(players) == 0 {
+		return fatalError("Error reading players: ", fmt.Errorf("no player files found in %s", dir))
+	}
+	
+	// Every player's map covers a different area, which layers aren't kept
+	// by.
+	if opts.Cache != nil {
+		opts.Progress.Warnf("-cache and -resume don't apply to -per-player maps")
+		opts.Cache = nil
+	}
+	
+	area, overlays := opts.Area, opts.Overlays
+	defer func() {
+		opts.Area, opts.Overlays = area, overlays
+	}()
+	for _, p := range players {
+		d, err := FindDimension(dir, p.Dimension)
+		if err != nil {
+			opts.Progress.Warnf("Skipping %s: %s", p.ID, err)
+			continue
+		}
+		d.Name = ""
+		
+		opts.Area = area
+		opts.Area.Limit(BlockPoint{p.X, p.Z}, radius)
+		probe := &Dimension{Path: d.Path}
+		if err := probe.Glob(0, opts); err != nil {
+			return err
+		}
+		if len(probe.Regions) == 0 {
+			opts.Progress.Warnf("Skipping %s, who has no regions within %d blocks", p.ID, radius)
+			continue
+		}
+		
+		playerTargets := make([]RenderTarget, len(targets))
+		for i, target := range targets {
+			playerTargets[i] = RenderTarget{OutputFilename(target.Out, p.ID), target.Modes}
+		}
+		d.AddOutputs(playerTargets)
+		
+		opts.Overlays = append(overlays[:len(overlays):len(overlays)], MarkerOverlay{{X: p.X, Y: p.Y, Z: p.Z}})
+		opts.Progress.Printf("Rendering %s at %d,%d", p.ID, p.X, p.Z)
+		if _, err := RenderDimensions(dir, []*Dimension{d}, playerTargets, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package render
+
+import (
+	"io"
+	"bytes"
+	"hash/crc32"
+	"encoding/binary"
+)
+
+// The signature and IHDR chunk every PNG starts with, after which text
+// chunks are inserted.
+const PNGHEADERSIZE = 8 + 4 + 4 + 13 + 4
+
+// PNGText is a keyword and value stored in a tEXt chunk, or an iTXt chunk
+// when the value isn't plain ASCII.
+type PNGText struct {
+	Keyword, Text string
+}
+
+func writeChunk(w io.Writer, name string, data []byte) error {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	w.Write(length[:])
+	io.WriteString(w, name)
+	w.Write(data)
+	
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(name))
+	crc.Write(data)
+	
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	_, err := w.Write(sum[:])
+	return err
+}
+
+func writeText(w io.Writer, text []PNGText) error {
+	for _, t := range text {
+		ascii := true
+		for i := 0; i < len(t.Text); i++ {
+			ascii = ascii && t.Text[i] < 0x80
+		}
+		
+		var data bytes.Buffer
+		data.WriteString(t.Keyword)
+		data.WriteByte(0)
+		name := "tEXt"
+		if !ascii {
+			// Uncompressed, with no language or translated keyword.
+			data.Write([]byte{0, 0, 0, 0})
+			name = "iTXt"
+		}
+		data.WriteString(t.Text)
+		
+		if err := writeChunk(w, name, data.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A pngTextWriter passes an encoded PNG through to w, inserting text chunks
+// once the header has gone by, since image/png can't write them itself.
+type pngTextWriter struct {
+	w io.Writer
+	text []PNGText
+	n int
+}
+
+func (p *pngTextWriter) Write(b []byte) (int, error) {
+	written := 0
+	if p.n < PNGHEADERSIZE {
+		header := Min(PNGHEADERSIZE - p.n, len(b))
+		n, err := p.w.Write(b[:header])
+		p.n += n
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if p.n == PNGHEADERSIZE {
+			if err := writeText(p.w, p.text); err != nil {
+				return written, err
+			}
+		}
+		b = b[header:]
+	}
+	
+	n, err := p.w.Write(b)
+	return written + n, err
+}
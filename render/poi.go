@@ -0,0 +1,154 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"sort"
+	"strings"
+	"image/color"
+	"path/filepath"
+)
+
+// POIGLOBPATTERN finds the point of interest files 1.14 added beside each
+// dimension's region files, which list portals, villagers' beds and
+// workstations and the like without having to search every chunk.
+const POIGLOBPATTERN = "poi/r.*.*.mca"
+
+// A POIKind is a group of point of interest types -pois can mark, each in
+// its own color. Only lodestones are labelled, as villages have far too many
+// beds and job sites to read.
+type POIKind struct {
+	Types []string
+	Label string
+	Color color.RGBA
+}
+
+var poiKinds = map[string]POIKind{
+	"beds": {[]string{"home"}, "", color.RGBA{0xD0, 0x30, 0x30, 0xFF}},
+	"jobs": {[]string{"armorer", "butcher", "cartographer", "cleric", "farmer", "fisherman", "fletcher", "leatherworker", "librarian", "mason", "shepherd", "toolsmith", "weaponsmith"}, "", color.RGBA{0xF0, 0x90, 0x20, 0xFF}},
+	"bells": {[]string{"meeting"}, "", color.RGBA{0xFF, 0xE0, 0x40, 0xFF}},
+	"lodestones": {[]string{"lodestone"}, "Lodestone", color.RGBA{0x40, 0xC0, 0xE0, 0xFF}},
+}
+
+// A POISet selects kinds of points of interest by name, or all of them.
+type POISet map[string]bool
+
+func (s *POISet) String() string {
+	var names sort.StringSlice
+	for name := range *s {
+		names = append(names, name)
+	}
+	names.Sort()
+	return strings.Join(names, ",")
+}
+
+func (s *POISet) Set(v string) error {
+	*s = make(POISet)
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		switch _, exists := poiKinds[name]; {
+		case name == "all":
+			for kind := range poiKinds {
+				(*s)[kind] = true
+			}
+		case exists:
+			(*s)[name] = true
+		case name != "":
+			return fmt.Errorf("unknown point of interest %q, expected beds, jobs, bells, lodestones or all", name)
+		}
+	}
+	return nil
+}
+
+// Markers marks the points of interest of the kinds in the set.
+func (s POISet) Markers(pois []POI) (markers []Marker) {
+	kinds := make(map[string]POIKind)
+	for name := range s {
+		for _, t := range poiKinds[name].Types {
+			kinds["minecraft:" + t] = poiKinds[name]
+		}
+	}
+	for _, poi := range pois {
+		if kind, exists := kinds[poi.Type]; exists {
+			markers = append(markers, Marker{Label: kind.Label, X: poi.X, Y: poi.Y, Z: poi.Z, Color: kind.Color})
+		}
+	}
+	return
+}
+
+// A POI is one point of interest, of a type such as
+// "minecraft:nether_portal".
+type POI struct {
+	Type string
+	X, Y, Z int
+}
+
+// ReadPOIs reads every point of interest in a dimension's poi files, if it
+// has any.
+func ReadPOIs(dimensionPath string) ([]POI, error) {
+	files, err := filepath.Glob(filepath.Join(dimensionPath, POIGLOBPATTERN))
+	if err != nil {
+		return nil, err
+	}
+	
+	var pois []POI
+	for _, file := range files {
+		found, err := readPOIFile(file)
+		if err != nil {
+			return pois, err
+		}
+		pois = append(pois, found...)
+	}
+	return pois, nil
+}
+
+func readPOIFile(path string) (pois []POI, err error) {
+	poiFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer poiFile.Close()
+	
+	stat, err := poiFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	
+	var header Header
+	header.Read(poiFile)
+	
+	for _, location := range header.Locations {
+		if !location.Valid(stat.Size()) {
+			continue
+		}
+		
+		var chunk RawChunk
+		if err := chunk.Read(io.NewSectionReader(poiFile, location.Start(), location.Size())); err != nil {
+			return pois, err
+		}
+		data, err := chunk.Decompress()
+		if err != nil {
+			return pois, err
+		}
+		root, err := ReadNBTTree(data)
+		if err != nil {
+			return pois, err
+		}
+		
+		// Sections are keyed by their height, each listing its records.
+		sections, _ := root["Sections"].(map[string]interface{})
+		for _, section := range sections {
+			s, _ := section.(map[string]interface{})
+			records, _ := s["Records"].([]interface{})
+			for _, record := range records {
+				r, _ := record.(map[string]interface{})
+				kind, _ := r["type"].(string)
+				if pos, ok := r["pos"].([]int32); ok && len(pos) == 3 {
+					pois = append(pois, POI{kind, int(pos[0]), int(pos[1]), int(pos[2])})
+				}
+			}
+		}
+	}
+	return pois, nil
+}
@@ -0,0 +1,209 @@
+package render
+
+import (
+	"sort"
+	"image/color"
+	"path/filepath"
+)
+
+const (
+	PORTALBLOCK = 0x5A
+	PORTALPOI = "minecraft:nether_portal"
+	
+	// PORTALSEARCH is how far around where a portal comes out the game looks
+	// for a portal to link to before building a new one.
+	PORTALSEARCH = 128
+)
+
+var (
+	portalColor = color.RGBA{0xA0, 0x40, 0xFF, 0xFF}
+	linkColor = color.RGBA{0xD0, 0x90, 0xFF, 0xFF}
+)
+
+// A Portal is one nether portal, placed at the middle of its bottom row.
+type Portal struct {
+	Dimension int
+	X, Y, Z int
+}
+
+// In returns the portal's position in the coordinates of a dimension, the
+// nether being an eighth the size of the overworld.
+func (p Portal) In(dimension int) [3]int {
+	switch {
+	case p.Dimension == 0 && dimension == -1:
+		return [3]int{p.X >> 3, p.Y, p.Z >> 3}
+	case p.Dimension == -1 && dimension == 0:
+		return [3]int{p.X << 3, p.Y, p.Z << 3}
+	}
+	return [3]int{p.X, p.Y, p.Z}
+}
+
+// Destination finds the portal among others in the other dimension that p
+// leads to: the nearest within PORTALSEARCH of where it comes out. Without
+// one, the game would build a new portal there.
+func (p Portal) Destination(others []Portal) (dest Portal, found bool) {
+	best := 0
+	for _, o := range others {
+		at := p.In(o.Dimension)
+		dx, dy, dz := o.X - at[0], o.Y - at[1], o.Z - at[2]
+		if Abs(dx) > PORTALSEARCH || Abs(dz) > PORTALSEARCH {
+			continue
+		}
+		if d := dx * dx + dy * dy + dz * dz; !found || d < best {
+			dest, best, found = o, d, true
+		}
+	}
+	return
+}
+
+// FindPortals lists the nether portals of the overworld and nether, from
+// their poi files where the world has them and otherwise by searching every
+// chunk for portal blocks.
+func FindPortals(dir string, opts *Options) (map[int][]Portal, error) {
+	portals := make(map[int][]Portal)
+	for _, d := range dimensionDirs {
+		if d.ID != 0 && d.ID != -1 {
+			continue
+		}
+		path := filepath.Join(dir, d.Path)
+		
+		blocks := make(map[[3]int]bool)
+		pois, err := ReadPOIs(path)
+		if err != nil {
+			opts.Progress.Warnf("Error reading %s points of interest, searching its chunks instead: %s", d.Name, err)
+		}
+		for _, poi := range pois {
+			if poi.Type == PORTALPOI {
+				blocks[[3]int{poi.X, poi.Y, poi.Z}] = true
+			}
+		}
+		if len(pois) == 0 || err != nil {
+			if err := portalBlocks(path, opts, blocks); err != nil {
+				return nil, err
+			}
+		}
+		portals[d.ID] = groupPortals(d.ID, blocks)
+	}
+	return portals, nil
+}
+
+// portalBlocks adds the portal blocks in a dimension's chunks to blocks.
+func portalBlocks(path string, opts *Options, blocks map[[3]int]bool) error {
+	search := Options{Concurrency: opts.Concurrency, ChunkCache: opts.ChunkCache, Failure: opts.Failure}
+	dimension := &Dimension{Path: path}
+	if err := dimension.Glob(0, &search); err != nil {
+		return err
+	}
+	
+	for job := range Decode(dimension.Regions, &search) {
+		for _, chunk := range job.Chunks {
+			chunk.(Level).EachBlock(func(x, y, z int, block byte) {
+				if block == PORTALBLOCK {
+					blocks[[3]int{x, y, z}] = true
+				}
+			})
+		}
+	}
+	return search.Failure.Err()
+}
+
+// groupPortals joins touching portal blocks into portals.
+func groupPortals(dimension int, blocks map[[3]int]bool) (portals []Portal) {
+	var sorted byBlock
+	for b := range blocks {
+		sorted = append(sorted, b)
+	}
+	sort.Sort(sorted)
+	
+	seen := make(map[[3]int]bool)
+	for _, start := range sorted {
+		if seen[start] {
+			continue
+		}
+		
+		var group [][3]int
+		queue := [][3]int{start}
+		seen[start] = true
+		for len(queue) != 0 {
+			b := queue[0]
+			queue = queue[1:]
+			group = append(group, b)
+			for _, d := range [][3]int{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}} {
+				n := [3]int{b[0] + d[0], b[1] + d[1], b[2] + d[2]}
+				if blocks[n] && !seen[n] {
+					seen[n] = true
+					queue = append(queue, n)
+				}
+			}
+		}
+		
+		bottom := group[0][1]
+		for _, b := range group {
+			bottom = Min(bottom, b[1])
+		}
+		var sumX, sumZ, n int
+		for _, b := range group {
+			if b[1] == bottom {
+				sumX, sumZ, n = sumX + b[0], sumZ + b[2], n + 1
+			}
+		}
+		portals = append(portals, Portal{dimension, sumX / n, bottom, sumZ / n})
+	}
+	return
+}
+
+// PortalOverlay marks the portals of the overworld or nether and those of
+// the other dimension where they'd come out in it, and joins each pair that
+// link, in either direction.
+func PortalOverlay(portals map[int][]Portal, dimension int) (markers []Marker, paths []Path) {
+	if dimension != 0 && dimension != -1 {
+		return
+	}
+	
+	labels := map[int]string{0: "Overworld portal", -1: "Nether portal"}
+	for _, id := range []int{0, -1} {
+		for _, p := range portals[id] {
+			at := p.In(dimension)
+			markers = append(markers, Marker{Label: labels[id], X: at[0], Y: at[1], Z: at[2], Color: portalColor})
+		}
+	}
+	
+	linked := make(map[[2]Portal]bool)
+	for _, id := range []int{0, -1} {
+		for _, p := range portals[id] {
+			dest, found := p.Destination(portals[-1 - id])
+			if !found {
+				continue
+			}
+			pair := [2]Portal{p, dest}
+			if id == -1 {
+				pair = [2]Portal{dest, p}
+			}
+			if !linked[pair] {
+				linked[pair] = true
+				paths = append(paths, Path{Points: [][3]int{pair[0].In(dimension), pair[1].In(dimension)}, Color: linkColor})
+			}
+		}
+	}
+	return
+}
+
+type byBlock [][3]int
+
+func (b byBlock) Len() int {
+	return len(b)
+}
+
+func (b byBlock) Less(i, j int) bool {
+	if b[i][0] != b[j][0] {
+		return b[i][0] < b[j][0]
+	}
+	if b[i][1] != b[j][1] {
+		return b[i][1] < b[j][1]
+	}
+	return b[i][2] < b[j][2]
+}
+
+func (b byBlock) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
@@ -0,0 +1,110 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"strings"
+)
+
+// PROFILEALL renders every profile in the config.
+const PROFILEALL = "all"
+
+// passFlags only change what's drawn from each region, not how the world is
+// read, so profiles differing in nothing else share a pass.
+var passFlags = map[string]bool{
+	"out": true,
+	"modes": true,
+	"projection": true,
+	"slices": true,
+	"profile": true,
+	"config": true,
+}
+
+// passKey describes every setting that needs its own pass over the world.
+func passKey(flags *flag.FlagSet) string {
+	var key []string
+	flags.VisitAll(func(f *flag.Flag) {
+		if !passFlags[f.Name] {
+			key = append(key, f.Name + "=" + f.Value.String())
+		}
+	})
+	return strings.Join(key, "\n")
+}
+
+// RenderProfiles renders the named profile from config, or every profile for
+// PROFILEALL, each from its own settings on top of config's and args, as
+// tiles for the tiles command. With printConfig it reports what each profile
+// resolves to instead.
+func RenderProfiles(config *Config, profile string, args []string, tiles, printConfig bool) error {
+	names := []string{profile}
+	if profile == PROFILEALL {
+		names = config.ProfileNames
+	}
+	
+	var (
+		keys []string
+		passes = make(map[string][]*RenderSettings)
+	)
+	for _, name := range names {
+		pc, err := config.ForProfile(name)
+		if err != nil {
+			return fatalError("Error in config: ", err)
+		}
+		
+		flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		flags.Usage = Usage
+		s := NewRenderSettings(flags)
+		s.Tiles = tiles
+		if tiles {
+			SetDefault(flags, "out", TILESFILE)
+		}
+		if err := parseFlags(flags, args); err != nil {
+			return err
+		}
+		if err := pc.Apply(flags); err != nil {
+			return fatalError("Error in config: ", err)
+		}
+		s.Resolve()
+		s.UseCache(flags)
+		
+		if printConfig {
+			fmt.Printf("[profile.%s]\n", name)
+			if err := ResolveSettings(flags, pc).Print(os.Stdout); err != nil {
+				return fatalError("Error printing config: ", err)
+			}
+			fmt.Println()
+			continue
+		}
+		
+		key := passKey(flags)
+		if _, exists := passes[key]; !exists {
+			keys = append(keys, key)
+		}
+		passes[key] = append(passes[key], s)
+	}
+	
+	skipped := 0
+	for _, key := range keys {
+		var (
+			targets []RenderTarget
+			profiles = passes[key]
+		)
+		for _, s := range profiles {
+			targets = append(targets, s.Target())
+		}
+		
+		// Each pass starts from the built-in palette whatever the last loaded.
+		restore := SavePalette()
+		err := profiles[0].Run(targets)
+		restore()
+		if err != nil {
+			return err
+		}
+		skipped += profiles[0].Opts.Progress.SkippedChunks()
+	}
+	if skipped > 0 {
+		return ErrSkipped
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"log"
+	"flag"
+	"time"
+	"strings"
+	"path/filepath"
+	"encoding/json"
+)
+
+type ProgressMode string
+
+const (
+	ProgressText ProgressMode = "text"
+	ProgressJSON ProgressMode = "json"
+)
+
+func (m *ProgressMode) String() string {
+	return string(*m)
+}
+
+func (m *ProgressMode) Set(s string) error {
+	switch ProgressMode(s) {
+	case ProgressText, ProgressJSON:
+		*m = ProgressMode(s)
+		return nil
+	}
+	return fmt.Errorf("unknown log format %q, expected text or json", s)
+}
+
+// LogLevel orders messages by importance, lower levels always shown before
+// higher ones.
+type LogLevel int
+
+const (
+	LevelError LogLevel = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+	LevelTrace
+)
+
+var levelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+func (l LogLevel) String() string {
+	return levelNames[l]
+}
+
+// ProgressEvent is one line of json output. Every event has a time, level
+// and event name, and messages a message, with the rest set as relevant.
+type ProgressEvent struct {
+	Time time.Time `json:"time"`
+	Level string `json:"level"`
+	Event string `json:"event"`
+	Message string `json:"message,omitempty"`
+	Dimension string `json:"dimension,omitempty"`
+	Region string `json:"region,omitempty"`
+	Index int `json:"index,omitempty"`
+	Total int `json:"total,omitempty"`
+	Chunks int `json:"chunks"`
+	Percent float64 `json:"percent"`
+	Elapsed float64 `json:"elapsed"`
+	ETA float64 `json:"eta"`
+}
+
+// Progress reports what the renderer is doing at the levels asked for,
+// either as human readable lines, warnings and errors on stderr and the rest
+// on stdout, or as newline-delimited JSON events on stderr.
+type Progress struct {
+	Mode ProgressMode
+	Quiet bool
+	Verbose, VeryVerbose bool
+	
+	// Output, if set, takes everything instead of stdout and stderr, and
+	// leaves the log package alone, for programs embedding the renderer.
+	Output io.Writer
+	
+	start time.Time
+	chunks, skipped int
+	text, errText io.Writer
+	events *json.Encoder
+}
+
+// Flags defines the flags choosing what's reported and how.
+func (p *Progress) Flags(flags *flag.FlagSet) {
+	flags.Var(&p.Mode, "log-format", "Report progress and errors as text or as newline-delimited json on stderr, with a time, level and event on every line.")
+	flags.Var(&p.Mode, "progress", "Same as -log-format.")
+	flags.BoolVar(&p.Quiet, "quiet", false, "Suppress all progress output, reporting only errors.")
+	flags.BoolVar(&p.Verbose, "v", false, "Also report debugging detail, such as each region's chunk count.")
+	flags.BoolVar(&p.VeryVerbose, "vv", false, "Report even more detail than -v, such as why each region is drawn.")
+}
+
+// Start begins timing and takes over the log package's output, which
+// HandleError reports fatal errors through, so they're reported as errors in
+// the same format as everything else.
+func (p *Progress) Start() {
+	if p.Mode == "" {
+		p.Mode = ProgressText
+	}
+	
+	p.start = time.Now()
+	if p.Output != nil {
+		p.text, p.errText = p.Output, p.Output
+		p.events = json.NewEncoder(p.Output)
+		return
+	}
+	
+	p.text = os.Stdout
+	p.errText = os.Stderr
+	p.events = json.NewEncoder(os.Stderr)
+	
+	log.SetFlags(0)
+	log.SetOutput(fatalWriter{p})
+}
+
+// Level is the most detailed level reported.
+func (p *Progress) Level() LogLevel {
+	switch {
+	case p.Quiet:
+		return LevelError
+	case p.VeryVerbose:
+		return LevelTrace
+	case p.Verbose:
+		return LevelDebug
+	}
+	return LevelInfo
+}
+
+// write reports e, or text in text mode, if its level is enabled.
+func (p *Progress) write(level LogLevel, e ProgressEvent, text string) {
+	if level > p.Level() {
+		return
+	}
+	
+	if p.Mode == ProgressJSON {
+		e.Time = time.Now()
+		e.Level = level.String()
+		e.Elapsed = time.Since(p.start).Seconds()
+		p.events.Encode(e)
+		return
+	}
+	
+	switch level {
+	case LevelError:
+		fmt.Fprintln(p.errText, text)
+	case LevelWarn:
+		fmt.Fprintln(p.errText, "Warning: " + text)
+	default:
+		fmt.Fprintln(p.text, text)
+	}
+}
+
+func (p *Progress) logf(level LogLevel, format string, a ...interface{}) {
+	message := fmt.Sprintf(format, a...)
+	p.write(level, ProgressEvent{Event: "message", Message: message}, message)
+}
+
+// Printf reports at LevelInfo.
+func (p *Progress) Printf(format string, a ...interface{}) {
+	p.logf(LevelInfo, format, a...)
+}
+
+func (p *Progress) Errorf(format string, a ...interface{}) {
+	p.logf(LevelError, format, a...)
+}
+
+func (p *Progress) Warnf(format string, a ...interface{}) {
+	p.logf(LevelWarn, format, a...)
+}
+
+func (p *Progress) Debugf(format string, a ...interface{}) {
+	p.logf(LevelDebug, format, a...)
+}
+
+func (p *Progress) Tracef(format string, a ...interface{}) {
+	p.logf(LevelTrace, format, a...)
+}
+
+// A fatalWriter reports what's logged through the log package as errors.
+type fatalWriter struct {
+	p *Progress
+}
+
+func (w fatalWriter) Write(b []byte) (int, error) {
+	message := strings.TrimSpace(string(b))
+	w.p.write(LevelError, ProgressEvent{Event: "fatal", Message: message}, message)
+	return len(b), nil
+}
+
+func (p *Progress) Region(dimension, filename string, index, total, chunks int) {
+	p.chunks += chunks
+	
+	elapsed := time.Since(p.start).Seconds()
+	p.write(LevelInfo, ProgressEvent{
+		Event: "region",
+		Dimension: dimension,
+		Region: filename,
+		Index: index,
+		Total: total,
+		Chunks: chunks,
+		Percent: 100.0 * float64(index) / float64(total),
+		ETA: elapsed / float64(index) * float64(total - index),
+	}, fmt.Sprintf("Rendering: %s (%d/%d)", filepath.Join(dimension, filename), index, total))
+	if p.Mode != ProgressJSON {
+		p.Debugf("\tFound %d populated chunks", chunks)
+	}
+}
+
+func (p *Progress) ChunkError(e ChunkError) {
+	p.write(LevelWarn, ProgressEvent{Event: "error", Region: e.Region, Message: e.Error()}, fmt.Sprintf("Skipped %s", e))
+}
+
+func (p *Progress) Skipped(errors []ChunkError) {
+	p.skipped += len(errors)
+	if len(errors) == 0 || p.Level() < LevelWarn {
+		return
+	}
+	
+	if p.Mode == ProgressJSON {
+		p.write(LevelWarn, ProgressEvent{Event: "skipped", Chunks: len(errors)}, "")
+		return
+	}
+	
+	counts := make(map[string]int)
+	var regions []string
+	for _, e := range errors {
+		if counts[e.Region] == 0 {
+			regions = append(regions, e.Region)
+		}
+		counts[e.Region]++
+	}
+	
+	p.Warnf("Skipped %d corrupt chunks in %d regions:", len(errors), len(regions))
+	for _, region := range regions {
+		fmt.Fprintf(p.errText, "\t%s: %d\n", region, counts[region])
+	}
+}
+
+// SkippedChunks is how many corrupt chunks the render left out.
+func (p *Progress) SkippedChunks() int {
+	return p.skipped
+}
+
+func (p *Progress) Elapsed() time.Duration {
+	return time.Since(p.start)
+}
+
+func (p *Progress) Done() {
+	p.write(LevelInfo, ProgressEvent{Event: "done", Chunks: p.chunks, Percent: 100}, fmt.Sprintf("Render time: %+v", time.Since(p.start)))
+}
@@ -0,0 +1,73 @@
+package render
+
+import (
+	"fmt"
+	"image"
+)
+
+// DefaultProjection is the classic GoCart look: blocks 4 pixels wide with a
+// 1 pixel top and 2 pixel sides.
+var DefaultProjection = Projection{4, 1, 2}
+
+// A Projection sets the isometric block size in pixels. Each step in x
+// moves half of Width right and Top up, each in z half of Width right and
+// Top down, and each in y Side up. A larger Top looks more steeply down on
+// the world; a larger Side stretches it vertically.
+type Projection struct {
+	Width, Top, Side int
+}
+
+func (p *Projection) String() string {
+	return fmt.Sprintf("%d,%d,%d", p.Width, p.Top, p.Side)
+}
+
+func (p *Projection) Set(s string) error {
+	var width, top, side int
+	if _, err := fmt.Sscanf(s, "%d,%d,%d", &width, &top, &side); err != nil {
+		return fmt.Errorf("expected width,top,side: %s", err)
+	}
+	if width < 2 || width & 1 != 0 || top < 1 || side < 1 {
+		return fmt.Errorf("width must be even and at least 2, top and side at least 1")
+	}
+	*p = Projection{width, top, side}
+	return nil
+}
+
+// orDefault lets the zero Projection stand for DefaultProjection, so
+// IsometricMode{} draws as it always has.
+func (p Projection) orDefault() Projection {
+	if p == (Projection{}) {
+		return DefaultProjection
+	}
+	return p
+}
+
+func (p Projection) Project(x, y, z int) (int, int) {
+	return p.Width / 2 * (x + z), p.Top * (z - x) - p.Side * y
+}
+
+// Box returns the pixels covered by every block from x0, y0, z0 to x1, y1,
+// z1 inclusive.
+func (p Projection) Box(x0, y0, z0, x1, y1, z1 int) image.Rectangle {
+	left, _ := p.Project(x0, 0, z0)
+	right, _ := p.Project(x1, 0, z1)
+	_, top := p.Project(x1, y1, z0)
+	_, bottom := p.Project(x0, y0, z1)
+	return image.Rect(left - p.Width / 2, top - p.Top, right + p.Width / 2, bottom + 2 * p.Top + p.Side - 1)
+}
+
+// Region and chunk bounds leave room for a block above the highest one, so
+// markers and entities standing on top aren't cut off.
+func (p Projection) RegionBounds(r Region) image.Rectangle {
+	x, z := r.X << 9, r.Z << 9
+	return p.Box(x, 0, z, x + 511, 256, z + 511)
+}
+
+func (p Projection) ChunkBounds(l Level) image.Rectangle {
+	x, z := int(l.X) << 4, int(l.Z) << 4
+	return p.Box(x, 0, z, x + 15, l.Top(), z + 15)
+}
+
+func (p Projection) AreaBounds(a Area) image.Rectangle {
+	return p.Box(a.X0, 0, a.Z0, a.X1, 255, a.Z1)
+}
@@ -0,0 +1,177 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Prune removes chunks whose terrain was never populated, which the game
+// generates again when they're next needed, from a world's region files.
+// Chunks that can't be read are kept, and nothing is written if any chunk
+// is of a format that can't be told populated or not.
+func Prune(args []string) error {
+	var (
+		dir string
+		write, noLock bool
+		opts Options
+	)
+	
+	flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+	flags.StringVar(&dir, "dir", DIR, "Prune region files of the world or dimension at this directory.")
+	flags.BoolVar(&write, "write", false, "Rewrite the region files rather than only reporting what pruning would free. Stop the server first.")
+	flags.BoolVar(&noLock, "no-lock", false, "Don't lock the world directory against other runs.")
+	opts.Progress.Flags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	
+	opts.Auto()
+	opts.Progress.Start()
+	
+	dimension := &Dimension{Path: dir}
+	if err := dimension.Glob(0, &opts); err != nil {
+		return err
+	}
+	if len(dimension.Regions) == 0 {
+		return exitError(ExitNoRegions, "Error reading world: ", fmt.Errorf("no region files found in %s", dir))
+	}
+	
+	if write && !noLock {
+		lock, err := AcquireLock(dir, 0)
+		if err != nil {
+			return fatalError("Error locking world directory: ", err)
+		}
+		defer lock.Release()
+	}
+	
+	type regionChunks struct {
+		region Region
+		keep, drop []ExploredChunk
+	}
+	var regions []regionChunks
+	var total, pruned, unknown int
+	var freed int64
+	for _, r := range dimension.Regions {
+		region := r.(Region)
+		chunks, err := ExploreRegion(region)
+		if err != nil {
+			opts.Progress.Warnf("Error reading %s: %s", filepath.Base(region.Path), err)
+			continue
+		}
+		
+		rc := regionChunks{region: region}
+		for _, c := range chunks {
+			if c.Unknown {
+				unknown++
+			}
+			if c.Populated || c.Err != nil {
+				rc.keep = append(rc.keep, c)
+				continue
+			}
+			rc.drop = append(rc.drop, c)
+			freed += c.Size
+		}
+		total += len(chunks)
+		pruned += len(rc.drop)
+		if len(rc.drop) != 0 {
+			opts.Progress.Debugf("%s: %d of %d chunks unpopulated", filepath.Base(region.Path), len(rc.drop), len(chunks))
+			regions = append(regions, rc)
+		}
+	}
+	
+	if unknown != 0 {
+		err := fmt.Errorf("%d chunks record neither TerrainPopulated nor a known Status, so can't be told populated or not", unknown)
+		if write {
+			return fatalError("Error pruning world: ", err)
+		}
+		opts.Progress.Warnf("%s; -write would refuse to prune", err)
+	}
+	if write {
+		for _, rc := range regions {
+			if err := PruneRegion(rc.region, rc.keep, rc.drop); err != nil {
+				opts.Progress.Errorf("Error pruning %s: %s", filepath.Base(rc.region.Path), err)
+			}
+		}
+	}
+	
+	verb := "would free"
+	if write {
+		verb = "freed"
+	}
+	opts.Progress.Printf("%d of %d chunks in %d regions unpopulated; pruning them %s %.1f MiB", pruned, total, len(dimension.Regions), verb, float64(freed) / (1 << 20))
+	return nil
+}
+
+// PruneRegion rewrites a region file with only the chunks in keep, packed
+// together, removing it if there are none. The .mcc files of external
+// chunks in drop are removed too.
+func PruneRegion(region Region, keep, drop []ExploredChunk) error {
+	regionFile, err := os.Open(region.Path)
+	if err != nil {
+		return err
+	}
+	defer regionFile.Close()
+	
+	var header, pruned Header
+	header.Read(regionFile)
+	
+	if len(keep) == 0 {
+		if err := os.Remove(region.Path); err != nil {
+			return err
+		}
+		return removeExternal(region, drop)
+	}
+	
+	f, err := ioutil.TempFile(filepath.Dir(region.Path), ".prune-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	
+	// Chunks are copied whole sectors at a time after the two of the header.
+	sector := uint32(2)
+	if _, err := f.Seek(int64(sector) << 12, io.SeekStart); err != nil {
+		return err
+	}
+	for _, c := range keep {
+		i := c.Z & 31 << 5 + c.X & 31
+		if _, err := io.Copy(f, io.NewSectionReader(regionFile, c.Offset, c.Size)); err != nil {
+			return err
+		}
+		pruned.Locations[i] = Location{sector, header.Locations[i].Length}
+		pruned.Timestamps[i] = header.Timestamps[i]
+		sector += uint32(header.Locations[i].Length)
+	}
+	
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := pruned.Write(f); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), region.Path); err != nil {
+		return err
+	}
+	return removeExternal(region, drop)
+}
+
+func removeExternal(region Region, chunks []ExploredChunk) error {
+	for _, c := range chunks {
+		if !c.External {
+			continue
+		}
+		err := os.Remove(filepath.Join(filepath.Dir(region.Path), fmt.Sprintf("c.%d.%d.mcc", c.X, c.Z)))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
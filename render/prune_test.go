@@ -0,0 +1,214 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"bytes"
+	"testing"
+	"io/ioutil"
+	"math/rand"
+	"compress/zlib"
+	"path/filepath"
+	"encoding/binary"
+)
+
+// unpopulatedChunk is a 1.16 chunk at x, z generated only as far as its caves.
+func unpopulatedChunk(x, z int32) []byte {
+	return nbtRoot(
+		nbtTag(TagInt, "DataVersion", nbtInt(2586)),
+		nbtTag(TagCompound, "Level", nbtCompound(
+			nbtTag(TagInt, "xPos", nbtInt(x)),
+			nbtTag(TagInt, "zPos", nbtInt(z)),
+			nbtTag(TagString, "Status", nbtString("minecraft:carvers")),
+		)),
+	)
+}
+
+// noisyChunk is a populated chunk that won't compress into one sector.
+func noisyChunk(x, z int32) []byte {
+	noise := make([]byte, 3 * 4096)
+	rand.New(rand.NewSource(int64(x) << 32 | int64(z))).Read(noise)
+	return nbtRoot(
+		nbtTag(TagCompound, "Level", nbtCompound(
+			nbtTag(TagInt, "xPos", nbtInt(x)),
+			nbtTag(TagInt, "zPos", nbtInt(z)),
+			nbtTag(TagByte, "TerrainPopulated", []byte{1}),
+			nbtTag(TagByteArray, "Noise", nbtByteArray(noise)),
+		)),
+	)
+}
+
+// pruneRegion writes r.-1.2.mca holding populated and unpopulated chunks,
+// one of them external, returning the region and the file's bytes.
+func pruneRegion(t *testing.T) (Region, []byte) {
+	dir, err := ioutil.TempDir("", "gocart-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	
+	chunk := func(i int, build func(x, z int32) []byte) []byte {
+		return build(int32(-32 + i & 31), int32(64 + i >> 5))
+	}
+	data := regionData(map[int][]byte{
+		0: chunk(0, func(x, z int32) []byte { return legacyChunk(x, z, 1) }),
+		1: chunk(1, unpopulatedChunk),
+		33: chunk(33, noisyChunk),
+		40: chunk(40, unpopulatedChunk),
+		1023: chunk(1023, func(x, z int32) []byte { return legacyChunk(x, z, 3) }),
+	})
+	
+	// An unpopulated chunk at 500 kept in its .mcc file, its one sector
+	// holding only the length and compression.
+	sector := len(data) >> 12
+	binary.BigEndian.PutUint32(data[4 * 500:], uint32(sector) << 8 | 1)
+	binary.BigEndian.PutUint32(data[4096 + 4 * 500:], 1500)
+	external := make([]byte, 4096)
+	copy(external, []byte{0, 0, 0, 1, CompressionExternal | CompressionZlib})
+	data = append(data, external...)
+	
+	var mcc bytes.Buffer
+	w := zlib.NewWriter(&mcc)
+	w.Write(chunk(500, unpopulatedChunk))
+	w.Close()
+	if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("c.%d.%d.mcc", -32 + 500 & 31, 64 + 500 >> 5)), mcc.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	
+	path := filepath.Join(dir, "r.-1.2.mca")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return NewRegion(path), data
+}
+
+func readHeader(data []byte) Header {
+	var header Header
+	header.Read(bytes.NewReader(data))
+	return header
+}
+
+func TestExploreRegion(t *testing.T) {
+	region, data := pruneRegion(t)
+	header := readHeader(data)
+	chunks, err := ExploreRegion(region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	want := map[int]ExploredChunk{
+		0: {X: -32, Z: 64, Populated: true},
+		1: {X: -31, Z: 64},
+		33: {X: -31, Z: 65, Populated: true},
+		40: {X: -24, Z: 65},
+		500: {X: -12, Z: 79, External: true},
+		1023: {X: -1, Z: 95, Populated: true},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("explored %d chunks, want %d", len(chunks), len(want))
+	}
+	for _, c := range chunks {
+		i := c.Z & 31 << 5 + c.X & 31
+		w, exists := want[i]
+		if !exists {
+			t.Errorf("explored chunk %d,%d, which isn't in the region", c.X, c.Z)
+			continue
+		}
+		w.Offset, w.Size = header.Locations[i].Start(), header.Locations[i].Size()
+		if c != w {
+			t.Errorf("chunk %d = %+v, want %+v", i, c, w)
+		}
+	}
+	if header.Locations[33].Length < 2 {
+		t.Errorf("chunk 33 takes %d sectors, so spanning several went untested", header.Locations[33].Length)
+	}
+}
+
+func TestPruneRegion(t *testing.T) {
+	region, data := pruneRegion(t)
+	header := readHeader(data)
+	chunks, err := ExploreRegion(region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keep, drop []ExploredChunk
+	for _, c := range chunks {
+		if c.Populated {
+			keep = append(keep, c)
+		} else {
+			drop = append(drop, c)
+		}
+	}
+	
+	if err := PruneRegion(region, keep, drop); err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := ioutil.ReadFile(region.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := readHeader(pruned)
+	
+	// Kept chunks are packed in order after the header, each byte for byte
+	// as it was.
+	sector := uint32(2)
+	for _, c := range keep {
+		i := c.Z & 31 << 5 + c.X & 31
+		location := after.Locations[i]
+		if location != (Location{sector, header.Locations[i].Length}) {
+			t.Errorf("chunk %d moved to %+v, want sector %d", i, location, sector)
+		}
+		if after.Timestamps[i] != header.Timestamps[i] {
+			t.Errorf("chunk %d timestamp = %d, want %d", i, after.Timestamps[i], header.Timestamps[i])
+		}
+		if location.Start() + location.Size() <= int64(len(pruned)) && !bytes.Equal(pruned[location.Start() : location.Start() + location.Size()], data[c.Offset : c.Offset + c.Size]) {
+			t.Errorf("chunk %d's sectors changed", i)
+		}
+		sector += uint32(location.Length)
+	}
+	if int64(len(pruned)) != int64(sector) << 12 {
+		t.Errorf("pruned file is %d bytes, want %d", len(pruned), int64(sector) << 12)
+	}
+	
+	for _, c := range drop {
+		i := c.Z & 31 << 5 + c.X & 31
+		if after.Locations[i] != (Location{}) || after.Timestamps[i] != 0 {
+			t.Errorf("dropped chunk %d left at %+v, timestamp %d", i, after.Locations[i], after.Timestamps[i])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(region.Path), "c.-12.79.mcc")); !os.IsNotExist(err) {
+		t.Errorf("dropped external chunk's .mcc file is still there: %v", err)
+	}
+	
+	explored, err := ExploreRegion(region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(explored) != len(keep) {
+		t.Errorf("pruned region holds %d chunks, want %d", len(explored), len(keep))
+	}
+	for _, c := range explored {
+		if !c.Populated || c.Err != nil {
+			t.Errorf("pruned region holds chunk %+v", c)
+		}
+	}
+}
+
+func TestPruneRegionEmpty(t *testing.T) {
+	region, _ := pruneRegion(t)
+	chunks, err := ExploreRegion(region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := PruneRegion(region, nil, chunks); err != nil {
+		t.Fatal(err)
+	}
+	
+	left, err := filepath.Glob(filepath.Join(filepath.Dir(region.Path), "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("pruning every chunk left %q", left)
+	}
+}
@@ -0,0 +1,127 @@
+package render
+
+import (
+	"image"
+	"image/draw"
+)
+
+const TILESIZE = 256
+
+// A TileWriter takes a finished image a strip at a time and writes it out as
+// tiles.
+type TileWriter interface {
+	Write(strip image.Image)
+	Close() error
+}
+
+// A TileFunc receives each tile of a pyramid as it's cut, with level 0 the
+// smallest.
+type TileFunc func(level, col, row int, tile *image.RGBA) error
+
+// A Pyramid cuts an image into tiles at full size and at each halving below
+// it. The image is written top to bottom in strips of any height, and only
+// one row of tiles is held per level, so the image itself never needs to be
+// in memory at once.
+type Pyramid struct {
+	Bounds image.Rectangle
+	
+	levels []*pyramidLevel
+	tile TileFunc
+	err error
+}
+
+// A pyramidLevel collects rows into the next row of tiles, handing it on at
+// half size to the level below once it's cut.
+type pyramidLevel struct {
+	index int
+	width, height int
+	row *image.RGBA
+	next *pyramidLevel
+}
+
+// PyramidLevels returns how many levels it takes to halve bounds down to a
+// single tile of the given size.
+func PyramidLevels(bounds image.Rectangle, size int) int {
+	levels := 1
+	for size << uint(levels - 1) < Max(bounds.Dx(), bounds.Dy()) {
+		levels++
+	}
+	return levels
+}
+
+func NewPyramid(bounds image.Rectangle, levels int, tile TileFunc) *Pyramid {
+	p := &Pyramid{Bounds: bounds, tile: tile}
+	
+	var next *pyramidLevel
+	for i := 0; i < levels; i++ {
+		shift := uint(levels - 1 - i)
+		level := &pyramidLevel{index: i, width: (bounds.Dx() + 1 << shift - 1) >> shift, height: (bounds.Dy() + 1 << shift - 1) >> shift, next: next}
+		p.levels = append(p.levels, level)
+		next = level
+	}
+	return p
+}
+
+// Write adds the next strip of the image, in the image's own coordinates.
+// Errors are kept until Close.
+func (p *Pyramid) Write(strip image.Image) {
+	if p.err != nil {
+		return
+	}
+	
+	b := strip.Bounds().Intersect(p.Bounds)
+	rgba := image.NewRGBA(b.Sub(p.Bounds.Min))
+	draw.Draw(rgba, rgba.Rect, strip, b.Min, draw.Src)
+	p.err = p.add(p.levels[len(p.levels) - 1], rgba)
+}
+
+// Close cuts any rows still held.
+func (p *Pyramid) Close() error {
+	for i := len(p.levels) - 1; i >= 0 && p.err == nil; i-- {
+		if p.levels[i].row != nil {
+			p.err = p.flush(p.levels[i])
+		}
+	}
+	return p.err
+}
+
+// add copies rows into the level's row of tiles, cutting it each time it's
+// full.
+func (p *Pyramid) add(l *pyramidLevel, rows *image.RGBA) error {
+	for y := rows.Rect.Min.Y; y < rows.Rect.Max.Y; {
+		if l.row == nil {
+			top := y - y % TILESIZE
+			l.row = image.NewRGBA(image.Rect(0, top, l.width, Min(top + TILESIZE, l.height)))
+		}
+		
+		part := l.row.Rect.Intersect(rows.Rect)
+		draw.Draw(l.row, part, rows, part.Min, draw.Src)
+		y = part.Max.Y
+		
+		if y == l.row.Rect.Max.Y {
+			if err := p.flush(l); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flush cuts the level's row into tiles and passes it on to the next level
+// down.
+func (p *Pyramid) flush(l *pyramidLevel) error {
+	row := l.row
+	l.row = nil
+	
+	for x := 0; x < row.Rect.Max.X; x += TILESIZE {
+		tile := row.SubImage(image.Rect(x, row.Rect.Min.Y, x + TILESIZE, row.Rect.Max.Y)).(*image.RGBA)
+		if err := p.tile(l.index, x / TILESIZE, row.Rect.Min.Y / TILESIZE, tile); err != nil {
+			return err
+		}
+	}
+	
+	if l.next == nil {
+		return nil
+	}
+	return p.add(l.next, Downsample(row, 2))
+}
@@ -0,0 +1,101 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"net"
+	"flag"
+	"strings"
+	"net/http"
+	"path/filepath"
+)
+
+// DescribeWorld reports the region format and dimensions found in dir.
+func DescribeWorld(dir string) (format string, dimensions []string) {
+	for _, d := range dimensionDirs {
+		anvil, _ := filepath.Glob(filepath.Join(dir, d.Path, GLOBPATTERN))
+		legacy, _ := filepath.Glob(filepath.Join(dir, d.Path, LEGACYGLOBPATTERN))
+		switch {
+		case len(anvil) != 0:
+			format = "Anvil"
+		case len(legacy) != 0:
+			if format == "" {
+				format = "MCRegion"
+			}
+		default:
+			continue
+		}
+		dimensions = append(dimensions, d.Name)
+	}
+	return
+}
+
+// Quick renders every dimension of a world in both modes with an index page
+// and serves the result locally, without any configuration.
+func Quick(args []string) error {
+	var (
+		outDir, listen string
+		noServe bool
+	)
+	
+	flags := flag.NewFlagSet("quick", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s quick [flags] [worlddir]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&outDir, "out", "", "Write images and index.html to this directory (default <worlddir>_map).")
+	flags.StringVar(&listen, "listen", "localhost:8080", "Serve the rendered map on this address.")
+	flags.BoolVar(&noServe, "no-serve", false, "Only render, don't start a web server.")
+	// Streaming keeps memory bounded however large the world turns out to be.
+	opts := Options{Labels: DefaultTextStyle, Modes: ModeList{IsometricMode{}, TopDownMode{}}}
+	opts.Progress.Flags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	
+	opts.MaxPixels = MAXPIXELS
+	opts.Stream = true
+	opts.Auto()
+	opts.Progress.Start()
+	
+	dir := DIR
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+	if outDir == "" {
+		outDir = strings.TrimRight(dir, `/\`) + "_map"
+	}
+	
+	format, found := DescribeWorld(dir)
+	if format == "" {
+		return exitError(ExitNoRegions, "Error reading world: ", fmt.Errorf("no region files found in %s", dir))
+	}
+	opts.Progress.Printf("Found %s world with %s", format, strings.Join(found, ", "))
+	
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return fatalError("Error creating output directory: ", err)
+	}
+	
+	lock, err := AcquireLock(outDir, 0)
+	if err != nil {
+		return fatalError("Error locking output directory: ", err)
+	}
+	_, err = RenderWorld(dir, filepath.Join(outDir, IMGFILE), true, &opts)
+	lock.Release()
+	if err != nil {
+		return err
+	}
+	
+	index := filepath.Join(outDir, INDEXFILE)
+	if noServe {
+		opts.Progress.Printf("Open %s in a browser", index)
+		return nil
+	}
+	
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fatalError("Error starting web server: ", err)
+	}
+	opts.Progress.Printf("Serving %s at http://%s/ (Ctrl+C to stop)", outDir, listener.Addr())
+	return fatalError("Error serving map: ", http.Serve(listener, http.FileServer(http.Dir(outDir))))
+}
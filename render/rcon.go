@@ -0,0 +1,198 @@
+package render
+
+import (
+	"io"
+	"net"
+	"time"
+	"errors"
+	"strconv"
+	"strings"
+	"encoding/binary"
+)
+
+const (
+	RCONTIMEOUT = 10 * time.Second
+	RCONINTERVAL = 5 * time.Second
+)
+
+const (
+	rconResponse = 0
+	rconCommand = 2
+	rconAuthResponse = 2
+	rconAuth = 3
+)
+
+// An RCON is a connection to a Minecraft server's remote console.
+type RCON struct {
+	conn net.Conn
+	id int32
+}
+
+// DialRCON connects to the server at addr and logs in with password.
+func DialRCON(addr, password string) (*RCON, error) {
+	conn, err := net.DialTimeout("tcp", addr, RCONTIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+	c := &RCON{conn: conn}
+	
+	id, err := c.send(rconAuth, password)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	
+	// Servers may send an empty response ahead of the auth response, which
+	// carries an id of -1 when the password is wrong.
+	for {
+		respID, kind, _, err := c.read()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if kind != rconAuthResponse {
+			continue
+		}
+		if respID != id {
+			conn.Close()
+			return nil, errors.New("rcon: wrong password")
+		}
+		return c, nil
+	}
+}
+
+func (c *RCON) send(kind int32, body string) (int32, error) {
+	c.id++
+	packet := make([]byte, 12, 14 + len(body))
+	binary.LittleEndian.PutUint32(packet[0:], uint32(10 + len(body)))
+	binary.LittleEndian.PutUint32(packet[4:], uint32(c.id))
+	binary.LittleEndian.PutUint32(packet[8:], uint32(kind))
+	packet = append(append(packet, body...), 0, 0)
+	
+	c.conn.SetDeadline(time.Now().Add(RCONTIMEOUT))
+	_, err := c.conn.Write(packet)
+	return c.id, err
+}
+
+func (c *RCON) read() (id, kind int32, body string, err error) {
+	var length int32
+	if err = binary.Read(c.conn, binary.LittleEndian, &length); err != nil {
+		return
+	}
+	if length < 10 || length > 1 << 20 {
+		err = errors.New("rcon: bad packet length")
+		return
+	}
+	
+	packet := make([]byte, length)
+	if _, err = io.ReadFull(c.conn, packet); err != nil {
+		return
+	}
+	id = int32(binary.LittleEndian.Uint32(packet[0:]))
+	kind = int32(binary.LittleEndian.Uint32(packet[4:]))
+	body = strings.TrimRight(string(packet[8:]), "\x00")
+	return
+}
+
+// Command runs cmd on the server and returns what it printed.
+func (c *RCON) Command(cmd string) (string, error) {
+	id, err := c.send(rconCommand, cmd)
+	if err != nil {
+		return "", err
+	}
+	for {
+		respID, kind, body, err := c.read()
+		if err != nil {
+			return "", err
+		}
+		if respID == id && kind == rconResponse {
+			return body, nil
+		}
+	}
+}
+
+func (c *RCON) Close() error {
+	return c.conn.Close()
+}
+
+// A LivePlayer is where an online player is right now.
+type LivePlayer struct {
+	Name string `json:"name"`
+	Dimension string `json:"dimension"`
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// Players lists who is online and where, asking for each player's position
+// with the data command.
+func (c *RCON) Players() ([]LivePlayer, error) {
+	list, err := c.Command("list")
+	if err != nil {
+		return nil, err
+	}
+	
+	// "There are 2 of a max of 20 players online: Alice, Bob"
+	i := strings.Index(list, ":")
+	if i < 0 {
+		return nil, nil
+	}
+	
+	var players []LivePlayer
+	for _, name := range strings.Split(list[i + 1:], ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		
+		p := LivePlayer{Name: name}
+		pos, err := c.Command("data get entity " + name + " Pos")
+		if err != nil {
+			return nil, err
+		}
+		if !parseRCONPos(pos, &p) {
+			continue
+		}
+		
+		dimension, err := c.Command("data get entity " + name + " Dimension")
+		if err != nil {
+			return nil, err
+		}
+		p.Dimension = parseRCONDimension(dimension)
+		players = append(players, p)
+	}
+	return players, nil
+}
+
+// parseRCONPos reads "Alice has the following entity data: [1.5d, 64.0d,
+// -3.2d]". Players who logged off in between have no data.
+func parseRCONPos(s string, p *LivePlayer) bool {
+	start, end := strings.Index(s, "["), strings.LastIndex(s, "]")
+	if start < 0 || end < start {
+		return false
+	}
+	
+	fields := strings.Split(s[start + 1:end], ",")
+	if len(fields) != 3 {
+		return false
+	}
+	var coords [3]float64
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(strings.TrimRight(strings.TrimSpace(field), "d"), 64)
+		if err != nil {
+			return false
+		}
+		coords[i] = v
+	}
+	p.X, p.Y, p.Z = coords[0], coords[1], coords[2]
+	return true
+}
+
+// parseRCONDimension returns the key of the dimension in "Alice has the
+// following entity data: "minecraft:overworld"", or the old numeric id.
+func parseRCONDimension(s string) string {
+	if i := strings.LastIndex(s, ": "); i >= 0 {
+		s = s[i + 2:]
+	}
+	key, _ := ParseDimension(strings.Trim(strings.TrimSpace(s), `"`))
+	return key
+}
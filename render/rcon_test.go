@@ -0,0 +1,134 @@
+package render
+
+import (
+	"io"
+	"net"
+	"testing"
+	"encoding/binary"
+)
+
+func writeRCON(w io.Writer, id, kind int32, body string) error {
+	packet := make([]byte, 12, 14 + len(body))
+	binary.LittleEndian.PutUint32(packet[0:], uint32(10 + len(body)))
+	binary.LittleEndian.PutUint32(packet[4:], uint32(id))
+	binary.LittleEndian.PutUint32(packet[8:], uint32(kind))
+	_, err := w.Write(append(append(packet, body...), 0, 0))
+	return err
+}
+
+// fakeRCON serves one connection as a Minecraft server's remote console
+// does, answering commands from responses. It checks each packet it's sent
+// and, like real servers, sends a stray empty packet before answering a
+// login and unrelated output before answering a command.
+func fakeRCON(t *testing.T, password string, responses map[string]string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		
+		for {
+			var length int32
+			if err := binary.Read(conn, binary.LittleEndian, &length); err != nil {
+				return
+			}
+			packet := make([]byte, length)
+			if _, err := io.ReadFull(conn, packet); err != nil {
+				t.Errorf("reading packet: %s", err)
+				return
+			}
+			if length < 10 || packet[length - 2] != 0 || packet[length - 1] != 0 {
+				t.Errorf("packet % x isn't terminated by two nulls", packet)
+				return
+			}
+			
+			id, kind := int32(binary.LittleEndian.Uint32(packet)), int32(binary.LittleEndian.Uint32(packet[4:]))
+			body := string(packet[8 : length - 2])
+			switch kind {
+			case rconAuth:
+				writeRCON(conn, id, rconResponse, "")
+				if body != password {
+					id = -1
+				}
+				writeRCON(conn, id, rconAuthResponse, "")
+			case rconCommand:
+				response, exists := responses[body]
+				if !exists {
+					t.Errorf("unexpected command %q", body)
+				}
+				writeRCON(conn, id + 100, rconResponse, "Saved the game")
+				writeRCON(conn, id, rconResponse, response)
+			default:
+				t.Errorf("packet of unknown type %d", kind)
+				return
+			}
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestRCONPlayers(t *testing.T) {
+	addr := fakeRCON(t, "secret", map[string]string{
+		"list": "There are 3 of a max of 20 players online: Alice, Gone, Bob_2",
+		"data get entity Alice Pos": "Alice has the following entity data: [1.5d, 64.0d, -3.25d]",
+		"data get entity Alice Dimension": `Alice has the following entity data: "minecraft:overworld"`,
+		"data get entity Gone Pos": "No entity was found",
+		"data get entity Bob_2 Pos": "Bob_2 has the following entity data: [-100.0d, 12.0d, 200.5d]",
+		"data get entity Bob_2 Dimension": `Bob_2 has the following entity data: "minecraft:the_nether"`,
+	})
+	
+	c, err := DialRCON(addr, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	
+	players, err := c.Players()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LivePlayer{
+		{"Alice", "minecraft:overworld", 1.5, 64, -3.25},
+		{"Bob_2", "minecraft:the_nether", -100, 12, 200.5},
+	}
+	if len(players) != len(want) {
+		t.Fatalf("got %d players, want %d: %+v", len(players), len(want), players)
+	}
+	for i := range want {
+		if players[i] != want[i] {
+			t.Errorf("player %d = %+v, want %+v", i, players[i], want[i])
+		}
+	}
+	
+	if out, err := c.Command("list"); err != nil || out != "There are 3 of a max of 20 players online: Alice, Gone, Bob_2" {
+		t.Errorf("Command(list) = %q, %v", out, err)
+	}
+}
+
+func TestRCONWrongPassword(t *testing.T) {
+	addr := fakeRCON(t, "secret", nil)
+	if c, err := DialRCON(addr, "guess"); err == nil {
+		c.Close()
+		t.Error("logged in with the wrong password")
+	}
+}
+
+func TestRCONNobodyOnline(t *testing.T) {
+	addr := fakeRCON(t, "", map[string]string{"list": "There are 0 of a max of 20 players online: "})
+	c, err := DialRCON(addr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	
+	if players, err := c.Players(); err != nil || len(players) != 0 {
+		t.Errorf("got %+v, %v", players, err)
+	}
+}
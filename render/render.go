@@ -0,0 +1,1310 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"log"
+	"flag"
+	"math"
+	"time"
+	"bytes"
+	"image"
+	"runtime"
+	"runtime/debug"
+	"image/color"
+	"encoding/gob"
+	"io/ioutil"
+	"compress/gzip"
+	"compress/zlib"
+	"path/filepath"
+	"encoding/binary"
+	_ "embed"
+	"github.com/bemasher/GoNBT"
+)
+
+// Version is stamped into rendered images; release builds set it with
+// -ldflags "-X github.com/imclab/GoCart/render.Version=...".
+var Version = "dev"
+
+// blockColorsGob is the block palette blocks.go generates, built in so gocart
+// finds it wherever it's run from.
+//go:embed blocks.gob
+var blockColorsGob []byte
+
+const (
+	DIR = `world`
+	GLOBPATTERN = "region/*.mca"
+	IMGFILE = "map.png"
+	TILESFILE = "map.mbtiles"
+	
+	DIM = 1024
+	NCPUS = 4
+	
+	// How long -nice sleeps after each chunk read unless -pace says otherwise.
+	NICEPACE = 2 * time.Millisecond
+)
+
+const (
+	CompressionGzip = 1
+	CompressionZlib = 2
+	CompressionNone = 3
+	
+	// Set on chunks too large for the region file, which are stored in a
+	// c.X.Z.mcc file beside it.
+	CompressionExternal = 0x80
+)
+
+var (
+	big binary.ByteOrder = binary.BigEndian
+	blockColors map[byte]BlockColor
+)
+
+type Positioner interface {
+	GetPos() (int, int)
+}
+
+type PositionList []Positioner
+
+func (pl PositionList) Len() int {
+	return len(pl)
+}
+
+func (pl PositionList) Less(i, j int) bool {
+	xi, zi := pl[i].GetPos()
+	xj, zj := pl[j].GetPos()
+	if zi == zj {
+		return xj < xi
+	}
+	return zi < zj
+}
+
+func (pl PositionList) Swap(i, j int) {
+	pl[i], pl[j] = pl[j], pl[i]
+}
+
+type Region struct {
+	X, Z int
+	Path string
+	Dimension int
+	Legacy bool
+	
+	// Snapshot is the copy of the file taken by -snapshot, if any.
+	Snapshot string
+}
+
+func NewRegion(file string) Region {
+	var r Region
+	r.Path = file
+	r.Legacy = filepath.Ext(file) == ".mcr"
+	fmt.Sscanf(filepath.Base(file), "r.%d.%d.", &r.X, &r.Z)
+	return r
+}
+
+func (r Region) GetPos() (int, int) {
+	return int(r.X), int(r.Z)
+}
+
+
+type Header struct {
+	Locations [DIM]Location
+	Timestamps [DIM]int32
+}
+
+func (h *Header) Read(r io.Reader) {
+	for i := 0; i < DIM; i++ {
+		h.Locations[i].Read(r)
+	}
+	
+	for i := 0; i < DIM; i++ {
+		binary.Read(r, big, &h.Timestamps[i])
+	}
+}
+
+func (h *Header) Write(w io.Writer) error {
+	for i := 0; i < DIM; i++ {
+		if err := binary.Write(w, big, h.Locations[i].Offset << 8 | uint32(h.Locations[i].Length)); err != nil {
+			return err
+		}
+	}
+	return binary.Write(w, big, h.Timestamps)
+}
+
+type Location struct {
+	Offset uint32
+	Length byte
+}
+
+func (rl *Location) Read(r io.Reader) {
+	binary.Read(r, big, &rl.Offset)
+	rl.Length = uint8(rl.Offset & 0x000000FF)
+	rl.Offset >>= 8
+}
+
+func (rl Location) Start() int64 {
+	return int64(rl.Offset) << 12
+}
+
+func (rl Location) Size() int64 {
+	return int64(rl.Length) << 12
+}
+
+// Offsets pointing back into the header or past the end of the file are
+// corrupt and must not be followed.
+func (rl Location) Valid(fileSize int64) bool {
+	return rl.Length != 0 && rl.Offset >= 2 && rl.Start() + rl.Size() <= fileSize
+}
+
+type Level struct {
+	X int32 `nbt:"xPos"`
+	Z int32 `nbt:"zPos"`
+	LastUpdate int64
+	TerrainPopulated byte
+	InhabitedTime int64
+	HeightMap []int32
+	Biomes []byte
+	Sections []Section
+	Entities []Entity
+	
+	// Modified comes from the region header rather than the chunk's NBT.
+	Modified int64 `nbt:"-"`
+}
+
+type Section struct {
+	Y byte
+	Data []byte
+	Blocks []byte
+	BlockLight []byte
+}
+
+func (s Section) String() string {
+	return fmt.Sprintf("{Y: %d Data: %d... Blocks: %d...}", s.Y, s.Data[:Min(6, len(s.Data))], s.Blocks[:Min(6, len(s.Blocks))])
+}
+
+func (s Section) Valid() bool {
+	return s.Y < 16 && len(s.Blocks) == 4096
+}
+
+func (s Section) Block(x, y, z int) byte {
+	return s.Blocks[(y * 16 + z) * 16 + x]
+}
+
+// BlockData returns the 4-bit data value stored beside a block, or 0 when
+// the section has none.
+func (s Section) BlockData(x, y, z int) byte {
+	i := (y * 16 + z) * 16 + x
+	if len(s.Data) != 2048 {
+		return 0
+	}
+	if i & 1 == 0 {
+		return s.Data[i >> 1] & 0x0F
+	}
+	return s.Data[i >> 1] >> 4
+}
+
+// Light returns the light level torches and the like give the block, or 0
+// when the section has none.
+func (s Section) Light(x, y, z int) byte {
+	i := (y * 16 + z) * 16 + x
+	if len(s.BlockLight) != 2048 {
+		return 0
+	}
+	if i & 1 == 0 {
+		return s.BlockLight[i >> 1] & 0x0F
+	}
+	return s.BlockLight[i >> 1] >> 4
+}
+
+func (l Level) String() string {
+	return fmt.Sprintf("{X: %d Z: %d LastUpdate: %d TerrainPopulated: %d HeightMap: %d...}",
+		l.X, l.Z,
+		l.LastUpdate,
+		l.TerrainPopulated,
+		l.HeightMap[:Min(6, len(l.HeightMap))],
+		// l.Sections[:Min(6, len(l.Sections))],
+	)
+}
+
+func (l Level) GetPos() (int, int) {
+	return int(l.X), int(l.Z)
+}
+
+// SectionTable indexes the valid sections by their Y.
+func (l *Level) SectionTable() (sections [16]*Section) {
+	for i := range l.Sections {
+		if l.Sections[i].Valid() {
+			sections[l.Sections[i].Y] = &l.Sections[i]
+		}
+	}
+	return
+}
+
+// BlockAt looks up a block by chunk-local x and z and world height y, treating
+// missing sections and heights outside the world as air.
+func BlockAt(sections [16]*Section, x, y, z int) byte {
+	if y < 0 || y > 255 || sections[y >> 4] == nil {
+		return 0
+	}
+	return sections[y >> 4].Block(x, y & 15, z)
+}
+
+type RawChunk struct {
+	Region int
+	X, Z int
+	Offset int64
+	Timestamp int32
+	Legacy bool
+	Compression byte
+	Data []byte
+	Err error
+	
+	// Cached is the chunk as already decoded by the -chunk-cache, if it was.
+	Cached *Level
+}
+
+func (rc *RawChunk) Read(r io.Reader) error {
+	var length int32
+	
+	if err := binary.Read(r, big, &length); err != nil {
+		return err
+	}
+	if err := binary.Read(r, big, &rc.Compression); err != nil {
+		return err
+	}
+	
+	if rc.External() {
+		return nil
+	}
+	
+	if length <= 1 || length > MAXCHUNKSIZE {
+		return fmt.Errorf("invalid chunk length: %d", length)
+	}
+	
+	rc.Data = make([]byte, length - 1)
+	_, err := io.ReadFull(r, rc.Data)
+	return err
+}
+
+func (rc RawChunk) External() bool {
+	return rc.Compression & CompressionExternal != 0
+}
+
+func (rc *RawChunk) ReadExternal(dir string) error {
+	mccFile, err := os.Open(filepath.Join(dir, fmt.Sprintf("c.%d.%d.mcc", rc.X, rc.Z)))
+	if err != nil {
+		return err
+	}
+	defer mccFile.Close()
+	
+	rc.Data, err = ioutil.ReadAll(io.LimitReader(mccFile, MAXCHUNKSIZE + 1))
+	if err != nil {
+		return err
+	}
+	
+	if len(rc.Data) > MAXCHUNKSIZE {
+		return fmt.Errorf("external chunk exceeds %d bytes", MAXCHUNKSIZE)
+	}
+	
+	rc.Compression &^= CompressionExternal
+	return nil
+}
+
+func (rc RawChunk) Decompress() ([]byte, error) {
+	var (
+		rawLevelData io.ReadCloser
+		err error
+	)
+	
+	switch rc.Compression {
+	case CompressionGzip:
+		rawLevelData, err = gzip.NewReader(bytes.NewReader(rc.Data))
+	case CompressionZlib:
+		rawLevelData, err = zlib.NewReader(bytes.NewReader(rc.Data))
+	case CompressionNone:
+		rawLevelData = ioutil.NopCloser(bytes.NewReader(rc.Data))
+	default:
+		err = fmt.Errorf("unknown compression type: %d", rc.Compression)
+	}
+	
+	if err != nil {
+		return nil, err
+	}
+	defer rawLevelData.Close()
+	
+	levelData := bytes.NewBuffer(nil)
+	if _, err := levelData.ReadFrom(io.LimitReader(rawLevelData, MAXCHUNKSIZE + 1)); err != nil {
+		return nil, err
+	}
+	
+	if levelData.Len() > MAXCHUNKSIZE {
+		return nil, fmt.Errorf("decompressed chunk exceeds %d bytes", MAXCHUNKSIZE)
+	}
+	
+	return levelData.Bytes(), nil
+}
+
+func (l *Level) Decode(data []byte) (err error) {
+	if err = ValidateNBT(data); err != nil {
+		return
+	}
+	
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("nbt: %v", r)
+		}
+	}()
+	
+	nbt.Read(bytes.NewReader(data), l)
+	if l.TerrainPopulated == 0 && Flattened(data) {
+		err = ErrFlattened
+	}
+	return
+}
+
+func (l *Level) Read(r io.Reader) error {
+	var chunk RawChunk
+	if err := chunk.Read(r); err != nil {
+		return err
+	}
+	
+	levelData, err := chunk.Decompress()
+	if err != nil {
+		return err
+	}
+	
+	return l.Decode(levelData)
+}
+
+// Top returns the height just above the chunk's highest section.
+func (l *Level) Top() int {
+	y := 0
+	for _, section := range l.Sections {
+		if section.Valid() && y < int(section.Y) << 4 {
+			y = int(section.Y) << 4
+		}
+	}
+	return y + 16
+}
+
+func Min(a ...int) (min int) {
+	min = math.MaxInt32
+	for _, i := range a {
+		if i < min {
+			min = i
+		}
+	}
+	return
+}
+
+type BlockColor struct {
+	Alpha byte
+	Full bool
+	Top, Left, Right color.RGBA
+}
+
+// DrawBlock draws a single block. Drawing many goes faster through Sprites.
+func DrawBlock(img *image.RGBA, x, y int, c BlockColor) {
+	NewSprite(c).Draw(img, x, y)
+}
+
+// EachBlock calls fn with the world coordinates of every block in the chunk,
+// back to front in isometric drawing order. Sections are visited bottom up
+// whatever order the chunk stores them in.
+//
+// Every block is drawn after any block it could hide, those being no higher,
+// no further east and no further south, which is what lets chunks sorted by
+// PositionList and regions sorted the same way be painted one after another
+// without ever drawing in front of something nearer.
+func (l Level) EachBlock(fn func(x, y, z int, block byte)) {
+	for _, section := range l.SectionTable() {
+		if section == nil {
+			continue
+		}
+		
+		for y := 0; y < 16; y++ {
+			for x := 15; x >= 0; x-- {
+				for z := 0; z < 16; z++ {
+					fn(int(l.X) << 4 + x, int(section.Y) << 4 + y, int(l.Z) << 4 + z, section.Block(x, y, z))
+				}
+			}
+		}
+	}
+}
+
+func (l Level) Draw(img *image.RGBA, m IsometricMode, n Neighborhood, opts *Options) {
+	p := m.projection()
+	fade := opts.Fade.Amount(l)
+	faded := make(map[byte]BlockColor)
+	sprites := make(Sprites)
+	sections := l.SectionTable()
+	scale := Supersample(IsometricMode{}, opts)
+	exact := scale == 1 && p == DefaultProjection
+	hidden := opts.Filter.Hidden()
+	shaders := opts.BlockShaders()
+	
+	colorAt := func(x, y, z int, block byte) (BlockColor, bool) {
+		if !opts.Area.Contains(x, z) || hidden[block] || !m.Band.Contains(y) || y >= opts.Underground.Top(l, x & 15, z & 15) {
+			return BlockColor{}, false
+		}
+		
+		blockColor, exists := blockColors[block]
+		if !exists {
+			return blockColor, false
+		}
+		if !opts.FlatWater && IsWater(block) && !IsWater(BlockAt(sections, x & 15, y + 1, z & 15)) {
+			blockColor = WaterColor(blockColor, WaterDepth(sections, x & 15, y, z & 15))
+			if fade > 0 {
+				blockColor = opts.Fade.Block(blockColor, fade)
+			}
+		} else if fade > 0 {
+			if _, cached := faded[block]; !cached {
+				faded[block] = opts.Fade.Block(blockColor, fade)
+			}
+			blockColor = faded[block]
+		}
+		
+		blockColor = Jitter(blockColor, block, opts.Jitter, opts.Seed, x, y, z)
+		if opts.Shadows && !n.Opaque(x, y + 1, z) && opts.Sun.Shadowed(n, x, y, z) {
+			blockColor = ShadowBlock(blockColor)
+		}
+		if len(shaders) != 0 {
+			blockColor = Shade(shaders, BlockContext{&l, sections, block, x, y, z, n}, blockColor)
+		}
+		if m.XRay {
+			blockColor = XRay(blockColor, block)
+		}
+		return blockColor, true
+	}
+	
+	// Translucent cubes stacked in a column are drawn as one body, so the
+	// faces between them don't each hide more of what's behind: the top of
+	// the stack shows them all composited, and those below only their sides.
+	// X-ray is left as it is, every block in it being see-through.
+	stacks := !m.XRay && !m.Textured
+	stacked := func(x, y, z int) (BlockColor, bool) {
+		if y < 0 || y > 255 || sections[y >> 4] == nil {
+			return BlockColor{}, false
+		}
+		block := sections[y >> 4].Block(x & 15, y & 15, z & 15)
+		if _, exists := ShapeOf(block, int(sections[y >> 4].BlockData(x & 15, y & 15, z & 15))); exists {
+			return BlockColor{}, false
+		}
+		c, ok := colorAt(x, y, z, block)
+		return c, ok && c.Alpha != 0xFF
+	}
+	
+	// A block is buried when the cubes above it, at -x and at +z, which are
+	// drawn after it and between them cover every pixel it would, are all
+	// drawn opaque. Only neighbors in this chunk count, as other chunks may
+	// be drawn first, and not under x-ray or shaders that may see through
+	// what the palette calls opaque.
+	cull := !m.XRay && opts.Script == nil && len(opts.Shaders) == 0
+	var solid [256]bool
+	var limits [256]int
+	bottom, top := m.Band.Limits()
+	if cull {
+		for block, c := range blockColors {
+			texture := blockTextures[block]
+			solid[block] = c.Alpha == 0xFF && c.Full && !hidden[block] && (!m.Textured || texture == nil || texture.Top.Opaque() && texture.Side.Opaque())
+		}
+		for _, shapes := range []map[BlockState]Shape{blockShapes, defaultShapes} {
+			for state := range shapes {
+				solid[state.ID] = false
+			}
+		}
+		for i := range limits {
+			x, z := int(l.X) << 4 + i & 15, int(l.Z) << 4 + i >> 4
+			if opts.Area.Contains(x, z) {
+				limits[i] = Min(top, opts.Underground.Top(l, i & 15, i >> 4))
+			}
+		}
+	}
+	covers := func(x, y, z int) bool {
+		if y >= limits[z << 4 + x] || y < bottom || sections[y >> 4] == nil {
+			return false
+		}
+		return solid[sections[y >> 4].Block(x, y & 15, z)]
+	}
+	buried := func(x, y, z int) bool {
+		x, z = x & 15, z & 15
+		return cull && x != 0 && z != 15 && covers(x, y + 1, z) && covers(x - 1, y, z) && covers(x, y, z + 1)
+	}
+	
+	// Surface mode only goes as deep as a column or the neighbors in front,
+	// where they're known, leave its sides showing.
+	var floors [256]int
+	if m.Surface && len(l.HeightMap) == 256 {
+		for i := range floors {
+			x, z := int(l.X) << 4 + i & 15, int(l.Z) << 4 + i >> 4
+			floor := int(l.HeightMap[i])
+			if height, known := n.Height(x - 1, z); known {
+				floor = Min(floor, height)
+			}
+			if height, known := n.Height(x, z + 1); known {
+				floor = Min(floor, height)
+			}
+			floors[i] = floor - SURFACEDEPTH
+		}
+	}
+	
+	l.EachBlock(func(x, y, z int, block byte) {
+		if y < floors[(z & 15) << 4 + x & 15] || buried(x, y, z) {
+			return
+		}
+		blockColor, ok := colorAt(x, y, z, block)
+		if !ok {
+			return
+		}
+		base := blockColors[block]
+		
+		xISO, yISO := p.Project(x, y, z)
+		if shape, exists := ShapeOf(block, int(sections[y >> 4].BlockData(x & 15, y & 15, z & 15))); exists {
+			DrawShape(img, xISO, yISO, scale, p, blockColor, shape)
+		} else if texture := blockTextures[block]; m.Textured && texture != nil {
+			DrawTextured(img, xISO, yISO, scale, p, blockColor, base, texture)
+		} else if stacks && blockColor.Alpha != 0xFF {
+			top := blockColor
+			if _, covered := stacked(x, y + 1, z); covered {
+				top.Alpha = 0
+			} else {
+				layers := []BlockColor{blockColor}
+				for below := y - 1; ; below-- {
+					c, ok := stacked(x, below, z)
+					if !ok {
+						break
+					}
+					// Depth-shaded water's surface stands for all of it.
+					if !opts.FlatWater && IsWater(BlockAt(sections, x & 15, below, z & 15)) && IsWater(BlockAt(sections, x & 15, below + 1, z & 15)) {
+						continue
+					}
+					layers = append(layers, c)
+				}
+				top.Top, top.Alpha = Composite(layers)
+			}
+			
+			if exact {
+				sprites.DrawFaces(img, xISO, yISO, blockColor, false, true)
+				if top.Alpha != 0 {
+					sprites.DrawFaces(img, xISO, yISO, top, true, false)
+				}
+			} else {
+				DrawFacesScaled(img, xISO, yISO, scale, p, blockColor, false, true)
+				if top.Alpha != 0 {
+					DrawFacesScaled(img, xISO, yISO, scale, p, top, true, false)
+				}
+			}
+		} else if exact {
+			sprites.Draw(img, xISO, yISO, blockColor)
+		} else {
+			DrawBlockScaled(img, xISO, yISO, scale, p, blockColor)
+		}
+		
+		if opts.Occlusion && blockColor.Alpha == 0xFF && !n.Opaque(x, y + 1, z) {
+			left, right := n.Occlusion(x, y, z)
+			if exact {
+				ShadeTop(img, xISO, yISO, blockColor, left, right)
+			} else {
+				ShadeTopScaled(img, xISO, yISO, scale, p, blockColor, left, right)
+			}
+		}
+	})
+}
+
+type Job struct {
+	Filename string
+	Index int
+	ChunkCount int
+	Chunks PositionList
+	Errors []ChunkError
+	
+	// Unpopulated counts the region's chunks whose terrain hasn't been
+	// populated, whether or not they're among Chunks.
+	Unpopulated int
+}
+
+func Alloc() uint64 {
+	m := new(runtime.MemStats)
+	runtime.ReadMemStats(m)
+	return m.Alloc
+}
+
+// LoadBlockColors decodes the built-in block palette, unless it has been
+// already.
+func LoadBlockColors() error {
+	if blockColors != nil {
+		return nil
+	}
+	
+	blockDecoder := gob.NewDecoder(bytes.NewReader(blockColorsGob))
+	return exitError(ExitPalette, "Error reading block color file: ", blockDecoder.Decode(&blockColors))
+}
+
+// RenderSettings holds what the render flags set, so each -profile can be
+// parsed into its own.
+type RenderSettings struct {
+	Dir, Out, EntityTypes, PaletteFilename, ConfigFilename, Profile, CacheDir, ChunkCacheDir, ResourcePack, BiomePalette, Script, Dimension string
+	AllDimensions, PaletteReport, DryRun, NoLock, Resume, PerPlayer bool
+	
+	// Tiles is set by the tiles command, which writes tiles whatever -out.
+	Tiles bool
+	LockWait time.Duration
+	DeltaE float64
+	Radius, Slices, UploadParallel int
+	Center BlockPoint
+	Projection Projection
+	Opts Options
+}
+
+// NewRenderSettings defines the render flags on flags.
+func NewRenderSettings(flags *flag.FlagSet) *RenderSettings {
+	s := &RenderSettings{Projection: DefaultProjection, Opts: Options{Labels: DefaultTextStyle, Sun: DefaultSun, Theme: ThemeDefault, Elevation: DefaultElevation, Modes: ModeList{IsometricMode{}}}}
+	opts := &s.Opts
+	flags.StringVar(&s.ConfigFilename, "config", "", "Read settings from this TOML file, keyed by flag name (e.g. modes = [\"iso\", \"topdown\"], or scale under [label] for -label-scale). Flags given on the command line override it.")
+	flags.StringVar(&s.Profile, "profile", "", "Render this [profile.name] table of -config over its top-level settings, or all to render every profile, sharing passes over the world where profiles differ only in -out, -modes, -projection and -slices.")
+	flags.StringVar(&s.Dir, "dir", DIR, "Read region files from the world at this directory.")
+	flags.StringVar(&s.Out, "out", IMGFILE, "Write the rendered image to this file, or its tiles to an MBTiles database if it ends in .mbtiles. An s3://bucket/path or gs://bucket/path uploads everything written there instead, the default image name used when the path ends in /.")
+	flags.IntVar(&s.UploadParallel, "upload-parallel", UPLOADPARALLEL, "Upload this many files or parts of large files at once when -out is in a bucket.")
+	flags.BoolVar(&s.AllDimensions, "all-dimensions", false, "Render the overworld, nether and end, and any datapack dimensions, to separate images named after -out. Dimensions saved by Minecraft 1.13 or later, as datapack dimensions always are, can't be drawn yet and stop the render.")
+	flags.StringVar(&s.Dimension, "dimension", "", "Render only this dimension of the world, by namespace:name (e.g. minecraft:the_nether or one of a datapack's) or as overworld, nether or end.")
+	flags.Var(&opts.Modes, "modes", "Render these comma-separated modes (iso, xray, textured, surface, topdown, biomes, inhabited, age, elevation), each to its own image named after -out.")
+	flags.StringVar(&opts.Objective, "objective", "", "Label players with their score for this scoreboard objective.")
+	flags.StringVar(&opts.Positions, "positions", "", "Place -objective labels using name,x,z rows from this file instead of player homes.")
+	flags.BoolVar(&opts.PlayerHeads, "player-heads", false, "Draw -objective players as their skins' heads, fetched from Mojang, instead of dots.")
+	flags.StringVar(&opts.SkinCache, "skin-cache", "", "Keep -player-heads in this directory, fetching each again after a day (default gocart/skins in the user cache directory).")
+	flags.DurationVar(&opts.SkinTimeout, "skin-timeout", DefaultSkinTimeout, "Give up on fetching a player's head after this long, drawing a dot instead.")
+	flags.StringVar(&opts.MarkerFile, "markers", "", "Draw points, lines and polygons from this GeoJSON file of [x, z] world coordinates, labelled by each feature's label or name property and placed in the dimension of its dimension property, a vanilla id or a namespace:name.")
+	flags.StringVar(&opts.RouteFile, "routes", "", "Draw routes through the ordered name,x,z waypoint rows of this file, each begun by a route,name[,#rrggbb[,dimension]] row.")
+	flags.BoolVar(&opts.DZI, "dzi", false, "Also cut each image into a Deep Zoom tile pyramid, written to a .dzi descriptor and _files directory beside it, for browsing huge maps with OpenSeadragon.")
+	flags.IntVar(&opts.MarkerZooms, "marker-zooms", 0, "Also write markers clustered for this many zoom levels below full size to a .markers.json file beside each image.")
+	flags.Var(&opts.Background, "background", "Fill the image around and behind the world with this #rrggbb color, or leave it transparent.")
+	flags.BoolVar(&opts.Trim, "trim", false, "Crop each image to the pixels drawn over -background rather than to whole chunks, which leave margins where their tall sections are empty.")
+	flags.IntVar(&opts.TrimPadding, "trim-padding", 0, "Leave this many pixels of -background around what -trim keeps.")
+	flags.DurationVar(&opts.Fade.Duration, "fade", 0, "Fade chunks toward -fade-style by how long ago they were saved, fully at this age (e.g. 2160h).")
+	flags.DurationVar(&opts.InhabitedMax, "inhabited-max", DefaultInhabitedMax, "Draw chunks players have spent this long near hottest in inhabited mode.")
+	flags.DurationVar(&opts.AgeMax, "age-max", DefaultAgeMax, "Draw chunks last updated this much game time ago or longer coldest in age mode.")
+	flags.BoolVar(&opts.Unpopulated, "unpopulated", false, "Draw chunks whose terrain hasn't been populated yet, rather than leaving holes at the edge of the explored world.")
+	flags.Var(&opts.UnpopulatedTint, "unpopulated-tint", "Draw unpopulated chunks tinted toward this #rrggbb color (implies -unpopulated).")
+	flags.BoolVar(&opts.Portals, "portals", false, "Mark nether portals, with those of the other dimension where they'd come out, and join each pair that link (reads the nether too).")
+	flags.Float64Var(&opts.NetherOverlay, "nether-overlay", 0, "Draw the nether over the overworld in top-down modes, scaled 8x, at this opacity from 0 to 1, and the overworld over the nether (reads the other dimension).")
+	flags.Var(&opts.POIs, "pois", "Mark these comma-separated kinds of points of interest from 1.14+ poi files: beds, jobs, bells, lodestones or all.")
+	flags.Var(&opts.Theme, "theme", "Restyle the palette: default, high-contrast, colorblind (for red-green color blindness) or parchment, an antique map in sepia with inked shores.")
+	flags.Var(&opts.Elevation, "elevation-gradient", "Color elevation mode's land by height through these comma-separated y:#rrggbb stops, blending between them.")
+	flags.Var(&opts.Fade.Style, "fade-style", "Color chunks fade toward with -fade: sepia or gray.")
+	flags.BoolVar(&opts.FlatWater, "flat-water", false, "Draw water as a flat translucent layer instead of shading it by depth.")
+	flags.BoolVar(&opts.Occlusion, "occlusion", false, "Darken the corners of blocks beside taller neighbors, like ambient occlusion.")
+	flags.BoolVar(&opts.Night, "night", false, "Draw the world at night, lit only by the moon and its own light sources.")
+	flags.BoolVar(&opts.SpawnLight, "spawn-light", false, "Mark the tops of blocks hostile mobs could spawn on at night in red where unlit and yellow where lit too dimly.")
+	flags.BoolVar(&opts.Shadows, "shadows", false, "Darken terrain shaded from the sun by taller terrain, using the chunks' height maps.")
+	flags.Var(&opts.Sun, "sun", "Cast -shadows from this azimuth,elevation in degrees, the azimuth clockwise from north.")
+	flags.IntVar(&opts.Labels.Scale, "label-scale", opts.Labels.Scale, "Draw label text this many times larger than the built-in 5x7 font.")
+	flags.IntVar(&opts.Labels.Halo, "label-halo", opts.Labels.Halo, "Outline label text with a halo this many pixels wide (0 for none).")
+	flags.StringVar(&opts.Title, "title", "", "Draw this title in the top left corner of each image.")
+	flags.BoolVar(&opts.Axes.Ticks, "axes", false, "Label the edges of top-down images with X and Z world coordinates.")
+	flags.BoolVar(&opts.Axes.ScaleBar, "scale-bar", false, "Draw a scale bar along the X axis in the bottom left corner of each image.")
+	flags.BoolVar(&opts.Axes.NorthArrow, "north-arrow", false, "Draw an arrow pointing north (toward negative Z) in the top right corner of each image.")
+	flags.Var(&opts.Filter.Hide, "hide", "Leave out blocks of these comma-separated names or IDs (e.g. leaves,glass).")
+	flags.Var(&opts.Filter.Only, "only", "Draw only blocks of these comma-separated names or IDs.")
+	flags.BoolVar(&opts.Underground.Enabled, "underground", false, "Clip away everything above -underground-depth below the surface, leaving mines, tunnels and caves.")
+	flags.IntVar(&opts.Underground.Depth, "underground-depth", UNDERGROUNDDEPTH, "Clip -underground renders this many blocks below the surface.")
+	flags.IntVar(&s.Slices, "slices", 0, "Split each mode into one image per band of this many heights (e.g. 16 for one per section), drawn in the same pass.")
+	flags.Var(&opts.Find, "find", "Mark blocks of these comma-separated names or IDs (e.g. mob_spawner,diamond_ore).")
+	flags.StringVar(&s.EntityTypes, "entities", "", "Draw entities of these comma-separated types (e.g. Villager,magma_cube or all, by either ID) as colored dots.")
+	opts.Progress.Flags(flags)
+	flags.Var(&opts.Area, "area", "Only render blocks within x0,z0,x1,z1 (world coordinates), or the area a WorldEdit .schematic was copied from or an MCEdit or Amulet .mcselection covers, and crop the image to them.")
+	flags.Var(&s.Center, "center", "Center -radius on this x,z (world coordinates).")
+	flags.BoolVar(&s.PerPlayer, "per-player", false, "Render a map of the area within -radius (default " + fmt.Sprint(PLAYERRADIUS) + ") of each player's last position instead, in their dimension, named after -out and their name or UUID.")
+	flags.IntVar(&s.Radius, "radius", 0, "Only render blocks within this many blocks of -center, skipping regions and chunks entirely outside it (0 for no limit).")
+	flags.Int64Var(&opts.MaxPixels, "maxpixels", MAXPIXELS, "Refuse to render images with more than this many pixels (0 for no limit).")
+	flags.Var(&opts.MaxMemory, "max-memory", "Keep the image buffers within this much memory (e.g. 4G), falling back as -memory-fallback says when whole images wouldn't fit (0 for no limit).")
+	flags.Var(&opts.Fallback, "memory-fallback", "Over -max-memory, composite a strip at a time as -stream does, refusing only if even that won't fit (stream), or refuse to render (refuse).")
+	flags.Var(MiBSize{&opts.Limits}, "maxmemory", "Deprecated: the same as -max-memory with plain numbers in MiB and -memory-fallback refuse.")
+	flags.Var(&s.Projection, "projection", "Draw isometric blocks width,top,side pixels in size: e.g. 4,2,3 looks more steeply down than the default 4,1,2.")
+	flags.IntVar(&opts.Jitter, "jitter", 0, "Vary the brightness of grass and leaves from block to block by up to this much, seeded from the world seed so every render matches.")
+	flags.IntVar(&opts.Supersample, "supersample", 1, "Draw isometric blocks at this many times the resolution and average down, smoothing their edges.")
+	flags.StringVar(&s.CacheDir, "cache", "", "Keep each region's drawn layers in this directory and only draw regions again once their files change, reusing the rest for every render with the same settings.")
+	flags.StringVar(&s.ChunkCacheDir, "chunk-cache", "", "Keep decoded chunks in this directory so renders with another palette, mode or overlay skip decompressing and parsing chunks that haven't been saved since.")
+	flags.BoolVar(&s.Resume, "resume", false, "Checkpoint each region as it's drawn, in " + CHECKPOINTDIR + " beside -out until the render completes, and pick up from the checkpoints of an interrupted render with the same settings. The -cache directory serves as the checkpoint when given.")
+	flags.BoolVar(&opts.Mapped, "mmap", false, "Keep each image in a memory-mapped temporary file beside it instead of in memory, as is done anyway when the images would need more memory than is available.")
+	flags.BoolVar(&opts.Stream, "stream", false, "Buffer region layers on disk and composite the image a strip at a time to bound memory on huge worlds.")
+	flags.IntVar(&opts.Workers, "workers", 0, "Number of goroutines for each stage of parsing, drawing and encoding not set below (0 for one per CPU).")
+	flags.IntVar(&opts.Readers, "readers", 0, "Number of goroutines reading region files (0 for auto).")
+	flags.IntVar(&opts.Decompressors, "decompressors", 0, "Number of goroutines decompressing chunks (0 for auto).")
+	flags.IntVar(&opts.Decoders, "decoders", 0, "Number of goroutines decoding chunk NBT (0 for auto).")
+	flags.IntVar(&opts.Drawers, "drawers", 0, "Number of goroutines drawing regions (0 for auto).")
+	flags.IntVar(&opts.Encoders, "encoders", 0, "Number of goroutines encoding output images (0 for auto).")
+	flags.IntVar(&opts.ChunkBuffer, "chunk-buffer", 0, "Queue up to this many chunks between reading, decompressing and decoding (0 for one per goroutine of the next stage).")
+	flags.IntVar(&opts.RegionBuffer, "region-buffer", 0, "Queue up to this many regions between decoding, drawing and compositing, each held in memory while it waits.")
+	flags.BoolVar(&opts.Nice, "nice", false, "Run in the background: one goroutine per stage unless set above, paced reads, and the lowest CPU and I/O priority the OS allows.")
+	flags.DurationVar(&opts.Pace, "pace", 0, "Sleep this long after reading each chunk (default 2ms with -nice).")
+	
+	flags.BoolVar(&s.NoLock, "no-lock", false, "Don't lock the world and output directories against other runs.")
+	flags.DurationVar(&s.LockWait, "lock-wait", 0, "Wait this long for another run to release its lock before giving up.")
+	flags.BoolVar(&opts.Snapshot, "snapshot", false, "Copy region files to a temporary directory before reading them, so a running server saving the world can't change them mid-render.")
+	
+	flags.StringVar(&s.PaletteFilename, "palette", "", "Override block colors and shapes from this JSON file of block name[:data] to {top, left, right, alpha, shape: [[x0,y0,z0,x1,y1,z1], ...]}.")
+	flags.StringVar(&s.ResourcePack, "resource-pack", "", "Draw blocks with the textures of this Minecraft resource pack zip in textured mode, those it lacks in their palette colors.")
+	flags.StringVar(&s.Script, "script", "", "Color blocks with the color(block, data, biome, y, light) function of this Starlark file, returning None to leave a block be, \"#rrggbb\" or (r, g, b[, alpha]).")
+	flags.StringVar(&s.BiomePalette, "biome-palette", "", "Override the colors of biomes mode from this JSON file of biome name or ID to #rrggbb.")
+	flags.BoolVar(&s.PaletteReport, "palette-report", false, "Report block colors that are hard to tell apart, including under color blindness, and exit.")
+	flags.Float64Var(&s.DeltaE, "deltae", DELTAE, "Minimum CIE76 color difference required by -palette-report.")
+	flags.BoolVar(&s.DryRun, "dry-run", false, "Report the regions and chunks to be rendered, and each image's size and estimated memory, from the region headers alone, and exit.")
+	flags.StringVar(&opts.Report, "report", "", "Write a JSON summary of the render to this file: regions and chunks drawn, chunks skipped and why, block IDs without colors, peak memory and time spent in each stage.")
+	
+	return s
+}
+
+// Resolve fills in the settings left to defaults once flags are parsed.
+func (s *RenderSettings) Resolve() {
+	s.Opts.Auto()
+	s.Opts.Entities = NewEntityFilter(s.EntityTypes)
+	if s.PerPlayer && s.Radius == 0 {
+		s.Radius = PLAYERRADIUS
+	}
+	if s.Radius > 0 && !s.PerPlayer {
+		s.Opts.Area.Limit(s.Center, s.Radius)
+	}
+	if s.ChunkCacheDir != "" {
+		s.Opts.ChunkCache = &ChunkCache{Dir: s.ChunkCacheDir}
+	}
+	if s.Opts.UnpopulatedTint.A != 0 {
+		s.Opts.Unpopulated = true
+	}
+	if s.Tiles && !IsMBTiles(s.Out) {
+		s.Opts.DZI = true
+	}
+}
+
+// UseCache sets up -cache, or checkpoints for -resume, keyed by the flags
+// the settings were parsed from.
+func (s *RenderSettings) UseCache(flags *flag.FlagSet) {
+	dir := s.CacheDir
+	if dir == "" && s.Resume {
+		dir = StateDir(s.Out, CHECKPOINTDIR)
+	}
+	s.Opts.Cache = NewLayerCache(dir, flags)
+	if s.Opts.Cache != nil {
+		s.Opts.Cache.Checkpoint = s.CacheDir == ""
+	}
+}
+
+// Target returns the images the settings ask for, with the modes as drawn.
+func (s *RenderSettings) Target() RenderTarget {
+	modes := append(ModeList(nil), s.Opts.Modes...)
+	modes.SetProjection(s.Projection)
+	if s.Slices > 0 {
+		modes = modes.Slice(s.Slices)
+	}
+	return RenderTarget{s.Out, modes}
+}
+
+// Dimensions returns the dimensions to render, with outputs for targets:
+// the world, every dimension with -all-dimensions, or that of -dimension.
+func (s *RenderSettings) Dimensions(targets []RenderTarget) ([]*Dimension, error) {
+	if s.Dimension == "" {
+		return FindTargets(s.Dir, targets, s.AllDimensions)
+	}
+	
+	d, err := FindDimension(s.Dir, s.Dimension)
+	if err != nil {
+		return nil, exitError(ExitNoRegions, "Error reading world: ", err)
+	}
+	// Only one dimension is rendered, so images are named as for the world.
+	d.Name = ""
+	d.AddOutputs(targets)
+	return []*Dimension{d}, nil
+}
+
+// Run renders targets in one pass over the world with the settings.
+func (s *RenderSettings) Run(targets []RenderTarget) (err error) {
+	opts := &s.Opts
+	opts.Fade.Now = time.Now()
+	opts.Progress.Start()
+	
+	if s.PaletteFilename != "" {
+		if err := LoadPaletteFile(s.PaletteFilename); err != nil {
+			return exitError(ExitPalette, "Error reading palette file: ", err)
+		}
+	}
+	if s.ResourcePack != "" {
+		if err := LoadResourcePack(s.ResourcePack); err != nil {
+			return fatalError("Error reading resource pack: ", err)
+		}
+	}
+	if s.Script != "" {
+		if opts.Script, err = LoadScript(s.Script); err != nil {
+			return fatalError("Error reading script: ", err)
+		}
+	}
+	if s.BiomePalette != "" {
+		if err := LoadBiomePalette(s.BiomePalette); err != nil {
+			return exitError(ExitPalette, "Error reading biome palette: ", err)
+		}
+	}
+	opts.Theme.Apply()
+	for _, target := range targets {
+		for _, mode := range target.Modes {
+			if iso, ok := mode.(IsometricMode); ok && iso.Textured && blockTextures == nil {
+				opts.Progress.Warnf("No -resource-pack given, so %s draws palette colors", mode.Name())
+			}
+		}
+	}
+	
+	if s.PaletteReport {
+		PaletteReport(os.Stdout, blockColors, s.DeltaE)
+		return nil
+	}
+	
+	if _, err := os.Stat(s.Dir); err != nil {
+		return fatalError("Error statting directory: ", err)
+	}
+	
+	if s.DryRun {
+		dimensions, err := s.Dimensions(targets)
+		if err != nil {
+			return err
+		}
+		return DryRun(dimensions, opts)
+	}
+	
+	if opts.Nice {
+		if err := LowerPriority(); err != nil {
+			opts.Progress.Warnf("Couldn't lower priority: %s", err)
+		}
+	}
+	
+	backends := make([]OutputBackend, len(targets))
+	for i := range targets {
+		if backends[i], targets[i].Out, err = OpenOutput(targets[i].Out); err != nil {
+			return fatalError("Error opening output: ", err)
+		}
+		if store, ok := backends[i].(*ObjectStore); ok {
+			store.Parallel = s.UploadParallel
+			defer os.RemoveAll(filepath.Dir(targets[i].Out))
+		}
+	}
+	
+	if !s.NoLock {
+		locked := make(map[string]bool)
+		for _, target := range targets {
+			dir := filepath.Clean(filepath.Dir(target.Out))
+			if locked[dir] {
+				continue
+			}
+			outLock, err := AcquireLock(dir, s.LockWait)
+			if err != nil {
+				return fatalError("Error locking output directory: ", err)
+			}
+			defer outLock.Release()
+			locked[dir] = true
+			opts.Progress.Debugf("Locked %s", outLock.Path)
+		}
+		
+		// The world may be read-only, in which case only the output is
+		// locked, or hold the output, already locked.
+		if !locked[filepath.Clean(s.Dir)] {
+			worldLock, err := AcquireLock(s.Dir, s.LockWait)
+			if !ReadOnly(err) {
+				if err != nil {
+					return fatalError("Error locking world directory: ", err)
+				}
+				opts.Progress.Debugf("Locked %s", worldLock.Path)
+			}
+			defer worldLock.Release()
+		}
+	}
+	
+	if s.PerPlayer {
+		err = RenderPlayers(s.Dir, targets, s.Radius, opts)
+	} else {
+		var dimensions []*Dimension
+		if dimensions, err = s.Dimensions(targets); err == nil {
+			_, err = RenderDimensions(s.Dir, dimensions, targets, opts)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	for i, backend := range backends {
+		if backend != nil {
+			if err := backend.Publish(filepath.Dir(targets[i].Out), &opts.Progress); err != nil {
+				return fatalError("Error uploading output: ", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Main runs the gocart command with args, those after the program name. A
+// panic is still an error to whatever ran gocart, so it's logged and exits
+// with ExitFatal rather than going unnoticed.
+func Main(args []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Fatal error: %v\n%s", r, debug.Stack())
+			os.Exit(ExitFatal)
+		}
+	}()
+	
+	flag.Usage = Usage
+	HandleError(LoadBlockColors())
+	HandleError(RunCommand(args))
+}
+
+// RenderCommand renders the world as the render flags in args say, or, with
+// printConfig, reports what they resolve to. Tiles always come out as tiles:
+// an MBTiles database by default, or a Deep Zoom pyramid beside the image.
+func RenderCommand(args []string, tiles, printConfig bool) error {
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.Usage = Usage
+	s := NewRenderSettings(flags)
+	s.Tiles = tiles
+	if tiles {
+		SetDefault(flags, "out", TILESFILE)
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	
+	var config *Config
+	if s.ConfigFilename != "" {
+		var err error
+		if config, err = ReadConfig(s.ConfigFilename); err != nil {
+			return fatalError("Error reading config: ", err)
+		}
+		if err := config.Apply(flags); err != nil {
+			return fatalError("Error in config: ", err)
+		}
+	}
+	
+	if s.Profile != "" {
+		if config == nil {
+			return fatalError("Error in config: ", fmt.Errorf("-profile needs a -config file"))
+		}
+		return RenderProfiles(config, s.Profile, args, tiles, printConfig)
+	}
+	
+	s.Resolve()
+	s.UseCache(flags)
+	if printConfig {
+		return fatalError("Error printing config: ", ResolveSettings(flags, config).Print(os.Stdout))
+	}
+	if err := s.Run([]RenderTarget{s.Target()}); err != nil {
+		return err
+	}
+	if s.Opts.Progress.SkippedChunks() > 0 {
+		return ErrSkipped
+	}
+	return nil
+}
+
+// SetDefault changes the default of a flag, as shown in usage and taken
+// when neither the command line nor -config sets it.
+func SetDefault(flags *flag.FlagSet, name, value string) {
+	f := flags.Lookup(name)
+	f.Value.Set(value)
+	f.DefValue = value
+}
+
+// RenderWorld renders every dimension and mode to images named after
+// outFilename, with an index page when there is more than one.
+func RenderWorld(dir, outFilename string, allDimensions bool, opts *Options) ([]*Dimension, error) {
+	return RenderTargets(dir, []RenderTarget{{outFilename, opts.Modes}}, allDimensions, opts)
+}
+
+// RenderTargets renders every target's modes in a single pass, each named
+// after its own Out, with an index page beside the first when there is more
+// than one image.
+func RenderTargets(dir string, targets []RenderTarget, allDimensions bool, opts *Options) ([]*Dimension, error) {
+	dimensions, err := FindTargets(dir, targets, allDimensions)
+	if err != nil {
+		return nil, err
+	}
+	return RenderDimensions(dir, dimensions, targets, opts)
+}
+
+// RenderDimensions renders dimensions of the world at dir to their outputs,
+// made for targets, in a single pass.
+func RenderDimensions(dir string, dimensions []*Dimension, targets []RenderTarget, opts *Options) ([]*Dimension, error) {
+	var regions PositionList
+	
+	opts.Failure = new(Failure)
+	if opts.Script != nil {
+		opts.Script.Failure = opts.Failure
+	}
+	
+	opts.Modes = nil
+	for _, target := range targets {
+		opts.Modes = append(opts.Modes, target.Modes...)
+	}
+	
+	aged := false
+	for _, mode := range opts.Modes {
+		if _, ok := mode.(AgeMode); ok {
+			aged = true
+		}
+	}
+	// Only features that need level.dat fail without it; the rest of the
+	// render goes on.
+	var world string
+	level, err := ReadLevelDat(dir)
+	switch {
+	case err == nil:
+		world = level.Data.Summary()
+		opts.Progress.Debugf("Game rules: %s", level.Data.Rules())
+	case os.IsNotExist(err):
+	case opts.Jitter > 0 || aged:
+		return nil, fatalError("Error reading level.dat: ", err)
+	default:
+		opts.Progress.Warnf("Error reading level.dat: %s", err)
+	}
+	opts.Seed, opts.WorldTime = level.Data.Seed(), level.Data.Time
+	if aged && opts.WorldTime == 0 {
+		opts.Progress.Warnf("No world time in level.dat, so age mode measures from when chunks were saved")
+	}
+	
+	if opts.Objective != "" {
+		markers, err := ScoreMarkers(dir, opts.Objective, opts.Positions)
+		if err != nil {
+			return nil, fatalError("Error reading scoreboard: ", err)
+		}
+		if opts.PlayerHeads {
+			skins, err := NewSkinCache(opts.SkinCache, opts.SkinTimeout)
+			if err != nil {
+				return nil, fatalError("Error opening skin cache: ", err)
+			}
+			skins.AddHeads(markers, &opts.Progress)
+		}
+		for _, dimension := range dimensions {
+			dimension.AddMarkers(markers[dimension.Key], opts)
+		}
+	}
+	
+	if opts.Portals {
+		portals, err := FindPortals(dir, opts)
+		if err != nil {
+			return nil, err
+		}
+		opts.Progress.Printf("Found %d overworld and %d nether portals", len(portals[0]), len(portals[-1]))
+		for _, dimension := range dimensions {
+			markers, paths := PortalOverlay(portals, dimension.ID)
+			dimension.AddMarkers(markers, opts)
+			dimension.AddPaths(paths)
+		}
+	}
+	
+	if opts.NetherOverlay > 0 && hasTopDown(opts.Modes) {
+		for _, dimension := range dimensions {
+			if dimension.Other, err = NetherOverlay(dir, dimension.ID, opts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	
+	if len(opts.POIs) != 0 {
+		for _, dimension := range dimensions {
+			pois, err := ReadPOIs(dimension.Path)
+			if err != nil {
+				opts.Progress.Warnf("Error reading points of interest: %s", err)
+			}
+			dimension.AddMarkers(opts.POIs.Markers(pois), opts)
+		}
+	}
+	
+	if opts.MarkerFile != "" {
+		markers, paths, err := ReadMarkerFile(opts.MarkerFile)
+		if err != nil {
+			return nil, fatalError("Error reading marker file: ", err)
+		}
+		for _, dimension := range dimensions {
+			dimension.AddMarkers(markers[dimension.Key], opts)
+			dimension.AddPaths(paths[dimension.Key])
+		}
+	}
+	
+	if opts.RouteFile != "" {
+		markers, paths, err := ReadRoutes(opts.RouteFile)
+		if err != nil {
+			return nil, fatalError("Error reading routes: ", err)
+		}
+		for _, dimension := range dimensions {
+			dimension.AddMarkers(markers[dimension.Key], opts)
+			dimension.AddPaths(paths[dimension.Key])
+		}
+	}
+	
+	// Chunks a server saves mid-read are read again either way, but only a
+	// snapshot keeps the regions consistent with each other.
+	var snapshot string
+	if FileLocked(filepath.Join(dir, SESSIONLOCK)) && !opts.Snapshot {
+		opts.Progress.Warnf("The world is open in a running game or server, so it may change as it's read (-snapshot copies it first)")
+	}
+	if opts.Snapshot {
+		var err error
+		if snapshot, err = ioutil.TempDir("", "gocart-snapshot-"); err != nil {
+			return nil, fatalError("Error creating snapshot directory: ", err)
+		}
+		defer os.RemoveAll(snapshot)
+	}
+	
+	for i, dimension := range dimensions {
+		if err := dimension.Glob(i, opts); err != nil {
+			return nil, err
+		}
+		if len(dimension.Regions) == 0 {
+			continue
+		}
+		if err := dimension.CheckFormat(); err != nil {
+			return nil, fatalError("Error reading world: ", err)
+		}
+		if snapshot != "" {
+			if err := SnapshotRegions(dimension.Regions, filepath.Join(snapshot, dimension.StoreName())); err != nil {
+				return nil, fatalError("Error copying regions: ", err)
+			}
+			opts.Progress.Debugf("Copied %d %s regions to %s", len(dimension.Regions), dimension.Name, snapshot)
+		}
+		
+		defer dimension.Close()
+		if err := dimension.Create(opts); err != nil {
+			return nil, err
+		}
+		
+		regions = append(regions, dimension.Regions...)
+	}
+	if len(regions) == 0 {
+		return nil, exitError(ExitNoRegions, "Error reading world: ", fmt.Errorf("no region files found in %s", dir))
+	}
+	
+	var (
+		skipped []ChunkError
+		unpopulated int
+		report *RenderReport
+	)
+	if opts.Report != "" {
+		report, opts.Stages = NewRenderReport(), &StageTimes{}
+	}
+	
+	cache, drawn := opts.Cache, regions
+	if cache != nil {
+		if err := cache.Usable(opts); err != nil {
+			opts.Progress.Warnf("Not using -cache: %s", err)
+			cache = nil
+		}
+	}
+	if cache != nil {
+		if err := cache.Prepare(opts); err != nil {
+			return nil, fatalError("Error reading checkpoint: ", err)
+		}
+		drawn = cache.Stale(dimensions, regions)
+		if len(drawn) < len(regions) {
+			opts.Progress.Printf("Drawing %d of %d regions, reusing the rest from %s", len(drawn), len(regions), cache.Dir)
+		}
+		for _, r := range drawn {
+			opts.Progress.Tracef("Drawing %s: changed or not cached with these settings", r.(Region).Path)
+		}
+	}
+	
+	opts.Progress.Debugf("Pipeline: %d readers, %d decompressors, %d decoders, %d drawers, %d encoders; %d chunks and %d regions buffered", opts.Readers, opts.Decompressors, opts.Decoders, opts.Drawers, opts.Encoders, opts.chunkBuffer(opts.Decoders), opts.RegionBuffer)
+	for layer := range Render(drawn, opts) {
+		// Layers drawn once cancelled are missing chunks, so mustn't be
+		// cached or composited.
+		if opts.Cancelled() {
+			continue
+		}
+		region := drawn[layer.Index - 1].(Region)
+		dimension := dimensions[region.Dimension]
+		
+		opts.Progress.Region(dimension.Name, layer.Filename, layer.Index, len(drawn), layer.ChunkCount)
+		for _, chunkErr := range layer.Errors {
+			opts.Progress.ChunkError(chunkErr)
+		}
+		skipped = append(skipped, layer.Errors...)
+		unpopulated += layer.Unpopulated
+		if report != nil {
+			report.Regions++
+			report.Chunks += layer.ChunkCount
+			report.Unpopulated += layer.Unpopulated
+			for _, c := range layer.Chunks {
+				report.AddChunk(c.(Level))
+			}
+		}
+		
+		// Cached layers are all added in order once every region is drawn.
+		if cache != nil {
+			opts.Failure.Fail(fatalError("Error caching layer: ", cache.Store(dimension, region, layer, opts)))
+			continue
+		}
+		if layer.Imgs == nil {
+			continue
+		}
+		
+		for _, c := range layer.Chunks {
+			dimension.AddChunk(c.(Level), opts.Entities, opts)
+			dimension.AddMarkers(FoundMarkers(c.(Level), opts), opts)
+		}
+		start := time.Now()
+		opts.Failure.Fail(fatalError("Error buffering layer: ", dimension.AddLayer(layer)))
+		opts.Stages.Add(StageComposite, start)
+	}
+	
+	// Layers keep coming until the pipeline has drained, so a failure is
+	// only returned once it has.
+	if err := opts.Failure.Err(); err != nil {
+		return nil, err
+	}
+	if opts.Cancelled() {
+		opts.Progress.Warnf("Render cancelled, so nothing was written")
+		return dimensions, nil
+	}
+	
+	if cache != nil {
+		start := time.Now()
+		if err := cache.Composite(dimensions, regions, opts); err != nil {
+			return nil, fatalError("Error reading cached layers: ", err)
+		}
+		opts.Stages.Add(StageComposite, start)
+		if err := cache.Finish(); err != nil {
+			return nil, fatalError("Error finishing -cache: ", err)
+		}
+	}
+	
+	var encodeJobs []EncodeJob
+	for _, dimension := range dimensions {
+		if len(dimension.Regions) != 0 {
+			jobs, err := dimension.Finish(opts)
+			if err != nil {
+				return nil, err
+			}
+			encodeJobs = append(encodeJobs, jobs...)
+		}
+	}
+	
+	opts.Progress.Printf("Committing image to disk...")
+	start := time.Now()
+	if err := Encode(encodeJobs, opts.Encoders); err != nil {
+		return nil, err
+	}
+	opts.Stages.Add(StageEncode, start)
+	
+	if len(encodeJobs) > 1 {
+		if err := WriteIndex(filepath.Dir(targets[0].Out), dimensions); err != nil {
+			return nil, fatalError("Error writing index: ", err)
+		}
+	}
+	
+	if unpopulated > 0 && opts.Unpopulated {
+		opts.Progress.Printf("Drew %d chunks whose terrain hasn't been populated", unpopulated)
+	} else if unpopulated > 0 {
+		opts.Progress.Printf("Left out %d chunks whose terrain hasn't been populated (-unpopulated draws them)", unpopulated)
+	}
+	if world != "" {
+		opts.Progress.Printf("%s", world)
+	}
+	opts.Progress.Skipped(skipped)
+	if report != nil {
+		if err := report.Write(opts.Report, skipped, opts.Stages, opts.Progress.Elapsed()); err != nil {
+			return nil, fatalError("Error writing report: ", err)
+		}
+	}
+	opts.Progress.Done()
+	return dimensions, nil
+}
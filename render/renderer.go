@@ -0,0 +1,206 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"flag"
+	"sync"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// A Renderer renders one world with fixed settings, for Go programs such as
+// server panels that embed gocart rather than running it and reading its
+// output. Failures are returned, as an *ExitError where the gocart command
+// would exit with a status of its own. Each render starts from the built-in
+// palette and puts it back afterwards, so renders run one at a time.
+type Renderer struct {
+	settings *RenderSettings
+	flags *flag.FlagSet
+}
+
+var renderMu sync.Mutex
+
+// An Option configures a Renderer.
+type Option func(r *Renderer) error
+
+// WithFlags sets render flags as the command line would, e.g. "-night".
+func WithFlags(args ...string) Option {
+	return func(r *Renderer) error {
+		if err := r.flags.Parse(args); err != nil {
+			return err
+		}
+		if r.flags.NArg() != 0 {
+			return fmt.Errorf("unexpected argument %q", r.flags.Arg(0))
+		}
+		return nil
+	}
+}
+
+// WithMode renders in the named mode, such as topdown, instead of iso.
+func WithMode(name string) Option {
+	return func(r *Renderer) error {
+		return r.flags.Set("modes", name)
+	}
+}
+
+// WithArea only renders blocks within x0,z0,x1,z1, cropping to them.
+func WithArea(x0, z0, x1, z1 int) Option {
+	return func(r *Renderer) error {
+		return r.flags.Set("area", fmt.Sprintf("%d,%d,%d,%d", x0, z0, x1, z1))
+	}
+}
+
+// WithPalette overrides block colors from a JSON file, as -palette does.
+func WithPalette(filename string) Option {
+	return func(r *Renderer) error {
+		return r.flags.Set("palette", filename)
+	}
+}
+
+// WithShader colors blocks through shader after the built-in shaders.
+func WithShader(shader BlockShader) Option {
+	return func(r *Renderer) error {
+		r.settings.Opts.Shaders = append(r.settings.Opts.Shaders, shader)
+		return nil
+	}
+}
+
+// WithOverlay draws overlay over each image after the built-in overlays.
+func WithOverlay(overlay Overlay) Option {
+	return func(r *Renderer) error {
+		r.settings.Opts.Overlays = append(r.settings.Opts.Overlays, overlay)
+		return nil
+	}
+}
+
+// WithTileHook passes hook each region's tile as soon as it's drawn, before
+// the whole image is composited, as Hooks describes.
+func WithTileHook(hook func(Tile)) Option {
+	return func(r *Renderer) error {
+		r.settings.Opts.Hooks.Tile = hook
+		return nil
+	}
+}
+
+// WithEncodedTileHook passes hook each region's tile as WithTileHook does,
+// along with the tile encoded as a PNG.
+func WithEncodedTileHook(hook func(Tile, []byte)) Option {
+	return func(r *Renderer) error {
+		r.settings.Opts.Hooks.EncodedTile = hook
+		return nil
+	}
+}
+
+// WithLog reports progress and errors to w, which a Renderer otherwise
+// discards.
+func WithLog(w io.Writer) Option {
+	return func(r *Renderer) error {
+		r.settings.Opts.Progress.Output = w
+		return nil
+	}
+}
+
+// WithQuiet reports only errors.
+func WithQuiet() Option {
+	return func(r *Renderer) error {
+		return r.flags.Set("quiet", "true")
+	}
+}
+
+// New prepares to render the overworld of the world at dir.
+func New(world string, options ...Option) (*Renderer, error) {
+	if err := LoadBlockColors(); err != nil {
+		return nil, err
+	}
+	
+	r := &Renderer{flags: flag.NewFlagSet("renderer", flag.ContinueOnError)}
+	r.flags.SetOutput(ioutil.Discard)
+	r.settings = NewRenderSettings(r.flags)
+	r.settings.Opts.Progress.Output = ioutil.Discard
+	if err := r.flags.Set("dir", world); err != nil {
+		return nil, err
+	}
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+	
+	if _, err := os.Stat(world); err != nil {
+		return nil, err
+	}
+	if len(r.settings.Opts.Modes) != 1 || r.settings.Slices > 0 {
+		return nil, fmt.Errorf("a Renderer draws a single image, so takes one mode and no slices")
+	}
+	r.settings.AllDimensions = false
+	r.settings.Resolve()
+	return r, nil
+}
+
+// Render draws the world and writes it to w as a PNG. If ctx is done first,
+// the render stops and ctx's error is returned with nothing written.
+func (r *Renderer) Render(ctx context.Context, w io.Writer) error {
+	dir, err := ioutil.TempDir("", "gocart-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	
+	out := filepath.Join(dir, IMGFILE)
+	if err := r.run(ctx, out, false); err != nil {
+		return err
+	}
+	
+	img, err := os.Open(out)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+	_, err = io.Copy(w, img)
+	return err
+}
+
+// RenderTiles draws the world into dir as an image with a Deep Zoom tile
+// pyramid beside it, as the tiles command does.
+func (r *Renderer) RenderTiles(ctx context.Context, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return r.run(ctx, filepath.Join(dir, IMGFILE), true)
+}
+
+func (r *Renderer) run(ctx context.Context, out string, tiles bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	
+	// Palettes, themes and resource packs are loaded into the shared block
+	// colors, so they're undone for the next render, this Renderer's or not.
+	renderMu.Lock()
+	defer renderMu.Unlock()
+	defer SavePalette()()
+	
+	s := *r.settings
+	s.Out = out
+	s.Opts.DZI = s.Opts.DZI || tiles
+	
+	done, finished := make(chan struct{}), make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(done)
+		case <-finished:
+		}
+	}()
+	s.Opts.Done = done
+	
+	s.UseCache(r.flags)
+	if err := s.Run([]RenderTarget{s.Target()}); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,251 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"sort"
+	"time"
+	"bufio"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+)
+
+const (
+	STATEFILE = "state.db"
+	STATEERRORS = 1000
+)
+
+// A RenderState records, in an SQLite database beside a -cache's layers,
+// which version of each region file its layers were drawn from, down to
+// every chunk's timestamp, what part of each image those layers cover, and
+// the errors of recent renders. The chunk timestamps let regions count as
+// unchanged even once their files have new modification times, as when the
+// world is copied or moved.
+type RenderState struct {
+	Regions map[string]*RegionState
+	Errors []StateError
+}
+
+type RegionState struct {
+	Modified time.Time
+	Size int64
+	Rendered time.Time
+	
+	// Chunks holds the timestamp of each chunk present, by index in the file.
+	Chunks map[int]int32
+	Tiles []TileDependency
+}
+
+// A TileDependency is the part of a mode's image a region's layer covers,
+// and so which of its tiles must be redone when the region changes.
+type TileDependency struct {
+	Mode string
+	Bounds image.Rectangle
+}
+
+type StateError struct {
+	Time time.Time
+	Region string
+	X, Z int
+	Offset int64
+	Message string
+}
+
+var stateTables = []struct {
+	name, sql string
+}{
+	{"regions", "CREATE TABLE regions (name TEXT, modified INTEGER, size INTEGER, rendered INTEGER)"},
+	{"chunks", "CREATE TABLE chunks (region TEXT, x INTEGER, z INTEGER, timestamp INTEGER)"},
+	{"tiles", "CREATE TABLE tiles (region TEXT, mode TEXT, x0 INTEGER, y0 INTEGER, x1 INTEGER, y1 INTEGER)"},
+	{"errors", "CREATE TABLE errors (time INTEGER, region TEXT, x INTEGER, z INTEGER, offset INTEGER, message TEXT)"},
+}
+
+// stateName identifies a region by dimension and file name, so the state
+// follows the world wherever it's moved.
+func stateName(d *Dimension, region Region) string {
+	return d.StoreName() + "/" + filepath.Base(region.Path)
+}
+
+// chunkTimestamps reads when each chunk present in a region file was last
+// saved.
+func chunkTimestamps(path string) (map[int]int32, os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	var header Header
+	header.Read(bufio.NewReader(f))
+	
+	timestamps := make(map[int]int32)
+	for i, location := range header.Locations {
+		if location.Valid(stat.Size()) {
+			timestamps[i] = header.Timestamps[i]
+		}
+	}
+	return timestamps, stat, nil
+}
+
+// ReadRenderState reads the state in filename, empty if there's none yet.
+func ReadRenderState(filename string) (*RenderState, error) {
+	state := &RenderState{Regions: make(map[string]*RegionState)}
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+	defer f.Close()
+	
+	tables := make(map[string][][]interface{})
+	for _, table := range stateTables {
+		rows, err := ReadSQLiteTable(f, table.name)
+		if err != nil {
+			return state, fmt.Errorf("%s: %s", filename, err)
+		}
+		tables[table.name] = rows
+	}
+	
+	region := func(name interface{}) *RegionState {
+		r := state.Regions[fmt.Sprint(name)]
+		if r == nil {
+			r = &RegionState{Chunks: make(map[int]int32)}
+			state.Regions[fmt.Sprint(name)] = r
+		}
+		return r
+	}
+	integer := func(v interface{}) int64 {
+		i, _ := v.(int64)
+		return i
+	}
+	
+	for _, row := range tables["regions"] {
+		if len(row) == 4 {
+			r := region(row[0])
+			r.Modified, r.Size, r.Rendered = time.Unix(0, integer(row[1])), integer(row[2]), time.Unix(integer(row[3]), 0)
+		}
+	}
+	for _, row := range tables["chunks"] {
+		if len(row) == 4 {
+			region(row[0]).Chunks[int(integer(row[1]) & 31 + integer(row[2]) & 31 << 5)] = int32(integer(row[3]))
+		}
+	}
+	for _, row := range tables["tiles"] {
+		if len(row) == 6 {
+			r := region(row[0])
+			r.Tiles = append(r.Tiles, TileDependency{fmt.Sprint(row[1]), image.Rect(int(integer(row[2])), int(integer(row[3])), int(integer(row[4])), int(integer(row[5])))})
+		}
+	}
+	for _, row := range tables["errors"] {
+		if len(row) == 6 {
+			state.Errors = append(state.Errors, StateError{time.Unix(integer(row[0]), 0), fmt.Sprint(row[1]), int(integer(row[2])), int(integer(row[3])), integer(row[4]), fmt.Sprint(row[5])})
+		}
+	}
+	return state, nil
+}
+
+// Unchanged reports whether a region file still holds the version the state
+// has for it, and if so records the file's current modification time and
+// size to recognize it by next time.
+func (s *RenderState) Unchanged(name, path string) bool {
+	r := s.Regions[name]
+	if r == nil {
+		return false
+	}
+	
+	timestamps, stat, err := chunkTimestamps(path)
+	if err != nil || len(timestamps) != len(r.Chunks) {
+		return false
+	}
+	for i, t := range timestamps {
+		if recorded, exists := r.Chunks[i]; !exists || recorded != t {
+			return false
+		}
+	}
+	r.Modified, r.Size = stat.ModTime(), stat.Size()
+	return true
+}
+
+// Record replaces a region's state with the version of its file drawn now.
+func (s *RenderState) Record(name string, region Region, tiles []TileDependency, errors []ChunkError) error {
+	timestamps, stat, err := chunkTimestamps(region.Path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	s.Regions[name] = &RegionState{stat.ModTime(), stat.Size(), now, timestamps, tiles}
+	
+	for _, e := range errors {
+		s.Errors = append(s.Errors, StateError{now, name, e.X, e.Z, e.Offset, e.Err.Error()})
+	}
+	if len(s.Errors) > STATEERRORS {
+		s.Errors = s.Errors[len(s.Errors) - STATEERRORS:]
+	}
+	return nil
+}
+
+// Write replaces filename with the state, keeping only the regions in keep.
+// The old state stays whole until the new one is, so a render that's
+// interrupted never leaves a partial one behind.
+func (s *RenderState) Write(filename string, keep map[string]bool) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), ".state-")
+	if err != nil {
+		return err
+	}
+	
+	db := NewSQLiteDB(f)
+	tables := make(map[string]*SQLiteTable)
+	for _, table := range stateTables {
+		tables[table.name] = db.CreateTable(table.name, table.sql)
+	}
+	
+	var names sort.StringSlice
+	for name := range s.Regions {
+		if keep[name] {
+			names = append(names, name)
+		}
+	}
+	names.Sort()
+	
+	insert := func(table string, values ...interface{}) {
+		if err == nil {
+			_, err = tables[table].Insert(values...)
+		}
+	}
+	for _, name := range names {
+		r := s.Regions[name]
+		insert("regions", name, r.Modified.UnixNano(), r.Size, r.Rendered.Unix())
+		
+		var region Region
+		fmt.Sscanf(filepath.Base(name), "r.%d.%d", &region.X, &region.Z)
+		for i := 0; i < DIM; i++ {
+			if t, exists := r.Chunks[i]; exists {
+				insert("chunks", name, region.X << 5 + i & 31, region.Z << 5 + i >> 5, int64(t))
+			}
+		}
+		for _, tile := range r.Tiles {
+			insert("tiles", name, tile.Mode, tile.Bounds.Min.X, tile.Bounds.Min.Y, tile.Bounds.Max.X, tile.Bounds.Max.Y)
+		}
+	}
+	for _, e := range s.Errors {
+		insert("errors", e.Time.Unix(), e.Region, e.X, e.Z, e.Offset, e.Message)
+	}
+	
+	if err == nil {
+		err = db.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
@@ -0,0 +1,124 @@
+package render
+
+import (
+	"fmt"
+	"time"
+	"runtime"
+	"io/ioutil"
+	"sync/atomic"
+	"encoding/json"
+)
+
+// A Stage is one step of the render pipeline, timed for -report.
+type Stage int
+
+const (
+	StageRead Stage = iota
+	StageDecompress
+	StageDecode
+	StageDraw
+	StageComposite
+	StageEncode
+)
+
+var stageNames = []string{"read", "decompress", "decode", "draw", "composite", "encode"}
+
+// StageTimes adds up how long the goroutines of each stage spent working.
+// A nil StageTimes times nothing.
+type StageTimes [StageEncode + 1]int64
+
+// Add counts the time since start toward stage.
+func (s *StageTimes) Add(stage Stage, start time.Time) {
+	if s != nil {
+		atomic.AddInt64(&s[stage], int64(time.Since(start)))
+	}
+}
+
+// A RenderReport summarises a render for -report, so scripts can tell when
+// one went wrong without studying the image.
+type RenderReport struct {
+	Regions int `json:"regions"`
+	Chunks int `json:"chunks"`
+	Unpopulated int `json:"unpopulated"`
+	Skipped []SkippedChunk `json:"skipped"`
+	
+	// UnknownBlocks counts the blocks of each ID, as 0xNN, that have no
+	// color and so weren't drawn.
+	UnknownBlocks map[string]int `json:"unknown_blocks"`
+	
+	// PeakMemory is what the Go runtime took from the OS, which it never
+	// gives back, so covers the peak. Memory-mapped canvases aren't in it.
+	PeakMemory uint64 `json:"peak_memory"`
+	
+	// Stages is how many seconds each stage's goroutines spent working,
+	// added together, so stages running in parallel can exceed Duration.
+	Stages map[string]float64 `json:"stages"`
+	Duration float64 `json:"duration"`
+	
+	known [256]bool
+	unknown [256]int
+}
+
+// NewRenderReport starts a report on a render with the current palette.
+func NewRenderReport() *RenderReport {
+	r := &RenderReport{}
+	for id := range blockColors {
+		r.known[id] = true
+	}
+	r.known[0] = true
+	return r
+}
+
+// A SkippedChunk is a chunk left out of the render, and why.
+type SkippedChunk struct {
+	Region string `json:"region"`
+	X int `json:"x"`
+	Z int `json:"z"`
+	Reason string `json:"reason"`
+}
+
+// AddChunk counts the blocks in chunk that have no color.
+func (r *RenderReport) AddChunk(chunk Level) {
+	for _, section := range chunk.SectionTable() {
+		if section == nil {
+			continue
+		}
+		for _, block := range section.Blocks {
+			if !r.known[block] {
+				r.unknown[block]++
+			}
+		}
+	}
+}
+
+// Write finishes the report with the errors and stage times of the render
+// and writes it to filename.
+func (r *RenderReport) Write(filename string, skipped []ChunkError, stages *StageTimes, duration time.Duration) error {
+	r.Skipped = make([]SkippedChunk, len(skipped))
+	for i, e := range skipped {
+		r.Skipped[i] = SkippedChunk{e.Region, e.X, e.Z, e.Err.Error()}
+	}
+	
+	r.UnknownBlocks = make(map[string]int)
+	for id, count := range r.unknown {
+		if count != 0 {
+			r.UnknownBlocks[fmt.Sprintf("0x%02X", id)] = count
+		}
+	}
+	
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	r.PeakMemory = memory.Sys
+	
+	r.Stages = make(map[string]float64)
+	for i, name := range stageNames {
+		r.Stages[name] = time.Duration(atomic.LoadInt64(&stages[i])).Seconds()
+	}
+	r.Duration = duration.Seconds()
+	
+	data, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(data, '\n'), 0644)
+}
@@ -0,0 +1,326 @@
+package render
+
+import (
+	"io"
+	"fmt"
+	"sort"
+	"image"
+	"image/draw"
+	"image/color"
+	"crypto/sha1"
+	"archive/zip"
+	_ "image/png"
+)
+
+// TexturedProjection is how large the textured mode draws blocks unless
+// given another -projection: 24 pixels wide with 12 pixel sides, the size
+// of Minecraft Overviewer's blocks.
+var TexturedProjection = Projection{24, 6, 12}
+
+// Sides are darkened like the built-in palette's, in 256ths.
+const (
+	TEXTURELEFT = 205
+	TEXTURERIGHT = 230
+)
+
+// Textures loaded with -resource-pack, by block ID, and a hash of them.
+var (
+	blockTextures map[byte]*BlockTexture
+	texturesVersion string
+)
+
+type BlockTexture struct {
+	Top, Side *image.RGBA
+	
+	// Tinted textures are gray in the pack, colored by biome in the game.
+	// Here they're colored so they average out to the palette's top color.
+	TopTinted, SideTinted bool
+	TopAverage, SideAverage color.RGBA
+}
+
+type textureNames struct {
+	top, side string
+	topTinted, sideTinted bool
+}
+
+// blockTextureNames follows the names of 1.8 to 1.12 resource packs, whose
+// blocks are still numbered as in the worlds drawn here. Packs for 1.13 and
+// later are matched through textureRenames.
+var blockTextureNames = map[byte]textureNames{
+	0x01: {"stone", "stone", false, false},
+	0x02: {"grass_top", "grass_side", true, false},
+	0x03: {"dirt", "dirt", false, false},
+	0x04: {"cobblestone", "cobblestone", false, false},
+	0x05: {"planks_oak", "planks_oak", false, false},
+	0x07: {"bedrock", "bedrock", false, false},
+	0x08: {"water_still", "water_still", true, true},
+	0x09: {"water_still", "water_still", true, true},
+	0x0A: {"lava_still", "lava_still", false, false},
+	0x0B: {"lava_still", "lava_still", false, false},
+	0x0C: {"sand", "sand", false, false},
+	0x0D: {"gravel", "gravel", false, false},
+	0x0E: {"gold_ore", "gold_ore", false, false},
+	0x0F: {"iron_ore", "iron_ore", false, false},
+	0x10: {"coal_ore", "coal_ore", false, false},
+	0x11: {"log_oak_top", "log_oak", false, false},
+	0x12: {"leaves_oak", "leaves_oak", true, true},
+	0x13: {"sponge", "sponge", false, false},
+	0x14: {"glass", "glass", false, false},
+	0x15: {"lapis_ore", "lapis_ore", false, false},
+	0x16: {"lapis_block", "lapis_block", false, false},
+	0x18: {"sandstone_top", "sandstone_normal", false, false},
+	0x23: {"wool_colored_white", "wool_colored_white", false, false},
+	0x29: {"gold_block", "gold_block", false, false},
+	0x2A: {"iron_block", "iron_block", false, false},
+	0x2B: {"stone_slab_top", "stone_slab_side", false, false},
+	0x2C: {"stone_slab_top", "stone_slab_side", false, false},
+	0x2D: {"brick", "brick", false, false},
+	0x2E: {"tnt_top", "tnt_side", false, false},
+	0x2F: {"planks_oak", "bookshelf", false, false},
+	0x30: {"cobblestone_mossy", "cobblestone_mossy", false, false},
+	0x31: {"obsidian", "obsidian", false, false},
+	0x34: {"mob_spawner", "mob_spawner", false, false},
+	0x38: {"diamond_ore", "diamond_ore", false, false},
+	0x39: {"diamond_block", "diamond_block", false, false},
+	0x3A: {"crafting_table_top", "crafting_table_side", false, false},
+	0x3C: {"farmland_wet", "dirt", false, false},
+	0x3D: {"furnace_top", "furnace_side", false, false},
+	0x3E: {"furnace_top", "furnace_side", false, false},
+	0x49: {"redstone_ore", "redstone_ore", false, false},
+	0x4A: {"redstone_ore", "redstone_ore", false, false},
+	0x4E: {"snow", "snow", false, false},
+	0x4F: {"ice", "ice", false, false},
+	0x50: {"snow", "snow", false, false},
+	0x51: {"cactus_top", "cactus_side", false, false},
+	0x52: {"clay", "clay", false, false},
+	0x56: {"pumpkin_top", "pumpkin_side", false, false},
+	0x57: {"netherrack", "netherrack", false, false},
+	0x58: {"soul_sand", "soul_sand", false, false},
+	0x59: {"glowstone", "glowstone", false, false},
+	0x5B: {"pumpkin_top", "pumpkin_side", false, false},
+	0x62: {"stonebrick", "stonebrick", false, false},
+	0x67: {"melon_top", "melon_side", false, false},
+	0x6E: {"mycelium_top", "mycelium_side", false, false},
+	0x70: {"nether_brick", "nether_brick", false, false},
+	0x79: {"end_stone", "end_stone", false, false},
+}
+
+var textureRenames = map[string]string{
+	"grass_top": "grass_block_top",
+	"grass_side": "grass_block_side",
+	"planks_oak": "oak_planks",
+	"log_oak_top": "oak_log_top",
+	"log_oak": "oak_log",
+	"leaves_oak": "oak_leaves",
+	"sandstone_normal": "sandstone",
+	"wool_colored_white": "white_wool",
+	"stone_slab_top": "smooth_stone",
+	"stone_slab_side": "smooth_stone_slab_side",
+	"brick": "bricks",
+	"cobblestone_mossy": "mossy_cobblestone",
+	"mob_spawner": "spawner",
+	"farmland_wet": "farmland_moist",
+	"stonebrick": "stone_bricks",
+	"nether_brick": "nether_bricks",
+}
+
+// LoadResourcePack reads the block textures from a resource pack zip,
+// replacing any loaded before. Blocks it has no textures for are drawn in
+// their palette colors.
+func LoadResourcePack(filename string) error {
+	pack, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer pack.Close()
+	
+	files := make(map[string]*zip.File)
+	for _, f := range pack.File {
+		files[f.Name] = f
+	}
+	
+	h := sha1.New()
+	loaded := make(map[string]*image.RGBA)
+	load := func(name string) (*image.RGBA, error) {
+		if img, exists := loaded[name]; exists {
+			return img, nil
+		}
+		
+		var f *zip.File
+		for _, path := range []string{"blocks/" + name, "block/" + textureRenames[name], "block/" + name} {
+			if f = files["assets/minecraft/textures/" + path + ".png"]; f != nil {
+				break
+			}
+		}
+		if f == nil {
+			loaded[name] = nil
+			return nil, nil
+		}
+		
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		src, _, err := image.Decode(io.TeeReader(r, h))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Name, err)
+		}
+		
+		// Animated textures are strips of square frames; only the first is used.
+		size := src.Bounds().Dx()
+		img := image.NewRGBA(image.Rect(0, 0, size, size))
+		draw.Draw(img, img.Rect, src, src.Bounds().Min, draw.Src)
+		loaded[name] = img
+		return img, nil
+	}
+	
+	var ids []int
+	for id := range blockTextureNames {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	
+	textures := make(map[byte]*BlockTexture)
+	for _, id := range ids {
+		names := blockTextureNames[byte(id)]
+		top, err := load(names.top)
+		if err != nil {
+			return err
+		}
+		side, err := load(names.side)
+		if err != nil {
+			return err
+		}
+		if top != nil && side != nil {
+			textures[byte(id)] = &BlockTexture{top, side, names.topTinted, names.sideTinted, averageColor(top), averageColor(side)}
+		}
+	}
+	if len(textures) == 0 {
+		return fmt.Errorf("%s: no block textures found", filename)
+	}
+	
+	blockTextures = textures
+	texturesVersion = fmt.Sprintf("%x", h.Sum(nil))
+	return nil
+}
+
+// averageColor averages a texture's opaque pixels.
+func averageColor(img *image.RGBA) color.RGBA {
+	var r, g, b, n uint32
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i + 3] == 0xFF {
+			r, g, b, n = r + uint32(img.Pix[i]), g + uint32(img.Pix[i + 1]), b + uint32(img.Pix[i + 2]), n + 1
+		}
+	}
+	if n == 0 {
+		return color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	}
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), 0xFF}
+}
+
+// faceTint returns how much to scale each channel of a face's texture, in
+// 256ths: by shade, by however far effects such as -fade and -night have
+// moved the face's color c from the palette's, and for tinted textures from
+// their average gray to the palette's top color.
+func faceTint(c, palette color.RGBA, tinted bool, top, average color.RGBA, shade uint32) (tint [3]uint32) {
+	ratio := func(a, b uint8) uint32 {
+		if b == 0 {
+			return 0x100
+		}
+		return uint32(a) * 0x100 / uint32(b)
+	}
+	
+	final, base := [3]uint8{c.R, c.G, c.B}, [3]uint8{palette.R, palette.G, palette.B}
+	want, gray := [3]uint8{top.R, top.G, top.B}, [3]uint8{average.R, average.G, average.B}
+	for i := range tint {
+		tint[i] = shade * ratio(final[i], base[i]) >> 8
+		if tinted {
+			tint[i] = tint[i] * ratio(want[i], gray[i]) >> 8
+		}
+	}
+	return
+}
+
+// textureCoords finds where u, v, measured as for BlockFace, falls on the
+// texture of face: s across it and t down it, each from 0 to 1. Textures are
+// laid on the top with s along x and t along z, on the left (west) face with
+// s along z and on the right (south) face with s along x. Blocks that aren't
+// Full show the bottom half of their sides.
+func textureCoords(face Face, u, v float64, full bool, p Projection) (s, t float64) {
+	half, top, side := float64(p.Width) / 2, float64(p.Top), float64(p.Side)
+	if !full {
+		side /= 2
+		v -= side
+	}
+	v -= top - 0.5
+	
+	switch face {
+	case TopFace:
+		s, t = (u / half + 1 - v / top) / 2, (u / half + 1 + v / top) / 2
+	case LeftFace:
+		s, t = 1 + u / half, (v - top * (1 + u / half)) / side
+	case RightFace:
+		s, t = u / half, (v - top * (1 - u / half)) / side
+	}
+	if !full && face != TopFace {
+		t = 0.5 + t / 2
+	}
+	return
+}
+
+// texel samples a texture at s, t.
+func texel(img *image.RGBA, s, t float64) color.RGBA {
+	size := img.Rect.Dx()
+	x, y := Max(0, Min(size - 1, int(s * float64(size)))), Max(0, Min(size - 1, int(t * float64(size))))
+	return img.RGBAAt(x, y)
+}
+
+// DrawTextured draws a block projected to x, y with p on an image n times
+// the normal size, its faces covered by its textures. c is the block's color
+// after any effects, base its color in the palette.
+func DrawTextured(img *image.RGBA, x, y, n int, p Projection, c, base BlockColor, t *BlockTexture) {
+	var tints [RightFace + 1][3]uint32
+	tints[TopFace] = faceTint(c.Top, base.Top, t.TopTinted, base.Top, t.TopAverage, 0x100)
+	tints[LeftFace] = faceTint(c.Left, base.Left, t.SideTinted, base.Top, t.SideAverage, TEXTURELEFT)
+	tints[RightFace] = faceTint(c.Right, base.Right, t.SideTinted, base.Top, t.SideAverage, TEXTURERIGHT)
+	
+	bounds := blockRect(x, y, n, p).Intersect(img.Rect)
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			u, v := (float64(px) + 0.5) / float64(n) - float64(x), (float64(py) + 0.5) / float64(n) - float64(y)
+			face := BlockFace(u, v, c.Full, p)
+			if face == NoFace {
+				continue
+			}
+			
+			s, tv := textureCoords(face, u, v, c.Full, p)
+			texture := t.Side
+			if face == TopFace {
+				texture = t.Top
+			}
+			src := texel(texture, s, tv)
+			if src.A == 0 {
+				continue
+			}
+			
+			// Channels stay premultiplied, so no brighter than alpha.
+			tint := tints[face]
+			scale := func(v uint8, i int) uint8 {
+				return uint8(Min(int(src.A), int(uint32(v) * tint[i] >> 8)))
+			}
+			src = color.RGBA{scale(src.R, 0), scale(src.G, 1), scale(src.B, 2), src.A}
+			if src.A == 0xFF && c.Alpha == 0xFF {
+				img.SetRGBA(px, py, src)
+				continue
+			}
+			
+			alpha := uint32(c.Alpha)
+			over := func(d, s uint8) uint8 {
+				return uint8((uint32(s) * alpha + uint32(d) * (0xFF * 0xFF - uint32(src.A) * alpha) / 0xFF) / 0xFF)
+			}
+			dst := img.RGBAAt(px, py)
+			img.SetRGBA(px, py, color.RGBA{over(dst.R, src.R), over(dst.G, src.G), over(dst.B, src.B), over(dst.A, src.A)})
+		}
+	}
+}
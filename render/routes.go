@@ -0,0 +1,116 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"strconv"
+	"strings"
+	"image/color"
+	"encoding/csv"
+)
+
+// ROUTEROW begins a new route in a -routes file.
+const ROUTEROW = "route"
+
+// ReadRoutes loads routes, such as ice roads, rail lines and nether tunnels,
+// from a file of ordered name,x,z or name,x,y,z waypoint rows, keyed by
+// dimension key. Each route is a line through its waypoints in order with a
+// labelled marker at each. A route,name[,#rrggbb[,dimension]] row begins a
+// new route; waypoints before the first make an unnamed overworld route.
+// Waypoints without a height are at sea level, as lines of -markers are, so
+// their markers stay on the line. Lines starting with # are skipped.
+func ReadRoutes(path string) (markers map[string][]Marker, paths map[string][]Path, err error) {
+	routeFile, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer routeFile.Close()
+	
+	r := csv.NewReader(routeFile)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	
+	markers = make(map[string][]Marker)
+	paths = make(map[string][]Path)
+	overworld := dimensionDirs[0].Key
+	route, name, dim := Path{Color: routeColor}, "", overworld
+	end := func() {
+		if len(route.Points) != 0 {
+			paths[dim] = append(paths[dim], route)
+		}
+	}
+	
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		
+		if strings.TrimSpace(record[0]) == ROUTEROW {
+			end()
+			route, name, dim = Path{Color: routeColor}, "", overworld
+			if len(record) < 2 || len(record) > 4 {
+				return nil, nil, fmt.Errorf("%s: expected route,name[,#rrggbb[,dimension]], got %q", path, record)
+			}
+			name = strings.TrimSpace(record[1])
+			if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+				if route.Color, err = ParseHex(strings.TrimSpace(record[2])); err != nil {
+					return nil, nil, fmt.Errorf("%s: %s", path, err)
+				}
+			}
+			if len(record) > 3 {
+				if dim, err = ParseDimension(record[3]); err != nil {
+					return nil, nil, fmt.Errorf("%s: %s", path, err)
+				}
+			}
+			continue
+		}
+		
+		var coords []int
+		for _, field := range record[1:] {
+			v, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s", path, err)
+			}
+			coords = append(coords, v)
+		}
+		
+		m := Marker{Label: strings.TrimSpace(record[0]), Color: route.Color}
+		switch len(coords) {
+		case 2:
+			m.X, m.Y, m.Z = coords[0], PATHHEIGHT, coords[1]
+		case 3:
+			m.X, m.Y, m.Z = coords[0], coords[1], coords[2]
+		default:
+			return nil, nil, fmt.Errorf("%s: expected name,x,z or name,x,y,z, got %q", path, record)
+		}
+		// Routes are named at their first waypoint, whose label would cover
+		// a label of the line's own there.
+		if len(route.Points) == 0 {
+			m.Label = routeLabel(name, m.Label)
+		}
+		markers[dim] = append(markers[dim], m)
+		route.Points = append(route.Points, [3]int{m.X, m.Y, m.Z})
+	}
+	end()
+	return markers, paths, nil
+}
+
+func routeLabel(route, waypoint string) string {
+	switch {
+	case route == "":
+		return waypoint
+	case waypoint == "":
+		return route
+	}
+	return route + ": " + waypoint
+}
+
+// routeColor is for routes given no color of their own, apart from the
+// yellow of other markers.
+var routeColor = color.RGBA{0xE0, 0x40, 0x40, 0xFF}
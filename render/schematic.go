@@ -0,0 +1,148 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"sort"
+	"image"
+	"strings"
+	"image/png"
+)
+
+// A Schematic is an MCEdit or WorldEdit .schematic export. WorldEdit records
+// where the selection was copied from in WEOrigin, which lets a schematic
+// double as a crop of the world it came from.
+type Schematic struct {
+	Width, Height, Length int16
+	Materials string
+	Blocks []byte
+	Data []byte
+	WEOriginX, WEOriginY, WEOriginZ int32
+}
+
+func ReadSchematic(path string) (*Schematic, error) {
+	if isSelection(path) {
+		return nil, fmt.Errorf("%s: a selection holds no blocks to render, give it to -area to crop a world instead", path)
+	}
+	
+	s := new(Schematic)
+	if err := ReadNBTFile(path, s); err != nil {
+		return nil, err
+	}
+	
+	switch {
+	case s.Materials != "" && s.Materials != "Alpha":
+		return nil, fmt.Errorf("%s: unsupported materials %q", path, s.Materials)
+	case s.Width <= 0 || s.Length <= 0 || s.Height <= 0 || s.Height > 256:
+		return nil, fmt.Errorf("%s: invalid size %dx%dx%d", path, s.Width, s.Height, s.Length)
+	case len(s.Blocks) != s.Volume() || (s.Data != nil && len(s.Data) != s.Volume()):
+		return nil, fmt.Errorf("%s: expected %d blocks, found %d", path, s.Volume(), len(s.Blocks))
+	}
+	return s, nil
+}
+
+func (s *Schematic) Volume() int {
+	return int(s.Width) * int(s.Height) * int(s.Length)
+}
+
+// Area is the part of the world the schematic was copied from.
+func (s *Schematic) Area() Area {
+	x, z := int(s.WEOriginX), int(s.WEOriginZ)
+	return Area{X0: x, Z0: z, X1: x + int(s.Width) - 1, Z1: z + int(s.Length) - 1, Active: true}
+}
+
+// Levels lays the schematic's blocks out as chunks with their minimum corner
+// at the origin, so it can be drawn like any part of a world.
+func (s *Schematic) Levels() (levels PositionList) {
+	width, height, length := int(s.Width), int(s.Height), int(s.Length)
+	
+	for cz := 0; cz << 4 < length; cz++ {
+		for cx := 0; cx << 4 < width; cx++ {
+			level := Level{X: int32(cx), Z: int32(cz), TerrainPopulated: 1}
+			for sy := 0; sy << 4 < height; sy++ {
+				section := Section{Y: byte(sy), Blocks: make([]byte, 4096), Data: make([]byte, 2048)}
+				for y := 0; y < 16 && sy << 4 + y < height; y++ {
+					for z := 0; z < 16 && cz << 4 + z < length; z++ {
+						for x := 0; x < 16 && cx << 4 + x < width; x++ {
+							src := ((sy << 4 + y) * length + cz << 4 + z) * width + cx << 4 + x
+							dst := (y * 16 + z) * 16 + x
+							section.Blocks[dst] = s.Blocks[src]
+							if s.Data != nil {
+								section.Data[dst >> 1] |= (s.Data[src] & 0x0F) << (uint(dst & 1) << 2)
+							}
+						}
+					}
+				}
+				level.Sections = append(level.Sections, section)
+			}
+			levels = append(levels, level)
+		}
+	}
+	
+	sort.Sort(levels)
+	return
+}
+
+func isSchematic(s string) bool {
+	return strings.HasSuffix(strings.ToLower(s), ".schematic")
+}
+
+// isSelection matches MCEdit and Amulet .mcselection files.
+func isSelection(s string) bool {
+	return strings.HasSuffix(strings.ToLower(s), ".mcselection")
+}
+
+// RenderSchematic draws a schematic on its own, outside of any world.
+func RenderSchematic(args []string) error {
+	var (
+		inFilename, outFilename string
+		opts = Options{Modes: ModeList{IsometricMode{}}}
+	)
+	
+	flags := flag.NewFlagSet("schematic", flag.ContinueOnError)
+	flags.StringVar(&inFilename, "in", "", "Render this MCEdit or WorldEdit .schematic file.")
+	flags.StringVar(&outFilename, "out", IMGFILE, "Write the rendered image to this file.")
+	flags.Var(&opts.Modes, "mode", "Render in this mode (iso, xray, topdown).")
+	opts.Progress.Flags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	opts.Progress.Start()
+	
+	if inFilename == "" {
+		flags.Usage()
+		return usageError("schematic needs -in")
+	}
+	
+	schematic, err := ReadSchematic(inFilename)
+	if err != nil {
+		return fatalError("Error reading schematic: ", err)
+	}
+	
+	mode := opts.Modes[0]
+	levels := schematic.Levels()
+	
+	var bounds image.Rectangle
+	for _, l := range levels {
+		bounds = bounds.Union(mode.ChunkBounds(l.(Level)))
+	}
+	
+	img := image.NewRGBA(bounds)
+	neighbors := NewNeighborhood(levels)
+	for _, l := range levels {
+		mode.Draw(img, l.(Level), neighbors, &opts)
+	}
+	
+	outFile, err := os.Create(outFilename)
+	if err != nil {
+		return fatalError("Error creating image file: ", err)
+	}
+	defer outFile.Close()
+	if err := png.Encode(outFile, img); err != nil {
+		return fatalError("Error encoding image: ", err)
+	}
+	
+	opts.Progress.Printf("Rendered %dx%dx%d schematic: %+v", schematic.Width, schematic.Height, schematic.Length, bounds.Size())
+	return nil
+}
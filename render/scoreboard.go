@@ -0,0 +1,154 @@
+package render
+
+import (
+	"os"
+	"io"
+	"fmt"
+	"strconv"
+	"strings"
+	"encoding/csv"
+	"path/filepath"
+)
+
+const (
+	SCOREBOARDFILE = "data/scoreboard.dat"
+	PLAYERSDIR = "players"
+)
+
+type Scoreboard struct {
+	Objectives []Objective
+	PlayerScores []PlayerScore
+}
+
+type Objective struct {
+	Name string
+	DisplayName string
+	CriteriaName string
+}
+
+type PlayerScore struct {
+	Name string
+	Objective string
+	Score int32
+}
+
+type Player struct {
+	Pos []float64
+	Dimension int32
+	SpawnX, SpawnY, SpawnZ int32
+}
+
+// Home is the player's bed spawn if one is set, which is always in the
+// overworld, otherwise wherever they last logged out.
+func (p Player) Home() (dimension, x, y, z int, ok bool) {
+	if p.SpawnX != 0 || p.SpawnY != 0 || p.SpawnZ != 0 {
+		return 0, int(p.SpawnX), int(p.SpawnY), int(p.SpawnZ), true
+	}
+	if len(p.Pos) != 3 {
+		return 0, 0, 0, 0, false
+	}
+	return int(p.Dimension), Floor(p.Pos[0]), Floor(p.Pos[1]), Floor(p.Pos[2]), true
+}
+
+type Position struct {
+	Dimension, X, Y, Z int
+	Surface bool
+}
+
+// ReadPositions loads name,x,z or name,x,y,z rows, for example claim or town
+// centroids exported from a server plugin. Lines starting with # are skipped.
+func ReadPositions(path string) (map[string]Position, error) {
+	positionsFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer positionsFile.Close()
+	
+	r := csv.NewReader(positionsFile)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	
+	positions := make(map[string]Position)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		
+		var coords []int
+		for _, field := range record[1:] {
+			v, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", path, err)
+			}
+			coords = append(coords, v)
+		}
+		
+		switch len(coords) {
+		case 2:
+			positions[record[0]] = Position{0, coords[0], 0, coords[1], true}
+		case 3:
+			positions[record[0]] = Position{0, coords[0], coords[1], coords[2], false}
+		default:
+			return nil, fmt.Errorf("%s: expected name,x,z or name,x,y,z, got %q", path, record)
+		}
+	}
+	return positions, nil
+}
+
+// ScoreMarkers labels each scored player with their score for objective,
+// keyed by dimension key. Positions from positionsFile take precedence over
+// player files.
+func ScoreMarkers(dir, objective, positionsFile string) (map[string][]Marker, error) {
+	var scoreboard Scoreboard
+	if err := ReadNBTFile(filepath.Join(dir, SCOREBOARDFILE), &scoreboard); err != nil {
+		return nil, err
+	}
+	
+	displayName := ""
+	for _, o := range scoreboard.Objectives {
+		if o.Name == objective {
+			displayName = o.DisplayName
+		}
+	}
+	if displayName == "" {
+		return nil, fmt.Errorf("no objective named %q in %s", objective, SCOREBOARDFILE)
+	}
+	
+	positions := make(map[string]Position)
+	if positionsFile != "" {
+		var err error
+		if positions, err = ReadPositions(positionsFile); err != nil {
+			return nil, err
+		}
+	}
+	
+	markers := make(map[string][]Marker)
+	for _, score := range scoreboard.PlayerScores {
+		if score.Objective != objective {
+			continue
+		}
+		
+		pos, exists := positions[score.Name]
+		if !exists {
+			var player Player
+			if ReadNBTFile(filepath.Join(dir, PLAYERSDIR, score.Name + ".dat"), &player) != nil {
+				continue
+			}
+			
+			var ok bool
+			if pos.Dimension, pos.X, pos.Y, pos.Z, ok = player.Home(); !ok {
+				continue
+			}
+		}
+		
+		key, _ := DimensionKey(pos.Dimension)
+		label := fmt.Sprintf("%s: %d", score.Name, score.Score)
+		markers[key] = append(markers[key], Marker{Label: label, X: pos.X, Y: pos.Y, Z: pos.Z, Surface: pos.Surface, Player: score.Name})
+	}
+	return markers, nil
+}
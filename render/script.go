@@ -0,0 +1,143 @@
+package render
+
+import (
+	"fmt"
+	"sync"
+	"crypto/sha1"
+	"io/ioutil"
+	"image/color"
+	"go.starlark.net/syntax"
+	"go.starlark.net/starlark"
+)
+
+// SCRIPTFUNC is the function a -script must define.
+const SCRIPTFUNC = "color"
+
+// A ScriptShader colors blocks with the color function of a Starlark script,
+// called as color(block, data, biome, y, light) with the block's ID, data
+// value, biome ID (255 if unknown), height and the light above it. It
+// returns None to leave a block as it is, a "#rrggbb" string, or an
+// (r, g, b) or (r, g, b, alpha) tuple of 0-255 values.
+//
+// Starlark can't see the clock or anything random, so the color for each
+// set of arguments is only asked for once.
+type ScriptShader struct {
+	Filename string
+	Source []byte
+	
+	fn starlark.Value
+	threads sync.Pool
+	mu sync.RWMutex
+	results map[uint64]scriptResult
+	
+	// Failure is failed with the script's first error, ending the render.
+	Failure *Failure
+}
+
+type scriptResult struct {
+	c color.RGBA
+	set bool
+}
+
+func LoadScript(filename string) (*ScriptShader, error) {
+	source, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	
+	thread := &starlark.Thread{Name: filename}
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, filename, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := globals[SCRIPTFUNC].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s defines no %s function", filename, SCRIPTFUNC)
+	}
+	
+	s := &ScriptShader{Filename: filename, Source: source, fn: fn, results: make(map[uint64]scriptResult)}
+	s.threads.New = func() interface{} {
+		return &starlark.Thread{Name: filename}
+	}
+	return s, nil
+}
+
+// Version identifies the script, so -cache can tell when it's changed.
+func (s *ScriptShader) Version() string {
+	return fmt.Sprintf("%x", sha1.Sum(s.Source))
+}
+
+func (s *ScriptShader) Shade(b BlockContext, c BlockColor) BlockColor {
+	x, z := b.X & 15, b.Z & 15
+	data, biome := 0, BIOMEUNSET
+	if section := b.Sections[b.Y >> 4]; section != nil {
+		data = int(section.BlockData(x, b.Y & 15, z))
+	}
+	if len(b.Chunk.Biomes) == 256 {
+		biome = int(b.Chunk.Biomes[z << 4 + x])
+	}
+	light := b.Light()
+	
+	key := uint64(b.Block) | uint64(data) << 8 | uint64(biome) << 12 | uint64(uint16(b.Y)) << 20 | uint64(light) << 36
+	s.mu.RLock()
+	r, known := s.results[key]
+	s.mu.RUnlock()
+	if !known {
+		r = s.call(int(b.Block), data, biome, b.Y, light)
+		s.mu.Lock()
+		s.results[key] = r
+		s.mu.Unlock()
+	}
+	
+	if !r.set {
+		return c
+	}
+	top := color.RGBA{r.c.R, r.c.G, r.c.B, 0xFF}
+	c.Top, c.Left, c.Right, c.Alpha = top, top, lighten(top), r.c.A
+	return c
+}
+
+// call runs the script's color function, failing the render if it fails as
+// it would for every other block too.
+func (s *ScriptShader) call(args ...int) scriptResult {
+	thread := s.threads.Get().(*starlark.Thread)
+	defer s.threads.Put(thread)
+	
+	tuple := make(starlark.Tuple, len(args))
+	for i, arg := range args {
+		tuple[i] = starlark.MakeInt(arg)
+	}
+	v, err := starlark.Call(thread, s.fn, tuple, nil)
+	if err != nil {
+		s.Failure.Fail(fatalError("Error running script: ", err))
+		return scriptResult{}
+	}
+	
+	r, err := scriptColor(v)
+	s.Failure.Fail(fatalError("Error running script: ", err))
+	return r
+}
+
+func scriptColor(v starlark.Value) (scriptResult, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return scriptResult{}, nil
+	case starlark.String:
+		c, err := ParseHex(string(v))
+		return scriptResult{c, true}, err
+	case starlark.Tuple:
+		if len(v) != 3 && len(v) != 4 {
+			return scriptResult{}, fmt.Errorf("%s returned %d values, not (r, g, b) or (r, g, b, alpha)", SCRIPTFUNC, len(v))
+		}
+		rgba := []byte{0, 0, 0, 0xFF}
+		for i, component := range v {
+			n, err := starlark.AsInt32(component)
+			if err != nil || n < 0 || n > 0xFF {
+				return scriptResult{}, fmt.Errorf("%s returned %s, not a 0-255 color component", SCRIPTFUNC, component)
+			}
+			rgba[i] = byte(n)
+		}
+		return scriptResult{color.RGBA{rgba[0], rgba[1], rgba[2], rgba[3]}, true}, nil
+	}
+	return scriptResult{}, fmt.Errorf("%s returned %s, not None, a \"#rrggbb\" string or a tuple", SCRIPTFUNC, v)
+}
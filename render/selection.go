@@ -0,0 +1,173 @@
+package render
+
+import (
+	"fmt"
+	"bytes"
+	"strings"
+	"io/ioutil"
+	"encoding/json"
+)
+
+// A Selection is part of a world selected in MCEdit or Amulet and saved as
+// an .mcselection file. It has no blocks of its own, so it's only a crop.
+// The format isn't published, so boxes are read as each editor holds them:
+// MCEdit's BoundingBox as an Origin and a Size, and Amulet's SelectionGroup
+// as boxes of Min and Max corners with Max exclusive. The file can be
+// gzipped NBT, plain NBT or JSON. A file holding neither layout is an error,
+// not an empty crop.
+type Selection struct {
+	Boxes []SelectionBox
+}
+
+// A SelectionBox holds the blocks from Min up to but not including Max.
+type SelectionBox struct {
+	Min, Max [3]int
+}
+
+func ReadSelection(path string) (*Selection, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	
+	var root interface{}
+	switch trimmed := bytes.TrimSpace(raw); {
+	case len(raw) > 1 && raw[0] == 0x1F && raw[1] == 0x8B:
+		data, err := ReadNBTData(path)
+		if err != nil {
+			return nil, err
+		}
+		if root, err = ReadNBTTree(data); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	case len(raw) > 0 && raw[0] == TagCompound:
+		if root, err = ReadNBTTree(raw); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	case len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '['):
+		if err := json.Unmarshal(trimmed, &root); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: not NBT or JSON", path)
+	}
+	
+	s := new(Selection)
+	if err := s.add(root); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if len(s.Boxes) == 0 {
+		return nil, fmt.Errorf("%s: no selection found, expected Origin and Size, Min and Max, or a list of boxes", path)
+	}
+	return s, nil
+}
+
+// add appends the boxes in v: a compound with Origin and Size or Min and
+// Max, one wrapping them under any key, a list of x0,y0,z0,x1,y1,z1, or a
+// list of any of these.
+func (s *Selection) add(v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if origin, size, ok := pointPair(v, "origin", "size"); ok {
+			for i := range size {
+				size[i] += origin[i]
+			}
+			return s.addBox(origin, size)
+		}
+		if min, max, ok := pointPair(v, "min", "max"); ok {
+			return s.addBox(min, max)
+		}
+		for _, child := range v {
+			if err := s.add(child); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if corners, ok := ints(v); ok && len(corners) == 6 {
+			return s.addBox([3]int{corners[0], corners[1], corners[2]}, [3]int{corners[3], corners[4], corners[5]})
+		}
+		for _, child := range v {
+			if err := s.add(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Selection) addBox(min, max [3]int) error {
+	for i := range min {
+		if max[i] <= min[i] {
+			return fmt.Errorf("empty selection box from %v to %v", min, max)
+		}
+	}
+	s.Boxes = append(s.Boxes, SelectionBox{min, max})
+	return nil
+}
+
+// Area is the smallest area holding every box.
+func (s *Selection) Area() Area {
+	a := Area{X0: s.Boxes[0].Min[0], Z0: s.Boxes[0].Min[2], X1: s.Boxes[0].Max[0] - 1, Z1: s.Boxes[0].Max[2] - 1, Active: true}
+	for _, box := range s.Boxes[1:] {
+		a.X0, a.Z0 = Min(a.X0, box.Min[0]), Min(a.Z0, box.Min[2])
+		a.X1, a.Z1 = Max(a.X1, box.Max[0] - 1), Max(a.Z1, box.Max[2] - 1)
+	}
+	return a
+}
+
+// pointPair finds the points named a and b in m, ignoring case.
+func pointPair(m map[string]interface{}, a, b string) (pa, pb [3]int, ok bool) {
+	var va, vb interface{}
+	for key, v := range m {
+		switch {
+		case strings.EqualFold(key, a):
+			va = v
+		case strings.EqualFold(key, b):
+			vb = v
+		}
+	}
+	
+	na, okA := ints(va)
+	nb, okB := ints(vb)
+	if !okA || !okB || len(na) != 3 || len(nb) != 3 {
+		return pa, pb, false
+	}
+	copy(pa[:], na)
+	copy(pb[:], nb)
+	return pa, pb, true
+}
+
+// ints reads an NBT int array or a list of whole numbers from NBT or JSON.
+func ints(v interface{}) ([]int, bool) {
+	switch v := v.(type) {
+	case []int32:
+		n := make([]int, len(v))
+		for i := range v {
+			n[i] = int(v[i])
+		}
+		return n, true
+	case []interface{}:
+		n := make([]int, len(v))
+		for i, e := range v {
+			switch e := e.(type) {
+			case int8:
+				n[i] = int(e)
+			case int16:
+				n[i] = int(e)
+			case int32:
+				n[i] = int(e)
+			case int64:
+				n[i] = int(e)
+			case float64:
+				if e != float64(int(e)) {
+					return nil, false
+				}
+				n[i] = int(e)
+			default:
+				return nil, false
+			}
+		}
+		return n, true
+	}
+	return nil, false
+}
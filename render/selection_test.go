@@ -0,0 +1,88 @@
+package render
+
+import (
+	"os"
+	"bytes"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+	"compress/gzip"
+)
+
+func TestReadSelection(t *testing.T) {
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	w.Write(nbtRoot(
+		nbtTag(TagIntArray, "Origin", append(append(nbtInt(3), nbtInt(-3)...), append(nbtInt(0), nbtInt(-20)...)...)),
+		nbtTag(TagIntArray, "Size", append(append(nbtInt(3), nbtInt(10)...), append(nbtInt(5), nbtInt(4)...)...)),
+	))
+	w.Close()
+	
+	for _, test := range []struct {
+		name string
+		data []byte
+		area Area
+	}{
+		{"mcedit gzipped nbt", gzipped.Bytes(), Area{X0: -3, Z0: -20, X1: 6, Z1: -17, Active: true}},
+		{"mcedit json", []byte(`{"origin": [0, 0, 0], "size": [16, 256, 32]}`), Area{X0: 0, Z0: 0, X1: 15, Z1: 31, Active: true}},
+		{"amulet boxes", []byte(`{"boxes": [{"min": [0, 0, 0], "max": [10, 5, 10]}, {"min": [-5, 0, 20], "max": [0, 5, 30]}]}`), Area{X0: -5, Z0: 0, X1: 9, Z1: 29, Active: true}},
+		{"amulet corner lists", []byte(` [[1, 2, 3, 4, 5, 6]]`), Area{X0: 1, Z0: 3, X1: 3, Z1: 5, Active: true}},
+		{"plain nbt", nbtRoot(nbtTag(TagList, "Selection", nbtList(TagCompound, nbtCompound(
+			nbtTag(TagList, "Min", nbtList(TagInt, nbtInt(8), nbtInt(0), nbtInt(8))),
+			nbtTag(TagList, "Max", nbtList(TagInt, nbtInt(24), nbtInt(64), nbtInt(40))),
+		)))), Area{X0: 8, Z0: 8, X1: 23, Z1: 39, Active: true}},
+	} {
+		path := writeTemp(t, test.data)
+		s, err := ReadSelection(path)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if area := s.Area(); area != test.area {
+			t.Errorf("%s: area %+v, want %+v", test.name, area, test.area)
+		}
+	}
+}
+
+func TestReadSelectionErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		data []byte
+	}{
+		{"no boxes", []byte(`{"name": "build"}`)},
+		{"empty box", []byte(`{"min": [0, 0, 0], "max": [0, 5, 5]}`)},
+		{"fractional", []byte(`{"origin": [0.5, 0, 0], "size": [1, 1, 1]}`)},
+		{"not nbt or json", []byte("origin 0 0 0")},
+		{"truncated nbt", nbtRoot(nbtTag(TagIntArray, "Origin", nbtInt(3)))[:12]},
+	} {
+		if _, err := ReadSelection(writeTemp(t, test.data)); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
+
+func TestAreaSetSelection(t *testing.T) {
+	path := writeTemp(t, []byte(`{"origin": [-16, 0, 16], "size": [32, 10, 16]}`))
+	var a Area
+	if err := a.Set(path); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Area{X0: -16, Z0: 16, X1: 15, Z1: 31, Active: true}); a != want {
+		t.Errorf("area %+v, want %+v", a, want)
+	}
+}
+
+// writeTemp writes data to an .mcselection file removed after the test.
+func writeTemp(t *testing.T, data []byte) string {
+	dir, err := ioutil.TempDir("", "gocart-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	
+	path := filepath.Join(dir, "build.mcselection")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
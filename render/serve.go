@@ -0,0 +1,644 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"net"
+	"flag"
+	"sync"
+	"time"
+	"bytes"
+	"image"
+	_ "embed"
+	"strings"
+	"net/http"
+	"image/png"
+	"image/draw"
+	"crypto/sha1"
+	"io/ioutil"
+	"encoding/json"
+	"path/filepath"
+	"container/list"
+)
+
+const (
+	TILECACHESIZE = 4096
+	EVENTSPATH = "/events"
+	LEAFLETPATH = "/leaflet/"
+	
+	// The viewer pins this release by its hashes, so a -leaflet directory
+	// has to hold the same one.
+	LEAFLETURL = "https://unpkg.com/leaflet@1.9.4/dist/"
+)
+
+//go:embed viewer.html
+var viewerHTML []byte
+
+// An EncodedTile is a tile's PNG as served, with its ETag.
+type EncodedTile struct {
+	Data []byte
+	ETag string
+	Modified time.Time
+}
+
+func NewEncodedTile(data []byte, modified time.Time) *EncodedTile {
+	sum := sha1.Sum(data)
+	return &EncodedTile{data, fmt.Sprintf(`"%x"`, sum[:8]), modified}
+}
+
+// A tileLRU keeps the most recently served tiles in memory.
+type tileLRU struct {
+	mu sync.Mutex
+	size int
+	order *list.List
+	tiles map[string]*list.Element
+}
+
+type tileLRUEntry struct {
+	key string
+	tile *EncodedTile
+}
+
+func newTileLRU(size int) *tileLRU {
+	return &tileLRU{size: size, order: list.New(), tiles: make(map[string]*list.Element)}
+}
+
+func (c *tileLRU) Get(key string) (*EncodedTile, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	e, exists := c.tiles[key]
+	if !exists {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(tileLRUEntry).tile, true
+}
+
+func (c *tileLRU) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	if e, exists := c.tiles[key]; exists {
+		c.order.Remove(e)
+		delete(c.tiles, key)
+	}
+}
+
+func (c *tileLRU) Add(key string, tile *EncodedTile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	if e, exists := c.tiles[key]; exists {
+		e.Value = tileLRUEntry{key, tile}
+		c.order.MoveToFront(e)
+		return
+	}
+	
+	c.tiles[key] = c.order.PushFront(tileLRUEntry{key, tile})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.tiles, oldest.Value.(tileLRUEntry).key)
+	}
+}
+
+// A TileLayer is one way of drawing the map the viewer can switch between.
+type TileLayer struct {
+	Name string
+	Opts *Options
+}
+
+// TileLayers returns the surface as opts draws it, the caves beneath it and
+// the surface by night.
+func TileLayers(opts *Options) []TileLayer {
+	cave, night := *opts, *opts
+	cave.Underground = Underground{true, UNDERGROUNDDEPTH}
+	night.Night = true
+	return []TileLayer{{"surface", opts}, {"cave", &cave}, {"night", &night}}
+}
+
+// ViewerInfo tells the viewer how large the map is and how to turn its
+// pixels back into world coordinates.
+type ViewerInfo struct {
+	Mode string `json:"mode"`
+	Layers []string `json:"layers"`
+	TileSize int `json:"tile_size"`
+	Zooms int `json:"zooms"`
+	Width int `json:"width"`
+	Height int `json:"height"`
+	Transform PixelTransform `json:"transform"`
+	
+	// Live is set when the server watches the world or its players, and
+	// viewers can listen at EVENTSPATH for tiles to reload and players to
+	// move.
+	Live bool `json:"live"`
+	Players bool `json:"players"`
+	
+	// Dates are the backups viewers can go back to, oldest first, their
+	// tiles at /tiles/date/layer/z/x/y.png.
+	Dates []string `json:"dates,omitempty"`
+}
+
+// A TileDate is a backup the viewer can go back to, drawn like the live
+// world onto the same tiles. Archives are extracted the first time one of
+// its tiles is drawn.
+type TileDate struct {
+	Label string
+	Backup Backup
+	
+	mu sync.Mutex
+	regions PositionList
+	extracted bool
+}
+
+// Regions returns the backup's regions within area, extracting them into
+// dir if it's an archive.
+func (d *TileDate) Regions(dir string, area Area) (PositionList, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	
+	if d.extracted {
+		return d.regions, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	regions, err := d.Backup.Regions(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range regions {
+		if area.ContainsRegion(r.(Region)) {
+			d.regions = append(d.regions, r)
+		}
+	}
+	d.extracted = true
+	return d.regions, nil
+}
+
+// A TileServer serves a world as map tiles, layer/z/x/y from the top left as
+// web maps expect. Tiles at the most detailed zoom are rendered when first
+// asked for and those below are built from the four tiles they cover, every
+// one kept in Dir and the busiest held in memory as well. Backups in Dates
+// are served the same way, at date/layer/z/x/y.
+type TileServer struct {
+	Dir string
+	Mode Mode
+	Regions PositionList
+	Bounds image.Rectangle
+	Zooms int
+	MaxAge time.Duration
+	Opts *Options
+	Layers []TileLayer
+	Watch time.Duration
+	Events TileEvents
+	Dates []*TileDate
+	
+	// Leaflet is served from this directory if set, for servers that
+	// can't reach LEAFLETURL, and otherwise redirected there.
+	Leaflet string
+	
+	// With RCON set, players online in Dimension are polled from the
+	// running server for the viewer to show.
+	RCON, RCONPassword string
+	RCONInterval time.Duration
+	Dimension string
+	
+	// Renders share one pipeline, so only one runs at a time.
+	mu sync.Mutex
+	cache *tileLRU
+	
+	// Guards the fields below, which Status reads while tiles are drawn.
+	statusMu sync.Mutex
+	started time.Time
+	queued int
+	rendering *RenderStatus
+	renders map[string]RenderStatus
+	stats CacheStatus
+	corrupt map[string]bool
+	quarantined map[string]*QuarantinedRegion
+	
+	playersMu sync.Mutex
+	players []LivePlayer
+}
+
+// Filename is where tile z, x, y of layer is kept, for the live world if
+// date is nil.
+func (t *TileServer) Filename(date *TileDate, layer string, z, x, y int) string {
+	dir := t.Dir
+	if date != nil {
+		dir = filepath.Join(t.Dir, date.Label)
+	}
+	return filepath.Join(dir, t.Mode.Name(), layer, fmt.Sprint(z), fmt.Sprint(x), fmt.Sprintf("%d.png", y))
+}
+
+func (t *TileServer) Date(label string) (*TileDate, bool) {
+	for _, date := range t.Dates {
+		if date.Label == label {
+			return date, true
+		}
+	}
+	return nil, false
+}
+
+// regions returns the regions date is drawn from, or the live world's.
+func (t *TileServer) regions(date *TileDate) (PositionList, error) {
+	if date == nil {
+		return t.Regions, nil
+	}
+	return date.Regions(filepath.Join(t.Dir, date.Label, "regions"), t.Opts.Area)
+}
+
+// snapshotName names date, or the live world if nil, in status reports.
+func snapshotName(date *TileDate) string {
+	if date == nil {
+		return "live"
+	}
+	return date.Label
+}
+
+func (t *TileServer) count(hit bool) {
+	t.statusMu.Lock()
+	if hit {
+		t.stats.Hits++
+	} else {
+		t.stats.Misses++
+	}
+	t.statusMu.Unlock()
+}
+
+// wait counts a render waiting for the pipeline until it's taken.
+func (t *TileServer) wait() func() {
+	t.statusMu.Lock()
+	t.queued++
+	t.statusMu.Unlock()
+	
+	t.mu.Lock()
+	
+	t.statusMu.Lock()
+	t.queued--
+	t.statusMu.Unlock()
+	return t.mu.Unlock
+}
+
+func (t *TileServer) startRender(label string) {
+	t.statusMu.Lock()
+	t.rendering = &RenderStatus{Label: label, Started: time.Now()}
+	t.statusMu.Unlock()
+}
+
+// finishRender records the render in progress as date's latest and
+// quarantines the regions it found corrupt chunks in.
+func (t *TileServer) finishRender(date *TileDate, errs []ChunkError, err error) {
+	t.statusMu.Lock()
+	defer t.statusMu.Unlock()
+	
+	r := *t.rendering
+	r.Label = snapshotName(date)
+	r.Duration = time.Since(r.Started)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if t.renders == nil {
+		t.renders = make(map[string]RenderStatus)
+		t.corrupt = make(map[string]bool)
+		t.quarantined = make(map[string]*QuarantinedRegion)
+	}
+	t.renders[r.Label] = r
+	t.rendering = nil
+	
+	// Chunks are counted once however many tiles they were left out of.
+	for _, e := range errs {
+		chunk := fmt.Sprintf("%s/%s/%d,%d", r.Label, e.Region, e.X, e.Z)
+		if t.corrupt[chunk] {
+			continue
+		}
+		t.corrupt[chunk] = true
+		
+		region := r.Label + "/" + e.Region
+		q := t.quarantined[region]
+		if q == nil {
+			q = &QuarantinedRegion{Snapshot: r.Label, Region: e.Region}
+			t.quarantined[region] = q
+		}
+		q.Chunks++
+		q.Error = e.Err.Error()
+	}
+}
+
+// tileName names a tile in messages.
+func tileName(date *TileDate, layer string, z, x, y int) string {
+	if date != nil {
+		layer = date.Label + " " + layer
+	}
+	return fmt.Sprintf("%s tile %d/%d/%d", layer, z, x, y)
+}
+
+func (t *TileServer) Layer(name string) (TileLayer, bool) {
+	for _, layer := range t.Layers {
+		if layer.Name == name {
+			return layer, true
+		}
+	}
+	return TileLayer{}, false
+}
+
+func (t *TileServer) Info() ViewerInfo {
+	info := ViewerInfo{
+		Mode: t.Mode.Name(),
+		TileSize: TILESIZE,
+		Zooms: t.Zooms,
+		Width: t.Bounds.Dx(),
+		Height: t.Bounds.Dy(),
+		Transform: NewPixelTransform(t.Mode, &Output{ChunkBounds: t.Bounds}),
+		Live: t.Watch > 0 || t.RCON != "",
+		Players: t.RCON != "",
+	}
+	for _, layer := range t.Layers {
+		info.Layers = append(info.Layers, layer.Name)
+	}
+	for _, date := range t.Dates {
+		info.Dates = append(info.Dates, date.Label)
+	}
+	return info
+}
+
+// TileBounds returns the pixels of the full size map tile z, x, y covers and
+// how many times it's shrunk to fit a tile.
+func (t *TileServer) TileBounds(z, x, y int) (image.Rectangle, int) {
+	scale := 1 << uint(t.Zooms - 1 - z)
+	size := TILESIZE * scale
+	min := t.Bounds.Min.Add(image.Pt(x * size, y * size))
+	return image.Rectangle{min, min.Add(image.Pt(size, size))}, scale
+}
+
+// Tile returns tile z, x, y of layer on date, or the live world if nil, from
+// memory, from Dir or freshly drawn. Tiles off the edge of the map don't
+// exist.
+func (t *TileServer) Tile(date *TileDate, layer TileLayer, z, x, y int) (*EncodedTile, error) {
+	if z < 0 || z >= t.Zooms || x < 0 || y < 0 {
+		return nil, os.ErrNotExist
+	}
+	if bounds, _ := t.TileBounds(z, x, y); !bounds.Overlaps(t.Bounds) {
+		return nil, os.ErrNotExist
+	}
+	
+	filename := t.Filename(date, layer.Name, z, x, y)
+	if tile, cached := t.cache.Get(filename); cached {
+		t.count(true)
+		return tile, nil
+	}
+	
+	if stat, err := os.Stat(filename); err == nil {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		tile := NewEncodedTile(data, stat.ModTime())
+		t.cache.Add(filename, tile)
+		t.count(true)
+		return tile, nil
+	}
+	
+	t.count(false)
+	img, err := t.draw(date, layer, z, x, y)
+	if err != nil {
+		return nil, err
+	}
+	
+	buf := bytes.NewBuffer(nil)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	tile := NewEncodedTile(buf.Bytes(), time.Now())
+	
+	// Written under a temporary name so a partial tile is never served.
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filename + ".tmp", tile.Data, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(filename + ".tmp", filename); err != nil {
+		return nil, err
+	}
+	
+	t.cache.Add(filename, tile)
+	return tile, nil
+}
+
+func (t *TileServer) draw(date *TileDate, layer TileLayer, z, x, y int) (*image.RGBA, error) {
+	bounds, scale := t.TileBounds(z, x, y)
+	if scale == 1 {
+		defer t.wait()()
+		t.startRender(tileName(date, layer.Name, z, x, y))
+		all, err := t.regions(date)
+		if err != nil {
+			t.finishRender(date, nil, err)
+			return nil, err
+		}
+		
+		var regions PositionList
+		for _, r := range all {
+			if t.Mode.RegionBounds(r.(Region)).Overlaps(bounds) {
+				regions = append(regions, r)
+			}
+		}
+		
+		t.Opts.Progress.Debugf("Rendering %s from %d regions", tileName(date, layer.Name, z, x, y), len(regions))
+		img, errs := DrawFrame(regions, bounds, layer.Opts)
+		for _, chunkErr := range errs {
+			t.Opts.Progress.ChunkError(chunkErr)
+		}
+		t.finishRender(date, errs, nil)
+		return &image.RGBA{Pix: img.Pix, Stride: img.Stride, Rect: img.Rect.Sub(bounds.Min)}, nil
+	}
+	
+	quad := image.NewRGBA(image.Rect(0, 0, 2 * TILESIZE, 2 * TILESIZE))
+	for i := 0; i < 4; i++ {
+		dx, dy := i & 1, i >> 1
+		child, err := t.Tile(date, layer, z + 1, 2 * x + dx, 2 * y + dy)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		
+		img, err := png.Decode(bytes.NewReader(child.Data))
+		if err != nil {
+			return nil, err
+		}
+		draw.Draw(quad, img.Bounds().Add(image.Pt(dx * TILESIZE, dy * TILESIZE)), img, img.Bounds().Min, draw.Src)
+	}
+	return Downsample(quad, 2), nil
+}
+
+func (t *TileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(viewerHTML)
+		return
+	case "/map.json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.Info())
+		return
+	case EVENTSPATH:
+		t.Events.ServeHTTP(w, r)
+		return
+	case STATUSPATH:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.Status())
+		return
+	case "/players.json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.Players())
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, LEAFLETPATH) {
+		if t.Leaflet != "" {
+			http.StripPrefix(LEAFLETPATH, http.FileServer(http.Dir(t.Leaflet))).ServeHTTP(w, r)
+		} else {
+			http.Redirect(w, r, LEAFLETURL + strings.TrimPrefix(r.URL.Path, LEAFLETPATH), http.StatusFound)
+		}
+		return
+	}
+	
+	var (
+		z, x, y int
+		date *TileDate
+	)
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/tiles/"), "/", 2)
+	if d, exists := t.Date(parts[0]); exists && len(parts) == 2 {
+		date, parts = d, strings.SplitN(parts[1], "/", 2)
+	}
+	layer, exists := t.Layer(parts[0])
+	if len(parts) != 2 || !exists {
+		http.NotFound(w, r)
+		return
+	}
+	if _, err := fmt.Sscanf(parts[1], "%d/%d/%d.png", &z, &x, &y); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	
+	tile, err := t.Tile(date, layer, z, x, y)
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		t.Opts.Progress.Errorf("Error rendering %s: %s", tileName(date, layer.Name, z, x, y), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(t.MaxAge.Seconds())))
+	w.Header().Set("ETag", tile.ETag)
+	http.ServeContent(w, r, "", tile.Modified, bytes.NewReader(tile.Data))
+}
+
+// ServeTiles serves a world as map tiles at /tiles/layer/z/x/y.png, rendering
+// each as it's first asked for, with a viewer for them at / and its status at
+// STATUSPATH. Given backups, the viewer gets a time slider to go back to them.
+func ServeTiles(args []string) error {
+	var (
+		dir, listen, pattern string
+		cacheSize int
+		t = TileServer{Opts: &Options{Labels: DefaultTextStyle, Modes: ModeList{IsometricMode{}}}}
+	)
+	
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.StringVar(&dir, "dir", DIR, "Serve the world at this directory.")
+	flags.StringVar(&t.Dir, "out", "tiles", "Keep rendered tiles in this directory, by mode, layer, zoom, x and y, and those of backups under their date.")
+	flags.StringVar(&listen, "listen", "localhost:8080", "Serve the viewer and tiles on this address.")
+	flags.Var(&t.Opts.Modes, "mode", "Render tiles in this mode (iso, xray, surface, topdown).")
+	flags.Var(&t.Opts.Area, "area", "Only render blocks within x0,z0,x1,z1 (world coordinates).")
+	flags.DurationVar(&t.MaxAge, "max-age", time.Hour, "Let browsers and proxies reuse tiles for this long without asking again.")
+	flags.IntVar(&cacheSize, "cache", TILECACHESIZE, "Keep this many encoded tiles in memory.")
+	flags.StringVar(&pattern, "backups", "", "Let the viewer go back to each world backup (directory, .tar or .tar.gz) matching this pattern, rendering a date's tiles as they're first asked for.")
+	flags.DurationVar(&t.Watch, "watch", 0, "Check the world for saved chunks this often, redrawing their tiles and updating open viewers (0 to never check).")
+	flags.StringVar(&t.RCON, "rcon", "", "Show online players live, asking the Minecraft server at this host:port over RCON where they are.")
+	flags.StringVar(&t.RCONPassword, "rcon-password", "", "Log in to RCON with this password. Defaults to $GOCART_RCON_PASSWORD, which unlike a flag isn't visible to other users.")
+	flags.DurationVar(&t.RCONInterval, "rcon-interval", RCONINTERVAL, "Ask the server where players are this often.")
+	flags.StringVar(&t.Leaflet, "leaflet", "", "Serve the viewer's copy of Leaflet 1.9.4 (leaflet.js, leaflet.css and images/) from this directory instead of " + LEAFLETURL + ", for servers without internet access.")
+	t.Opts.Progress.Flags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	
+	// Read only now, so -h can't show it as the flag's default.
+	if t.RCONPassword == "" {
+		t.RCONPassword = os.Getenv("GOCART_RCON_PASSWORD")
+	}
+	
+	t.Opts.Auto()
+	t.Opts.Progress.Start()
+	t.started = time.Now()
+	t.Opts.Modes = t.Opts.Modes[:1]
+	t.Mode = t.Opts.Modes[0]
+	t.cache = newTileLRU(Max(cacheSize, 1))
+	t.Layers = TileLayers(t.Opts)
+	
+	dimensions, err := FindDimensions(dir, "", false, t.Opts.Modes)
+	if err != nil {
+		return err
+	}
+	dimension := dimensions[0]
+	if err := dimension.Glob(0, t.Opts); err != nil {
+		return err
+	}
+	if len(dimension.Regions) == 0 {
+		return exitError(ExitNoRegions, "Error reading world: ", fmt.Errorf("no region files found in %s", dir))
+	}
+	t.Regions = dimension.Regions
+	t.Dimension = dimension.Key
+	t.Bounds = dimension.Outputs[0].Bounds
+	
+	if pattern != "" {
+		backups, err := FindBackups(pattern)
+		if err != nil {
+			return fatalError("Error finding backups: ", err)
+		}
+		
+		// Tiles line up across dates only if every date shares the bounds.
+		bounds, err := BackupBounds(backups, t.Mode, t.Opts.Area)
+		if err != nil {
+			return fatalError("Error listing backup: ", err)
+		}
+		t.Bounds = t.Bounds.Union(bounds)
+		
+		// Backups sharing a date share tiles; the last one sorted wins.
+		for _, backup := range backups {
+			if date, exists := t.Date(backup.Label); exists {
+				date.Backup = backup
+				continue
+			}
+			t.Dates = append(t.Dates, &TileDate{Label: backup.Label, Backup: backup})
+		}
+	}
+	t.Zooms = PyramidLevels(t.Bounds, TILESIZE)
+	
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return fatalError("Error creating tile directory: ", err)
+	}
+	if t.Watch > 0 {
+		go t.WatchRegions()
+	}
+	if t.RCON != "" {
+		if t.RCONInterval <= 0 {
+			t.RCONInterval = RCONINTERVAL
+		}
+		go t.PollPlayers()
+	}
+	
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fatalError("Error starting web server: ", err)
+	}
+	t.Opts.Progress.Printf("Serving %d zoom levels of tiles and %d backups at http://%s/ (Ctrl+C to stop)", t.Zooms, len(t.Dates), listener.Addr())
+	return fatalError("Error serving tiles: ", http.Serve(listener, &t))
+}
@@ -0,0 +1,62 @@
+package render
+
+import (
+	"image/color"
+)
+
+// A BlockContext is what a BlockShader is told of the block it's coloring,
+// at X, Y, Z in world coordinates, with the chunks around it in Neighbors.
+type BlockContext struct {
+	Chunk *Level
+	Sections [16]*Section
+	Block byte
+	X, Y, Z int
+	Neighbors Neighborhood
+}
+
+// Light is the light level of the block above, which its top face sees.
+func (b BlockContext) Light() int {
+	return LightAt(b.Sections, b.X & 15, b.Y + 1, b.Z & 15)
+}
+
+// A BlockShader adjusts the color of each block isometric and top-down modes
+// draw, after water, fading, jitter and shadows and before x-ray.
+type BlockShader interface {
+	Shade(b BlockContext, c BlockColor) BlockColor
+}
+
+// A ShaderFunc is a BlockShader written as a function.
+type ShaderFunc func(b BlockContext, c BlockColor) BlockColor
+
+func (f ShaderFunc) Shade(b BlockContext, c BlockColor) BlockColor {
+	return f(b, c)
+}
+
+// BlockShaders returns the shaders the options ask for, -script and those
+// built in before any in Shaders.
+func (c *Options) BlockShaders() (shaders []BlockShader) {
+	if c.Script != nil {
+		shaders = append(shaders, c.Script)
+	}
+	if c.Night {
+		shaders = append(shaders, NightShader{})
+	}
+	if c.UnpopulatedTint.A != 0 {
+		shaders = append(shaders, UnpopulatedShader{Tint: color.RGBA(c.UnpopulatedTint)})
+	}
+	if c.SpawnLight {
+		shaders = append(shaders, SpawnLightShader{})
+	}
+	if c.Theme == ThemeParchment {
+		shaders = append(shaders, ParchmentShader{})
+	}
+	return append(shaders, c.Shaders...)
+}
+
+// Shade passes c through each shader in turn.
+func Shade(shaders []BlockShader, b BlockContext, c BlockColor) BlockColor {
+	for _, shader := range shaders {
+		c = shader.Shade(b, c)
+	}
+	return c
+}
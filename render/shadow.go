@@ -0,0 +1,69 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"image/color"
+)
+
+const (
+	// Shadows are cast by terrain at most this many blocks away.
+	SHADOWDISTANCE = 64
+	SHADOWALPHA = 0x60
+)
+
+var (
+	DefaultSun = Sun{315, 35}
+	shadowColor = color.RGBA{0x10, 0x10, 0x28, 0xff}
+)
+
+// Sun is the direction shadows are cast from: a compass bearing in degrees
+// clockwise from north (-z) and an elevation in degrees above the horizon.
+type Sun struct {
+	Azimuth, Elevation float64
+}
+
+func (s *Sun) String() string {
+	return fmt.Sprintf("%g,%g", s.Azimuth, s.Elevation)
+}
+
+func (s *Sun) Set(v string) error {
+	var azimuth, elevation float64
+	if _, err := fmt.Sscanf(v, "%g,%g", &azimuth, &elevation); err != nil {
+		return fmt.Errorf("expected azimuth,elevation: %s", err)
+	}
+	if elevation <= 0 || elevation > 90 {
+		return fmt.Errorf("elevation must be above 0 and at most 90 degrees")
+	}
+	*s = Sun{azimuth, elevation}
+	return nil
+}
+
+// Shadowed steps from the top of the block at x, y, z toward the sun one
+// block at a time and reports whether any column's height map rises above
+// the ray. Columns outside the neighborhood are taken to cast no shadow.
+func (s Sun) Shadowed(n Neighborhood, x, y, z int) bool {
+	azimuth, elevation := s.Azimuth * math.Pi / 180, s.Elevation * math.Pi / 180
+	dx, dz, dy := math.Sin(azimuth), -math.Cos(azimuth), math.Tan(elevation)
+	
+	px, py, pz := float64(x) + 0.5, float64(y + 1), float64(z) + 0.5
+	for step := 0; step < SHADOWDISTANCE && py < 256; step++ {
+		px, py, pz = px + dx, py + dy, pz + dz
+		
+		height, ok := n.Height(Floor(px), Floor(pz))
+		if !ok {
+			return false
+		}
+		if float64(height) > py {
+			return true
+		}
+	}
+	return false
+}
+
+func ShadowBlock(c BlockColor) BlockColor {
+	c.Top = Blend(c.Top, shadowColor, SHADOWALPHA)
+	c.Left = Blend(c.Left, shadowColor, SHADOWALPHA)
+	c.Right = Blend(c.Right, shadowColor, SHADOWALPHA)
+	return c
+}
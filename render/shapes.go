@@ -0,0 +1,96 @@
+package render
+
+// builtinShapes approximates the common blocks that aren't whole cubes, in
+// the same sixteenths as -palette shapes, which replace them state by state.
+// Shapes can't see neighboring blocks, so fences, walls and panes are drawn
+// as lone posts, and the upper halves of doors, which don't record which way
+// they face, as if facing east.
+func builtinShapes() map[BlockState]Shape {
+	shapes := make(map[BlockState]Shape)
+	all := func(id byte, shape ...Box) {
+		shapes[BlockState{id, -1}] = shape
+	}
+	each := func(id byte, shape func(data int) Shape) {
+		for data := 0; data < 16; data++ {
+			shapes[BlockState{id, data}] = shape(data)
+		}
+	}
+
+	// Slabs fill the top half with data bit 8.
+	slab := func(data int) Shape {
+		if data & 8 != 0 {
+			return Shape{{0, 8, 0, 16, 16, 16}}
+		}
+		return Shape{{0, 0, 0, 16, 8, 16}}
+	}
+	each(0x2C, slab)
+	each(0x7E, slab)
+
+	// Stairs ascend east, west, south or north, upside down with bit 4.
+	stairs := func(data int) Shape {
+		step := [4]Box{{8, 0, 0, 16, 16, 16}, {0, 0, 0, 8, 16, 16}, {0, 0, 8, 16, 16, 16}, {0, 0, 0, 16, 16, 8}}[data & 3]
+		if data & 4 != 0 {
+			step[4] = 8
+			return Shape{{0, 8, 0, 16, 16, 16}, step}
+		}
+		step[1] = 8
+		return Shape{{0, 0, 0, 16, 8, 16}, step}
+	}
+	for _, id := range []byte{0x35, 0x43, 0x6C, 0x6D, 0x72, 0x80, 0x86, 0x87, 0x88, 0x9C} {
+		each(id, stairs)
+	}
+
+	// Doors stand against the side opposite the way they face.
+	door := func(data int) Shape {
+		if data & 8 != 0 {
+			return Shape{{0, 0, 0, 3, 16, 16}}
+		}
+		return Shape{[4]Box{{0, 0, 0, 3, 16, 16}, {0, 0, 0, 16, 16, 3}, {13, 0, 0, 16, 16, 16}, {0, 0, 13, 16, 16, 16}}[data & 3]}
+	}
+	each(0x40, door)
+	each(0x47, door)
+
+	// Trapdoors lie in the bottom or, with bit 8, top of the block, or
+	// stand against their hinge when open.
+	each(0x60, func(data int) Shape {
+		if data & 4 != 0 {
+			return Shape{[4]Box{{0, 0, 13, 16, 16, 16}, {0, 0, 0, 16, 16, 3}, {13, 0, 0, 16, 16, 16}, {0, 0, 0, 3, 16, 16}}[data & 3]}
+		}
+		if data & 8 != 0 {
+			return Shape{{0, 13, 0, 16, 16, 16}}
+		}
+		return Shape{{0, 0, 0, 16, 3, 16}}
+	})
+
+	each(0x6B, func(data int) Shape {
+		if data & 1 == 0 {
+			return Shape{{0, 5, 7, 16, 16, 9}}
+		}
+		return Shape{{7, 5, 0, 9, 16, 16}}
+	})
+
+	// Snow lies in layers two sixteenths deep.
+	each(0x4E, func(data int) Shape {
+		return Shape{{0, 0, 0, 16, 2 * (data & 7 + 1), 16}}
+	})
+
+	all(0x55, Box{6, 0, 6, 10, 16, 10})
+	all(0x71, Box{6, 0, 6, 10, 16, 10})
+	all(0x8B, Box{4, 0, 4, 12, 16, 12})
+	all(0x65, Box{7, 0, 7, 9, 16, 9})
+	all(0x66, Box{7, 0, 7, 9, 16, 9})
+	all(0xAB, Box{0, 0, 0, 16, 1, 16})
+	all(0x6F, Box{0, 0, 0, 16, 1, 16})
+	all(0x46, Box{1, 0, 1, 15, 1, 15})
+	all(0x48, Box{1, 0, 1, 15, 1, 15})
+	all(0x5D, Box{0, 0, 0, 16, 2, 16})
+	all(0x5E, Box{0, 0, 0, 16, 2, 16})
+	all(0x1A, Box{0, 0, 0, 16, 9, 16})
+	all(0x5C, Box{1, 0, 1, 15, 8, 15})
+	all(0x36, Box{1, 0, 1, 15, 14, 15})
+	all(0x74, Box{0, 0, 0, 16, 12, 16})
+	all(0x78, Box{0, 0, 0, 16, 13, 16})
+	all(0x3C, Box{0, 0, 0, 16, 15, 16})
+	all(0x51, Box{1, 0, 1, 15, 16, 15})
+	return shapes
+}
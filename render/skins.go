@@ -0,0 +1,206 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"image"
+	"strings"
+	"net/http"
+	"image/png"
+	"image/draw"
+	"encoding/json"
+	"path/filepath"
+	"encoding/base64"
+)
+
+const (
+	PROFILEURL = "https://api.mojang.com/users/profiles/minecraft/"
+	SESSIONURL = "https://sessionserver.mojang.com/session/minecraft/profile/"
+	
+	// SKINMAXAGE is how long cached heads are used before being fetched
+	// again, in case players changed their skins.
+	SKINMAXAGE = 24 * time.Hour
+	DefaultSkinTimeout = 5 * time.Second
+)
+
+// A SkinCache fetches players' heads from their Mojang skins, keeping them
+// as 8x8 images in Dir.
+type SkinCache struct {
+	Dir string
+	Client http.Client
+}
+
+func NewSkinCache(dir string, timeout time.Duration) (*SkinCache, error) {
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(cacheDir, "gocart", "skins")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &SkinCache{Dir: dir, Client: http.Client{Timeout: timeout}}, nil
+}
+
+// Head returns the face of a player's skin with their hat over it. Once
+// cached, a head is reused for SKINMAXAGE, and for longer if the player's
+// skin can't be fetched again.
+func (s *SkinCache) Head(name string) (*image.RGBA, error) {
+	path := filepath.Join(s.Dir, strings.ToLower(name) + ".png")
+	cached, cacheErr := readHead(path)
+	if info, err := os.Stat(path); cacheErr == nil && err == nil && time.Since(info.ModTime()) < SKINMAXAGE {
+		return cached, nil
+	}
+	
+	head, err := s.fetchHead(name)
+	if err != nil {
+		if cacheErr == nil {
+			return cached, nil
+		}
+		return nil, err
+	}
+	
+	f, err := os.Create(path)
+	if err != nil {
+		return head, nil
+	}
+	defer f.Close()
+	png.Encode(f, head)
+	return head, nil
+}
+
+func readHead(path string) (*image.RGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	head := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(head, head.Bounds(), img, img.Bounds().Min, draw.Src)
+	return head, nil
+}
+
+func (s *SkinCache) getJSON(url string, v interface{}) error {
+	resp, err := s.Client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (s *SkinCache) fetchHead(name string) (*image.RGBA, error) {
+	var profile struct {
+		ID string
+	}
+	if err := s.getJSON(PROFILEURL + name, &profile); err != nil {
+		return nil, err
+	}
+	
+	var session struct {
+		Properties []struct {
+			Name, Value string
+		}
+	}
+	if err := s.getJSON(SESSIONURL + profile.ID, &session); err != nil {
+		return nil, err
+	}
+	
+	var textures struct {
+		Textures struct {
+			SKIN struct {
+				URL string
+			}
+		}
+	}
+	for _, property := range session.Properties {
+		if property.Name != "textures" {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(property.Value)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &textures); err != nil {
+			return nil, err
+		}
+	}
+	if textures.Textures.SKIN.URL == "" {
+		return nil, fmt.Errorf("%s has no skin", name)
+	}
+	
+	resp, err := s.Client.Get(textures.Textures.SKIN.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", textures.Textures.SKIN.URL, resp.Status)
+	}
+	skin, err := png.Decode(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return SkinHead(skin), nil
+}
+
+// SkinHead cuts the face out of a skin and draws the hat layer over it.
+// Old 64x32 skins often fill the hat with solid color where it's unused,
+// so, as Minecraft does, a hat without any transparency there is left off.
+func SkinHead(skin image.Image) *image.RGBA {
+	head := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	origin := skin.Bounds().Min
+	draw.Draw(head, head.Bounds(), skin, origin.Add(image.Pt(8, 8)), draw.Src)
+	
+	hat := origin.Add(image.Pt(40, 8))
+	if skin.Bounds().Dy() < 64 {
+		opaque := true
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				if _, _, _, a := skin.At(hat.X + x, hat.Y + y).RGBA(); a != 0xFFFF {
+					opaque = false
+				}
+			}
+		}
+		if opaque {
+			return head
+		}
+	}
+	draw.Draw(head, head.Bounds(), skin, hat, draw.Over)
+	return head
+}
+
+// AddHeads gives each player's markers their head, leaving those whose
+// skins can't be found as dots.
+func (s *SkinCache) AddHeads(markers map[string][]Marker, progress *Progress) {
+	heads := make(map[string]*image.RGBA)
+	for _, dimension := range markers {
+		for i, m := range dimension {
+			if m.Player == "" {
+				continue
+			}
+			head, fetched := heads[m.Player]
+			if !fetched {
+				var err error
+				if head, err = s.Head(m.Player); err != nil {
+					progress.Warnf("No head for %s: %s", m.Player, err)
+				}
+				heads[m.Player] = head
+			}
+			dimension[i].Icon = head
+		}
+	}
+}
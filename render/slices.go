@@ -0,0 +1,64 @@
+package render
+
+import (
+	"fmt"
+)
+
+// A Band limits a mode to blocks from Y0 up to but not including Y1. The zero
+// Band draws every height.
+type Band struct {
+	Y0, Y1 int
+}
+
+// Bands splits the height of the world into steps of step blocks.
+func Bands(step int) (bands []Band) {
+	for y := 0; y < 256; y += step {
+		bands = append(bands, Band{y, Min(y + step, 256)})
+	}
+	return
+}
+
+func (b Band) Limits() (int, int) {
+	if b == (Band{}) {
+		return 0, 256
+	}
+	return b.Y0, b.Y1
+}
+
+func (b Band) Contains(y int) bool {
+	y0, y1 := b.Limits()
+	return y >= y0 && y < y1
+}
+
+// suffix distinguishes the names of modes drawing different bands.
+func (b Band) suffix() string {
+	if b == (Band{}) {
+		return ""
+	}
+	return fmt.Sprintf("_y%d-%d", b.Y0, b.Y1 - 1)
+}
+
+// Slice replaces each mode with one per band of step heights, so every band
+// is drawn to its own image from the same pass over the world.
+func (ml ModeList) Slice(step int) (sliced ModeList) {
+	for _, mode := range ml {
+		// Biomes and chunk-wide heatmaps don't change with height, and elevation
+		// maps are of the whole column.
+		switch mode.(type) {
+		case BiomeMode, InhabitedMode, AgeMode, ElevationMode:
+			sliced = append(sliced, mode)
+			continue
+		}
+		for _, band := range Bands(step) {
+			switch m := mode.(type) {
+			case IsometricMode:
+				m.Band = band
+				sliced = append(sliced, m)
+			case TopDownMode:
+				m.Band = band
+				sliced = append(sliced, m)
+			}
+		}
+	}
+	return
+}
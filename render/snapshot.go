@@ -0,0 +1,107 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"bytes"
+	"path/filepath"
+)
+
+const (
+	// SESSIONLOCK is the file a running game or server holds locked in
+	// the world it has open.
+	SESSIONLOCK = "session.lock"
+	
+	// LIVERETRIES is how many times a chunk is read again after a running
+	// server moved or rewrote it while it was being read.
+	LIVERETRIES = 3
+)
+
+// Source is the file the region's chunks are read from: its snapshot, if
+// one was taken, or the region file itself.
+func (r Region) Source() string {
+	if r.Snapshot != "" {
+		return r.Snapshot
+	}
+	return r.Path
+}
+
+// SnapshotRegions copies the region files into dir, along with the external
+// chunks beside them, and reads them from there, so a server saving the
+// world can't change them mid-render. Copies keep the originals' times for
+// -cache to compare.
+func SnapshotRegions(regions PositionList, dir string) error {
+	targets := make(map[string]string)
+	for i, r := range regions {
+		region := r.(Region)
+		source := filepath.Dir(region.Path)
+		target, copied := targets[source]
+		if !copied {
+			target = filepath.Join(dir, fmt.Sprint(len(targets)))
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			external, _ := filepath.Glob(filepath.Join(source, "c.*.mcc"))
+			for _, path := range external {
+				if err := copyFile(path, filepath.Join(target, filepath.Base(path))); err != nil {
+					return err
+				}
+			}
+			targets[source] = target
+		}
+		
+		region.Snapshot = filepath.Join(target, filepath.Base(region.Path))
+		if err := copyFile(region.Path, region.Snapshot); err != nil {
+			return err
+		}
+		regions[i] = region
+	}
+	return nil
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	
+	stat, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(to, stat.ModTime(), stat.ModTime())
+}
+
+// rereadLocation reads where the region file's header now puts chunk i and
+// when it was saved, reporting false if that can't be followed.
+func rereadLocation(regionFile *os.File, i int) (Location, int32, bool) {
+	var location Location
+	stat, err := regionFile.Stat()
+	if err != nil {
+		return location, 0, false
+	}
+	
+	// Timestamps follow the DIM locations, each entry 4 bytes.
+	entry := make([]byte, 4)
+	if _, err := regionFile.ReadAt(entry, int64(i) << 2); err != nil {
+		return location, 0, false
+	}
+	location.Read(bytes.NewReader(entry))
+	if _, err := regionFile.ReadAt(entry, int64(DIM + i) << 2); err != nil {
+		return location, 0, false
+	}
+	return location, int32(big.Uint32(entry)), location.Valid(stat.Size())
+}
@@ -0,0 +1,63 @@
+package render
+
+import (
+	"image/color"
+)
+
+const (
+	// SPAWNLIGHT is the most block light hostile mobs spawn in at night.
+	SPAWNLIGHT = 7
+	SPAWNALPHA = 0x90
+)
+
+var (
+	unlitColor = color.RGBA{0xE0, 0x10, 0x10, 0xFF}
+	dimColor = color.RGBA{0xF0, 0xD0, 0x10, 0xFF}
+)
+
+// CanSpawnOn reports whether hostile mobs could stand on the block at
+// chunk-local x and z and world height y: a whole opaque cube other than
+// leaves, with two blocks of room above that aren't solid or water.
+func CanSpawnOn(sections [16]*Section, x, y, z int) bool {
+	block := BlockAt(sections, x, y, z)
+	if c, exists := blockColors[block]; !exists || c.Alpha != 0xFF || !c.Full || block == 0x12 || block == 0xA1 {
+		return false
+	}
+	if _, shaped := ShapeOf(block, int(sections[y >> 4].BlockData(x, y & 15, z))); shaped {
+		return false
+	}
+	
+	for dy := 1; dy <= 2; dy++ {
+		above := BlockAt(sections, x, y + dy, z)
+		if c, exists := blockColors[above]; exists && c.Alpha == 0xFF && c.Full || IsWater(above) {
+			return false
+		}
+	}
+	return true
+}
+
+// SpawnLight marks the top of a block mobs could spawn on when the block
+// light above it is too low to stop them: red where there's none at all,
+// yellow where there's some but not enough. Sky light isn't counted, so it
+// shows where they spawn at night.
+func SpawnLight(c BlockColor, light int) BlockColor {
+	if light > SPAWNLIGHT {
+		return c
+	}
+	mark := dimColor
+	if light == 0 {
+		mark = unlitColor
+	}
+	c.Top = Blend(c.Top, mark, SPAWNALPHA)
+	return c
+}
+
+// SpawnLightShader marks where mobs could spawn, as -spawn-light does.
+type SpawnLightShader struct{}
+
+func (SpawnLightShader) Shade(b BlockContext, c BlockColor) BlockColor {
+	if !CanSpawnOn(b.Sections, b.X & 15, b.Y, b.Z & 15) {
+		return c
+	}
+	return SpawnLight(c, b.Light())
+}
@@ -0,0 +1,99 @@
+package render
+
+import (
+	"image"
+	"image/color"
+)
+
+// A Sprite is a BlockColor rasterized once the way DrawBlock draws it: four
+// pixels wide and three tall from x - 2, y, each row either fully covered by
+// a face or left alone. Opaque rows are copied straight into the image;
+// translucent ones are blended over it exactly as draw.DrawMask would with
+// a uniform mask of the block's alpha.
+type Sprite struct {
+	Opaque bool
+	First int
+	Pix [3][16]byte
+	
+	// For translucent sprites, each covered pixel's channels premultiplied
+	// by the mask, and how much of what's beneath survives.
+	over [3][16]uint32
+	keep [3][4]uint32
+}
+
+func NewSprite(c BlockColor) *Sprite {
+	s := &Sprite{Opaque: c.Alpha == 0xFF}
+	t, l, r := c.Top, c.Left, c.Right
+	rows := [3][4]color.RGBA{{t, t, t, t}, {l, l, r, r}, {l, l, r, r}}
+	if !c.Full {
+		rows = [3][4]color.RGBA{{}, {t, t, t, t}, {l, l, r, r}}
+		s.First = 1
+	}
+	
+	const m = 0xFFFF
+	ma := uint32(c.Alpha) * 0x101
+	for row := s.First; row < 3; row++ {
+		for col, p := range rows[row] {
+			copy(s.Pix[row][col * 4:], []byte{p.R, p.G, p.B, p.A})
+			
+			for k, v := range []byte{p.R, p.G, p.B, p.A} {
+				s.over[row][col * 4 + k] = uint32(v) * 0x101 * ma
+			}
+			s.keep[row][col] = (m - uint32(p.A) * 0x101 * ma / m) * 0x101
+		}
+	}
+	return s
+}
+
+// Draw paints the sprite at x, y, clipped to the image.
+func (s *Sprite) Draw(img *image.RGBA, x, y int) {
+	s.DrawFaces(img, x, y, true, true)
+}
+
+// DrawFaces paints only the top row, the side rows or both.
+func (s *Sprite) DrawFaces(img *image.RGBA, x, y int, top, sides bool) {
+	c0, c1 := Max(0, img.Rect.Min.X - (x - 2)), Min(4, img.Rect.Max.X - (x - 2))
+	if c0 >= c1 {
+		return
+	}
+	
+	const m = 0xFFFF
+	for row := s.First; row < 3; row++ {
+		if row == s.First && !top || row != s.First && !sides {
+			continue
+		}
+		if y + row < img.Rect.Min.Y || y + row >= img.Rect.Max.Y {
+			continue
+		}
+		
+		i := img.PixOffset(x - 2 + c0, y + row)
+		if s.Opaque {
+			copy(img.Pix[i:], s.Pix[row][c0 * 4 : c1 * 4])
+			continue
+		}
+		for col := c0; col < c1; col, i = col + 1, i + 4 {
+			d := img.Pix[i : i + 4 : i + 4]
+			a := s.keep[row][col]
+			for k := range d {
+				d[k] = uint8((uint32(d[k]) * a + s.over[row][col * 4 + k]) / m >> 8)
+			}
+		}
+	}
+}
+
+// Sprites rasterizes each BlockColor the first time it's drawn. It isn't
+// safe for concurrent use, so each drawer keeps its own.
+type Sprites map[BlockColor]*Sprite
+
+func (s Sprites) Draw(img *image.RGBA, x, y int, c BlockColor) {
+	s.DrawFaces(img, x, y, c, true, true)
+}
+
+func (s Sprites) DrawFaces(img *image.RGBA, x, y int, c BlockColor, top, sides bool) {
+	sprite, exists := s[c]
+	if !exists {
+		sprite = NewSprite(c)
+		s[c] = sprite
+	}
+	sprite.DrawFaces(img, x, y, top, sides)
+}
@@ -0,0 +1,588 @@
+package render
+
+import (
+	"io"
+	"fmt"
+	"math"
+	"encoding/binary"
+)
+
+// Just enough of the SQLite file format to write a new database in one go:
+// tables filled in rowid order and indexes built from entries sorted in
+// memory, with no journal, free list or later updates.
+const (
+	SQLITEPAGESIZE = 4096
+	
+	sqliteInteriorIndex = 0x02
+	sqliteInteriorTable = 0x05
+	sqliteLeafIndex = 0x0A
+	sqliteLeafTable = 0x0D
+)
+
+// An SQLiteDB lays pages out in the order they're allocated, page 1 being
+// kept for the header and schema until Close.
+type SQLiteDB struct {
+	w io.WriterAt
+	pages uint32
+	schema []sqliteObject
+	tables []*SQLiteTable
+	
+	// ApplicationID marks the file format, e.g. MBTiles.
+	ApplicationID uint32
+}
+
+type sqliteObject struct {
+	kind, name, table, sql string
+	root uint32
+}
+
+func NewSQLiteDB(w io.WriterAt) *SQLiteDB {
+	return &SQLiteDB{w: w, pages: 1}
+}
+
+func (db *SQLiteDB) allocate() uint32 {
+	db.pages++
+	return db.pages
+}
+
+func (db *SQLiteDB) writePage(n uint32, page []byte) error {
+	_, err := db.w.WriteAt(page, int64(n - 1) * SQLITEPAGESIZE)
+	return err
+}
+
+// sqliteVarint appends v as SQLite's big-endian varint, whose ninth byte, if
+// it gets that far, holds a full eight bits.
+func sqliteVarint(buf []byte, v uint64) []byte {
+	if v > 1 << 56 - 1 {
+		var b [9]byte
+		b[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			b[i] = byte(v) | 0x80
+			v >>= 7
+		}
+		return append(buf, b[:]...)
+	}
+	
+	var b [8]byte
+	i := len(b) - 1
+	b[i] = byte(v) & 0x7F
+	for v >>= 7; v != 0; v >>= 7 {
+		i--
+		b[i] = byte(v) | 0x80
+	}
+	return append(buf, b[i:]...)
+}
+
+// sqliteRecord encodes values, each nil, an integer, a string or a []byte,
+// in SQLite's record format.
+func sqliteRecord(values ...interface{}) []byte {
+	var header, body []byte
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			header = sqliteVarint(header, 0)
+		case int:
+			header, body = sqliteInteger(header, body, int64(v))
+		case int64:
+			header, body = sqliteInteger(header, body, v)
+		case string:
+			header = sqliteVarint(header, uint64(len(v)) * 2 + 13)
+			body = append(body, v...)
+		case []byte:
+			header = sqliteVarint(header, uint64(len(v)) * 2 + 12)
+			body = append(body, v...)
+		default:
+			panic(fmt.Sprintf("sqlite: can't encode %T", value))
+		}
+	}
+	
+	// The header's length counts itself, which may take another byte.
+	size := len(header) + 1
+	if len(sqliteVarint(nil, uint64(size))) > 1 {
+		size++
+	}
+	return append(append(sqliteVarint(nil, uint64(size)), header...), body...)
+}
+
+func sqliteInteger(header, body []byte, v int64) ([]byte, []byte) {
+	if v == 0 || v == 1 {
+		return sqliteVarint(header, uint64(8 + v)), body
+	}
+	
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	for _, t := range []struct {
+		serial uint64
+		size uint
+	}{{1, 1}, {2, 2}, {3, 3}, {4, 4}, {5, 6}} {
+		if bits := 8 * t.size - 1; v >= -1 << bits && v < 1 << bits {
+			return sqliteVarint(header, t.serial), append(body, b[8 - t.size:]...)
+		}
+	}
+	return sqliteVarint(header, 6), append(body, b[:]...)
+}
+
+// sqliteLocal returns how much of a payload stays in its cell, the rest
+// going to overflow pages.
+func sqliteLocal(n int, index bool) int {
+	u := SQLITEPAGESIZE
+	max := u - 35
+	if index {
+		max = (u - 12) * 64 / 255 - 23
+	}
+	if n <= max {
+		return n
+	}
+	
+	min := (u - 12) * 32 / 255 - 23
+	if k := min + (n - min) % (u - 4); k <= max {
+		return k
+	}
+	return min
+}
+
+// cell appends payload to buf, spilling whatever doesn't fit in the cell to
+// a chain of overflow pages.
+func (db *SQLiteDB) cell(buf, payload []byte, index bool) ([]byte, error) {
+	local := sqliteLocal(len(payload), index)
+	buf = append(buf, payload[:local]...)
+	if local == len(payload) {
+		return buf, nil
+	}
+	
+	rest := payload[local:]
+	first := db.pages + 1
+	for len(rest) > 0 {
+		n := db.allocate()
+		page := make([]byte, SQLITEPAGESIZE)
+		chunk := copy(page[4:], rest)
+		if rest = rest[chunk:]; len(rest) > 0 {
+			binary.BigEndian.PutUint32(page, n + 1)
+		}
+		if err := db.writePage(n, page); err != nil {
+			return nil, err
+		}
+	}
+	return append(buf, byte(first >> 24), byte(first >> 16), byte(first >> 8), byte(first)), nil
+}
+
+// An sqlitePage gathers cells for one b-tree page. The first page of the
+// file has the database header in front of its own.
+type sqlitePage struct {
+	kind byte
+	offset int
+	cells [][]byte
+	size int
+}
+
+func (p *sqlitePage) headerSize() int {
+	if p.kind == sqliteLeafIndex || p.kind == sqliteLeafTable {
+		return 8
+	}
+	return 12
+}
+
+func (p *sqlitePage) fits(cell []byte) bool {
+	return p.offset + p.headerSize() + 2 * (len(p.cells) + 1) + p.size + len(cell) <= SQLITEPAGESIZE
+}
+
+func (p *sqlitePage) add(cell []byte) {
+	p.cells = append(p.cells, cell)
+	p.size += len(cell)
+}
+
+// bytes lays the page out with cells packed against its end, right being
+// the rightmost child of interior pages.
+func (p *sqlitePage) bytes(right uint32) []byte {
+	page := make([]byte, SQLITEPAGESIZE)
+	header := page[p.offset:]
+	header[0] = p.kind
+	binary.BigEndian.PutUint16(header[3:], uint16(len(p.cells)))
+	if p.headerSize() == 12 {
+		binary.BigEndian.PutUint32(header[8:], right)
+	}
+	
+	end := SQLITEPAGESIZE
+	pointers := header[p.headerSize():]
+	for i, cell := range p.cells {
+		end -= len(cell)
+		copy(page[end:], cell)
+		binary.BigEndian.PutUint16(pointers[2 * i:], uint16(end))
+	}
+	binary.BigEndian.PutUint16(header[5:], uint16(end))
+	return page
+}
+
+// An sqliteChild is a page of a b-tree being built with the largest rowid
+// under it.
+type sqliteChild struct {
+	page uint32
+	max int64
+}
+
+// An SQLiteTable writes rows to leaf pages as they're inserted, building the
+// interior of its b-tree on Close.
+type SQLiteTable struct {
+	db *SQLiteDB
+	object int
+	leaf *sqlitePage
+	leaves []sqliteChild
+	rowid int64
+}
+
+// CreateTable starts a table whose rows must match sql, a CREATE TABLE
+// statement.
+func (db *SQLiteDB) CreateTable(name, sql string) *SQLiteTable {
+	db.schema = append(db.schema, sqliteObject{kind: "table", name: name, table: name, sql: sql})
+	t := &SQLiteTable{db: db, object: len(db.schema) - 1, leaf: &sqlitePage{kind: sqliteLeafTable}}
+	db.tables = append(db.tables, t)
+	return t
+}
+
+// Insert adds a row and returns its rowid.
+func (t *SQLiteTable) Insert(values ...interface{}) (int64, error) {
+	t.rowid++
+	payload := sqliteRecord(values...)
+	cell, err := t.db.cell(sqliteVarint(sqliteVarint(nil, uint64(len(payload))), uint64(t.rowid)), payload, false)
+	if err != nil {
+		return 0, err
+	}
+	
+	if !t.leaf.fits(cell) {
+		if err := t.flush(); err != nil {
+			return 0, err
+		}
+	}
+	t.leaf.add(cell)
+	return t.rowid, nil
+}
+
+func (t *SQLiteTable) flush() error {
+	n := t.db.allocate()
+	t.leaves = append(t.leaves, sqliteChild{n, t.rowid - 1})
+	page := t.leaf.bytes(0)
+	t.leaf = &sqlitePage{kind: sqliteLeafTable}
+	return t.db.writePage(n, page)
+}
+
+// close writes the last leaf and the pages above the leaves, returning the
+// root.
+func (t *SQLiteTable) close() (uint32, error) {
+	n := t.db.allocate()
+	t.leaves = append(t.leaves, sqliteChild{n, t.rowid})
+	if err := t.db.writePage(n, t.leaf.bytes(0)); err != nil {
+		return 0, err
+	}
+	
+	// Interior cells are at most a page number and a nine byte rowid.
+	perPage := (SQLITEPAGESIZE - 12) / (2 + 4 + 9)
+	children := t.leaves
+	for len(children) > 1 {
+		var parents []sqliteChild
+		for _, group := range sqliteGroups(len(children), perPage + 1) {
+			page := &sqlitePage{kind: sqliteInteriorTable}
+			last := children[group[1] - 1]
+			for _, child := range children[group[0] : group[1] - 1] {
+				page.add(sqliteVarint([]byte{byte(child.page >> 24), byte(child.page >> 16), byte(child.page >> 8), byte(child.page)}, uint64(child.max)))
+			}
+			
+			n := t.db.allocate()
+			if err := t.db.writePage(n, page.bytes(last.page)); err != nil {
+				return 0, err
+			}
+			parents = append(parents, sqliteChild{n, last.max})
+		}
+		children = parents
+	}
+	return children[0].page, nil
+}
+
+// sqliteGroups splits n items into as few runs of at most max as possible,
+// evened out so no run is left with only one.
+func sqliteGroups(n, max int) (groups [][2]int) {
+	count := (n + max - 1) / max
+	start := 0
+	for i := 0; i < count; i++ {
+		end := start + (n - start) / (count - i)
+		groups = append(groups, [2]int{start, end})
+		start = end
+	}
+	return
+}
+
+// CreateIndex writes an index of entries, each the indexed columns followed
+// by the rowid and already sorted, for sql, a CREATE INDEX statement.
+func (db *SQLiteDB) CreateIndex(name, table, sql string, entries [][]interface{}) error {
+	cells := make([][]byte, len(entries))
+	maxCell := 0
+	for i, entry := range entries {
+		payload := sqliteRecord(entry...)
+		cell, err := db.cell(sqliteVarint(nil, uint64(len(payload))), payload, true)
+		if err != nil {
+			return err
+		}
+		cells[i] = cell
+		maxCell = Max(maxCell, len(cell))
+	}
+	
+	// Index b-trees keep keys in their interior pages too: each run of
+	// entries fills a leaf and the one after it moves up to divide the leaf
+	// from the next.
+	perPage := (SQLITEPAGESIZE - 12) / (2 + 4 + maxCell)
+	var children []uint32
+	for _, group := range sqliteGroups(len(cells) + 1, perPage + 1) {
+		page := &sqlitePage{kind: sqliteLeafIndex}
+		for _, cell := range cells[group[0] : Min(group[1] - 1, len(cells))] {
+			page.add(cell)
+		}
+		n := db.allocate()
+		if err := db.writePage(n, page.bytes(0)); err != nil {
+			return err
+		}
+		children = append(children, n)
+	}
+	
+	var dividers [][]byte
+	for _, group := range sqliteGroups(len(cells) + 1, perPage + 1)[1:] {
+		dividers = append(dividers, cells[group[0] - 1])
+	}
+	
+	for len(children) > 1 {
+		var parents []uint32
+		var promoted [][]byte
+		for i, group := range sqliteGroups(len(children), perPage + 1) {
+			if i > 0 {
+				promoted = append(promoted, dividers[group[0] - 1])
+			}
+			page := &sqlitePage{kind: sqliteInteriorIndex}
+			for j := group[0]; j < group[1] - 1; j++ {
+				child := children[j]
+				page.add(append([]byte{byte(child >> 24), byte(child >> 16), byte(child >> 8), byte(child)}, dividers[j]...))
+			}
+			
+			n := db.allocate()
+			if err := db.writePage(n, page.bytes(children[group[1] - 1])); err != nil {
+				return err
+			}
+			parents = append(parents, n)
+		}
+		children, dividers = parents, promoted
+	}
+	
+	db.schema = append(db.schema, sqliteObject{kind: "index", name: name, table: table, sql: sql, root: children[0]})
+	return nil
+}
+
+// Close finishes every table and writes the header and schema to page 1.
+func (db *SQLiteDB) Close() error {
+	for _, t := range db.tables {
+		root, err := t.close()
+		if err != nil {
+			return err
+		}
+		db.schema[t.object].root = root
+	}
+	
+	schema := &sqlitePage{kind: sqliteLeafTable, offset: 100}
+	for i, object := range db.schema {
+		payload := sqliteRecord(object.kind, object.name, object.table, int64(object.root), object.sql)
+		cell, err := db.cell(sqliteVarint(sqliteVarint(nil, uint64(len(payload))), uint64(i + 1)), payload, false)
+		if err != nil {
+			return err
+		}
+		if !schema.fits(cell) {
+			return fmt.Errorf("sqlite: schema doesn't fit on the first page")
+		}
+		schema.add(cell)
+	}
+	
+	page := schema.bytes(0)
+	header := page[:100]
+	copy(header, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(header[16:], SQLITEPAGESIZE)
+	header[18], header[19] = 1, 1
+	header[21], header[22], header[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(header[24:], 1)
+	binary.BigEndian.PutUint32(header[28:], db.pages)
+	binary.BigEndian.PutUint32(header[40:], 1)
+	binary.BigEndian.PutUint32(header[44:], 4)
+	binary.BigEndian.PutUint32(header[56:], 1)
+	binary.BigEndian.PutUint32(header[68:], db.ApplicationID)
+	binary.BigEndian.PutUint32(header[92:], 1)
+	binary.BigEndian.PutUint32(header[96:], 3008000)
+	return db.writePage(1, page)
+}
+
+// ReadSQLiteTable returns the rows of a table, each a list of nil, int64,
+// float64, string or []byte values. Only databases with SQLITEPAGESIZE pages
+// can be read, which includes any this writes even once SQLite has changed
+// them.
+func ReadSQLiteTable(r io.ReaderAt, name string) (rows [][]interface{}, err error) {
+	// Whatever a malformed database does to the reader is reported as such.
+	defer func() {
+		if recover() != nil {
+			rows, err = nil, fmt.Errorf("sqlite: malformed database")
+		}
+	}()
+	
+	rd := sqliteReader{r}
+	header := make([]byte, 100)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	if string(header[:16]) != "SQLite format 3\x00" {
+		return nil, fmt.Errorf("sqlite: not a database")
+	}
+	if size := binary.BigEndian.Uint16(header[16:]); size != SQLITEPAGESIZE || header[20] != 0 {
+		return nil, fmt.Errorf("sqlite: can only read databases of %d byte pages", SQLITEPAGESIZE)
+	}
+	
+	schema, err := rd.table(1, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range schema {
+		if len(object) == 5 && object[0] == "table" && object[1] == name {
+			if root, ok := object[3].(int64); ok {
+				return rd.table(uint32(root), 0)
+			}
+		}
+	}
+	return nil, fmt.Errorf("sqlite: no table %s", name)
+}
+
+type sqliteReader struct {
+	r io.ReaderAt
+}
+
+func (rd sqliteReader) page(n uint32) ([]byte, error) {
+	page := make([]byte, SQLITEPAGESIZE)
+	_, err := rd.r.ReadAt(page, int64(n - 1) * SQLITEPAGESIZE)
+	return page, err
+}
+
+// table reads the rows of the b-tree rooted at page n, depth pages down from
+// the table's root.
+func (rd sqliteReader) table(n uint32, depth int) (rows [][]interface{}, err error) {
+	if depth > 20 {
+		return nil, fmt.Errorf("sqlite: table b-tree too deep")
+	}
+	page, err := rd.page(n)
+	if err != nil {
+		return nil, err
+	}
+	header := page
+	if n == 1 {
+		header = page[100:]
+	}
+	
+	count := int(binary.BigEndian.Uint16(header[3:]))
+	switch header[0] {
+	case sqliteInteriorTable:
+		for i := 0; i <= count; i++ {
+			child := binary.BigEndian.Uint32(header[8:])
+			if i < count {
+				child = binary.BigEndian.Uint32(page[binary.BigEndian.Uint16(header[12 + 2 * i:]):])
+			}
+			children, err := rd.table(child, depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, children...)
+		}
+	case sqliteLeafTable:
+		for i := 0; i < count; i++ {
+			cell := page[binary.BigEndian.Uint16(header[8 + 2 * i:]):]
+			size, k := sqliteUvarint(cell)
+			cell = cell[k:]
+			_, k = sqliteUvarint(cell)
+			
+			payload, err := rd.payload(cell[k:], int(size))
+			if err != nil {
+				return nil, err
+			}
+			row, err := sqliteValues(payload)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+	default:
+		return nil, fmt.Errorf("sqlite: page %d isn't part of a table", n)
+	}
+	return
+}
+
+// payload gathers a cell's payload of size bytes from the cell and its
+// overflow pages.
+func (rd sqliteReader) payload(cell []byte, size int) ([]byte, error) {
+	local := sqliteLocal(size, false)
+	payload := append([]byte(nil), cell[:local]...)
+	next := uint32(0)
+	if local < size {
+		next = binary.BigEndian.Uint32(cell[local:])
+	}
+	
+	for len(payload) < size {
+		page, err := rd.page(next)
+		if err != nil {
+			return nil, err
+		}
+		payload = append(payload, page[4 : 4 + Min(size - len(payload), SQLITEPAGESIZE - 4)]...)
+		next = binary.BigEndian.Uint32(page)
+	}
+	return payload, nil
+}
+
+func sqliteUvarint(b []byte) (v uint64, n int) {
+	for n < 8 {
+		v = v << 7 | uint64(b[n] & 0x7F)
+		n++
+		if b[n - 1] < 0x80 {
+			return
+		}
+	}
+	return v << 8 | uint64(b[n]), n + 1
+}
+
+// sqliteValues decodes a record written by sqliteRecord, or by SQLite.
+func sqliteValues(record []byte) ([]interface{}, error) {
+	size, n := sqliteUvarint(record)
+	header, body := record[n:size], record[size:]
+	
+	var values []interface{}
+	for len(header) > 0 {
+		serial, n := sqliteUvarint(header)
+		header = header[n:]
+		
+		switch {
+		case serial == 0:
+			values = append(values, nil)
+		case serial <= 6:
+			n := []int{0, 1, 2, 3, 4, 6, 8}[serial]
+			v := int64(int8(body[0]))
+			for _, b := range body[1:n] {
+				v = v << 8 | int64(b)
+			}
+			values = append(values, v)
+			body = body[n:]
+		case serial == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(body)))
+			body = body[8:]
+		case serial == 8 || serial == 9:
+			values = append(values, int64(serial - 8))
+		case serial >= 12:
+			n := (serial - 12) / 2
+			if serial % 2 == 0 {
+				values = append(values, append([]byte(nil), body[:n]...))
+			} else {
+				values = append(values, string(body[:n]))
+			}
+			body = body[n:]
+		default:
+			return nil, fmt.Errorf("sqlite: unknown serial type %d", serial)
+		}
+	}
+	return values, nil
+}
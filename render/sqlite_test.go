@@ -0,0 +1,314 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"bytes"
+	"reflect"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+	"encoding/binary"
+)
+
+// tempFile creates an empty file that's removed once the test is over.
+func tempFile(t *testing.T, name string) *os.File {
+	dir, err := ioutil.TempDir("", "gocart-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// An sqliteLayout walks a database's b-trees the way SQLite would, counting
+// how often each page is reached and failing the test on any page whose
+// header or cells are out of place.
+type sqliteLayout struct {
+	t *testing.T
+	data []byte
+	seen map[uint32]int
+}
+
+func (l *sqliteLayout) page(n uint32) []byte {
+	l.seen[n]++
+	if n == 0 || int(n) * SQLITEPAGESIZE > len(l.data) {
+		l.t.Fatalf("page %d is past the end of the file", n)
+	}
+	return l.data[int(n - 1) * SQLITEPAGESIZE : int(n) * SQLITEPAGESIZE]
+}
+
+// overflow follows the chain of pages holding the rest of a payload of size
+// bytes once local of them are in its cell.
+func (l *sqliteLayout) overflow(cell []byte, size, local int) {
+	if local == size {
+		return
+	}
+	next := binary.BigEndian.Uint32(cell[local:])
+	for rest := size - local; rest > 0; rest -= SQLITEPAGESIZE - 4 {
+		page := l.page(next)
+		next = binary.BigEndian.Uint32(page)
+	}
+	if next != 0 {
+		l.t.Errorf("overflow chain runs on to page %d", next)
+	}
+}
+
+// tree walks the b-tree under page n, returning the index keys in order for
+// an index.
+func (l *sqliteLayout) tree(n uint32) (keys [][]interface{}) {
+	page := l.page(n)
+	offset := 0
+	if n == 1 {
+		offset = 100
+	}
+	header := page[offset:]
+	
+	kind, count := header[0], int(binary.BigEndian.Uint16(header[3:]))
+	size := 8
+	if kind == sqliteInteriorIndex || kind == sqliteInteriorTable {
+		size = 12
+	}
+	content := int(binary.BigEndian.Uint16(header[5:]))
+	if end := offset + size + 2 * count; content < end {
+		l.t.Errorf("page %d: cells start at %d, inside the header ending at %d", n, content, end)
+	}
+	
+	for i := 0; i < count; i++ {
+		at := int(binary.BigEndian.Uint16(header[size + 2 * i:]))
+		if at < content || at >= SQLITEPAGESIZE {
+			l.t.Fatalf("page %d: cell %d at %d is outside %d-%d", n, i, at, content, SQLITEPAGESIZE)
+		}
+		cell := page[at:]
+		
+		switch kind {
+		case sqliteInteriorTable:
+			l.tree(binary.BigEndian.Uint32(cell))
+		case sqliteLeafTable:
+			payload, k := sqliteUvarint(cell)
+			_, j := sqliteUvarint(cell[k:])
+			l.overflow(cell[k + j:], int(payload), sqliteLocal(int(payload), false))
+		case sqliteInteriorIndex, sqliteLeafIndex:
+			if kind == sqliteInteriorIndex {
+				keys = append(keys, l.tree(binary.BigEndian.Uint32(cell))...)
+				cell = cell[4:]
+			}
+			payload, k := sqliteUvarint(cell)
+			local := sqliteLocal(int(payload), true)
+			l.overflow(cell[k:], int(payload), local)
+			if local == int(payload) {
+				key, err := sqliteValues(cell[k : k + local])
+				if err != nil {
+					l.t.Fatalf("page %d: cell %d: %s", n, i, err)
+				}
+				keys = append(keys, key)
+			}
+		default:
+			l.t.Fatalf("page %d: unknown page type %#x", n, kind)
+		}
+	}
+	
+	if size == 12 {
+		keys = append(keys, l.tree(binary.BigEndian.Uint32(header[8:]))...)
+	}
+	return
+}
+
+// readSQLite checks a written database's header and layout and returns its
+// schema.
+func readSQLite(t *testing.T, f *os.File) (data []byte, schema [][]interface{}) {
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	if !bytes.HasPrefix(data, []byte("SQLite format 3\x00")) {
+		t.Fatalf("header starts %q", data[:16])
+	}
+	for _, field := range []struct {
+		name string
+		got, want int
+	}{
+		{"page size", int(binary.BigEndian.Uint16(data[16:])), SQLITEPAGESIZE},
+		{"reserved bytes", int(data[20]), 0},
+		{"page count", int(binary.BigEndian.Uint32(data[28:])), len(data) / SQLITEPAGESIZE},
+		{"free list", int(binary.BigEndian.Uint32(data[32:])), 0},
+		{"schema format", int(binary.BigEndian.Uint32(data[44:])), 4},
+		{"text encoding", int(binary.BigEndian.Uint32(data[56:])), 1},
+	} {
+		if field.got != field.want {
+			t.Errorf("%s = %d, want %d", field.name, field.got, field.want)
+		}
+	}
+	if len(data) % SQLITEPAGESIZE != 0 {
+		t.Errorf("file is %d bytes, not a whole number of pages", len(data))
+	}
+	
+	schema, err = sqliteReader{f}.table(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, schema
+}
+
+func TestSQLiteVarint(t *testing.T) {
+	for _, test := range []struct {
+		v uint64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{0x7F, []byte{0x7F}},
+		{0x80, []byte{0x81, 0x00}},
+		{0x3FFF, []byte{0xFF, 0x7F}},
+		{0x4000, []byte{0x81, 0x80, 0x00}},
+		{1 << 56 - 1, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F}},
+		{1 << 56, []byte{0x80, 0xC0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}},
+		{1 << 64 - 1, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	} {
+		got := sqliteVarint(nil, test.v)
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("sqliteVarint(%#x) = % x, want % x", test.v, got, test.want)
+		}
+		if v, n := sqliteUvarint(got); v != test.v || n != len(got) {
+			t.Errorf("sqliteUvarint(% x) = %#x, %d, want %#x, %d", got, v, n, test.v, len(got))
+		}
+	}
+}
+
+func TestSQLiteRecord(t *testing.T) {
+	values := []interface{}{nil, 0, 1, -1, 127, -129, 1 << 23, 1 << 40, int64(-1 << 63), "", "text", []byte{0, 1, 2}}
+	want := []interface{}{nil, int64(0), int64(1), int64(-1), int64(127), int64(-129), int64(1 << 23), int64(1 << 40), int64(-1 << 63), "", "text", []byte{0, 1, 2}}
+	got, err := sqliteValues(sqliteRecord(values...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v\nwant %#v", got, want)
+	}
+}
+
+// TestSQLiteRoundTrip writes a table and index big enough for interior pages
+// at several levels and rows spilling to overflow pages, then reads them back.
+func TestSQLiteRoundTrip(t *testing.T) {
+	f := tempFile(t, "test.db")
+	db := NewSQLiteDB(f)
+	db.ApplicationID = 0x12345678
+	table := db.CreateTable("things", "CREATE TABLE things (n integer, name text, data blob, nothing)")
+	
+	var want, entries [][]interface{}
+	for i := 0; i < 12000; i++ {
+		n := int64(i) * 7919 - 1 << 31
+		name := fmt.Sprintf("thing %06d %060d", i, i)
+		data := []byte{byte(i), byte(i >> 8)}
+		if i % 1000 == 0 {
+			data = bytes.Repeat([]byte{byte(i)}, 3 * SQLITEPAGESIZE)
+		}
+		
+		rowid, err := table.Insert(n, name, data, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rowid != int64(i + 1) {
+			t.Fatalf("row %d got rowid %d", i, rowid)
+		}
+		want = append(want, []interface{}{n, name, data, nil})
+		entries = append(entries, []interface{}{name, rowid})
+	}
+	
+	if err := db.CreateIndex("things_name", "things", "CREATE INDEX things_name ON things (name)", entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	
+	data, schema := readSQLite(t, f)
+	if id := binary.BigEndian.Uint32(data[68:]); id != db.ApplicationID {
+		t.Errorf("application id = %#x, want %#x", id, db.ApplicationID)
+	}
+	
+	if len(schema) != 2 {
+		t.Fatalf("schema has %d objects, want 2", len(schema))
+	}
+	for i, object := range []struct {
+		kind, name, sql string
+	}{
+		{"table", "things", "CREATE TABLE things (n integer, name text, data blob, nothing)"},
+		{"index", "things_name", "CREATE INDEX things_name ON things (name)"},
+	} {
+		row := schema[i]
+		if row[0] != object.kind || row[1] != object.name || row[2] != "things" || row[4] != object.sql {
+			t.Errorf("schema row %d = %v", i, row)
+		}
+	}
+	
+	layout := &sqliteLayout{t: t, data: data, seen: make(map[uint32]int)}
+	layout.tree(1)
+	layout.tree(uint32(schema[0][3].(int64)))
+	keys := layout.tree(uint32(schema[1][3].(int64)))
+	for n := uint32(1); int(n) <= len(data) / SQLITEPAGESIZE; n++ {
+		if layout.seen[n] != 1 {
+			t.Errorf("page %d is used %d times", n, layout.seen[n])
+		}
+	}
+	
+	for _, object := range schema {
+		root := object[3].(int64)
+		if kind := data[int(root - 1) * SQLITEPAGESIZE]; kind != sqliteInteriorTable && kind != sqliteInteriorIndex {
+			t.Errorf("%s's root page %d is a leaf, so its interior pages went untested", object[1], root)
+		}
+	}
+	
+	for i := range entries {
+		entries[i][1] = int64(i + 1)
+	}
+	if !reflect.DeepEqual(keys, entries) {
+		t.Errorf("index holds %d keys, not the %d entries in order", len(keys), len(entries))
+	}
+	
+	rows, err := ReadSQLiteTable(f, "things")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("read %d rows, want %d", len(rows), len(want))
+	}
+	for i := range rows {
+		if !reflect.DeepEqual(rows[i], want[i]) {
+			t.Fatalf("row %d = %v, want %v", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestReadSQLiteTableErrors(t *testing.T) {
+	f := tempFile(t, "test.db")
+	db := NewSQLiteDB(f)
+	db.CreateTable("things", "CREATE TABLE things (n integer)").Insert(1)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := readSQLite(t, f)
+	
+	if _, err := ReadSQLiteTable(f, "missing"); err == nil {
+		t.Error("read a table that doesn't exist")
+	}
+	if _, err := ReadSQLiteTable(bytes.NewReader(data[:50]), "things"); err == nil {
+		t.Error("read a truncated header")
+	}
+	if _, err := ReadSQLiteTable(bytes.NewReader(append([]byte("not a database!!"), data[16:]...)), "things"); err == nil {
+		t.Error("read a file without SQLite's header")
+	}
+	
+	// A schema cell pointing past the end of its page.
+	corrupt := append([]byte(nil), data...)
+	binary.BigEndian.PutUint16(corrupt[108:], 0xFFFF)
+	if _, err := ReadSQLiteTable(bytes.NewReader(corrupt), "things"); err == nil {
+		t.Error("read a malformed schema")
+	}
+}
@@ -0,0 +1,359 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"flag"
+	"sort"
+	"sync"
+	"encoding/csv"
+	"encoding/json"
+)
+
+var oreBlocks = []byte{0x10, 0x0F, 0x0E, 0x49, 0x4A, 0x15, 0x38, 0x81, 0x99}
+
+// BlockStats tallies blocks, ores by height and biome columns over any
+// number of chunks.
+type BlockStats struct {
+	Chunks int
+	Blocks [256]int64
+	Ores [256][256]int64
+	Biomes [256]int64
+}
+
+func (s *BlockStats) Add(l Level) {
+	s.Chunks++
+	
+	var ore [256]bool
+	for _, id := range oreBlocks {
+		ore[id] = true
+	}
+	
+	sections := l.SectionTable()
+	for sy, section := range sections {
+		if section == nil {
+			s.Blocks[0] += 4096
+			continue
+		}
+		
+		for i, block := range section.Blocks {
+			s.Blocks[block]++
+			if ore[block] {
+				s.Ores[block][sy << 4 + i >> 8]++
+			}
+		}
+	}
+	
+	if len(l.Biomes) == 256 {
+		for _, biome := range l.Biomes {
+			s.Biomes[biome]++
+		}
+	}
+}
+
+func (s *BlockStats) Merge(o *BlockStats) {
+	s.Chunks += o.Chunks
+	for i := range s.Blocks {
+		s.Blocks[i] += o.Blocks[i]
+		s.Biomes[i] += o.Biomes[i]
+		for y := range s.Ores[i] {
+			s.Ores[i][y] += o.Ores[i][y]
+		}
+	}
+}
+
+// RegionPalette summarises how varied a region's blocks are. Block states are
+// block ID and data value pairs, which is what a per-section palette stores,
+// so regions with many states per section compress poorly and bloat saves.
+type RegionPalette struct {
+	Dimension string `json:"dimension,omitempty"`
+	Region string `json:"region"`
+	FileSize int64 `json:"file_bytes"`
+	Chunks int `json:"chunks"`
+	States int `json:"states"`
+	MaxSectionStates int `json:"max_section_states"`
+	MeanSectionStates float64 `json:"mean_section_states"`
+	MeanBitsPerBlock float64 `json:"mean_bits_per_block"`
+}
+
+// PaletteBits is the index width a palette of n states needs, never less
+// than the 4 bits the game uses for its smallest palettes.
+func PaletteBits(n int) int {
+	bits := 4
+	for 1 << uint(bits) < n {
+		bits++
+	}
+	return bits
+}
+
+func NewRegionPalette(job Job, region Region) (p RegionPalette) {
+	p.Region = job.Filename
+	p.Chunks = job.ChunkCount
+	if stat, err := os.Stat(region.Path); err == nil {
+		p.FileSize = stat.Size()
+	}
+	
+	var (
+		regionStates [4096]bool
+		sections, stateSum, bitSum int
+	)
+	for _, chunk := range job.Chunks {
+		level := chunk.(Level)
+		for _, section := range level.SectionTable() {
+			if section == nil {
+				continue
+			}
+			
+			var states [4096]bool
+			count := 0
+			for i, block := range section.Blocks {
+				state := int(block) << 4
+				if len(section.Data) == 2048 {
+					state |= int(section.Data[i >> 1] >> (uint(i & 1) << 2) & 0x0F)
+				}
+				if !states[state] {
+					states[state] = true
+					count++
+				}
+				if !regionStates[state] {
+					regionStates[state] = true
+					p.States++
+				}
+			}
+			
+			sections++
+			stateSum += count
+			bitSum += PaletteBits(count)
+			p.MaxSectionStates = Max(p.MaxSectionStates, count)
+		}
+	}
+	
+	if sections != 0 {
+		p.MeanSectionStates = float64(stateSum) / float64(sections)
+		p.MeanBitsPerBlock = float64(bitSum) / float64(sections)
+	}
+	return
+}
+
+func WritePalettesCSV(w io.Writer, palettes []RegionPalette) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"dimension", "region", "file_bytes", "chunks", "states", "max_section_states", "mean_section_states", "mean_bits_per_block"})
+	for _, p := range palettes {
+		cw.Write([]string{p.Dimension, p.Region, fmt.Sprint(p.FileSize), fmt.Sprint(p.Chunks), fmt.Sprint(p.States),
+			fmt.Sprint(p.MaxSectionStates), fmt.Sprintf("%.2f", p.MeanSectionStates), fmt.Sprintf("%.2f", p.MeanBitsPerBlock)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type StatsCount struct {
+	Name string `json:"name"`
+	Count int64 `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+type StatsReport struct {
+	Chunks int `json:"chunks"`
+	Blocks []StatsCount `json:"blocks"`
+	Ores map[string][]int64 `json:"ores"`
+	Biomes []StatsCount `json:"biomes"`
+}
+
+// Report lists blocks and biomes most common first and each ore's count at
+// every Y level.
+func (s *BlockStats) Report() (r StatsReport) {
+	counts := func(tally [256]int64, name func(byte) string, skip int) (list []StatsCount) {
+		var total int64
+		for i, n := range tally {
+			if i != skip {
+				total += n
+			}
+		}
+		for i, n := range tally {
+			if n != 0 && i != skip {
+				list = append(list, StatsCount{name(byte(i)), n, 100 * float64(n) / float64(total)})
+			}
+		}
+		sort.Sort(byCount(list))
+		return
+	}
+	
+	r.Chunks = s.Chunks
+	r.Blocks = counts(s.Blocks, BlockName, -1)
+	r.Biomes = counts(s.Biomes, BiomeName, BIOMEUNSET)
+	r.Ores = make(map[string][]int64)
+	for _, id := range oreBlocks {
+		if s.Blocks[id] != 0 {
+			r.Ores[BlockName(id)] = s.Ores[id][:]
+		}
+	}
+	return
+}
+
+// WriteCSV writes every figure as one kind,name,y,count,percent table.
+func (r StatsReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"kind", "name", "y", "count", "percent"})
+	for _, b := range r.Blocks {
+		cw.Write([]string{"block", b.Name, "", fmt.Sprint(b.Count), fmt.Sprintf("%.4f", b.Percent)})
+	}
+	
+	var ores []string
+	for name := range r.Ores {
+		ores = append(ores, name)
+	}
+	sort.Strings(ores)
+	for _, name := range ores {
+		for y, n := range r.Ores[name] {
+			if n != 0 {
+				cw.Write([]string{"ore", name, fmt.Sprint(y), fmt.Sprint(n), ""})
+			}
+		}
+	}
+	
+	for _, b := range r.Biomes {
+		cw.Write([]string{"biome", b.Name, "", fmt.Sprint(b.Count), fmt.Sprintf("%.4f", b.Percent)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Stats decodes every chunk with the same pipeline as the renderer and
+// reports block, ore and biome statistics instead of drawing.
+func Stats(args []string) error {
+	var (
+		dir, outFilename, format string
+		allDimensions, palettes bool
+		opts Options
+	)
+	
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	flags.StringVar(&dir, "dir", DIR, "Read region files from the world at this directory.")
+	flags.StringVar(&outFilename, "out", "-", "Write the statistics to this file (- for stdout).")
+	flags.StringVar(&format, "format", "csv", "Write statistics as csv or json.")
+	flags.BoolVar(&allDimensions, "all-dimensions", false, "Include the nether and end.")
+	flags.BoolVar(&palettes, "palettes", false, "Report block state variety per region, largest files first, instead of block counts.")
+	flags.Var(&opts.Area, "area", "Only count chunks within x0,z0,x1,z1 (world coordinates).")
+	opts.Progress.Flags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	
+	if format != "csv" && format != "json" {
+		return fatalError("Error parsing flags: ", fmt.Errorf("unknown format %q, expected csv or json", format))
+	}
+	
+	opts.Auto()
+	// Text progress would be mixed into the output on stdout.
+	if outFilename == "-" && opts.Progress.Mode != ProgressJSON {
+		opts.Progress.Quiet = true
+	}
+	opts.Progress.Start()
+	
+	var regions PositionList
+	dimensions, err := FindDimensions(dir, "", allDimensions, nil)
+	if err != nil {
+		return err
+	}
+	for i, dimension := range dimensions {
+		if err := dimension.Glob(i, &opts); err != nil {
+			return err
+		}
+		regions = append(regions, dimension.Regions...)
+	}
+	
+	var (
+		mu sync.Mutex
+		regionPalettes []RegionPalette
+	)
+	jobs := Decode(regions, &opts)
+	partials := make(chan *BlockStats)
+	Spawn(opts.Drawers, func() {
+		stats := new(BlockStats)
+		for job := range jobs {
+			if palettes {
+				region := regions[job.Index - 1].(Region)
+				p := NewRegionPalette(job, region)
+				p.Dimension = dimensions[region.Dimension].Name
+				mu.Lock()
+				regionPalettes = append(regionPalettes, p)
+				mu.Unlock()
+			} else {
+				for _, chunk := range job.Chunks {
+					stats.Add(chunk.(Level))
+				}
+			}
+			for _, chunkErr := range job.Errors {
+				opts.Progress.ChunkError(chunkErr)
+			}
+		}
+		partials <- stats
+	}, func() {
+		close(partials)
+	})
+	
+	total := new(BlockStats)
+	for stats := range partials {
+		total.Merge(stats)
+	}
+	opts.Progress.Printf("Counted %d chunks in %d regions", total.Chunks, len(regions))
+	
+	out := io.Writer(os.Stdout)
+	if outFilename != "-" {
+		outFile, err := os.Create(outFilename)
+		if err != nil {
+			return fatalError("Error creating statistics file: ", err)
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+	
+	if palettes {
+		sort.Sort(byFileSize(regionPalettes))
+		if format == "json" {
+			return fatalError("Error writing statistics: ", json.NewEncoder(out).Encode(regionPalettes))
+		}
+		return fatalError("Error writing statistics: ", WritePalettesCSV(out, regionPalettes))
+	}
+	
+	report := total.Report()
+	if format == "json" {
+		return fatalError("Error writing statistics: ", json.NewEncoder(out).Encode(report))
+	}
+	return fatalError("Error writing statistics: ", report.WriteCSV(out))
+}
+
+type byCount []StatsCount
+
+func (b byCount) Len() int {
+	return len(b)
+}
+
+func (b byCount) Less(i, j int) bool {
+	if b[i].Count == b[j].Count {
+		return b[i].Name < b[j].Name
+	}
+	return b[i].Count > b[j].Count
+}
+
+func (b byCount) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
+
+type byFileSize []RegionPalette
+
+func (b byFileSize) Len() int {
+	return len(b)
+}
+
+func (b byFileSize) Less(i, j int) bool {
+	if b[i].FileSize == b[j].FileSize {
+		return b[i].Region < b[j].Region
+	}
+	return b[i].FileSize > b[j].FileSize
+}
+
+func (b byFileSize) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
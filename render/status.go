@@ -0,0 +1,187 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"flag"
+	"sort"
+	"time"
+	"strings"
+	"net/http"
+	"encoding/json"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+const STATUSPATH = "/status"
+
+// A RenderStatus describes the latest render of one snapshot, or the one in
+// progress if Duration is zero.
+type RenderStatus struct {
+	Label string `json:"label"`
+	Started time.Time `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Error string `json:"error,omitempty"`
+}
+
+type CacheStatus struct {
+	Hits int `json:"hits"`
+	Misses int `json:"misses"`
+	Files int `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// A QuarantinedRegion is a region file with chunks too corrupt to draw, left
+// out of every tile showing them.
+type QuarantinedRegion struct {
+	Snapshot string `json:"snapshot"`
+	Region string `json:"region"`
+	Chunks int `json:"chunks"`
+	Error string `json:"error"`
+}
+
+// A ScheduleStatus describes a daemon's runs so far and when the next is due.
+type ScheduleStatus struct {
+	Every string `json:"every"`
+	Next time.Time `json:"next"`
+	Runs int `json:"runs"`
+	Failures int `json:"failures"`
+	Skipped int `json:"skipped"`
+}
+
+// ServerStatus is what a serving instance reports at STATUSPATH. A tile
+// server reports the latest render of the live world and of each backup it
+// serves; a daemon reports its Schedule instead, with its recent runs as
+// Renders.
+type ServerStatus struct {
+	Started time.Time `json:"started"`
+	Snapshots int `json:"snapshots"`
+	Rendering *RenderStatus `json:"rendering,omitempty"`
+	Queued int `json:"queued,omitempty"`
+	Cache CacheStatus `json:"cache"`
+	Schedule *ScheduleStatus `json:"schedule,omitempty"`
+	Renders []RenderStatus `json:"renders"`
+	Quarantined []QuarantinedRegion `json:"quarantined,omitempty"`
+}
+
+type rendersByLabel []RenderStatus
+
+func (b rendersByLabel) Len() int {
+	return len(b)
+}
+
+func (b rendersByLabel) Less(i, j int) bool {
+	return b[i].Label < b[j].Label
+}
+
+func (b rendersByLabel) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
+
+// RemoteStatus prints the status of a gocart server, serve or daemon, running
+// elsewhere.
+func RemoteStatus(args []string) error {
+	var (
+		remote string
+		progress Progress
+	)
+	
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	flags.StringVar(&remote, "remote", "http://localhost:8080", "Query the server listening at this URL.")
+	progress.Flags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	progress.Start()
+	
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(strings.TrimRight(remote, "/") + STATUSPATH)
+	if err != nil {
+		return fatalError("Error querying server: ", err)
+	}
+	defer resp.Body.Close()
+	
+	if resp.StatusCode != http.StatusOK {
+		return fatalError("Error querying server: ", fmt.Errorf("%s", resp.Status))
+	}
+	
+	var status ServerStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return fatalError("Error decoding status: ", err)
+	}
+	return fatalError("Error printing status: ", status.Print(os.Stdout))
+}
+
+func (s ServerStatus) Print(f io.Writer) error {
+	now := time.Now()
+	up := now.Sub(s.Started).Truncate(time.Second)
+	if s.Schedule != nil {
+		fmt.Fprintf(f, "Up %s since %s, rendering every %s\n", up, s.Started.Format(time.RFC3339), s.Schedule.Every)
+	} else {
+		fmt.Fprintf(f, "Up %s since %s, serving %d snapshots\n", up, s.Started.Format(time.RFC3339), s.Snapshots)
+	}
+	
+	if s.Rendering != nil {
+		fmt.Fprintf(f, "Rendering %s for %s, %d more waiting\n", s.Rendering.Label, now.Sub(s.Rendering.Started).Truncate(time.Second), s.Queued)
+	} else {
+		fmt.Fprintln(f, "Idle")
+	}
+	
+	column := "SNAPSHOT"
+	if s.Schedule != nil {
+		column = "RUN"
+		fmt.Fprintf(f, "Runs: %d, %d failed, %d skipped while overrunning; next due %s\n", s.Schedule.Runs, s.Schedule.Failures, s.Schedule.Skipped, s.Schedule.Next.Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(f, "Cache: %d files, %.1f MiB, %d hits, %d misses\n", s.Cache.Files, float64(s.Cache.Bytes) / (1 << 20), s.Cache.Hits, s.Cache.Misses)
+	}
+	
+	tw := tabwriter.NewWriter(f, 0, 8, 2, ' ', 0)
+	if len(s.Renders) != 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintf(tw, "%s\tLAST RENDER\tDURATION\tERROR\n", column)
+		for _, r := range s.Renders {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Label, r.Started.Format(time.RFC3339), r.Duration.Truncate(time.Millisecond), r.Error)
+		}
+	}
+	if len(s.Quarantined) != 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "QUARANTINED\tSNAPSHOT\tCORRUPT CHUNKS\tERROR")
+		for _, q := range s.Quarantined {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", q.Region, q.Snapshot, q.Chunks, q.Error)
+		}
+	}
+	return tw.Flush()
+}
+
+// Status reports the tiles drawn so far, those in Dir and any regions left
+// out of them.
+func (t *TileServer) Status() ServerStatus {
+	t.statusMu.Lock()
+	status := ServerStatus{Started: t.started, Snapshots: 1 + len(t.Dates), Queued: t.queued, Cache: t.stats}
+	if t.rendering != nil {
+		rendering := *t.rendering
+		status.Rendering = &rendering
+	}
+	for _, r := range t.renders {
+		status.Renders = append(status.Renders, r)
+	}
+	for _, q := range t.quarantined {
+		status.Quarantined = append(status.Quarantined, *q)
+	}
+	t.statusMu.Unlock()
+	sort.Sort(rendersByLabel(status.Renders))
+	sort.Slice(status.Quarantined, func(i, j int) bool {
+		a, b := status.Quarantined[i], status.Quarantined[j]
+		return a.Snapshot < b.Snapshot || a.Snapshot == b.Snapshot && a.Region < b.Region
+	})
+	
+	filepath.Walk(t.Dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && filepath.Ext(path) == ".png" {
+			status.Cache.Files++
+			status.Cache.Bytes += info.Size()
+		}
+		return nil
+	})
+	return status
+}
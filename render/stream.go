@@ -0,0 +1,293 @@
+package render
+
+import (
+	"io"
+	"os"
+	"image"
+	"bufio"
+	"image/draw"
+	"image/color"
+	"io/ioutil"
+	"compress/zlib"
+	"compress/flate"
+	"encoding/binary"
+)
+
+const (
+	STRIPHEIGHT = 256
+	IDATSIZE = 1 << 16
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// A Stream stands in for a full canvas when rendering with -stream. Region
+// layers are compressed into a temporary file as they arrive and composited
+// a strip at a time while encoding, so only the layers overlapping the
+// current strip are ever held in memory.
+type Stream struct {
+	Background BackgroundColor
+	
+	file *os.File
+	end int64
+	layers []streamLayer
+}
+
+type streamLayer struct {
+	Bounds image.Rectangle
+	Offset, Size int64
+}
+
+func NewStream(dir string) (*Stream, error) {
+	file, err := ioutil.TempFile(dir, ".gocart-")
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{file: file}, nil
+}
+
+func (s *Stream) Close() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+// Add appends a layer. Layers are composited in the order they are added.
+func (s *Stream) Add(img *image.RGBA) error {
+	counter := &countingWriter{w: s.file}
+	fw, err := flate.NewWriter(counter, flate.BestSpeed)
+	if err != nil {
+		return err
+	}
+	
+	if _, err := fw.Write(img.Pix); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+	
+	s.layers = append(s.layers, streamLayer{img.Bounds(), s.end, counter.n})
+	s.end += counter.n
+	return nil
+}
+
+func (s *Stream) load(layer streamLayer) (*image.RGBA, error) {
+	img := image.NewRGBA(layer.Bounds)
+	fr := flate.NewReader(io.NewSectionReader(s.file, layer.Offset, layer.Size))
+	defer fr.Close()
+	
+	_, err := io.ReadFull(fr, img.Pix)
+	return img, err
+}
+
+// Encode writes bounds of the composited canvas to w as a PNG. Overlay is
+// called on each strip after its layers are drawn and must clip itself to
+// the strip's bounds.
+func (s *Stream) Encode(w io.Writer, bounds image.Rectangle, scale int, text []PNGText, overlay func(*image.RGBA)) error {
+	enc, err := newPNGWriter(w, bounds.Dx(), bounds.Dy(), text)
+	if err != nil {
+		return err
+	}
+	
+	err = s.Composite(bounds, scale, func(strip *image.RGBA) error {
+		overlay(strip)
+		for row := 0; row < strip.Rect.Dy(); row++ {
+			if err := enc.WriteRow(strip.Pix[row * strip.Stride : row * strip.Stride + strip.Rect.Dx() * 4]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Composite calls fn with each strip of bounds of the composited canvas, top
+// to bottom. Layers drawn scale times larger are composited at that size and
+// averaged down a strip at a time.
+func (s *Stream) Composite(bounds image.Rectangle, scale int, fn func(*image.RGBA) error) (err error) {
+	cache := make(map[int]*image.RGBA)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += STRIPHEIGHT {
+		strip := image.NewRGBA(ScaleRect(image.Rect(bounds.Min.X, y, bounds.Max.X, Min(y + STRIPHEIGHT, bounds.Max.Y)), scale))
+		s.Background.Fill(strip)
+		
+		for i, layer := range s.layers {
+			if !layer.Bounds.Overlaps(strip.Rect) {
+				continue
+			}
+			
+			img, cached := cache[i]
+			if !cached {
+				if img, err = s.load(layer); err != nil {
+					return err
+				}
+				cache[i] = img
+			}
+			draw.Draw(strip, strip.Rect, img, strip.Rect.Min, draw.Over)
+			
+			// Strips only move down, so this layer won't be needed again.
+			if layer.Bounds.Max.Y <= strip.Rect.Max.Y {
+				delete(cache, i)
+			}
+		}
+		
+		if scale > 1 {
+			strip = Downsample(strip, scale)
+		}
+		if err := fn(strip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// pngWriter writes a non-interlaced 8 bit RGBA PNG one row at a time, which
+// image/png can't do since it needs the whole image up front.
+type pngWriter struct {
+	w *bufio.Writer
+	idat []byte
+	zw *zlib.Writer
+	
+	prev, cur []byte
+	filtered [5][]byte
+}
+
+func newPNGWriter(w io.Writer, width, height int, text []PNGText) (*pngWriter, error) {
+	p := &pngWriter{w: bufio.NewWriter(w)}
+	
+	var ihdr [13]byte
+	binary.BigEndian.PutUint32(ihdr[0:4], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[4:8], uint32(height))
+	ihdr[8], ihdr[9] = 8, 6
+	
+	p.w.Write(pngSignature)
+	if err := writeChunk(p.w, "IHDR", ihdr[:]); err != nil {
+		return nil, err
+	}
+	if err := writeText(p.w, text); err != nil {
+		return nil, err
+	}
+	
+	p.zw = zlib.NewWriter(p)
+	p.prev = make([]byte, width * 4 + 1)
+	p.cur = make([]byte, width * 4 + 1)
+	for i := range p.filtered {
+		p.filtered[i] = make([]byte, width * 4 + 1)
+	}
+	return p, nil
+}
+
+// Write collects compressed image data into IDAT chunks.
+func (p *pngWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		space := IDATSIZE - len(p.idat)
+		if space > len(b) {
+			space = len(b)
+		}
+		p.idat = append(p.idat, b[:space]...)
+		b = b[space:]
+		
+		if len(p.idat) == IDATSIZE {
+			if err := writeChunk(p.w, "IDAT", p.idat); err != nil {
+				return 0, err
+			}
+			p.idat = p.idat[:0]
+		}
+	}
+	return n, nil
+}
+
+// WriteRow converts one row of premultiplied RGBA pixels, filters and
+// compresses it, picking the filter with the smallest sum of absolute
+// differences the same way image/png does.
+func (p *pngWriter) WriteRow(pix []byte) error {
+	cur := p.cur[1:]
+	for i := 0; i < len(pix); i += 4 {
+		c := color.NRGBAModel.Convert(color.RGBA{pix[i], pix[i + 1], pix[i + 2], pix[i + 3]}).(color.NRGBA)
+		cur[i], cur[i + 1], cur[i + 2], cur[i + 3] = c.R, c.G, c.B, c.A
+	}
+	
+	row := p.filter()
+	if _, err := p.zw.Write(row); err != nil {
+		return err
+	}
+	p.prev, p.cur = p.cur, p.prev
+	return nil
+}
+
+func (p *pngWriter) filter() []byte {
+	cur, prev := p.cur[1:], p.prev[1:]
+	best, bestSum := 0, -1
+	
+	for f := range p.filtered {
+		out := p.filtered[f]
+		out[0] = byte(f)
+		sum := 0
+		for i := range cur {
+			var left, up, upLeft int
+			if i >= 4 {
+				left, upLeft = int(cur[i - 4]), int(prev[i - 4])
+			}
+			up = int(prev[i])
+			
+			var predicted int
+			switch f {
+			case 1:
+				predicted = left
+			case 2:
+				predicted = up
+			case 3:
+				predicted = (left + up) / 2
+			case 4:
+				predicted = paeth(left, up, upLeft)
+			}
+			
+			out[i + 1] = cur[i] - byte(predicted)
+			sum += Abs(int(int8(out[i + 1])))
+		}
+		
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = f, sum
+		}
+	}
+	return p.filtered[best]
+}
+
+func paeth(a, b, c int) int {
+	p := a + b - c
+	pa, pb, pc := Abs(p - a), Abs(p - b), Abs(p - c)
+	if pa <= pb && pa <= pc {
+		return a
+	} else if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func (p *pngWriter) Close() error {
+	if err := p.zw.Close(); err != nil {
+		return err
+	}
+	if len(p.idat) > 0 {
+		if err := writeChunk(p.w, "IDAT", p.idat); err != nil {
+			return err
+		}
+	}
+	if err := writeChunk(p.w, "IEND", nil); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
@@ -0,0 +1,142 @@
+package render
+
+import (
+	"math"
+	"image"
+	"image/draw"
+	"image/color"
+)
+
+// Supersample returns how many times larger than normal mode draws with
+// opts. Only isometric blocks have edges worth smoothing.
+func Supersample(mode Mode, opts *Options) int {
+	if _, iso := mode.(IsometricMode); iso && opts.Supersample > 1 {
+		return opts.Supersample
+	}
+	return 1
+}
+
+func ScaleRect(r image.Rectangle, n int) image.Rectangle {
+	return image.Rect(r.Min.X * n, r.Min.Y * n, r.Max.X * n, r.Max.Y * n)
+}
+
+// Downsample averages each n by n square of src into one pixel. RGBA is
+// premultiplied, so a plain average is a correct box filter.
+func Downsample(src *image.RGBA, n int) *image.RGBA {
+	b := src.Rect
+	dst := image.NewRGBA(image.Rect(floorDiv(b.Min.X, n), floorDiv(b.Min.Y, n), floorDiv(b.Max.X + n - 1, n), floorDiv(b.Max.Y + n - 1, n)))
+	for y := dst.Rect.Min.Y; y < dst.Rect.Max.Y; y++ {
+		for x := dst.Rect.Min.X; x < dst.Rect.Max.X; x++ {
+			var r, g, b, a uint32
+			for sy := y * n; sy < y * n + n; sy++ {
+				for sx := x * n; sx < x * n + n; sx++ {
+					c := src.RGBAAt(sx, sy)
+					r, g, b, a = r + uint32(c.R), g + uint32(c.G), b + uint32(c.B), a + uint32(c.A)
+				}
+			}
+			count := uint32(n * n)
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / count), uint8(g / count), uint8(b / count), uint8(a / count)})
+		}
+	}
+	return dst
+}
+
+// Face identifies which face of a block, if any, covers a point.
+type Face int
+
+const (
+	NoFace Face = iota
+	TopFace
+	LeftFace
+	RightFace
+)
+
+// BlockFace locates u, v in a block projected to x, y, measured in unscaled
+// pixels from x, y. The faces are the true projection of the cube: a diamond
+// on top of two parallelograms, which is what makes supersampled edges
+// smooth. Sampled at pixel centers with the default projection they match
+// DrawBlock's sprite. Blocks that aren't Full are half as tall.
+func BlockFace(u, v float64, full bool, p Projection) Face {
+	half, top, side := float64(p.Width) / 2, float64(p.Top), float64(p.Side)
+	if !full {
+		side /= 2
+		v -= side
+	}
+	
+	v -= top - 0.5
+	edge := top * (1 - math.Abs(u) / half)
+	switch {
+	case u < -half || u >= half:
+		return NoFace
+	case math.Abs(v) <= edge:
+		return TopFace
+	case v <= edge + side && v > edge:
+		if u < 0 {
+			return LeftFace
+		}
+		return RightFace
+	}
+	return NoFace
+}
+
+func blockRect(x, y, n int, p Projection) image.Rectangle {
+	return ScaleRect(image.Rect(x - p.Width / 2, y - p.Top, x + p.Width / 2, y + 2 * p.Top + p.Side), n)
+}
+
+// DrawBlockScaled draws a block projected to x, y with p on an image n times
+// the normal size.
+func DrawBlockScaled(img *image.RGBA, x, y, n int, p Projection, c BlockColor) {
+	DrawFacesScaled(img, x, y, n, p, c, true, true)
+}
+
+// DrawFacesScaled is DrawBlockScaled drawing only the top face, the sides or
+// both.
+func DrawFacesScaled(img *image.RGBA, x, y, n int, p Projection, c BlockColor, top, sides bool) {
+	bounds := blockRect(x, y, n, p)
+	
+	var blockImg *image.RGBA
+	if c.Alpha == 0xFF {
+		blockImg = img
+	} else {
+		blockImg = image.NewRGBA(bounds)
+	}
+	
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			u, v := (float64(px) + 0.5) / float64(n) - float64(x), (float64(py) + 0.5) / float64(n) - float64(y)
+			switch face := BlockFace(u, v, c.Full, p); {
+			case face == TopFace && top:
+				blockImg.SetRGBA(px, py, c.Top)
+			case face == LeftFace && sides:
+				blockImg.SetRGBA(px, py, c.Left)
+			case face == RightFace && sides:
+				blockImg.SetRGBA(px, py, c.Right)
+			}
+		}
+	}
+	
+	if c.Alpha != 0xFF {
+		draw.DrawMask(img, bounds, blockImg, bounds.Min, image.NewUniform(color.RGBA{c.Alpha, c.Alpha, c.Alpha, c.Alpha}), bounds.Min, draw.Over)
+	}
+}
+
+// ShadeTopScaled is ShadeTop for any projection and scale.
+func ShadeTopScaled(img *image.RGBA, x, y, n int, p Projection, c BlockColor, left, right int) {
+	bounds := blockRect(x, y, n, p)
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			u, v := (float64(px) + 0.5) / float64(n) - float64(x), (float64(py) + 0.5) / float64(n) - float64(y)
+			if BlockFace(u, v, c.Full, p) != TopFace {
+				continue
+			}
+			
+			count := right
+			if u < 0 {
+				count = left
+			}
+			if count > 0 {
+				img.SetRGBA(px, py, Blend(img.RGBAAt(px, py), occlusionShade, byte(count * OCCLUSIONSTEP)))
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"image/color"
+)
+
+// A Theme restyles the block palette as a whole, after any -palette file.
+type Theme string
+
+const (
+	ThemeDefault Theme = "default"
+	ThemeHighContrast Theme = "high-contrast"
+	ThemeColorblind Theme = "colorblind"
+	ThemeParchment Theme = "parchment"
+)
+
+func (t *Theme) String() string {
+	return string(*t)
+}
+
+func (t *Theme) Set(v string) error {
+	switch Theme(v) {
+	case ThemeDefault, ThemeHighContrast, ThemeColorblind, ThemeParchment:
+		*t = Theme(v)
+		return nil
+	}
+	return fmt.Errorf("unknown theme %q, expected default, high-contrast, colorblind or parchment", v)
+}
+
+const (
+	// CONTRAST is how much high-contrast stretches lightness away from the
+	// middle, and CHROMA how much it saturates.
+	CONTRAST = 1.35
+	CHROMA = 1.4
+	
+	// PARCHMENTPAPER is how far parchment blends sepia toward the paper.
+	PARCHMENTPAPER = 0x60
+	
+	// INKWASH is how much ink the deepest water is washed with.
+	INKWASH = 0x90
+)
+
+var (
+	paperColor = color.RGBA{0xE8, 0xD9, 0xB5, 0xFF}
+	inkColor = color.RGBA{0x4A, 0x36, 0x22, 0xFF}
+	parchmentWater = color.RGBA{0xB8, 0xC4, 0xB2, 0xFF}
+)
+
+// Apply recolors every block in the palette for the theme.
+func (t Theme) Apply() {
+	var restyle func(c color.RGBA) color.RGBA
+	switch t {
+	case ThemeHighContrast:
+		restyle = highContrast
+	case ThemeColorblind:
+		restyle = daltonize
+	case ThemeParchment:
+		restyle = parchment
+	default:
+		return
+	}
+	
+	for id, c := range blockColors {
+		c.Top, c.Left, c.Right = restyle(c.Top), restyle(c.Left), restyle(c.Right)
+		if t == ThemeParchment && IsWater(id) {
+			c.Top, c.Left, c.Right = parchmentWater, parchmentWater, lighten(parchmentWater)
+		}
+		blockColors[id] = c
+	}
+}
+
+func highContrast(c color.RGBA) color.RGBA {
+	lab := ToLab(c)
+	lab.L = math.Max(0, math.Min(100, 50 + (lab.L - 50) * CONTRAST))
+	lab.A, lab.B = lab.A * CHROMA, lab.B * CHROMA
+	return lab.RGBA()
+}
+
+// daltonize shifts the differences deuteranopes can't see, which mostly
+// hide protanopes' too, into lightness and blue they can.
+func daltonize(c color.RGBA) color.RGBA {
+	in := [3]float64{linearize(c.R), linearize(c.G), linearize(c.B)}
+	m := deficiencies[1].Matrix
+	var lost [3]float64
+	for i := range lost {
+		lost[i] = in[i] - (m[i][0] * in[0] + m[i][1] * in[1] + m[i][2] * in[2])
+	}
+	
+	g := in[1] + 0.7 * lost[0] + lost[1]
+	b := in[2] + 0.7 * lost[0] + lost[2]
+	return color.RGBA{c.R, delinearize(g), delinearize(b), c.A}
+}
+
+func parchment(c color.RGBA) color.RGBA {
+	return Blend(Fade{Style: FadeSepia}.Color(c, 1), paperColor, PARCHMENTPAPER)
+}
+
+// ParchmentShader inks the edges of water where it meets the shore, as on
+// an old hand-drawn map, and washes deep water with ink rather than blue.
+type ParchmentShader struct{}
+
+func (ParchmentShader) Shade(b BlockContext, c BlockColor) BlockColor {
+	if !IsWater(b.Block) || IsWater(BlockAt(b.Sections, b.X & 15, b.Y + 1, b.Z & 15)) {
+		return c
+	}
+	for _, d := range [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+		if block, ok := b.Neighbors.Block(b.X + d[0], b.Y, b.Z + d[1]); ok && !IsWater(block) {
+			c.Top, c.Alpha = inkColor, 0xFF
+			return c
+		}
+	}
+	
+	// Depth has darkened the water toward blue by now; keep how much.
+	dark := 1 - ToLab(c.Top).L / ToLab(parchmentWater).L
+	c.Top = Blend(parchmentWater, inkColor, byte(math.Max(0, math.Min(1, dark)) * INKWASH))
+	c.Left, c.Right = c.Top, lighten(c.Top)
+	return c
+}
@@ -0,0 +1,326 @@
+package render
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"flag"
+	"sort"
+	"time"
+	"image"
+	"regexp"
+	"strings"
+	"image/gif"
+	"image/png"
+	"image/draw"
+	"image/color"
+	"io/ioutil"
+	"archive/tar"
+	"compress/gzip"
+	"path/filepath"
+	"image/color/palette"
+)
+
+var (
+	backupDate = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+	frameBackground = color.RGBA{0x22, 0x22, 0x22, 0xff}
+)
+
+// A Backup is one world snapshot, either a directory or a .tar/.tar.gz
+// archive containing one.
+type Backup struct {
+	Path string
+	Label string
+}
+
+func NewBackup(path string) (Backup, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return Backup{}, err
+	}
+	
+	label := backupDate.FindString(filepath.Base(path))
+	if label == "" {
+		label = stat.ModTime().Format("2006-01-02")
+	}
+	return Backup{path, label}, nil
+}
+
+// overworldRegion reports whether an archive entry is an overworld region
+// file, wherever the world directory sits inside the archive.
+func overworldRegion(name string) bool {
+	dir := filepath.Dir(name)
+	if filepath.Base(dir) != filepath.Dir(GLOBPATTERN) || strings.HasPrefix(filepath.Base(filepath.Dir(dir)), "DIM") {
+		return false
+	}
+	matched, _ := filepath.Match(filepath.Base(GLOBPATTERN), filepath.Base(name))
+	return matched
+}
+
+// Walk calls fn with each overworld region file in the backup.
+func (b Backup) Walk(fn func(name string, r io.Reader) error) error {
+	if stat, err := os.Stat(b.Path); err == nil && stat.IsDir() {
+		files, err := filepath.Glob(filepath.Join(b.Path, GLOBPATTERN))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := fn(file, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	
+	archive, err := os.Open(b.Path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	
+	var r io.Reader = archive
+	if ext := filepath.Ext(b.Path); ext == ".gz" || ext == ".tgz" {
+		gz, err := gzip.NewReader(archive)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		
+		if header.Typeflag == tar.TypeReg && overworldRegion(header.Name) {
+			if err := fn(header.Name, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Regions returns the backup's region files, extracting archives into dir.
+func (b Backup) Regions(dir string) (regions PositionList, err error) {
+	err = b.Walk(func(name string, r io.Reader) error {
+		if r != nil {
+			path := filepath.Join(dir, filepath.Base(name))
+			regionFile, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer regionFile.Close()
+			
+			if _, err := io.Copy(regionFile, r); err != nil {
+				return err
+			}
+			name = path
+		}
+		regions = append(regions, NewRegion(name))
+		return nil
+	})
+	sort.Sort(regions)
+	return
+}
+
+// FindBackups returns the backups matching pattern in date order.
+func FindBackups(pattern string) (backups []Backup, err error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("nothing matches %q", pattern)
+	}
+	
+	for _, path := range paths {
+		backup, err := NewBackup(path)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backup)
+	}
+	sort.Sort(byLabel(backups))
+	return
+}
+
+// BackupBounds is the union of all regions in any of the backups, so frames
+// rendered with it grow in place instead of jumping around.
+func BackupBounds(backups []Backup, mode Mode, area Area) (bounds image.Rectangle, err error) {
+	for _, backup := range backups {
+		err = backup.Walk(func(name string, r io.Reader) error {
+			region := NewRegion(name)
+			if area.ContainsRegion(region) {
+				bounds = bounds.Union(mode.RegionBounds(region))
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	if area.Active {
+		bounds = bounds.Intersect(mode.AreaBounds(area))
+	}
+	return
+}
+
+// Render draws the backup's regions with the given bounds, extracting
+// archives to a temporary directory in tmpDir.
+func (b Backup) Render(tmpDir string, bounds image.Rectangle, opts *Options) (*image.RGBA, error) {
+	tmp, err := ioutil.TempDir(tmpDir, ".gocart-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	
+	regions, err := b.Regions(tmp)
+	if err != nil {
+		return nil, err
+	}
+	
+	var wanted PositionList
+	for _, r := range regions {
+		if opts.Area.ContainsRegion(r.(Region)) {
+			wanted = append(wanted, r)
+		}
+	}
+	return RenderFrame(wanted, bounds, opts), nil
+}
+
+// RenderFrame draws regions onto a canvas of exactly the given bounds.
+func RenderFrame(regions PositionList, bounds image.Rectangle, opts *Options) *image.RGBA {
+	img, errs := DrawFrame(regions, bounds, opts)
+	for _, chunkErr := range errs {
+		opts.Progress.ChunkError(chunkErr)
+	}
+	return img
+}
+
+// DrawFrame is RenderFrame returning the corrupt chunks it left out instead
+// of reporting them.
+func DrawFrame(regions PositionList, bounds image.Rectangle, opts *Options) (*image.RGBA, []ChunkError) {
+	var errs []ChunkError
+	scale := Supersample(opts.Modes[0], opts)
+	img := image.NewRGBA(ScaleRect(bounds, scale))
+	for layer := range Render(regions, opts) {
+		errs = append(errs, layer.Errors...)
+		for _, layerImg := range layer.Imgs {
+			draw.Draw(img, layerImg.Bounds(), layerImg, layerImg.Bounds().Min, draw.Over)
+		}
+	}
+	
+	if scale > 1 {
+		img = Downsample(img, scale)
+	}
+	return img, errs
+}
+
+// Timelapse renders each backup with the same bounds and palette and writes
+// the frames as an animated GIF, or as numbered PNGs for any other -out.
+func Timelapse(args []string) error {
+	var (
+		pattern, outFilename string
+		delay time.Duration
+		opts = Options{Labels: DefaultTextStyle, Modes: ModeList{IsometricMode{}}}
+	)
+	
+	flags := flag.NewFlagSet("timelapse", flag.ContinueOnError)
+	flags.StringVar(&pattern, "backups", "backups/*.tar.gz", "Render each world backup (directory, .tar or .tar.gz) matching this pattern as one frame.")
+	flags.StringVar(&outFilename, "out", "timelapse.gif", "Write an animated GIF, or numbered PNG frames named after this file.")
+	flags.DurationVar(&delay, "delay", 500 * time.Millisecond, "Show each GIF frame for this long.")
+	flags.Var(&opts.Modes, "mode", "Render frames in this mode (iso, xray, topdown).")
+	flags.Var(&opts.Area, "area", "Only render blocks within x0,z0,x1,z1 (world coordinates).")
+	opts.Progress.Flags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	
+	opts.Auto()
+	opts.Progress.Start()
+	mode := opts.Modes[0]
+	opts.Modes = opts.Modes[:1]
+	
+	backups, err := FindBackups(pattern)
+	if err != nil {
+		return fatalError("Error finding backups: ", err)
+	}
+	
+	bounds, err := BackupBounds(backups, mode, opts.Area)
+	if err != nil {
+		return fatalError("Error listing backup: ", err)
+	}
+	
+	animation := &gif.GIF{}
+	for i, backup := range backups {
+		opts.Progress.Printf("Frame %d/%d: %s", i + 1, len(backups), backup.Label)
+		
+		frame, err := backup.Render(filepath.Dir(outFilename), bounds, &opts)
+		if err != nil {
+			return fatalError("Error extracting backup: ", err)
+		}
+		
+		label := opts.Labels.Scaled(2)
+		DrawText(frame, bounds.Min.Add(image.Pt(opts.Labels.Height(), opts.Labels.Height())), backup.Label, label)
+		
+		if filepath.Ext(outFilename) == ".gif" {
+			flat := image.NewRGBA(bounds)
+			draw.Draw(flat, bounds, image.NewUniform(frameBackground), image.ZP, draw.Src)
+			draw.Draw(flat, bounds, frame, bounds.Min, draw.Over)
+			
+			// GIF frames can't have negative coordinates.
+			paletted := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette.Plan9)
+			draw.FloydSteinberg.Draw(paletted, paletted.Rect, flat, bounds.Min)
+			animation.Image = append(animation.Image, paletted)
+			animation.Delay = append(animation.Delay, int(delay / (10 * time.Millisecond)))
+			continue
+		}
+		
+		frameFile, err := os.Create(OutputFilename(outFilename, fmt.Sprintf("%04d", i)))
+		if err != nil {
+			return fatalError("Error creating frame: ", err)
+		}
+		err = png.Encode(frameFile, frame)
+		frameFile.Close()
+		if err != nil {
+			return fatalError("Error encoding frame: ", err)
+		}
+	}
+	
+	if len(animation.Image) != 0 {
+		opts.Progress.Printf("Committing animation to disk...")
+		gifFile, err := os.Create(outFilename)
+		if err != nil {
+			return fatalError("Error creating animation: ", err)
+		}
+		defer gifFile.Close()
+		if err := gif.EncodeAll(gifFile, animation); err != nil {
+			return fatalError("Error encoding animation: ", err)
+		}
+	}
+	opts.Progress.Done()
+	return nil
+}
+
+type byLabel []Backup
+
+func (b byLabel) Len() int {
+	return len(b)
+}
+
+func (b byLabel) Less(i, j int) bool {
+	if b[i].Label == b[j].Label {
+		return b[i].Path < b[j].Path
+	}
+	return b[i].Label < b[j].Label
+}
+
+func (b byLabel) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
@@ -0,0 +1,241 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"flag"
+	"sort"
+	"time"
+	"image"
+	"image/png"
+	"image/draw"
+	"image/color"
+	"encoding/csv"
+	"path/filepath"
+)
+
+const (
+	BARWIDTH = 6
+	CHARTHEIGHT = 160
+)
+
+var (
+	chartBackground = color.RGBA{0x22, 0x22, 0x22, 0xff}
+	chartBar = color.RGBA{0x6c, 0xb0, 0x4c, 0xff}
+)
+
+type Period string
+
+const (
+	PeriodWeek Period = "week"
+	PeriodMonth Period = "month"
+)
+
+func (p *Period) String() string {
+	return string(*p)
+}
+
+func (p *Period) Set(v string) error {
+	switch Period(v) {
+	case PeriodWeek, PeriodMonth:
+		*p = Period(v)
+		return nil
+	}
+	return fmt.Errorf("unknown period %q, expected week or month", v)
+}
+
+// Start returns the beginning of the week (Monday) or month containing t.
+func (p Period) Start(t time.Time) time.Time {
+	t = t.UTC()
+	if p == PeriodMonth {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+func (p Period) Next(t time.Time) time.Time {
+	if p == PeriodMonth {
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 7)
+}
+
+type TimelineBucket struct {
+	Start time.Time
+	Chunks int
+}
+
+// ChunkTimeline counts chunks by the period their region header says they
+// were last saved in. Periods without any saves are included so the result
+// reads as a continuous timeline.
+func ChunkTimeline(files []string, period Period) (buckets []TimelineBucket, err error) {
+	counts := make(map[time.Time]int)
+	for _, file := range files {
+		regionFile, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		
+		stat, err := regionFile.Stat()
+		if err != nil {
+			regionFile.Close()
+			return nil, err
+		}
+		
+		var header Header
+		header.Read(regionFile)
+		regionFile.Close()
+		
+		for i, location := range header.Locations {
+			if location.Valid(stat.Size()) && header.Timestamps[i] > 0 {
+				counts[period.Start(time.Unix(int64(header.Timestamps[i]), 0))]++
+			}
+		}
+	}
+	
+	if len(counts) == 0 {
+		return
+	}
+	
+	var starts []time.Time
+	for start := range counts {
+		starts = append(starts, start)
+	}
+	sort.Sort(byTime(starts))
+	
+	for t := starts[0]; !t.After(starts[len(starts) - 1]); t = period.Next(t) {
+		buckets = append(buckets, TimelineBucket{t, counts[t]})
+	}
+	return
+}
+
+func WriteTimelineCSV(filename string, buckets []TimelineBucket) error {
+	csvFile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+	
+	w := csv.NewWriter(csvFile)
+	w.Write([]string{"period", "chunks"})
+	for _, b := range buckets {
+		w.Write([]string{b.Start.Format("2006-01-02"), fmt.Sprint(b.Chunks)})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// TimelineChart draws the buckets as a bar chart with the busiest period's
+// count and the first and last dates labelled.
+func TimelineChart(buckets []TimelineBucket, style TextStyle) *image.RGBA {
+	peak := 1
+	for _, b := range buckets {
+		peak = Max(peak, b.Chunks)
+	}
+	
+	var first, last string
+	if len(buckets) != 0 {
+		first, last = buckets[0].Start.Format("2006-01-02"), buckets[len(buckets) - 1].Start.Format("2006-01-02")
+	}
+	
+	peakLabel := fmt.Sprintf("%d chunks", peak)
+	margin := style.Height()
+	width := Max(len(buckets) * BARWIDTH, style.Width(peakLabel), style.Width(first) + margin + style.Width(last))
+	plot := image.Rect(margin, 2 * margin + style.Height(), margin + width, 2 * margin + style.Height() + CHARTHEIGHT)
+	
+	img := image.NewRGBA(image.Rect(0, 0, plot.Max.X + margin, plot.Max.Y + 2 * margin + style.Height()))
+	draw.Draw(img, img.Rect, image.NewUniform(chartBackground), image.ZP, draw.Src)
+	
+	for i, b := range buckets {
+		height := b.Chunks * CHARTHEIGHT / peak
+		if b.Chunks > 0 && height == 0 {
+			height = 1
+		}
+		bar := image.Rect(plot.Min.X + i * BARWIDTH, plot.Max.Y - height, plot.Min.X + (i + 1) * BARWIDTH - 1, plot.Max.Y)
+		draw.Draw(img, bar, image.NewUniform(chartBar), image.ZP, draw.Src)
+	}
+	
+	style.Halo = 0
+	DrawText(img, image.Pt(margin, margin), peakLabel, style)
+	DrawText(img, image.Pt(plot.Min.X, plot.Max.Y + margin), first, style)
+	if len(buckets) > 1 {
+		DrawText(img, image.Pt(plot.Max.X - style.Width(last), plot.Max.Y + margin), last, style)
+	}
+	return img
+}
+
+// Timeline reports how many chunks were last saved in each week or month,
+// using only region header timestamps.
+func Timeline(args []string) error {
+	var (
+		dir, outFilename, chartFilename string
+		allDimensions bool
+		period = PeriodMonth
+		style = DefaultTextStyle
+		progress Progress
+	)
+	
+	flags := flag.NewFlagSet("timeline", flag.ContinueOnError)
+	flags.StringVar(&dir, "dir", DIR, "Read region files from the world at this directory.")
+	flags.StringVar(&outFilename, "out", "timeline.csv", "Write the period,chunks table to this file.")
+	flags.StringVar(&chartFilename, "chart", "timeline.png", "Draw a bar chart to this file (empty for none).")
+	flags.Var(&period, "period", "Count chunks per week or month.")
+	flags.BoolVar(&allDimensions, "all-dimensions", false, "Include the nether and end.")
+	flags.IntVar(&style.Scale, "label-scale", style.Scale, "Draw chart text this many times larger than the built-in 5x7 font.")
+	progress.Flags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	progress.Start()
+	
+	var files []string
+	for _, d := range dimensionDirs {
+		if d.ID != 0 && !allDimensions {
+			continue
+		}
+		for _, pattern := range []string{GLOBPATTERN, LEGACYGLOBPATTERN} {
+			matches, err := filepath.Glob(filepath.Join(dir, d.Path, pattern))
+			if err != nil {
+				return fatalError("Error globbing region files: ", err)
+			}
+			files = append(files, matches...)
+		}
+	}
+	
+	buckets, err := ChunkTimeline(files, period)
+	if err != nil {
+		return fatalError("Error reading region headers: ", err)
+	}
+	if err := WriteTimelineCSV(outFilename, buckets); err != nil {
+		return fatalError("Error writing timeline: ", err)
+	}
+	
+	if chartFilename != "" {
+		chartFile, err := os.Create(chartFilename)
+		if err != nil {
+			return fatalError("Error creating chart: ", err)
+		}
+		defer chartFile.Close()
+		if err := png.Encode(chartFile, TimelineChart(buckets, style)); err != nil {
+			return fatalError("Error encoding chart: ", err)
+		}
+	}
+	
+	progress.Printf("%d %ss from %d region files", len(buckets), period, len(files))
+	return nil
+}
+
+type byTime []time.Time
+
+func (b byTime) Len() int {
+	return len(b)
+}
+
+func (b byTime) Less(i, j int) bool {
+	return b[i].Before(b[j])
+}
+
+func (b byTime) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
@@ -0,0 +1,235 @@
+package render
+
+import (
+	"io"
+	"fmt"
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// A TOMLError is a mistake on a line of a TOML file.
+type TOMLError struct {
+	Line int
+	Message string
+}
+
+func (e TOMLError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// A TOMLValue is a setting as written in a TOML file, kept as the text a
+// flag would take: strings unquoted, arrays joined with commas. Path is its
+// table's key followed by its own.
+type TOMLValue struct {
+	Value string
+	Line int
+	Path []string
+}
+
+// A TOMLFile holds a file's settings keyed by their paths joined with "-",
+// so [label] scale is label-scale, and its table headers in order.
+type TOMLFile struct {
+	Values map[string]TOMLValue
+	Tables [][]string
+}
+
+// ParseTOML reads the subset of TOML settings files need: tables, bare,
+// quoted and dotted keys, strings, numbers, booleans and arrays of those.
+// Errors carry the line they were found on.
+func ParseTOML(r io.Reader) (*TOMLFile, error) {
+	f := &TOMLFile{Values: make(map[string]TOMLValue)}
+	scanner := bufio.NewScanner(r)
+	var table []string
+	line := 0
+	
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(tomlStripComment(scanner.Text()))
+		start := line
+		
+		// Arrays may run over several lines until their brackets close.
+		for tomlOpenArray(text) && scanner.Scan() {
+			line++
+			text += " " + strings.TrimSpace(tomlStripComment(scanner.Text()))
+		}
+		if text == "" {
+			continue
+		}
+		
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") || strings.HasPrefix(text, "[[") {
+				return nil, TOMLError{start, "expected [table]"}
+			}
+			path, err := tomlKey(text[1:len(text) - 1])
+			if err != nil {
+				return nil, TOMLError{start, err.Error()}
+			}
+			table = path
+			f.Tables = append(f.Tables, table)
+			continue
+		}
+		
+		eq := tomlIndex(text, '=')
+		if eq < 0 {
+			return nil, TOMLError{start, "expected key = value"}
+		}
+		path, err := tomlKey(text[:eq])
+		if err != nil {
+			return nil, TOMLError{start, err.Error()}
+		}
+		path = append(append([]string(nil), table...), path...)
+		key := strings.Join(path, "-")
+		
+		value, err := tomlValue(strings.TrimSpace(text[eq + 1:]))
+		if err != nil {
+			return nil, TOMLError{start, key + ": " + err.Error()}
+		}
+		if previous, exists := f.Values[key]; exists {
+			return nil, TOMLError{start, fmt.Sprintf("%s already set on line %d", key, previous.Line)}
+		}
+		f.Values[key] = TOMLValue{value, start, path}
+	}
+	return f, scanner.Err()
+}
+
+// tomlIndex finds c outside any quotes, or returns -1.
+func tomlIndex(s string, c byte) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == c:
+			return i
+		}
+	}
+	return -1
+}
+
+func tomlStripComment(s string) string {
+	if i := tomlIndex(s, '#'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+func tomlOpenArray(s string) bool {
+	eq := tomlIndex(s, '=')
+	if eq < 0 || strings.HasPrefix(s, "[") {
+		return false
+	}
+	depth := 0
+	for s = s[eq + 1:]; s != ""; {
+		i := tomlIndex(s, '[')
+		j := tomlIndex(s, ']')
+		switch {
+		case i >= 0 && (j < 0 || i < j):
+			depth++
+			s = s[i + 1:]
+		case j >= 0:
+			depth--
+			s = s[j + 1:]
+		default:
+			s = ""
+		}
+	}
+	return depth > 0
+}
+
+// tomlKey splits a dotted key into its parts.
+func tomlKey(s string) ([]string, error) {
+	var parts []string
+	for s = strings.TrimSpace(s); ; {
+		var part string
+		if s != "" && (s[0] == '"' || s[0] == '\'') {
+			end := strings.IndexByte(s[1:], s[0])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated key %s", s)
+			}
+			part, s = s[1:end + 1], strings.TrimSpace(s[end + 2:])
+		} else {
+			end := strings.IndexByte(s, '.')
+			if end < 0 {
+				end = len(s)
+			}
+			part = strings.TrimSpace(s[:end])
+			s = strings.TrimSpace(s[end:])
+			for _, c := range part {
+				if !(c == '-' || c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+					return nil, fmt.Errorf("invalid key %q", part)
+				}
+			}
+			if part == "" {
+				return nil, fmt.Errorf("missing key")
+			}
+		}
+		parts = append(parts, part)
+		
+		if s == "" {
+			return parts, nil
+		}
+		if s[0] != '.' {
+			return nil, fmt.Errorf("invalid key %q", s)
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+}
+
+func tomlValue(s string) (string, error) {
+	switch {
+	case s == "":
+		return "", fmt.Errorf("missing value")
+	case s[0] == '[':
+		if !strings.HasSuffix(s, "]") {
+			return "", fmt.Errorf("unterminated array")
+		}
+		var items []string
+		for rest := strings.TrimSpace(s[1:len(s) - 1]); rest != ""; {
+			end := tomlIndex(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			item := strings.TrimSpace(rest[:end])
+			if item != "" {
+				if item[0] == '[' {
+					return "", fmt.Errorf("nested arrays aren't supported")
+				}
+				v, err := tomlValue(item)
+				if err != nil {
+					return "", err
+				}
+				items = append(items, v)
+			}
+			if end == len(rest) {
+				break
+			}
+			rest = strings.TrimSpace(rest[end + 1:])
+		}
+		return strings.Join(items, ","), nil
+	case s[0] == '"':
+		if len(s) < 2 || s[len(s) - 1] != '"' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		return strconv.Unquote(s)
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s) - 1] != '\'' || strings.Contains(s[1:len(s) - 1], "'") {
+			return "", fmt.Errorf("unterminated string")
+		}
+		return s[1:len(s) - 1], nil
+	case s == "true" || s == "false":
+		return s, nil
+	}
+	
+	number := strings.Replace(s, "_", "", -1)
+	if _, err := strconv.ParseFloat(number, 64); err != nil {
+		return "", fmt.Errorf("invalid value %s", s)
+	}
+	return strings.TrimPrefix(number, "+"), nil
+}
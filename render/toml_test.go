@@ -0,0 +1,106 @@
+package render
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	for _, test := range []struct {
+		name, input string
+		want map[string]string
+	}{
+		{"basic string", `name = "world"`, map[string]string{"name": "world"}},
+		{"literal string", `path = 'C:\maps\'`, map[string]string{"path": `C:\maps\`}},
+		{"escapes", `s = "tab\there \"quoted\" caf\u00e9 \\"`, map[string]string{"s": "tab\there \"quoted\" café \\"}},
+		{"quotes inside strings", `a = "it's"` + "\n" + `b = 'say "hi"'`, map[string]string{"a": "it's", "b": `say "hi"`}},
+		{"integers", "a = 42\nb = -7\nc = +3\nd = 1_000", map[string]string{"a": "42", "b": "-7", "c": "3", "d": "1000"}},
+		{"floats", "a = 1.5\nb = -0.25\nc = 6e2", map[string]string{"a": "1.5", "b": "-0.25", "c": "6e2"}},
+		{"booleans", "on = true\noff = false", map[string]string{"on": "true", "off": "false"}},
+		{"array", `modes = ["iso", "topdown"]`, map[string]string{"modes": "iso,topdown"}},
+		{"array of numbers", `area = [-100, 0, 100, 200,]`, map[string]string{"area": "-100,0,100,200"}},
+		{"empty array", `hide = []`, map[string]string{"hide": ""}},
+		{"array with brackets in strings", `a = ["[x]", 'y]']`, map[string]string{"a": "[x],y]"}},
+		{"array over several lines", "modes = [\n\t\"iso\", # the default\n\t\"xray\",\n]\nafter = 1", map[string]string{"modes": "iso,xray", "after": "1"}},
+		{"comments", "# a file\n\nquiet = true # no output\n   # indented\n", map[string]string{"quiet": "true"}},
+		{"hash in string", `color = "#ff0000" # red`, map[string]string{"color": "#ff0000"}},
+		{"tables", "top = 1\n[label]\nscale = 2\ncolor = 'white'\n[render]\nmodes = ['iso']", map[string]string{"top": "1", "label-scale": "2", "label-color": "white", "render-modes": "iso"}},
+		{"dotted table", "[a.b]\nc = 1", map[string]string{"a-b-c": "1"}},
+		{"dotted keys", "label.scale = 2\n[x]\ny.z = 3", map[string]string{"label-scale": "2", "x-y-z": "3"}},
+		{"quoted keys", "\"odd key\" = 1\n'dotted.name' = 2\n[\"quoted table\"]\nk = 3", map[string]string{"odd key": "1", "dotted.name": "2", "quoted table-k": "3"}},
+		{"spaces around keys", "[ label ]\n  scale   =   2  ", map[string]string{"label-scale": "2"}},
+		{"empty", "", map[string]string{}},
+	} {
+		f, err := ParseTOML(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		got := make(map[string]string)
+		for key, value := range f.Values {
+			got[key] = value.Value
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseTOMLPositions(t *testing.T) {
+	f, err := ParseTOML(strings.NewReader("a = 1\n\n[label]\nmodes = [\n\t'iso',\n]\n[render.tiles]\nb = 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	for key, want := range map[string]TOMLValue{
+		"a": {"1", 1, []string{"a"}},
+		"label-modes": {"iso", 4, []string{"label", "modes"}},
+		"render-tiles-b": {"2", 8, []string{"render", "tiles", "b"}},
+	} {
+		if got := f.Values[key]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %+v, want %+v", key, got, want)
+		}
+	}
+	if want := [][]string{{"label"}, {"render", "tiles"}}; !reflect.DeepEqual(f.Tables, want) {
+		t.Errorf("tables = %q, want %q", f.Tables, want)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	for _, test := range []struct {
+		name, input string
+		line int
+		message string
+	}{
+		{"no equals", "a = 1\nquiet", 2, "expected key = value"},
+		{"array of tables", "[[render]]", 1, "expected [table]"},
+		{"unclosed table", "[render", 1, "expected [table]"},
+		{"bad table key", "[a b]", 1, `invalid key "a b"`},
+		{"invalid key", "bad key! = 1", 1, "invalid key"},
+		{"empty dotted part", "a. = 1", 1, "missing key"},
+		{"unterminated quoted key", `"a = 1`, 1, "expected key = value"},
+		{"missing value", "a =", 1, "a: missing value"},
+		{"unterminated string", `a = "abc`, 1, "a: unterminated string"},
+		{"unterminated literal", `a = 'abc`, 1, "a: unterminated string"},
+		{"quote inside literal", `a = 'a'b'`, 1, "a: unterminated string"},
+		{"bad escape", `a = "\q"`, 1, "a: invalid syntax"},
+		{"bare word", "a = yes", 1, "a: invalid value yes"},
+		{"nested array", "a = [1, [2]]", 1, "a: nested arrays aren't supported"},
+		{"bad array item", "a = [1, two]", 1, "a: invalid value two"},
+		{"unclosed array", "x = 1\na = [1,\n2\n", 2, "a: unterminated array"},
+		{"duplicate key", "a = 1\n\na = 2", 3, "a already set on line 1"},
+		{"duplicate through a table", "[label]\nscale = 1\n[x]\n[label]\nscale = 2", 5, "label-scale already set on line 2"},
+		{"duplicate dotted key", "label.scale = 1\n[label]\nscale = 2", 3, "label-scale already set on line 1"},
+	} {
+		_, err := ParseTOML(strings.NewReader(test.input))
+		tomlErr, ok := err.(TOMLError)
+		if !ok {
+			t.Errorf("%s: got %v, want a TOMLError", test.name, err)
+			continue
+		}
+		if tomlErr.Line != test.line || !strings.Contains(tomlErr.Message, test.message) {
+			t.Errorf("%s: got %q, want line %d: %s", test.name, err, test.line, test.message)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package render
+
+import (
+	"image"
+	"image/color"
+)
+
+// Trim returns output's bounds shrunk to the pixels drawn over the
+// background, with padding around them, so tall but empty sections don't
+// leave wide margins. Streamed images are composited once more to find them.
+func (d *Dimension) Trim(output *Output, opts *Options) image.Rectangle {
+	bg := color.RGBA(opts.Background)
+	var drawn image.Rectangle
+	if output.Stream != nil {
+		err := output.Stream.Composite(output.ChunkBounds, output.Scale, func(strip *image.RGBA) error {
+			drawn = drawn.Union(DrawnBounds(strip, strip.Rect, bg))
+			return nil
+		})
+		if err != nil {
+			opts.Progress.Warnf("Error trimming %s: %s", output.Out, err)
+			return output.ChunkBounds
+		}
+	} else {
+		n := output.Scale
+		r := DrawnBounds(output.Img, ScaleRect(output.ChunkBounds, n), bg)
+		drawn = image.Rect(floorDiv(r.Min.X, n), floorDiv(r.Min.Y, n), floorDiv(r.Max.X + n - 1, n), floorDiv(r.Max.Y + n - 1, n))
+	}
+	
+	if drawn.Empty() {
+		return output.ChunkBounds
+	}
+	return drawn.Inset(-opts.TrimPadding).Intersect(output.ChunkBounds)
+}
+
+// DrawnBounds returns the smallest rectangle within r holding every pixel
+// of img that isn't bg.
+func DrawnBounds(img *image.RGBA, r image.Rectangle, bg color.RGBA) (drawn image.Rectangle) {
+	r = r.Intersect(img.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		x0, x1 := r.Max.X, r.Min.X
+		i := img.PixOffset(r.Min.X, y)
+		for x := r.Min.X; x < r.Max.X; x, i = x + 1, i + 4 {
+			p := img.Pix[i : i + 4 : i + 4]
+			if p[0] != bg.R || p[1] != bg.G || p[2] != bg.B || p[3] != bg.A {
+				x0, x1 = Min(x0, x), x + 1
+			}
+		}
+		if x0 < x1 {
+			drawn = drawn.Union(image.Rect(x0, y, x1, y + 1))
+		}
+	}
+	return
+}
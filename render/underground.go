@@ -0,0 +1,21 @@
+package render
+
+// How far below the surface -underground starts by default, enough to get
+// under the dirt of most terrain.
+const UNDERGROUNDDEPTH = 4
+
+// Underground clips each column Depth blocks below its surface, going by the
+// chunk's height map, so only mines, tunnels and caves are left to draw.
+type Underground struct {
+	Enabled bool
+	Depth int
+}
+
+// Top returns the height blocks in the chunk-local column x, z must be below
+// to be drawn.
+func (u Underground) Top(l Level, x, z int) int {
+	if !u.Enabled || len(l.HeightMap) != 256 {
+		return 256
+	}
+	return int(l.HeightMap[z << 4 + x]) - u.Depth
+}
@@ -0,0 +1,432 @@
+package render
+
+import (
+	"os"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"sync"
+	"time"
+	"bytes"
+	"strings"
+	"net/url"
+	"net/http"
+	"io/ioutil"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"path/filepath"
+)
+
+const (
+	UPLOADPARALLEL = 8
+	
+	// Files larger than UPLOADPARTSIZE go up in parts of that size, well over
+	// the 5 MiB minimum object stores allow.
+	UPLOADPARTSIZE = 16 << 20
+)
+
+// An OutputBackend puts the files a run rendered into a local staging
+// directory wherever -out actually pointed.
+type OutputBackend interface {
+	Publish(dir string, progress *Progress) error
+}
+
+// OpenOutput returns the backend out names and the local path to render to
+// for it, or no backend when out is just a path. Remote output is staged in
+// a temporary directory the caller removes.
+func OpenOutput(out string) (OutputBackend, string, error) {
+	u, err := url.Parse(out)
+	if err != nil || (u.Scheme != "s3" && u.Scheme != "gs") {
+		return nil, out, nil
+	}
+	
+	store, err := NewObjectStore(u)
+	if err != nil {
+		return nil, "", err
+	}
+	
+	// A key ending in / is a prefix to put the default image name under.
+	name := IMGFILE
+	if !strings.HasSuffix(u.Path, "/") && u.Path != "" {
+		name = filepath.Base(u.Path)
+		store.Prefix = strings.TrimSuffix(store.Prefix, name)
+	}
+	
+	dir, err := ioutil.TempDir("", "gocart")
+	if err != nil {
+		return nil, "", err
+	}
+	return store, filepath.Join(dir, name), nil
+}
+
+// An ObjectStore uploads to an S3 bucket, or a GCS one through its S3
+// compatible API, signing requests with AWS Signature Version 4.
+type ObjectStore struct {
+	Endpoint string
+	Bucket string
+	Prefix string
+	Region string
+	AccessKey, SecretKey, SessionToken string
+	
+	// PathStyle puts the bucket in the path rather than the host name, as
+	// GCS and most self-hosted stores expect.
+	PathStyle bool
+	Parallel int
+	Client *http.Client
+}
+
+// NewObjectStore reads credentials from the environment: AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and AWS_REGION for s3:// URLs,
+// with AWS_ENDPOINT_URL for stores other than AWS, and GCS_ACCESS_KEY_ID and
+// GCS_SECRET_ACCESS_KEY, an HMAC key, for gs:// URLs.
+func NewObjectStore(u *url.URL) (*ObjectStore, error) {
+	s := &ObjectStore{
+		Bucket: u.Host,
+		Prefix: strings.TrimPrefix(u.Path, "/"),
+		Parallel: UPLOADPARALLEL,
+		Client: &http.Client{Timeout: 10 * time.Minute},
+	}
+	if s.Bucket == "" {
+		return nil, fmt.Errorf("no bucket in %s", u)
+	}
+	
+	if u.Scheme == "gs" {
+		s.Endpoint, s.Region, s.PathStyle = "https://storage.googleapis.com", "auto", true
+		s.AccessKey, s.SecretKey = os.Getenv("GCS_ACCESS_KEY_ID"), os.Getenv("GCS_SECRET_ACCESS_KEY")
+	} else {
+		s.Region = os.Getenv("AWS_REGION")
+		if s.Region == "" {
+			s.Region = os.Getenv("AWS_DEFAULT_REGION")
+		}
+		if s.Region == "" {
+			s.Region = "us-east-1"
+		}
+		s.AccessKey, s.SecretKey, s.SessionToken = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")
+		
+		s.Endpoint = strings.TrimSuffix(os.Getenv("AWS_ENDPOINT_URL"), "/")
+		s.PathStyle = s.Endpoint != ""
+		if s.Endpoint == "" {
+			s.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s.Region)
+		}
+	}
+	
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("no credentials for %s:// in the environment", u.Scheme)
+	}
+	return s, nil
+}
+
+func (s *ObjectStore) String() string {
+	return s.Bucket + "/" + s.Prefix
+}
+
+// objectURL returns the escaped URL of key.
+func (s *ObjectStore) objectURL(key string) string {
+	var path []string
+	for _, segment := range strings.Split(key, "/") {
+		path = append(path, awsEscape(segment))
+	}
+	escaped := strings.Join(path, "/")
+	
+	if s.PathStyle {
+		return s.Endpoint + "/" + awsEscape(s.Bucket) + "/" + escaped
+	}
+	endpoint, _ := url.Parse(s.Endpoint)
+	return endpoint.Scheme + "://" + s.Bucket + "." + endpoint.Host + "/" + escaped
+}
+
+// awsEscape percent-encodes everything but unreserved characters, which is
+// stricter than url.PathEscape and what signing requires.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign adds the Signature Version 4 headers to req, whose body is body.
+func (s *ObjectStore) sign(req *http.Request, body []byte, now time.Time) {
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	date := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", date)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	
+	names := []string{"host"}
+	for name := range req.Header {
+		if name = strings.ToLower(name); strings.HasPrefix(name, "x-amz-") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	
+	var headers bytes.Buffer
+	for _, name := range names {
+		value := req.Host
+		if name != "host" {
+			value = strings.TrimSpace(req.Header.Get(name))
+		}
+		fmt.Fprintf(&headers, "%s:%s\n", name, value)
+	}
+	signed := strings.Join(names, ";")
+	
+	var query []string
+	for key, values := range req.URL.Query() {
+		for _, value := range values {
+			query = append(query, awsEscape(key) + "=" + awsEscape(value))
+		}
+	}
+	sort.Strings(query)
+	
+	canonical := strings.Join([]string{req.Method, req.URL.EscapedPath(), strings.Join(query, "&"), headers.String(), signed, payload}, "\n")
+	canonicalSum := sha256.Sum256([]byte(canonical))
+	scope := date[:8] + "/" + s.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hex.EncodeToString(canonicalSum[:])
+	
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{date[:8], s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x", s.AccessKey, scope, signed, hmacSHA256(key, toSign)))
+}
+
+// do sends a signed request, returning the response only if it succeeded.
+func (s *ObjectStore) do(method, key, query string, body []byte, contentType string) (*http.Response, error) {
+	u := s.objectURL(key)
+	if query != "" {
+		u += "?" + query
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body, time.Now())
+	
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode / 100 != 2 {
+		defer resp.Body.Close()
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, key, resp.Status, bytes.TrimSpace(message))
+	}
+	return resp, nil
+}
+
+func (s *ObjectStore) Put(key string, body []byte, contentType string) error {
+	resp, err := s.do("PUT", key, "", body, contentType)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *ObjectStore) CreateMultipart(key, contentType string) (string, error) {
+	resp, err := s.do("POST", key, "uploads=", nil, contentType)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.UploadID, nil
+}
+
+func (s *ObjectStore) PutPart(key, uploadID string, n int, body []byte) (string, error) {
+	resp, err := s.do("PUT", key, fmt.Sprintf("partNumber=%d&uploadId=%s", n, url.QueryEscape(uploadID)), body, "")
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag string
+}
+
+func (s *ObjectStore) CompleteMultipart(key, uploadID string, etags []string) error {
+	var complete struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts []completedPart `xml:"Part"`
+	}
+	for i, etag := range etags {
+		complete.Parts = append(complete.Parts, completedPart{i + 1, etag})
+	}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	
+	resp, err := s.do("POST", key, "uploadId=" + url.QueryEscape(uploadID), body, "application/xml")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *ObjectStore) AbortMultipart(key, uploadID string) error {
+	resp, err := s.do("DELETE", key, "uploadId=" + url.QueryEscape(uploadID), nil, "")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// A multipartUpload tracks one large file's parts as they go up, so the
+// last to finish can complete it.
+type multipartUpload struct {
+	Key, Path, ID string
+	
+	mu sync.Mutex
+	etags []string
+	remaining int
+	failed bool
+}
+
+// Publish uploads every file under dir, Parallel requests at a time, with
+// large files split into parts sent alongside everything else.
+func (s *ObjectStore) Publish(dir string, progress *Progress) error {
+	var (
+		mu sync.Mutex
+		firstErr error
+		uploads []*multipartUpload
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	
+	work := make(chan func() error)
+	done := make(chan bool)
+	Spawn(Max(s.Parallel, 1), func() {
+		for job := range work {
+			if err := job(); err != nil {
+				fail(err)
+			}
+		}
+	}, func() {
+		close(done)
+	})
+	
+	files, bytesTotal := 0, int64(0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() == LOCKFILE {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		key := s.Prefix + filepath.ToSlash(rel)
+		contentType := mime.TypeByExtension(filepath.Ext(path))
+		files++
+		bytesTotal += info.Size()
+		
+		if info.Size() <= UPLOADPARTSIZE {
+			work <- func() error {
+				body, err := ioutil.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				return s.Put(key, body, contentType)
+			}
+			return nil
+		}
+		
+		id, err := s.CreateMultipart(key, contentType)
+		if err != nil {
+			return err
+		}
+		parts := int((info.Size() + UPLOADPARTSIZE - 1) / UPLOADPARTSIZE)
+		upload := &multipartUpload{Key: key, Path: path, ID: id, etags: make([]string, parts), remaining: parts}
+		uploads = append(uploads, upload)
+		for i := 0; i < parts; i++ {
+			n := i
+			work <- func() error {
+				return s.uploadPart(upload, n)
+			}
+		}
+		return nil
+	})
+	close(work)
+	<-done
+	
+	if err == nil {
+		err = firstErr
+	}
+	if err != nil {
+		for _, upload := range uploads {
+			if upload.remaining != 0 || upload.failed {
+				s.AbortMultipart(upload.Key, upload.ID)
+			}
+		}
+		return err
+	}
+	progress.Printf("Uploaded %d files (%d MiB) to %s", files, bytesTotal >> 20, s)
+	return nil
+}
+
+// uploadPart sends part n of upload, completing the upload if it was the
+// last outstanding.
+func (s *ObjectStore) uploadPart(upload *multipartUpload, n int) error {
+	f, err := os.Open(upload.Path)
+	if err != nil {
+		return err
+	}
+	body := make([]byte, UPLOADPARTSIZE)
+	size, err := f.ReadAt(body, int64(n) * UPLOADPARTSIZE)
+	f.Close()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	
+	etag, err := s.PutPart(upload.Key, upload.ID, n + 1, body[:size])
+	
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+	if err != nil {
+		upload.failed = true
+		return err
+	}
+	upload.etags[n] = etag
+	upload.remaining--
+	if upload.remaining != 0 || upload.failed {
+		return nil
+	}
+	if err := s.CompleteMultipart(upload.Key, upload.ID, upload.etags); err != nil {
+		upload.failed = true
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package render
+
+import (
+	"fmt"
+	"errors"
+	"encoding/binary"
+)
+
+const (
+	MAXCHUNKSIZE = 16 << 20
+	MAXNBTDEPTH = 64
+	MAXNBTARRAY = 1 << 20
+)
+
+const (
+	TagEnd = iota
+	TagByte
+	TagShort
+	TagInt
+	TagLong
+	TagFloat
+	TagDouble
+	TagByteArray
+	TagString
+	TagList
+	TagCompound
+	TagIntArray
+	TagLongArray
+)
+
+var (
+	ErrNBTTruncated = errors.New("nbt: unexpected end of data")
+	ErrNBTDepth = errors.New("nbt: maximum nesting depth exceeded")
+	ErrNBTArray = errors.New("nbt: array or list too long")
+)
+
+// ValidateNBT walks an uncompressed NBT stream without decoding it, rejecting
+// anything that is truncated, nested too deeply or declares oversized arrays
+// before it reaches the decoder.
+func ValidateNBT(data []byte) error {
+	v := nbtValidator{data: data}
+	
+	t, err := v.readByte()
+	if err != nil {
+		return err
+	}
+	if t != TagCompound {
+		return fmt.Errorf("nbt: root tag is %d, expected compound", t)
+	}
+	if err := v.readString(); err != nil {
+		return err
+	}
+	
+	return v.payload(t, 1)
+}
+
+type nbtValidator struct {
+	data []byte
+	pos int
+}
+
+func (v *nbtValidator) skip(n int64) error {
+	if n < 0 || n > int64(len(v.data) - v.pos) {
+		return ErrNBTTruncated
+	}
+	v.pos += int(n)
+	return nil
+}
+
+func (v *nbtValidator) readByte() (byte, error) {
+	if v.pos >= len(v.data) {
+		return 0, ErrNBTTruncated
+	}
+	v.pos++
+	return v.data[v.pos - 1], nil
+}
+
+func (v *nbtValidator) readInt() (int32, error) {
+	if len(v.data) - v.pos < 4 {
+		return 0, ErrNBTTruncated
+	}
+	v.pos += 4
+	return int32(binary.BigEndian.Uint32(v.data[v.pos - 4:])), nil
+}
+
+func (v *nbtValidator) readString() error {
+	if len(v.data) - v.pos < 2 {
+		return ErrNBTTruncated
+	}
+	v.pos += 2
+	return v.skip(int64(binary.BigEndian.Uint16(v.data[v.pos - 2:])))
+}
+
+func (v *nbtValidator) array(size int64) error {
+	n, err := v.readInt()
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > MAXNBTARRAY {
+		return ErrNBTArray
+	}
+	return v.skip(int64(n) * size)
+}
+
+func (v *nbtValidator) payload(t byte, depth int) error {
+	if depth > MAXNBTDEPTH {
+		return ErrNBTDepth
+	}
+	
+	switch t {
+	case TagByte:
+		return v.skip(1)
+	case TagShort:
+		return v.skip(2)
+	case TagInt, TagFloat:
+		return v.skip(4)
+	case TagLong, TagDouble:
+		return v.skip(8)
+	case TagByteArray:
+		return v.array(1)
+	case TagIntArray:
+		return v.array(4)
+	case TagLongArray:
+		return v.array(8)
+	case TagString:
+		return v.readString()
+	case TagList:
+		elem, err := v.readByte()
+		if err != nil {
+			return err
+		}
+		n, err := v.readInt()
+		if err != nil {
+			return err
+		}
+		if n < 0 || n > MAXNBTARRAY {
+			return ErrNBTArray
+		}
+		if elem == TagEnd {
+			return nil
+		}
+		for i := int32(0); i < n; i++ {
+			if err := v.payload(elem, depth + 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case TagCompound:
+		for {
+			child, err := v.readByte()
+			if err != nil {
+				return err
+			}
+			if child == TagEnd {
+				return nil
+			}
+			if err := v.readString(); err != nil {
+				return err
+			}
+			if err := v.payload(child, depth + 1); err != nil {
+				return err
+			}
+		}
+	}
+	
+	return fmt.Errorf("nbt: unknown tag type %d", t)
+}
@@ -0,0 +1,44 @@
+package render
+
+import (
+	"image/color"
+)
+
+const (
+	// Water reaches its darkest and most opaque at this many blocks deep.
+	WATERDEPTH = 16
+	WATERMAXALPHA = 0xF0
+)
+
+var deepWater = color.RGBA{0x0c, 0x1c, 0x50, 0xff}
+
+func IsWater(block byte) bool {
+	return block == 0x08 || block == 0x09
+}
+
+// WaterDepth counts the water blocks in a column from world height y down.
+func WaterDepth(sections [16]*Section, x, y, z int) (depth int) {
+	for ; y >= 0 && IsWater(BlockAt(sections, x, y, z)); y-- {
+		depth++
+	}
+	return
+}
+
+// WaterColor shades the surface of a body of water by its depth, darkening
+// and saturating toward deepWater while hiding more of the floor below. A
+// single block of water is left as it is.
+func WaterColor(c BlockColor, depth int) BlockColor {
+	if depth <= 1 {
+		return c
+	}
+	depth = Min(depth, WATERDEPTH)
+	
+	amount := byte(0xC0 * (depth - 1) / (WATERDEPTH - 1))
+	c.Top = Blend(c.Top, deepWater, amount)
+	c.Left = Blend(c.Left, deepWater, amount)
+	c.Right = Blend(c.Right, deepWater, amount)
+	if c.Alpha < WATERMAXALPHA {
+		c.Alpha += byte(int(WATERMAXALPHA - c.Alpha) * (depth - 1) / (WATERDEPTH - 1))
+	}
+	return c
+}
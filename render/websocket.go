@@ -0,0 +1,167 @@
+package render
+
+import (
+	"io"
+	"net"
+	"sync"
+	"bufio"
+	"errors"
+	"strings"
+	"net/url"
+	"net/http"
+	"io/ioutil"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/base64"
+)
+
+// WEBSOCKETGUID is hashed with the client's key to accept its handshake.
+const WEBSOCKETGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsText = 0x1
+	wsClose = 0x8
+	wsPing = 0x9
+	wsPong = 0xA
+)
+
+// ErrWebSocketOrigin refuses a handshake from a page served by another site,
+// which browsers would otherwise let open a connection here.
+var ErrWebSocketOrigin = errors.New("websocket: cross-origin connection refused")
+
+// A WebSocket is the server's end of an RFC 6455 connection, enough to push
+// text messages to a browser and notice when it goes away.
+type WebSocket struct {
+	conn net.Conn
+	rw *bufio.ReadWriter
+	mu sync.Mutex
+}
+
+// sameOrigin reports whether the page opening a connection was served from
+// the host it's connecting to. Clients other than browsers send no Origin.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// UpgradeWebSocket takes over an HTTP request asking to become a WebSocket,
+// if it comes from a page on the same host.
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request) (*WebSocket, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		return nil, errors.New("websocket: not a websocket handshake")
+	}
+	if !sameOrigin(r) {
+		return nil, ErrWebSocketOrigin
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("websocket: connection can't be taken over")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	
+	sum := sha1.Sum([]byte(key + WEBSOCKETGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &WebSocket{conn: conn, rw: rw}, nil
+}
+
+// writeFrame sends one unfragmented, unmasked frame, as servers must.
+func (ws *WebSocket) writeFrame(opcode byte, payload []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, byte(n >> 8), byte(n))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	ws.rw.Write(header)
+	ws.rw.Write(payload)
+	return ws.rw.Flush()
+}
+
+func (ws *WebSocket) WriteText(message []byte) error {
+	return ws.writeFrame(wsText, message)
+}
+
+// Wait reads what the client sends, answering pings and dropping anything
+// else, until it closes the connection or it fails.
+func (ws *WebSocket) Wait() error {
+	var header [2]byte
+	for {
+		if _, err := io.ReadFull(ws.rw, header[:]); err != nil {
+			return err
+		}
+		
+		length := uint64(header[1] & 0x7F)
+		switch length {
+		case 126:
+			var n uint16
+			if err := binary.Read(ws.rw, binary.BigEndian, &n); err != nil {
+				return err
+			}
+			length = uint64(n)
+		case 127:
+			if err := binary.Read(ws.rw, binary.BigEndian, &length); err != nil {
+				return err
+			}
+		}
+		
+		// Control frames are small; anything else is read and thrown away.
+		var mask [4]byte
+		if header[1] & 0x80 != 0 {
+			if _, err := io.ReadFull(ws.rw, mask[:]); err != nil {
+				return err
+			}
+		}
+		opcode := header[0] & 0x0F
+		if opcode < wsClose {
+			if _, err := io.CopyN(ioutil.Discard, ws.rw, int64(length)); err != nil {
+				return err
+			}
+			continue
+		}
+		if length > 125 {
+			return errors.New("websocket: control frame too long")
+		}
+		
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(ws.rw, payload); err != nil {
+			return err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i & 3]
+		}
+		
+		switch opcode {
+		case wsClose:
+			ws.writeFrame(wsClose, payload)
+			return nil
+		case wsPing:
+			if err := ws.writeFrame(wsPong, payload); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (ws *WebSocket) Close() error {
+	return ws.conn.Close()
+}
@@ -0,0 +1,186 @@
+package render
+
+import (
+	"io"
+	"net"
+	"time"
+	"bufio"
+	"bytes"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+)
+
+// wsFrame encodes a frame as a client must, masked.
+func wsFrame(opcode byte, payload []byte) []byte {
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80 | byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 0x80 | 126, byte(n >> 8), byte(n))
+	default:
+		frame = append(frame, 0x80 | 127, 0, 0, 0, 0, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n))
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b ^ mask[i & 3])
+	}
+	return frame
+}
+
+// testWebSocket is a WebSocket reading in and writing to out, with no
+// connection underneath.
+func testWebSocket(in []byte, out *bytes.Buffer) *WebSocket {
+	return &WebSocket{rw: bufio.NewReadWriter(bufio.NewReader(bytes.NewReader(in)), bufio.NewWriter(out))}
+}
+
+func TestWebSocketWriteFrame(t *testing.T) {
+	for _, test := range []struct {
+		length int
+		header []byte
+	}{
+		{0, []byte{0x81, 0}},
+		{125, []byte{0x81, 125}},
+		{126, []byte{0x81, 126, 0, 126}},
+		{0xFFFF, []byte{0x81, 126, 0xFF, 0xFF}},
+		{0x10000, []byte{0x81, 127, 0, 0, 0, 0, 0, 1, 0, 0}},
+	} {
+		var out bytes.Buffer
+		payload := bytes.Repeat([]byte{'x'}, test.length)
+		if err := testWebSocket(nil, &out).WriteText(payload); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.Bytes(); !bytes.Equal(got[:len(test.header)], test.header) || !bytes.Equal(got[len(test.header):], payload) {
+			t.Errorf("%d byte message: header % x, want % x", test.length, got[:Min(len(got), len(test.header))], test.header)
+		}
+	}
+}
+
+func TestWebSocketWait(t *testing.T) {
+	var in []byte
+	in = append(in, wsFrame(wsText, bytes.Repeat([]byte{'a'}, 300))...)
+	in = append(in, wsFrame(wsPing, []byte("hello"))...)
+	in = append(in, wsFrame(wsText, bytes.Repeat([]byte{'b'}, 70000))...)
+	in = append(in, wsFrame(wsClose, []byte{0x03, 0xE8})...)
+	in = append(in, wsFrame(wsPing, []byte("after close"))...)
+	
+	var out bytes.Buffer
+	if err := testWebSocket(in, &out).Wait(); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x80 | wsPong, 5, 'h', 'e', 'l', 'l', 'o', 0x80 | wsClose, 2, 0x03, 0xE8}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("answered % x, want % x", out.Bytes(), want)
+	}
+	
+	for name, in := range map[string][]byte{
+		"long control frame": wsFrame(wsPing, bytes.Repeat([]byte{'p'}, 126)),
+		"truncated frame": wsFrame(wsText, []byte("cut short"))[:8],
+		"no close": wsFrame(wsText, []byte("bye")),
+	} {
+		if err := testWebSocket(in, &bytes.Buffer{}).Wait(); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+// dialEvents opens a connection to the events server, returning the
+// handshake's response.
+func dialEvents(t *testing.T, server *httptest.Server, header http.Header) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	
+	req, err := http.NewRequest("GET", server.URL + EVENTSPATH, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = header
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, r, resp
+}
+
+func TestTileEventsHandshake(t *testing.T) {
+	var events TileEvents
+	server := httptest.NewServer(&events)
+	defer server.Close()
+	
+	// The example handshake from RFC 6455 section 1.3.
+	conn, r, resp := dialEvents(t, server, http.Header{"Sec-Websocket-Key": {"dGhlIHNhbXBsZSBub25jZQ=="}})
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake answered %s", resp.Status)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %q", accept)
+	}
+	
+	// Published only once subscribed, which follows the handshake.
+	for subscribed := false; !subscribed; time.Sleep(time.Millisecond) {
+		events.mu.Lock()
+		subscribed = len(events.viewers) == 1
+		events.mu.Unlock()
+	}
+	events.Publish([]byte(`{"tiles":[[0,0,0]]}`))
+	frame := make([]byte, 2 + 19)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		t.Fatal(err)
+	}
+	if want := append([]byte{0x81, 19}, `{"tiles":[[0,0,0]]}`...); !bytes.Equal(frame, want) {
+		t.Errorf("got frame % x, want % x", frame, want)
+	}
+	
+	conn.Write(wsFrame(wsClose, nil))
+	if _, err := io.ReadFull(r, frame[:2]); err != nil || frame[0] != 0x80 | wsClose {
+		t.Errorf("close answered % x, %v", frame[:2], err)
+	}
+}
+
+func TestTileEventsOrigin(t *testing.T) {
+	var events TileEvents
+	server := httptest.NewServer(&events)
+	defer server.Close()
+	host := server.Listener.Addr().String()
+	
+	for _, test := range []struct {
+		origin string
+		status int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{"http://" + host, http.StatusSwitchingProtocols},
+		{"https://" + host, http.StatusSwitchingProtocols},
+		{"http://evil.example", http.StatusForbidden},
+		{"http://" + host + ".evil.example", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	} {
+		header := http.Header{"Sec-Websocket-Key": {"dGhlIHNhbXBsZSBub25jZQ=="}}
+		if test.origin != "" {
+			header.Set("Origin", test.origin)
+		}
+		conn, _, resp := dialEvents(t, server, header)
+		if resp.StatusCode != test.status {
+			t.Errorf("origin %q: got %s, want %d", test.origin, resp.Status, test.status)
+		}
+		conn.Close()
+	}
+	
+	_, _, resp := dialEvents(t, server, http.Header{})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("handshake without a key: got %s, want 400", resp.Status)
+	}
+}
@@ -0,0 +1,32 @@
+package render
+
+// Alpha of every block x-ray mode doesn't highlight, low enough that a few
+// dozen layers of stone still let ores show through.
+const XRAYALPHA = 0x06
+
+// Blocks x-ray mode draws solid: ores, spawners and chests.
+var xrayBlocks = map[byte]bool{
+	0x0E: true, // GoldOre
+	0x0F: true, // IronOre
+	0x10: true, // CoalOre
+	0x15: true, // LapisLazuliOre
+	0x34: true, // MobSpawner
+	0x36: true, // Chest
+	0x38: true, // DiamondOre
+	0x49: true, // RedstoneOre
+	0x4A: true, // GlowingRedstoneOre
+	0x81: true, // EmeraldOre
+	0x92: true, // TrappedChest
+	0x99: true, // QuartzOre
+}
+
+// XRay fades block to a trace of itself unless it's one worth finding, so
+// stone, dirt and sand barely show and tunnels through them stand out.
+func XRay(c BlockColor, block byte) BlockColor {
+	if xrayBlocks[block] {
+		c.Alpha = 0xFF
+	} else {
+		c.Alpha = XRAYALPHA
+	}
+	return c
+}